@@ -3,9 +3,14 @@ package main
 import (
 	"context"
 	"errors"
+	"maps"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
 	"syscall"
+	"time"
 
 	"log/slog"
 
@@ -15,8 +20,11 @@ import (
 	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/controller"
 	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/dns"
 	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/docker"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/kubernetes"
 	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/labels"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/model"
 	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/reconcile"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/state"
 )
 
 func main() {
@@ -27,25 +35,121 @@ func main() {
 		os.Exit(1)
 	}
 
-	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: cfg.LogLevel}))
+	// The export mode prints YAML on stdout, so its logs go to stderr.
+	logOutput := os.Stdout
+	if cfg.Mode == config.ModeExport {
+		logOutput = os.Stderr
+	}
+	logger := slog.New(slog.NewTextHandler(logOutput, &slog.HandlerOptions{Level: cfg.LogLevel}))
 
-	dockerAdapter, err := docker.NewAdapter(cfg.Docker)
+	source, err := newSource(cfg)
 	if err != nil {
-		logger.Error("failed to initialize Docker adapter", "error", err)
+		logger.Error("failed to initialize label source", "source", cfg.Source, "error", err)
 		os.Exit(1)
 	}
 
-	cloudflareClient, err := cloudflare.NewClient(cfg.Cloudflare)
+	var sharedPolicies []model.AccessPolicySpec
+	if cfg.Controller.AccessPoliciesFile != "" {
+		sharedPolicies, err = labels.LoadSharedPolicies(cfg.Controller.AccessPoliciesFile)
+		if err != nil {
+			logger.Error("failed to load shared access policies", "error", err)
+			os.Exit(1)
+		}
+	}
+	parser := labels.NewParserWithSharedPolicies(sharedPolicies, slices.Sorted(maps.Keys(cfg.Cloudflare.Tunnels)))
+
+	if cfg.Mode == config.ModeValidate {
+		os.Exit(validate(logger, source, parser, cfg.Controller.RoutesFile, cfg.Controller.SyncTimeout))
+	}
+	if cfg.Mode == config.ModeExport {
+		reconcilers := map[string]*reconcile.Engine{"": newTunnelEngine(cfg, nil, logger, nil, nil, nil)}
+		for name := range cfg.Cloudflare.Tunnels {
+			reconcilers[name] = newTunnelEngine(cfg, nil, logger.With("tunnel", name), nil, nil, nil)
+		}
+		os.Exit(export(logger, source, parser, cfg.Controller.RoutesFile, cfg.Controller.ParkedHostnames, cfg.Controller.ParkedStatus, reconcilers, cfg.Controller.SyncTimeout))
+	}
+
+	cloudflareClient, err := cloudflare.NewClient(cfg.Cloudflare, logger)
 	if err != nil {
 		logger.Error("failed to initialize Cloudflare client", "error", err)
 		os.Exit(1)
 	}
 
-	parser := labels.NewParser()
-	reconciler := reconcile.NewEngine(cloudflareClient, logger, cfg.Controller.DryRun, cfg.Controller.ManageTunnel)
-	dnsEngine := dns.NewEngine(cloudflareClient, logger, cfg.Controller.DryRun, cfg.Controller.ManageDNS, cfg.Controller.DeleteDNS, cfg.Controller.DNSZones, cfg.Cloudflare.TunnelID, cfg.ManagedBy)
-	accessEngine := access.NewEngine(cloudflareClient, logger, cfg.Controller.DryRun, cfg.Controller.ManageAccess, cfg.ManagedBy)
-	controller := controller.NewController(dockerAdapter, parser, reconciler, dnsEngine, accessEngine, cfg.Controller.PollInterval, logger)
+	stateStore, err := state.Load(cfg.Controller.StateFile)
+	if err != nil {
+		logger.Error("failed to load state file", "error", err)
+		os.Exit(1)
+	}
+	backups := reconcile.NewBackups(cfg.Controller.BackupDir, cfg.Controller.BackupKeep, logger)
+	if cfg.Controller.RestoreFrom != "" {
+		os.Exit(restore(logger, cloudflareClient, backups, cfg.Controller.RestoreFrom, cfg.Controller.DryRun, cfg.Controller.SyncTimeout))
+	}
+
+	// One guard serves every engine; each counts its removals in its own scope.
+	removals := model.NewRemovalGuard(cfg.Controller.MaxRemovals, cfg.Controller.ForceRemovals)
+
+	components := cfg.Controller.Components
+	if cfg.Controller.Preflight {
+		if !preflight(logger, cloudflareClient, components, cfg.Controller.SyncTimeout) {
+			os.Exit(1)
+		}
+	}
+	reconcilers := map[string]*reconcile.Engine{}
+	if components.Tunnel {
+		reconcilers[""] = newTunnelEngine(cfg, cloudflareClient, logger, stateStore, backups, removals)
+		for name := range cfg.Cloudflare.Tunnels {
+			engine, err := namedTunnelEngine(cfg, name, logger)
+			if err != nil {
+				logger.Error("failed to initialize tunnel", "tunnel", name, "error", err)
+				os.Exit(1)
+			}
+			reconcilers[name] = engine
+		}
+	}
+	var dnsEngine *dns.Engine
+	if components.DNS {
+		dnsEngine = dns.NewEngine(cloudflareClient, logger, dns.Options{
+			DryRun:          cfg.Controller.DryRun,
+			Manage:          cfg.Controller.ManageDNS,
+			Delete:          cfg.Controller.DeleteDNS,
+			ConfiguredZones: cfg.Controller.DNSZones,
+			TunnelID:        cfg.Cloudflare.TunnelID,
+			TunnelSuffix:    cfg.Cloudflare.TunnelDNSSuffix,
+			ManagedBy:       cfg.ManagedBy,
+			Tracked:         stateStore,
+			Protected:       cfg.Controller.ProtectedHostnames,
+			Concurrency:     cfg.Controller.DNSConcurrency,
+			Removals:        removals,
+			Tunnels:         cfg.Cloudflare.Tunnels,
+		})
+	}
+	var accessEngine *access.Engine
+	if components.Access {
+		accessEngine = access.NewEngine(cloudflareClient, logger, access.Options{
+			DryRun:         cfg.Controller.DryRun,
+			Manage:         cfg.Controller.ManageAccess,
+			DriftCheck:     cfg.Controller.AccessDriftCheck,
+			ManagedBy:      cfg.ManagedBy,
+			SharedPolicies: sharedPolicies,
+			Protected:      cfg.Controller.ProtectedHostnames,
+			Removals:       removals,
+		})
+	}
+	controller := controller.NewController(source, parser, logger, controller.Options{
+		Reconcilers:     reconcilers,
+		DNSEngine:       dnsEngine,
+		AccessEngine:    accessEngine,
+		Components:      components,
+		ErrorReport:     controller.NewErrorReport(cfg.Controller.ErrorReportFile),
+		StrictLabels:    cfg.Controller.StrictLabels,
+		RoutesFile:      cfg.Controller.RoutesFile,
+		ParkedHostnames: cfg.Controller.ParkedHostnames,
+		ParkedStatus:    cfg.Controller.ParkedStatus,
+		Interval:        cfg.Controller.PollInterval,
+		Jitter:          cfg.Controller.PollJitter,
+		Timeout:         cfg.Controller.SyncTimeout,
+		GracePeriod:     cfg.Controller.RouteGracePeriod,
+	})
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
@@ -55,3 +159,155 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// newTunnelEngine returns the ingress engine of one tunnel. The state store
+// records the tunnel's routes and applied originRequest keys.
+func newTunnelEngine(cfg config.Config, api cloudflare.API, logger *slog.Logger, stateStore *state.Store, backups *reconcile.Backups, removals *model.RemovalGuard) *reconcile.Engine {
+	return reconcile.NewEngine(api, logger, reconcile.Options{
+		DryRun:            cfg.Controller.DryRun,
+		ManageTunnel:      cfg.Controller.ManageTunnel,
+		IgnoreConfigSrc:   cfg.Controller.IgnoreConfigSrc,
+		DeleteRoutes:      cfg.Controller.DeleteRoutes,
+		EnforceOrder:      cfg.Controller.EnforceRuleOrder,
+		AppendFallback:    cfg.Controller.AppendFallback,
+		FallbackService:   cfg.Controller.FallbackService,
+		Store:             stateStore,
+		PreserveUnmanaged: cfg.Controller.PreserveUnmanaged,
+		Protected:         cfg.Controller.ProtectedHostnames,
+		OriginDefaults:    cfg.Controller.DefaultOriginRequest,
+		Retries:           cfg.Controller.TunnelRetries,
+		Backups:           backups,
+		Removals:          removals,
+		WarpRouting:       cfg.Controller.WarpRouting,
+	})
+}
+
+// namedTunnelEngine returns the ingress engine of a CF_TUNNEL_IDS tunnel. It
+// keeps its own client, state file, backup directory, and removal limit, so
+// nothing it records or removes is shared with another tunnel.
+func namedTunnelEngine(cfg config.Config, name string, logger *slog.Logger) (*reconcile.Engine, error) {
+	logger = logger.With("tunnel", name)
+	tunnelConfig := cfg.Cloudflare
+	tunnelConfig.TunnelID = cfg.Cloudflare.Tunnels[name]
+	client, err := cloudflare.NewClient(tunnelConfig, logger)
+	if err != nil {
+		return nil, err
+	}
+	stateStore, err := state.Load(tunnelStateFile(cfg.Controller.StateFile, name))
+	if err != nil {
+		return nil, err
+	}
+	var backups *reconcile.Backups
+	if cfg.Controller.BackupDir != "" {
+		backups = reconcile.NewBackups(filepath.Join(cfg.Controller.BackupDir, name), cfg.Controller.BackupKeep, logger)
+	}
+	removals := model.NewRemovalGuard(cfg.Controller.MaxRemovals, cfg.Controller.ForceRemovals)
+	return newTunnelEngine(cfg, client, logger, stateStore, backups, removals), nil
+}
+
+// tunnelStateFile returns the state file of a named tunnel next to
+// SYNC_STATE_FILE, such as state-lab.json for state.json.
+func tunnelStateFile(path string, name string) string {
+	extension := filepath.Ext(path)
+	return strings.TrimSuffix(path, extension) + "-" + name + extension
+}
+
+// newSource returns the adapter SYNC_SOURCE selects.
+func newSource(cfg config.Config) (controller.ContainerSource, error) {
+	if cfg.Source == config.SourceKubernetes {
+		return kubernetes.NewAdapter(cfg.Kubernetes)
+	}
+	return docker.NewAdapter(cfg.Docker)
+}
+
+// preflight checks that the API token can read every enabled component and
+// reports whether it can.
+func preflight(logger *slog.Logger, api controller.PreflightAPI, components config.Components, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	failures := controller.Preflight(ctx, api, components)
+	for _, failure := range failures {
+		logger.Error("preflight check failed", "error", failure)
+	}
+	if len(failures) > 0 {
+		logger.Error("preflight failed; fix the Cloudflare API token permissions and restart", "errors", len(failures))
+		return false
+	}
+	logger.Info("preflight passed")
+	return true
+}
+
+// validate reports label errors for the running containers and returns the
+// process exit code: non-zero when Docker is unreachable or any label is invalid.
+func validate(logger *slog.Logger, source controller.ContainerSource, parser *labels.Parser, routesFile string, timeout time.Duration) int {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	parseErrors, err := controller.Validate(ctx, source, parser, routesFile)
+	if err != nil {
+		logger.Error("failed to list containers", "error", err)
+		return 1
+	}
+	validationErrors, warnings := labels.SplitWarnings(parseErrors)
+	for _, warning := range warnings {
+		logger.Warn("label warning", "warning", warning)
+	}
+	for _, validationErr := range validationErrors {
+		logger.Error("label validation error", "error", validationErr)
+	}
+	if len(validationErrors) > 0 {
+		logger.Error("label validation failed", "errors", len(validationErrors))
+		return 1
+	}
+	logger.Info("label validation passed")
+	return 0
+}
+
+// export prints the ingress built from the current labels as cloudflared
+// config.yaml and returns the process exit code: non-zero when Docker is
+// unreachable or any label is invalid, in which case the valid routes are
+// still printed.
+func export(logger *slog.Logger, source controller.ContainerSource, parser *labels.Parser, routesFile string, parkedHostnames []string, parkedStatus int, reconcilers map[string]*reconcile.Engine, timeout time.Duration) int {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	output, parseErrors, err := controller.Export(ctx, source, parser, routesFile, parkedHostnames, parkedStatus, reconcilers, logger)
+	if err != nil {
+		logger.Error("failed to export ingress", "error", err)
+		return 1
+	}
+	labelErrors, warnings := labels.SplitWarnings(parseErrors)
+	for _, warning := range warnings {
+		logger.Warn("label warning", "warning", warning)
+	}
+	for _, labelErr := range labelErrors {
+		logger.Error("label parsing error; route left out of the export", "error", labelErr)
+	}
+	if _, err := os.Stdout.Write(output); err != nil {
+		logger.Error("failed to write ingress", "error", err)
+		return 1
+	}
+	if len(labelErrors) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// restore replaces the tunnel configuration with a backup and returns the
+// process exit code.
+func restore(logger *slog.Logger, api cloudflare.API, backups *reconcile.Backups, path string, dryRun bool, timeout time.Duration) int {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := reconcile.Restore(ctx, api, backups, path, dryRun); err != nil {
+		logger.Error("failed to restore tunnel config", "path", path, "error", err)
+		return 1
+	}
+	if dryRun {
+		logger.Info("dry run: backup is valid; tunnel config not restored", "path", path)
+		return 0
+	}
+	logger.Info("restored tunnel config from backup", "path", path)
+	return 0
+}
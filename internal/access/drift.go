@@ -0,0 +1,47 @@
+package access
+
+import (
+	"context"
+
+	"log/slog"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/model"
+)
+
+// Drift kinds reported while SYNC_ACCESS_DRIFT_CHECK is set.
+const (
+	driftMissingApp     = "missing_app"
+	driftAppDiffers     = "app_differs"
+	driftOrphanedApp    = "orphaned_app"
+	driftMissingPolicy  = "missing_policy"
+	driftPolicyDiffers  = "policy_differs"
+	driftOrphanedPolicy = "orphaned_policy"
+)
+
+// driftReport counts the differences found during a drift check.
+type driftReport struct {
+	count int
+}
+
+// DriftCheck compares the desired apps with Cloudflare without writing
+// anything. Each difference is logged at warn level as an "access drift"
+// record with a "drift" group, and the number of differences is returned.
+func (engine *Engine) DriftCheck(ctx context.Context, apps []model.AccessAppSpec) (int, error) {
+	check := *engine
+	check.dryRun = true
+	check.drift = &driftReport{}
+	if _, err := check.Reconcile(ctx, apps); err != nil {
+		return check.drift.count, err
+	}
+	return check.drift.count, nil
+}
+
+// reportDrift records one difference when a drift check is running; attrs are
+// key/value pairs describing the app or policy.
+func (engine *Engine) reportDrift(kind string, attrs ...any) {
+	if engine.drift == nil {
+		return
+	}
+	engine.drift.count++
+	engine.log.Warn("access drift", slog.Group("drift", append([]any{"kind", kind}, attrs...)...))
+}
@@ -2,6 +2,9 @@ package access
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"slices"
 	"sort"
 	"strings"
 
@@ -11,50 +14,171 @@ import (
 	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/model"
 )
 
+const (
+	defaultAppType  = "self_hosted"
+	bookmarkAppType = "bookmark"
+)
+
 // Engine reconciles Access applications and policies.
 type Engine struct {
-	api        cloudflare.AccessAPI
-	log        *slog.Logger
-	dryRun     bool
-	manage     bool
-	managedTag string
+	api          cloudflare.AccessAPI
+	log          *slog.Logger
+	dryRun       bool
+	manage       bool
+	managedTag   string
+	policySuffix string
+	// driftCheck is set by SYNC_ACCESS_DRIFT_CHECK; Reconcile then only
+	// reports differences, see DriftCheck.
+	driftCheck bool
+	// drift collects the report while a drift check runs; nil otherwise.
+	drift *driftReport
+	// result collects the changes while Reconcile runs; nil otherwise.
+	result *model.SyncResult
+	// protected hostnames, from SYNC_PROTECTED_HOSTNAMES, are never claimed
+	// by labels and their apps are never deleted.
+	protected model.ProtectedHostnames
+	// removals holds back app deletions exceeding SYNC_MAX_REMOVALS; nil when
+	// unlimited.
+	removals *model.RemovalGuard
+	// audiences remembers the AUD last seen for each app, by name and domain,
+	// so a recreated app, which gets a new AUD, is called out. It lives in
+	// memory only.
+	audiences map[accessAppKey]string
+	// denyLabels remembers which deny settings labels set on each app, so
+	// only those are cleared once their label is removed and deny settings
+	// made in the dashboard are kept. It lives in memory only.
+	denyLabels map[accessAppKey]appliedDenyLabels
+
+	sharedPolicies []model.AccessPolicySpec
 }
 
-func NewEngine(api cloudflare.AccessAPI, logger *slog.Logger, dryRun bool, manage bool, managedBy string) *Engine {
+// Options configures an Engine; each field sets the Engine field of the same
+// name, except ManagedBy, from which the managed tag and policy name marker
+// are built.
+type Options struct {
+	DryRun         bool
+	Manage         bool
+	DriftCheck     bool
+	ManagedBy      string
+	SharedPolicies []model.AccessPolicySpec
+	Protected      model.ProtectedHostnames
+	Removals       *model.RemovalGuard
+}
+
+func NewEngine(api cloudflare.AccessAPI, logger *slog.Logger, options Options) *Engine {
 	return &Engine{
-		api:        api,
-		log:        logger,
-		dryRun:     dryRun,
-		manage:     manage,
-		managedTag: model.AccessManagedTag(managedBy),
+		api:            api,
+		log:            logger,
+		dryRun:         options.DryRun,
+		manage:         options.Manage,
+		driftCheck:     options.DriftCheck,
+		managedTag:     model.AccessManagedTag(options.ManagedBy),
+		policySuffix:   model.AccessPolicyManagedSuffix(options.ManagedBy),
+		sharedPolicies: options.SharedPolicies,
+		protected:      options.Protected,
+		removals:       options.Removals,
+		audiences:      map[accessAppKey]string{},
+		denyLabels:     map[accessAppKey]appliedDenyLabels{},
+	}
+}
+
+// Reconcile syncs the desired Access apps and their policies. The result lists
+// each app and policy created, updated, or deleted, including in dry-run; a
+// drift check reports no changes, only the number of differences found, which
+// does not fail the cycle.
+func (engine *Engine) Reconcile(ctx context.Context, apps []model.AccessAppSpec) (model.SyncResult, error) {
+	if engine.driftCheck && engine.drift == nil {
+		count, err := engine.DriftCheck(ctx, apps)
+		return model.SyncResult{AccessDrift: count}, err
+	}
+
+	result := model.SyncResult{}
+	engine.result = &result
+	defer func() { engine.result = nil }()
+	err := engine.reconcile(ctx, apps)
+	return result, err
+}
+
+// recordChange adds a change to the result of the running Reconcile.
+func (engine *Engine) recordChange(resource string, action string, name string) {
+	if engine.result == nil {
+		return
 	}
+	engine.result.Add(resource, action, name)
 }
 
-func (engine *Engine) Reconcile(ctx context.Context, apps []model.AccessAppSpec) error {
+func (engine *Engine) reconcile(ctx context.Context, apps []model.AccessAppSpec) error {
+	apps = engine.withoutProtectedApps(apps)
 	if len(apps) == 0 && !engine.manage {
 		return nil
 	}
 
-	existingApps, err := engine.api.ListAccessApps(ctx)
+	// Without desired apps only the orphan pass runs, which needs managed apps
+	// alone; otherwise the full list is needed to resolve existing apps.
+	listTag := ""
+	if len(apps) == 0 {
+		listTag = engine.managedTag
+	}
+	existingApps, err := engine.api.ListAccessApps(ctx, listTag)
 	if err != nil {
 		return err
 	}
 
 	var existingPolicies []cloudflare.AccessPolicyRecord
-	if len(apps) > 0 {
+	if len(apps) > 0 || engine.manage {
 		existingPolicies, err = engine.api.ListAccessPolicies(ctx)
 		if err != nil {
 			return err
 		}
 	}
 
+	// Shared policies are ensured even when no app references them, so they
+	// are resolved alongside the apps through a pseudo app.
+	resolvable := apps
+	shared := model.AccessAppSpec{Name: "shared policies", Policies: engine.sharedPolicies}
+	if len(shared.Policies) > 0 {
+		resolvable = append(slices.Clip(apps), shared)
+	}
+
+	var identityProviders []cloudflare.IdentityProvider
+	if needsIdentityProviders(apps) {
+		identityProviders, err = engine.api.ListIdentityProviders(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	var customPages []cloudflare.CustomPage
+	if needsCustomPages(apps) {
+		customPages, err = engine.api.ListCustomPages(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	var accessGroups []cloudflare.AccessGroup
+	if needsAccessGroups(resolvable) {
+		accessGroups, err = engine.api.ListAccessGroups(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	var serviceTokens []cloudflare.ServiceToken
+	if needsServiceTokens(resolvable) {
+		serviceTokens, err = engine.api.ListServiceTokens(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
 	appByID := map[string]cloudflare.AccessAppRecord{}
 	appByKey := map[accessAppKey][]cloudflare.AccessAppRecord{}
 	for _, app := range existingApps {
 		if app.ID != "" {
 			appByID[app.ID] = app
 		}
-		key := accessAppKey{Name: strings.ToLower(app.Name), Domain: strings.ToLower(app.Domain)}
+		key := accessAppKey{Name: strings.ToLower(app.Name), Domain: model.NormalizeAccessDomain(app.Domain)}
 		appByKey[key] = append(appByKey[key], app)
 	}
 
@@ -65,15 +189,28 @@ func (engine *Engine) Reconcile(ctx context.Context, apps []model.AccessAppSpec)
 			policyByID[policy.ID] = policy
 		}
 		if policy.Name != "" {
-			key := strings.ToLower(policy.Name)
+			key := strings.ToLower(strings.TrimSuffix(policy.Name, engine.policySuffix))
 			policyByName[key] = append(policyByName[key], policy)
 		}
 	}
 
+	failures := []error{}
 	desiredAppIDs := map[string]struct{}{}
+	desiredPolicyIDs := map[string]struct{}{}
+	if len(shared.Policies) > 0 {
+		policyRefs, err := engine.ensureSharedPolicies(ctx, shared, accessGroups, serviceTokens, policyByID, policyByName)
+		for _, ref := range policyRefs {
+			desiredPolicyIDs[ref.ID] = struct{}{}
+		}
+		if err != nil {
+			failures = append(failures, fmt.Errorf("shared access policies: %w", err))
+		}
+	}
 	for _, app := range apps {
 		tagging := false
-		if engine.manage {
+		if engine.manage && engine.dryRun {
+			tagging = true
+		} else if engine.manage {
 			if err := engine.api.EnsureAccessTag(ctx, engine.managedTag); err != nil {
 				engine.log.Warn("failed to ensure access tag; proceeding without tagging", "tag", engine.managedTag, "error", err)
 			} else {
@@ -81,131 +218,304 @@ func (engine *Engine) Reconcile(ctx context.Context, apps []model.AccessAppSpec)
 			}
 		}
 
-		policyRefs, ok := engine.ensurePolicies(ctx, app, policyByID, policyByName)
-		if !ok {
-			continue
+		// Resolve the existing app first so a partial failure below keeps it
+		// out of orphan cleanup and the next cycle can resume.
+		appRecord, found := engine.resolveAccessApp(app, appByID, appByKey)
+		if found {
+			desiredAppIDs[appRecord.ID] = struct{}{}
+			// The AUD is logged at Info the first time each app is seen, so it
+			// can be read from the logs without Debug.
+			switch previous := engine.rememberAudience(app, appRecord.AUD); {
+			case appRecord.AUD == "" || previous == appRecord.AUD:
+			case previous == "":
+				engine.log.Info("found access app", "app", app.Name, "id", appRecord.ID, "aud", appRecord.AUD, "source_container", app.Source.ContainerName)
+			default:
+				engine.log.Warn("access app was recreated with a new AUD; update the JWT audience its backends validate", "app", app.Name, "previous_aud", previous, "aud", appRecord.AUD, "source_container", app.Source.ContainerName)
+			}
+		}
+
+		if len(app.AllowedIdPs) > 0 {
+			resolved, ok := engine.resolveIdentityProviders(app, identityProviders)
+			if !ok {
+				continue
+			}
+			app.AllowedIdPs = resolved
+		}
+
+		if len(app.CustomPages) > 0 {
+			resolved, ok := engine.resolveCustomPages(app, customPages)
+			if !ok {
+				continue
+			}
+			app.CustomPages = resolved
+		}
+
+		if hasGroupIncludes(app) {
+			resolved, ok := engine.resolveAccessGroups(app, accessGroups)
+			if !ok {
+				continue
+			}
+			app.Policies = resolved
+		}
+
+		if hasServiceTokenIncludes(app) {
+			resolved, ok := engine.resolveServiceTokens(app, serviceTokens)
+			if !ok {
+				continue
+			}
+			app.Policies = resolved
+		}
+
+		// Bookmark apps only link to an external URL and carry no policies.
+		var policyRefs []cloudflare.AccessPolicyRef
+		if app.Type != bookmarkAppType {
+			refs, ok, err := engine.ensurePolicies(ctx, app, policyByID, policyByName)
+			for _, ref := range refs {
+				desiredPolicyIDs[ref.ID] = struct{}{}
+			}
+			if err != nil {
+				failures = append(failures, fmt.Errorf("access app %s: %w", app.Name, err))
+			}
+			if !ok {
+				continue
+			}
+			policyRefs = refs
 		}
 
 		appSpec := app
-		if engine.manage && app.TagsSet && len(app.Tags) > 0 {
+		if engine.manage && !engine.dryRun && app.TagsSet && len(app.Tags) > 0 {
 			ensuredTags, tagsOK := engine.ensureAppTags(ctx, app)
 			if !tagsOK {
-				engine.log.Warn("access app tags could not be ensured; keeping existing tags", "app", app.Name)
+				engine.log.Warn("access app tags could not be ensured; keeping existing tags", "app", app.Name, "source_container", app.Source.ContainerName)
 				appSpec.TagsSet = false
 			} else {
 				appSpec.Tags = ensuredTags
 			}
 		}
 
-		appRecord, found := engine.resolveAccessApp(appSpec, appByID, appByKey)
 		if !found {
+			engine.reportDrift(driftMissingApp, "app", app.Name, "domain", app.Domain, "source_container", app.Source.ContainerName)
 			if !engine.manage {
-				engine.log.Warn("access app missing but SYNC_MANAGED_ACCESS is false; skipping create", "app", app.Name)
+				engine.log.Warn("access app missing but SYNC_MANAGED_ACCESS is false; skipping create", "app", app.Name, "source_container", app.Source.ContainerName)
 				continue
 			}
 			if engine.dryRun {
-				engine.log.Info("would create access app", "app", app.Name)
+				engine.log.Info("would create access app", "app", app.Name, "source_container", app.Source.ContainerName)
+				engine.recordChange(model.ResourceAccessApp, model.ActionCreated, app.Name)
 				continue
 			}
 			created, err := engine.api.CreateAccessApp(ctx, engine.buildAppInput(appSpec, policyRefs, nil, tagging))
 			if err != nil {
-				engine.log.Error("failed to create access app", "app", app.Name, "error", err)
+				engine.log.Error("failed to create access app", "app", app.Name, "source_container", app.Source.ContainerName, "error", err)
+				failures = append(failures, fmt.Errorf("create access app %s: %w", app.Name, err))
 				continue
 			}
+			engine.recordChange(model.ResourceAccessApp, model.ActionCreated, app.Name)
+			engine.rememberDenyLabels(app, created)
+			engine.log.Info("created access app", "app", app.Name, "id", created.ID, "aud", created.AUD, "source_container", app.Source.ContainerName)
+			if previous := engine.rememberAudience(app, created.AUD); previous != "" && previous != created.AUD {
+				engine.log.Warn("access app was recreated with a new AUD; update the JWT audience its backends validate", "app", app.Name, "previous_aud", previous, "aud", created.AUD, "source_container", app.Source.ContainerName)
+			}
 			appByID[created.ID] = created
 			desiredAppIDs[created.ID] = struct{}{}
 			continue
 		}
 
-		desiredAppIDs[appRecord.ID] = struct{}{}
 		input := engine.buildAppInput(appSpec, policyRefs, appRecord.Tags, tagging)
-		if !engine.appNeedsUpdate(appRecord, input) {
-			engine.log.Debug("access app up-to-date", "app", app.Name)
+		if hasManagedTag(appRecord.Tags, engine.managedTag) {
+			engine.clearRemovedDenySettings(app, &input)
+		}
+		engine.rememberDenyLabels(app, appRecord)
+		differences := engine.appDifferences(appRecord, input)
+		if len(differences) == 0 {
+			engine.log.Debug("access app up-to-date", "app", app.Name, "aud", appRecord.AUD, "source_container", app.Source.ContainerName)
 			continue
 		}
+		engine.reportDrift(driftAppDiffers, "app", app.Name, "id", appRecord.ID, "fields", differences, "source_container", app.Source.ContainerName)
 		if !engine.manage {
-			engine.log.Warn("access app differs but SYNC_MANAGED_ACCESS is false; skipping update", "app", app.Name)
+			engine.log.Warn("access app differs but SYNC_MANAGED_ACCESS is false; skipping update", "app", app.Name, "source_container", app.Source.ContainerName)
 			continue
 		}
-		engine.log.Info("updating access app", "app", app.Name)
+		if tagging && !hasManagedTag(appRecord.Tags, engine.managedTag) {
+			// The managed tag makes the app eligible for orphan cleanup once
+			// its labels are gone.
+			engine.log.Info("adopting existing access app; adding managed tag", "app", app.Name, "tag", engine.managedTag, "source_container", app.Source.ContainerName)
+		}
+		engine.log.Info("updating access app", "app", app.Name, "aud", appRecord.AUD, "source_container", app.Source.ContainerName)
 		if engine.dryRun {
+			engine.recordChange(model.ResourceAccessApp, model.ActionUpdated, app.Name)
 			continue
 		}
+		preserveUnsetAppSettings(&input, appRecord)
 		updated, err := engine.api.UpdateAccessApp(ctx, appRecord.ID, input)
 		if err != nil {
-			engine.log.Error("failed to update access app", "app", app.Name, "error", err)
+			engine.log.Error("failed to update access app", "app", app.Name, "source_container", app.Source.ContainerName, "error", err)
+			failures = append(failures, fmt.Errorf("update access app %s: %w", app.Name, err))
 			continue
 		}
+		engine.recordChange(model.ResourceAccessApp, model.ActionUpdated, app.Name)
 		appByID[updated.ID] = updated
 	}
 
-	engine.deleteOrphanedApps(ctx, existingApps, desiredAppIDs)
+	if err := engine.deleteOrphanedApps(ctx, existingApps, desiredAppIDs); err != nil {
+		failures = append(failures, err)
+	}
+	if err := engine.deleteOrphanedPolicies(ctx, existingPolicies, existingApps, desiredAppIDs, desiredPolicyIDs); err != nil {
+		failures = append(failures, err)
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("access reconciliation completed with %d failure(s): %w", len(failures), errors.Join(failures...))
+	}
 	return nil
 }
 
-func (engine *Engine) ensurePolicies(ctx context.Context, app model.AccessAppSpec, policyByID map[string]cloudflare.AccessPolicyRecord, policyByName map[string][]cloudflare.AccessPolicyRecord) ([]cloudflare.AccessPolicyRef, bool) {
+// withoutProtectedApps drops apps whose domain is a protected hostname; the
+// existing apps are left as they are.
+func (engine *Engine) withoutProtectedApps(apps []model.AccessAppSpec) []model.AccessAppSpec {
+	if len(engine.protected) == 0 {
+		return apps
+	}
+	kept := make([]model.AccessAppSpec, 0, len(apps))
+	for _, app := range apps {
+		if engine.protected.MatchAccessDomain(app.Domain) {
+			engine.log.Warn("access app claims a protected hostname; ignoring", "app", app.Name, "domain", app.Domain, "source_container", app.Source.ContainerName)
+			continue
+		}
+		kept = append(kept, app)
+	}
+	return kept
+}
+
+// ensurePolicies resolves the app's policies to references. It returns false
+// when the app must be skipped, and an error for API failures that should be
+// reported even though reconciliation continues with other apps.
+func (engine *Engine) ensurePolicies(ctx context.Context, app model.AccessAppSpec, policyByID map[string]cloudflare.AccessPolicyRecord, policyByName map[string][]cloudflare.AccessPolicyRecord) ([]cloudflare.AccessPolicyRef, bool, error) {
+	failures := []error{}
 	policyRefs := make([]cloudflare.AccessPolicyRef, 0, len(app.Policies))
 	for _, policy := range app.Policies {
-		precedence := len(policyRefs) + 1
+		// Label-ordered policies get their precedence once all refs are known.
+		precedence := policy.Precedence
 		if policy.ID != "" {
 			record, ok := policyByID[policy.ID]
 			if !ok {
 				if !policy.Managed {
-					engine.log.Warn("access policy id not found in account policies; using id-only reference", "policy", policy.ID, "app", app.Name)
+					engine.log.Warn("access policy id not found in account policies; using id-only reference", "policy", policy.ID, "app", app.Name, "source_container", app.Source.ContainerName)
 					policyRefs = append(policyRefs, cloudflare.AccessPolicyRef{ID: policy.ID, Precedence: precedence})
 					continue
 				}
-				engine.log.Warn("access policy id not found", "policy", policyLabel(policy), "app", app.Name)
-				return nil, false
+				engine.log.Warn("access policy id not found", "policy", policyLabel(policy), "app", app.Name, "source_container", app.Source.ContainerName)
+				return nil, false, errors.Join(failures...)
 			}
 			policyRefs = append(policyRefs, cloudflare.AccessPolicyRef{ID: record.ID, Precedence: precedence})
-			engine.updatePolicyIfNeeded(ctx, app, policy, record)
+			if policy.Name == "" {
+				// A policy managed by id without a name keeps its current one.
+				policy.Name = strings.TrimSuffix(record.Name, engine.policySuffix)
+			}
+			if err := engine.updatePolicyIfNeeded(ctx, app, policy, record); err != nil {
+				failures = append(failures, err)
+			}
 			continue
 		}
 
 		if !policy.Managed {
 			record, found, ok := engine.resolvePolicyByName(policy, policyByName)
 			if !ok {
-				return nil, false
+				return nil, false, errors.Join(failures...)
 			}
 			if !found {
-				engine.log.Warn("access policy name not found; skipping access app", "policy", policyLabel(policy), "app", app.Name)
-				return nil, false
+				engine.log.Warn("access policy name not found; skipping access app", "policy", policyLabel(policy), "app", app.Name, "source_container", app.Source.ContainerName)
+				return nil, false, errors.Join(failures...)
 			}
 			policyRefs = append(policyRefs, cloudflare.AccessPolicyRef{ID: record.ID, Precedence: precedence})
-			engine.updatePolicyIfNeeded(ctx, app, policy, record)
+			if err := engine.updatePolicyIfNeeded(ctx, app, policy, record); err != nil {
+				failures = append(failures, err)
+			}
 			continue
 		}
 
 		record, found, ok := engine.resolvePolicyByName(policy, policyByName)
 		if !ok {
-			return nil, false
+			return nil, false, errors.Join(failures...)
 		}
 		if !found {
+			engine.reportDrift(driftMissingPolicy, "policy", policyLabel(policy), "app", app.Name, "source_container", app.Source.ContainerName)
 			if !engine.manage {
-				engine.log.Warn("access policy missing but SYNC_MANAGED_ACCESS is false; skipping create", "policy", policyLabel(policy), "app", app.Name)
+				engine.log.Warn("access policy missing but SYNC_MANAGED_ACCESS is false; skipping create", "policy", policyLabel(policy), "app", app.Name, "source_container", app.Source.ContainerName)
 				continue
 			}
-			engine.log.Info("creating access policy", "policy", policyLabel(policy), "app", app.Name)
+			engine.log.Info("creating access policy", "policy", policyLabel(policy), "app", app.Name, "source_container", app.Source.ContainerName)
 			if engine.dryRun {
+				engine.recordChange(model.ResourceAccessPolicy, model.ActionCreated, policyLabel(policy))
 				continue
 			}
-			created, err := engine.api.CreateAccessPolicy(ctx, engine.buildPolicyInput(policy))
+			created, err := engine.api.CreateAccessPolicy(ctx, engine.buildPolicyInput(policy, engine.managedPolicyName(policy.Name)))
 			if err != nil {
-				engine.log.Error("failed to create access policy", "policy", policyLabel(policy), "error", err)
-				return nil, false
+				engine.log.Error("failed to create access policy", "policy", policyLabel(policy), "app", app.Name, "source_container", app.Source.ContainerName, "error", err)
+				failures = append(failures, fmt.Errorf("create access policy %s: %w", policyLabel(policy), err))
+				return nil, false, errors.Join(failures...)
 			}
+			engine.recordChange(model.ResourceAccessPolicy, model.ActionCreated, policyLabel(policy))
 			policyByID[created.ID] = created
-			policyByName[strings.ToLower(created.Name)] = append(policyByName[strings.ToLower(created.Name)], created)
+			key := strings.ToLower(policy.Name)
+			policyByName[key] = append(policyByName[key], created)
 			policyRefs = append(policyRefs, cloudflare.AccessPolicyRef{ID: created.ID, Precedence: precedence})
 			continue
 		}
 
 		policyRefs = append(policyRefs, cloudflare.AccessPolicyRef{ID: record.ID, Precedence: precedence})
-		engine.updatePolicyIfNeeded(ctx, app, policy, record)
+		if err := engine.updatePolicyIfNeeded(ctx, app, policy, record); err != nil {
+			failures = append(failures, err)
+		}
+	}
+
+	assignPrecedence(policyRefs)
+	return policyRefs, len(policyRefs) > 0, errors.Join(failures...)
+}
+
+// assignPrecedence numbers refs without an explicit precedence in order,
+// skipping the values set by policy.N.precedence labels.
+func assignPrecedence(refs []cloudflare.AccessPolicyRef) {
+	explicit := map[int]struct{}{}
+	for _, ref := range refs {
+		if ref.Precedence > 0 {
+			explicit[ref.Precedence] = struct{}{}
+		}
+	}
+	next := 0
+	for index := range refs {
+		if refs[index].Precedence > 0 {
+			continue
+		}
+		next++
+		for {
+			if _, used := explicit[next]; !used {
+				break
+			}
+			next++
+		}
+		refs[index].Precedence = next
 	}
+}
 
-	return policyRefs, len(policyRefs) > 0
+// ensureSharedPolicies creates or updates the account-level policy
+// definitions, whether or not any app references them.
+func (engine *Engine) ensureSharedPolicies(ctx context.Context, shared model.AccessAppSpec, groups []cloudflare.AccessGroup, tokens []cloudflare.ServiceToken, policyByID map[string]cloudflare.AccessPolicyRecord, policyByName map[string][]cloudflare.AccessPolicyRecord) ([]cloudflare.AccessPolicyRef, error) {
+	if hasGroupIncludes(shared) {
+		resolved, ok := engine.resolveAccessGroups(shared, groups)
+		if !ok {
+			return nil, nil
+		}
+		shared.Policies = resolved
+	}
+	if hasServiceTokenIncludes(shared) {
+		resolved, ok := engine.resolveServiceTokens(shared, tokens)
+		if !ok {
+			return nil, nil
+		}
+		shared.Policies = resolved
+	}
+	policyRefs, _, err := engine.ensurePolicies(ctx, shared, policyByID, policyByName)
+	return policyRefs, err
 }
 
 func (engine *Engine) resolvePolicyByName(spec model.AccessPolicySpec, policyByName map[string][]cloudflare.AccessPolicyRecord) (cloudflare.AccessPolicyRecord, bool, bool) {
@@ -214,37 +524,56 @@ func (engine *Engine) resolvePolicyByName(spec model.AccessPolicySpec, policyByN
 		return cloudflare.AccessPolicyRecord{}, false, true
 	}
 	if len(matches) > 1 {
+		// A policy already marked as ours wins over unmarked ones sharing its name.
+		var marked []cloudflare.AccessPolicyRecord
+		for _, match := range matches {
+			if strings.HasSuffix(match.Name, engine.policySuffix) {
+				marked = append(marked, match)
+			}
+		}
+		if len(marked) == 1 {
+			return marked[0], true, true
+		}
 		engine.log.Warn("multiple access policies share the same name; skipping", "policy", spec.Name)
 		return cloudflare.AccessPolicyRecord{}, false, false
 	}
 	return matches[0], true, true
 }
 
-func (engine *Engine) updatePolicyIfNeeded(ctx context.Context, app model.AccessAppSpec, spec model.AccessPolicySpec, record cloudflare.AccessPolicyRecord) {
+func (engine *Engine) updatePolicyIfNeeded(ctx context.Context, app model.AccessAppSpec, spec model.AccessPolicySpec, record cloudflare.AccessPolicyRecord) error {
 	if !spec.Managed {
 		engine.log.Debug("access policy reference-only; skipping updates", "policy", policyLabel(spec))
-		return
+		return nil
 	}
 	if record.HasUnsupportedRules {
-		engine.log.Warn("access policy has unsupported rule types; rules will be replaced", "policy", policyLabel(spec))
+		engine.log.Warn("access policy has unsupported rule types; rules will be replaced", "policy", policyLabel(spec), "app", app.Name, "source_container", app.Source.ContainerName)
+	}
+	differences := policyDifferences(spec, record)
+	name := engine.policyName(spec, record)
+	if engine.manage && record.Name != name {
+		differences = append(differences, "name")
 	}
-	if !policyNeedsUpdate(spec, record) {
+	if len(differences) == 0 {
 		engine.log.Debug("access policy up-to-date", "policy", policyLabel(spec))
-		return
+		return nil
 	}
+	engine.reportDrift(driftPolicyDiffers, "policy", policyLabel(spec), "id", record.ID, "fields", differences, "app", app.Name, "source_container", app.Source.ContainerName)
 	if !engine.manage {
-		engine.log.Warn("access policy differs but SYNC_MANAGED_ACCESS is false; skipping update", "policy", policyLabel(spec))
-		return
+		engine.log.Warn("access policy differs but SYNC_MANAGED_ACCESS is false; skipping update", "policy", policyLabel(spec), "app", app.Name, "source_container", app.Source.ContainerName)
+		return nil
 	}
-	engine.log.Info("updating access policy", "policy", policyLabel(spec), "app", app.Name)
+	engine.log.Info("updating access policy", "policy", policyLabel(spec), "app", app.Name, "source_container", app.Source.ContainerName)
 	if engine.dryRun {
-		return
+		engine.recordChange(model.ResourceAccessPolicy, model.ActionUpdated, policyLabel(spec))
+		return nil
 	}
-	_, err := engine.api.UpdateAccessPolicy(ctx, record.ID, engine.buildPolicyInput(spec))
+	_, err := engine.api.UpdateAccessPolicy(ctx, record.ID, engine.buildPolicyInput(spec, name))
 	if err != nil {
-		engine.log.Error("failed to update access policy", "policy", policyLabel(spec), "error", err)
-		return
+		engine.log.Error("failed to update access policy", "policy", policyLabel(spec), "app", app.Name, "source_container", app.Source.ContainerName, "error", err)
+		return fmt.Errorf("update access policy %s: %w", policyLabel(spec), err)
 	}
+	engine.recordChange(model.ResourceAccessPolicy, model.ActionUpdated, policyLabel(spec))
+	return nil
 }
 
 func (engine *Engine) ensureAppTags(ctx context.Context, app model.AccessAppSpec) ([]string, bool) {
@@ -265,7 +594,7 @@ func (engine *Engine) ensureAppTags(ctx context.Context, app model.AccessAppSpec
 		}
 		seen[trimmed] = struct{}{}
 		if err := engine.api.EnsureAccessTag(ctx, trimmed); err != nil {
-			engine.log.Warn("failed to ensure access tag for app", "app", app.Name, "tag", trimmed, "error", err)
+			engine.log.Warn("failed to ensure access tag for app", "app", app.Name, "source_container", app.Source.ContainerName, "tag", trimmed, "error", err)
 			ok = false
 			continue
 		}
@@ -274,40 +603,208 @@ func (engine *Engine) ensureAppTags(ctx context.Context, app model.AccessAppSpec
 	return ensured, ok
 }
 
+// rememberAudience records the AUD of the app and returns the one recorded
+// before, if any.
+func (engine *Engine) rememberAudience(app model.AccessAppSpec, aud string) string {
+	key := accessAppKey{Name: strings.ToLower(app.Name), Domain: model.NormalizeAccessDomain(app.Domain)}
+	previous := engine.audiences[key]
+	if aud != "" {
+		engine.audiences[key] = aud
+	}
+	return previous
+}
+
 func (engine *Engine) resolveAccessApp(spec model.AccessAppSpec, appByID map[string]cloudflare.AccessAppRecord, appByKey map[accessAppKey][]cloudflare.AccessAppRecord) (cloudflare.AccessAppRecord, bool) {
 	if spec.ID != "" {
 		record, ok := appByID[spec.ID]
 		if !ok {
-			engine.log.Warn("access app id not found", "app", spec.Name, "id", spec.ID)
+			engine.log.Warn("access app id not found", "app", spec.Name, "source_container", spec.Source.ContainerName, "id", spec.ID)
 			return cloudflare.AccessAppRecord{}, false
 		}
 		return record, true
 	}
 
-	key := accessAppKey{Name: strings.ToLower(spec.Name), Domain: strings.ToLower(spec.Domain)}
+	key := accessAppKey{Name: strings.ToLower(spec.Name), Domain: model.NormalizeAccessDomain(spec.Domain)}
 	matches := appByKey[key]
 	if len(matches) == 0 {
 		return cloudflare.AccessAppRecord{}, false
 	}
 	if len(matches) > 1 {
-		engine.log.Warn("multiple access apps share the same name and domain; skipping", "app", spec.Name)
+		engine.log.Warn("multiple access apps share the same name and domain; skipping", "app", spec.Name, "source_container", spec.Source.ContainerName)
 		return cloudflare.AccessAppRecord{}, false
 	}
 	return matches[0], true
 }
 
-func (engine *Engine) buildPolicyInput(spec model.AccessPolicySpec) cloudflare.AccessPolicyInput {
-	includes := make([]cloudflare.AccessRule, 0, len(spec.IncludeEmails)+len(spec.IncludeIPs))
+// resolveIdentityProviders maps the app's allowed IdPs, given as IDs or names,
+// to provider IDs. It returns false when any entry is missing or ambiguous.
+func (engine *Engine) resolveIdentityProviders(app model.AccessAppSpec, providers []cloudflare.IdentityProvider) ([]string, bool) {
+	resolved := make([]string, 0, len(app.AllowedIdPs))
+	for _, value := range app.AllowedIdPs {
+		var matches []string
+		for _, provider := range providers {
+			if provider.ID == value {
+				matches = []string{provider.ID}
+				break
+			}
+			if strings.EqualFold(provider.Name, value) {
+				matches = append(matches, provider.ID)
+			}
+		}
+		if len(matches) == 0 {
+			engine.log.Warn("access identity provider not found; skipping access app", "idp", value, "app", app.Name, "source_container", app.Source.ContainerName)
+			return nil, false
+		}
+		if len(matches) > 1 {
+			engine.log.Warn("multiple access identity providers share the same name; skipping access app", "idp", value, "app", app.Name, "source_container", app.Source.ContainerName)
+			return nil, false
+		}
+		resolved = append(resolved, matches[0])
+	}
+	return resolved, true
+}
+
+// resolveCustomPages maps the app's custom pages, given as UIDs or names, to
+// UIDs. It returns false when any page is missing or ambiguous.
+func (engine *Engine) resolveCustomPages(app model.AccessAppSpec, pages []cloudflare.CustomPage) ([]string, bool) {
+	resolved := make([]string, 0, len(app.CustomPages))
+	for _, value := range app.CustomPages {
+		var matches []string
+		for _, page := range pages {
+			if page.ID == value {
+				matches = []string{page.ID}
+				break
+			}
+			if strings.EqualFold(page.Name, value) {
+				matches = append(matches, page.ID)
+			}
+		}
+		if len(matches) == 0 {
+			engine.log.Warn("access custom page not found; skipping access app", "custom_page", value, "app", app.Name, "source_container", app.Source.ContainerName)
+			return nil, false
+		}
+		if len(matches) > 1 {
+			engine.log.Warn("multiple access custom pages share the same name; skipping access app", "custom_page", value, "app", app.Name, "source_container", app.Source.ContainerName)
+			return nil, false
+		}
+		resolved = append(resolved, matches[0])
+	}
+	return resolved, true
+}
+
+// resolveAccessGroups returns a copy of the app's policies with include
+// groups, given as IDs or names, mapped to group IDs. It returns false when
+// any group is missing or ambiguous.
+func (engine *Engine) resolveAccessGroups(app model.AccessAppSpec, groups []cloudflare.AccessGroup) ([]model.AccessPolicySpec, bool) {
+	policies := make([]model.AccessPolicySpec, 0, len(app.Policies))
+	for _, policy := range app.Policies {
+		if len(policy.IncludeGroups) > 0 {
+			resolved := make([]string, 0, len(policy.IncludeGroups))
+			for _, value := range policy.IncludeGroups {
+				var matches []string
+				for _, group := range groups {
+					if group.ID == value {
+						matches = []string{group.ID}
+						break
+					}
+					if strings.EqualFold(group.Name, value) {
+						matches = append(matches, group.ID)
+					}
+				}
+				if len(matches) == 0 {
+					engine.log.Warn("access group not found; skipping access app", "group", value, "policy", policyLabel(policy), "app", app.Name, "source_container", app.Source.ContainerName)
+					return nil, false
+				}
+				if len(matches) > 1 {
+					engine.log.Warn("multiple access groups share the same name; skipping access app", "group", value, "policy", policyLabel(policy), "app", app.Name, "source_container", app.Source.ContainerName)
+					return nil, false
+				}
+				resolved = append(resolved, matches[0])
+			}
+			policy.IncludeGroups = resolved
+		}
+		policies = append(policies, policy)
+	}
+	return policies, true
+}
+
+// resolveServiceTokens returns a copy of the app's policies with include
+// service tokens, given as IDs or names, mapped to token IDs. It returns false
+// when any token is missing or ambiguous.
+func (engine *Engine) resolveServiceTokens(app model.AccessAppSpec, tokens []cloudflare.ServiceToken) ([]model.AccessPolicySpec, bool) {
+	policies := make([]model.AccessPolicySpec, 0, len(app.Policies))
+	for _, policy := range app.Policies {
+		if len(policy.IncludeServiceTokens) > 0 {
+			resolved := make([]string, 0, len(policy.IncludeServiceTokens))
+			for _, value := range policy.IncludeServiceTokens {
+				var matches []string
+				for _, token := range tokens {
+					if token.ID == value {
+						matches = []string{token.ID}
+						break
+					}
+					if strings.EqualFold(token.Name, value) {
+						matches = append(matches, token.ID)
+					}
+				}
+				if len(matches) == 0 {
+					engine.log.Warn("access service token not found; skipping access app", "service_token", value, "policy", policyLabel(policy), "app", app.Name, "source_container", app.Source.ContainerName)
+					return nil, false
+				}
+				if len(matches) > 1 {
+					engine.log.Warn("multiple access service tokens share the same name; skipping access app", "service_token", value, "policy", policyLabel(policy), "app", app.Name, "source_container", app.Source.ContainerName)
+					return nil, false
+				}
+				resolved = append(resolved, matches[0])
+			}
+			policy.IncludeServiceTokens = resolved
+		}
+		policies = append(policies, policy)
+	}
+	return policies, true
+}
+
+func (engine *Engine) buildPolicyInput(spec model.AccessPolicySpec, name string) cloudflare.AccessPolicyInput {
+	includes := make([]cloudflare.AccessRule, 0, len(spec.IncludeEmails)+len(spec.IncludeEmailDomains)+len(spec.IncludeIPs)+len(spec.IncludeGroups)+len(spec.IncludeCountries)+len(spec.IncludeServiceTokens))
 	for _, email := range spec.IncludeEmails {
 		includes = append(includes, cloudflare.AccessRule{Email: email})
 	}
+	for _, domain := range spec.IncludeEmailDomains {
+		includes = append(includes, cloudflare.AccessRule{EmailDomain: domain})
+	}
 	for _, ip := range spec.IncludeIPs {
 		includes = append(includes, cloudflare.AccessRule{IP: ip})
 	}
+	for _, group := range spec.IncludeGroups {
+		includes = append(includes, cloudflare.AccessRule{Group: group})
+	}
+	for _, country := range spec.IncludeCountries {
+		includes = append(includes, cloudflare.AccessRule{Country: country})
+	}
+	for _, token := range spec.IncludeServiceTokens {
+		includes = append(includes, cloudflare.AccessRule{ServiceToken: token})
+	}
+	if spec.IncludeAnyServiceToken {
+		includes = append(includes, cloudflare.AccessRule{AnyServiceToken: true})
+	}
+	for _, commonName := range spec.IncludeCommonNames {
+		includes = append(includes, cloudflare.AccessRule{CommonName: commonName})
+	}
+	if spec.IncludeCertificate {
+		includes = append(includes, cloudflare.AccessRule{Certificate: true})
+	}
+	if spec.IncludeEveryone {
+		includes = append(includes, cloudflare.AccessRule{Everyone: true})
+	}
+	var requires []cloudflare.AccessRule
+	if spec.RequireAuthMethod != "" {
+		requires = append(requires, cloudflare.AccessRule{AuthMethod: spec.RequireAuthMethod})
+	}
 	return cloudflare.AccessPolicyInput{
-		Name:    spec.Name,
+		Name:    name,
 		Action:  spec.Action,
 		Include: includes,
+		Require: requires,
 	}
 }
 
@@ -320,39 +817,281 @@ func (engine *Engine) buildAppInput(spec model.AccessAppSpec, policyRefs []cloud
 		tags = mergeTags(tags, engine.managedTag)
 	}
 
+	appType := spec.Type
+	if appType == "" {
+		appType = defaultAppType
+	}
+
 	return cloudflare.AccessAppInput{
-		Name:     spec.Name,
-		Domain:   spec.Domain,
-		Type:     "self_hosted",
-		Policies: policyRefs,
-		Tags:     tags,
+		Name:               spec.Name,
+		Domain:             spec.Domain,
+		Type:               appType,
+		Policies:           policyRefs,
+		Tags:               tags,
+		AppLauncherVisible: spec.AppLauncherVisible,
+		LogoURL:            spec.LogoURL,
+		AllowedIdPs:        spec.AllowedIdPs,
+		DenyMessage:        spec.DenyMessage,
+		DenyURL:            spec.DenyURL,
+		AutoRedirect:       spec.AutoRedirect,
+		SkipInterstitial:   spec.SkipInterstitial,
+		IsolationRequired:  spec.IsolationRequired,
+		SkipLauncherLogin:  spec.SkipLauncherLogin,
+		HTTPOnlyCookie:     spec.HTTPOnlyCookie,
+		SameSiteCookie:     spec.SameSiteCookie,
+		CustomPages:        spec.CustomPages,
+		CORS:               buildCORS(spec.CORS),
 	}
 }
 
-func (engine *Engine) appNeedsUpdate(record cloudflare.AccessAppRecord, desired cloudflare.AccessAppInput) bool {
+// appDifferences lists the fields, by their Cloudflare API names, in which
+// the existing app differs from the desired input. Optional settings are only
+// compared when set.
+func (engine *Engine) appDifferences(record cloudflare.AccessAppRecord, desired cloudflare.AccessAppInput) []string {
+	differences := []string{}
 	if record.Name != desired.Name {
-		return true
+		differences = append(differences, "name")
 	}
-	if record.Domain != desired.Domain {
-		return true
+	if model.NormalizeAccessDomain(record.Domain) != model.NormalizeAccessDomain(desired.Domain) {
+		differences = append(differences, "domain")
 	}
 	if record.Type != "" && record.Type != desired.Type {
-		return true
+		differences = append(differences, "type")
 	}
 	if !policyRefsEqual(record.Policies, desired.Policies) {
-		return true
+		differences = append(differences, "policies")
 	}
 	if !stringSetsEqual(record.Tags, desired.Tags) {
-		return true
+		differences = append(differences, "tags")
+	}
+	if desired.AppLauncherVisible != nil && record.AppLauncherVisible != *desired.AppLauncherVisible {
+		differences = append(differences, "app_launcher_visible")
+	}
+	if desired.LogoURL != nil && record.LogoURL != *desired.LogoURL {
+		differences = append(differences, "logo_url")
+	}
+	if desired.AllowedIdPs != nil && !stringSetsEqual(record.AllowedIdPs, desired.AllowedIdPs) {
+		differences = append(differences, "allowed_idps")
+	}
+	if desired.DenyMessage != nil && record.DenyMessage != *desired.DenyMessage {
+		differences = append(differences, "custom_deny_message")
+	}
+	if desired.DenyURL != nil && record.DenyURL != *desired.DenyURL {
+		differences = append(differences, "custom_deny_url")
+	}
+	if desired.AutoRedirect != nil && record.AutoRedirect != *desired.AutoRedirect {
+		differences = append(differences, "auto_redirect_to_identity")
+	}
+	if desired.SkipInterstitial != nil && record.SkipInterstitial != *desired.SkipInterstitial {
+		differences = append(differences, "skip_interstitial")
+	}
+	if desired.IsolationRequired != nil && record.IsolationRequired != *desired.IsolationRequired {
+		differences = append(differences, "isolation_required")
+	}
+	if desired.SkipLauncherLogin != nil && record.SkipLauncherLogin != *desired.SkipLauncherLogin {
+		differences = append(differences, "skip_app_launcher_login_page")
+	}
+	if desired.HTTPOnlyCookie != nil && record.HTTPOnlyCookie != *desired.HTTPOnlyCookie {
+		differences = append(differences, "http_only_cookie_attribute")
+	}
+	if desired.SameSiteCookie != nil && record.SameSiteCookie != *desired.SameSiteCookie {
+		differences = append(differences, "same_site_cookie_attribute")
+	}
+	if desired.CustomPages != nil && !stringSetsEqual(record.CustomPages, desired.CustomPages) {
+		differences = append(differences, "custom_pages")
+	}
+	if desired.CORS != nil && !corsEqual(record.CORS, desired.CORS) {
+		differences = append(differences, "cors_headers")
+	}
+	return differences
+}
+
+func buildCORS(spec *model.AccessCORSSpec) *cloudflare.AccessCORS {
+	if spec == nil {
+		return nil
+	}
+	return &cloudflare.AccessCORS{
+		AllowedOrigins:   spec.AllowedOrigins,
+		AllowedMethods:   spec.AllowedMethods,
+		AllowedHeaders:   spec.AllowedHeaders,
+		AllowAllOrigins:  spec.AllowAllOrigins,
+		AllowAllMethods:  spec.AllowAllMethods,
+		AllowAllHeaders:  spec.AllowAllHeaders,
+		AllowCredentials: spec.AllowCredentials,
+		MaxAge:           spec.MaxAge,
+	}
+}
+
+// corsEqual compares CORS settings, treating lists as unordered sets.
+func corsEqual(record *cloudflare.AccessCORS, desired *cloudflare.AccessCORS) bool {
+	if record == nil {
+		return false
+	}
+	return stringSetsEqual(record.AllowedOrigins, desired.AllowedOrigins) &&
+		stringSetsEqual(record.AllowedMethods, desired.AllowedMethods) &&
+		stringSetsEqual(record.AllowedHeaders, desired.AllowedHeaders) &&
+		record.AllowAllOrigins == desired.AllowAllOrigins &&
+		record.AllowAllMethods == desired.AllowAllMethods &&
+		record.AllowAllHeaders == desired.AllowAllHeaders &&
+		record.AllowCredentials == desired.AllowCredentials &&
+		record.MaxAge == desired.MaxAge
+}
+
+// preserveUnsetAppSettings copies optional settings the labels do not define
+// from the existing app, so a full update does not reset them.
+func preserveUnsetAppSettings(input *cloudflare.AccessAppInput, record cloudflare.AccessAppRecord) {
+	if input.AppLauncherVisible == nil {
+		visible := record.AppLauncherVisible
+		input.AppLauncherVisible = &visible
+	}
+	if input.LogoURL == nil && record.LogoURL != "" {
+		logoURL := record.LogoURL
+		input.LogoURL = &logoURL
+	}
+	if input.AllowedIdPs == nil {
+		input.AllowedIdPs = record.AllowedIdPs
+	}
+	if input.DenyMessage == nil && record.DenyMessage != "" {
+		denyMessage := record.DenyMessage
+		input.DenyMessage = &denyMessage
+	}
+	if input.DenyURL == nil && record.DenyURL != "" {
+		denyURL := record.DenyURL
+		input.DenyURL = &denyURL
+	}
+	if input.AutoRedirect == nil {
+		autoRedirect := record.AutoRedirect
+		input.AutoRedirect = &autoRedirect
+	}
+	if input.SkipInterstitial == nil {
+		skipInterstitial := record.SkipInterstitial
+		input.SkipInterstitial = &skipInterstitial
+	}
+	if input.IsolationRequired == nil {
+		isolationRequired := record.IsolationRequired
+		input.IsolationRequired = &isolationRequired
+	}
+	if input.SkipLauncherLogin == nil {
+		skipLauncherLogin := record.SkipLauncherLogin
+		input.SkipLauncherLogin = &skipLauncherLogin
+	}
+	if input.HTTPOnlyCookie == nil {
+		httpOnlyCookie := record.HTTPOnlyCookie
+		input.HTTPOnlyCookie = &httpOnlyCookie
+	}
+	if input.CustomPages == nil {
+		input.CustomPages = record.CustomPages
+	}
+	if input.CORS == nil {
+		input.CORS = record.CORS
+	}
+	if input.SameSiteCookie == nil && record.SameSiteCookie != "" {
+		sameSiteCookie := record.SameSiteCookie
+		input.SameSiteCookie = &sameSiteCookie
+	}
+}
+
+// appliedDenyLabels records which deny settings labels set on an app.
+type appliedDenyLabels struct {
+	message bool
+	url     bool
+}
+
+// clearRemovedDenySettings resets deny settings whose labels were removed, so
+// managed apps fall back to the Cloudflare default. Settings no label set
+// are left alone.
+func (engine *Engine) clearRemovedDenySettings(app model.AccessAppSpec, input *cloudflare.AccessAppInput) {
+	applied := engine.denyLabels[accessAppKey{Name: strings.ToLower(app.Name), Domain: model.NormalizeAccessDomain(app.Domain)}]
+	if input.DenyMessage == nil && applied.message {
+		cleared := ""
+		input.DenyMessage = &cleared
+	}
+	if input.DenyURL == nil && applied.url {
+		cleared := ""
+		input.DenyURL = &cleared
+	}
+}
+
+// rememberDenyLabels records the deny settings set by labels on the app. A
+// removed label stays recorded until the app shows the field cleared, so a
+// failed update is retried on the next cycle.
+func (engine *Engine) rememberDenyLabels(app model.AccessAppSpec, record cloudflare.AccessAppRecord) {
+	key := accessAppKey{Name: strings.ToLower(app.Name), Domain: model.NormalizeAccessDomain(app.Domain)}
+	previous := engine.denyLabels[key]
+	applied := appliedDenyLabels{
+		message: app.DenyMessage != nil || (previous.message && record.DenyMessage != ""),
+		url:     app.DenyURL != nil || (previous.url && record.DenyURL != ""),
+	}
+	if applied == (appliedDenyLabels{}) {
+		delete(engine.denyLabels, key)
+		return
+	}
+	engine.denyLabels[key] = applied
+}
+
+func needsAccessGroups(apps []model.AccessAppSpec) bool {
+	for _, app := range apps {
+		if hasGroupIncludes(app) {
+			return true
+		}
 	}
 	return false
 }
 
-func (engine *Engine) deleteOrphanedApps(ctx context.Context, existing []cloudflare.AccessAppRecord, desired map[string]struct{}) {
+func hasGroupIncludes(app model.AccessAppSpec) bool {
+	for _, policy := range app.Policies {
+		if len(policy.IncludeGroups) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func needsServiceTokens(apps []model.AccessAppSpec) bool {
+	for _, app := range apps {
+		if hasServiceTokenIncludes(app) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasServiceTokenIncludes(app model.AccessAppSpec) bool {
+	for _, policy := range app.Policies {
+		if len(policy.IncludeServiceTokens) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func needsIdentityProviders(apps []model.AccessAppSpec) bool {
+	for _, app := range apps {
+		if len(app.AllowedIdPs) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func needsCustomPages(apps []model.AccessAppSpec) bool {
+	for _, app := range apps {
+		if len(app.CustomPages) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteOrphanedApps removes managed apps no desired app resolved to. Apps
+// held back by the removal guard are added to desired, so their policies are
+// kept as well.
+func (engine *Engine) deleteOrphanedApps(ctx context.Context, existing []cloudflare.AccessAppRecord, desired map[string]struct{}) error {
 	if !engine.manage {
-		return
+		return nil
 	}
 
+	orphans := []cloudflare.AccessAppRecord{}
 	for _, app := range existing {
 		if _, wanted := desired[app.ID]; wanted {
 			continue
@@ -360,14 +1099,110 @@ func (engine *Engine) deleteOrphanedApps(ctx context.Context, existing []cloudfl
 		if !hasManagedTag(app.Tags, engine.managedTag) {
 			continue
 		}
-		engine.log.Warn("managed access app no longer desired; deleting", "app", app.Name)
+		if engine.protected.MatchAccessDomain(app.Domain) {
+			engine.log.Debug("keeping access app of protected hostname", "app", app.Name, "domain", app.Domain)
+			continue
+		}
+		orphans = append(orphans, app)
+	}
+
+	// A drift check reports every orphan, so the guard only applies to syncs.
+	if engine.drift == nil {
+		names := make([]string, 0, len(orphans))
+		for _, app := range orphans {
+			names = append(names, app.ID)
+		}
+		if !engine.removals.Allow("access", names) {
+			engine.log.Error("access sync would delete more apps than SYNC_MAX_REMOVALS allows; keeping them until the next sync asks for the same deletions or SYNC_FORCE_REMOVALS=true", "apps", len(orphans), "limit", engine.removals.Limit())
+			for _, app := range orphans {
+				desired[app.ID] = struct{}{}
+			}
+			return nil
+		}
+	}
+
+	failures := []error{}
+	for _, app := range orphans {
+		engine.reportDrift(driftOrphanedApp, "app", app.Name, "id", app.ID)
+		engine.log.Warn("managed access app no longer desired; deleting", "app", app.Name, "aud", app.AUD)
 		if engine.dryRun {
+			engine.recordChange(model.ResourceAccessApp, model.ActionDeleted, app.Name)
 			continue
 		}
 		if err := engine.api.DeleteAccessApp(ctx, app.ID); err != nil {
 			engine.log.Error("failed to delete access app", "app", app.Name, "error", err)
+			failures = append(failures, fmt.Errorf("delete access app %s: %w", app.Name, err))
+			continue
 		}
+		engine.recordChange(model.ResourceAccessApp, model.ActionDeleted, app.Name)
+	}
+	return errors.Join(failures...)
+}
+
+// deleteOrphanedPolicies removes policies carrying this controller's name
+// marker that no desired app uses. Policies still attached to a kept app, or
+// to apps outside the listed set, are left alone.
+func (engine *Engine) deleteOrphanedPolicies(ctx context.Context, existing []cloudflare.AccessPolicyRecord, apps []cloudflare.AccessAppRecord, desiredApps map[string]struct{}, desiredPolicies map[string]struct{}) error {
+	if !engine.manage {
+		return nil
+	}
+
+	attached := map[string]int{}
+	kept := map[string]struct{}{}
+	for _, app := range apps {
+		_, wanted := desiredApps[app.ID]
+		orphaned := !wanted && hasManagedTag(app.Tags, engine.managedTag) && !engine.protected.MatchAccessDomain(app.Domain)
+		for _, ref := range app.Policies {
+			attached[ref.ID]++
+			if !orphaned {
+				kept[ref.ID] = struct{}{}
+			}
+		}
+	}
+
+	failures := []error{}
+	for _, policy := range existing {
+		if _, wanted := desiredPolicies[policy.ID]; wanted {
+			continue
+		}
+		if !strings.HasSuffix(policy.Name, engine.policySuffix) {
+			continue
+		}
+		if _, ok := kept[policy.ID]; ok {
+			continue
+		}
+		if policy.AppCount > attached[policy.ID] {
+			engine.log.Debug("managed access policy still attached to other apps; keeping", "policy", policy.Name)
+			continue
+		}
+		engine.reportDrift(driftOrphanedPolicy, "policy", policy.Name, "id", policy.ID)
+		engine.log.Warn("managed access policy no longer desired; deleting", "policy", policy.Name)
+		if engine.dryRun {
+			engine.recordChange(model.ResourceAccessPolicy, model.ActionDeleted, policy.Name)
+			continue
+		}
+		if err := engine.api.DeleteAccessPolicy(ctx, policy.ID); err != nil {
+			engine.log.Error("failed to delete access policy", "policy", policy.Name, "error", err)
+			failures = append(failures, fmt.Errorf("delete access policy %s: %w", policy.Name, err))
+			continue
+		}
+		engine.recordChange(model.ResourceAccessPolicy, model.ActionDeleted, policy.Name)
+	}
+	return errors.Join(failures...)
+}
+
+func (engine *Engine) managedPolicyName(name string) string {
+	return name + engine.policySuffix
+}
+
+// policyName returns the name an existing policy is updated to. Only policies
+// the controller created carry the name marker, so adopted and referenced
+// policies are never picked up by orphan cleanup.
+func (engine *Engine) policyName(spec model.AccessPolicySpec, record cloudflare.AccessPolicyRecord) string {
+	if strings.HasSuffix(record.Name, engine.policySuffix) {
+		return engine.managedPolicyName(spec.Name)
 	}
+	return spec.Name
 }
 
 type accessAppKey struct {
@@ -375,21 +1210,38 @@ type accessAppKey struct {
 	Domain string
 }
 
-func policyNeedsUpdate(spec model.AccessPolicySpec, record cloudflare.AccessPolicyRecord) bool {
+// policyDifferences lists the policy fields that differ from the spec.
+func policyDifferences(spec model.AccessPolicySpec, record cloudflare.AccessPolicyRecord) []string {
+	differences := []string{}
 	if strings.ToLower(record.Action) != strings.ToLower(spec.Action) {
-		return true
+		differences = append(differences, "decision")
 	}
-	desired := normalizeRules(spec.IncludeEmails, spec.IncludeIPs)
-	current := normalizeRuleList(record.Include)
-	if len(desired) != len(current) {
-		return true
+	if !stringListsEqual(normalizeRules(spec), normalizeRuleList(record.Include)) {
+		differences = append(differences, "include")
 	}
-	for i := range desired {
-		if desired[i] != current[i] {
-			return true
+	if !stringListsEqual(normalizeRequireRules(spec), normalizeRuleList(record.Require)) {
+		differences = append(differences, "require")
+	}
+	return differences
+}
+
+func normalizeRequireRules(spec model.AccessPolicySpec) []string {
+	if spec.RequireAuthMethod == "" {
+		return []string{}
+	}
+	return []string{"auth_method:" + strings.ToLower(strings.TrimSpace(spec.RequireAuthMethod))}
+}
+
+func stringListsEqual(left []string, right []string) bool {
+	if len(left) != len(right) {
+		return false
+	}
+	for i := range left {
+		if left[i] != right[i] {
+			return false
 		}
 	}
-	return false
+	return true
 }
 
 func policyLabel(spec model.AccessPolicySpec) string {
@@ -402,14 +1254,38 @@ func policyLabel(spec model.AccessPolicySpec) string {
 	return "unknown"
 }
 
-func normalizeRules(emails []string, ips []string) []string {
-	result := make([]string, 0, len(emails)+len(ips))
-	for _, email := range emails {
+func normalizeRules(spec model.AccessPolicySpec) []string {
+	result := make([]string, 0, len(spec.IncludeEmails)+len(spec.IncludeEmailDomains)+len(spec.IncludeIPs)+len(spec.IncludeGroups)+len(spec.IncludeCountries)+len(spec.IncludeServiceTokens))
+	for _, email := range spec.IncludeEmails {
 		result = append(result, "email:"+strings.ToLower(strings.TrimSpace(email)))
 	}
-	for _, ip := range ips {
+	for _, domain := range spec.IncludeEmailDomains {
+		result = append(result, "email_domain:"+strings.ToLower(strings.TrimSpace(domain)))
+	}
+	for _, ip := range spec.IncludeIPs {
 		result = append(result, "ip:"+strings.ToLower(strings.TrimSpace(ip)))
 	}
+	for _, group := range spec.IncludeGroups {
+		result = append(result, "group:"+strings.TrimSpace(group))
+	}
+	for _, country := range spec.IncludeCountries {
+		result = append(result, "geo:"+strings.ToUpper(strings.TrimSpace(country)))
+	}
+	for _, token := range spec.IncludeServiceTokens {
+		result = append(result, "service_token:"+strings.TrimSpace(token))
+	}
+	if spec.IncludeAnyServiceToken {
+		result = append(result, "any_valid_service_token")
+	}
+	for _, commonName := range spec.IncludeCommonNames {
+		result = append(result, "common_name:"+strings.TrimSpace(commonName))
+	}
+	if spec.IncludeCertificate {
+		result = append(result, "certificate")
+	}
+	if spec.IncludeEveryone {
+		result = append(result, "everyone")
+	}
 	sort.Strings(result)
 	return result
 }
@@ -420,9 +1296,36 @@ func normalizeRuleList(rules []cloudflare.AccessRule) []string {
 		if rule.Email != "" {
 			result = append(result, "email:"+strings.ToLower(rule.Email))
 		}
+		if rule.EmailDomain != "" {
+			result = append(result, "email_domain:"+strings.ToLower(rule.EmailDomain))
+		}
 		if rule.IP != "" {
 			result = append(result, "ip:"+strings.ToLower(rule.IP))
 		}
+		if rule.Group != "" {
+			result = append(result, "group:"+rule.Group)
+		}
+		if rule.Country != "" {
+			result = append(result, "geo:"+strings.ToUpper(rule.Country))
+		}
+		if rule.ServiceToken != "" {
+			result = append(result, "service_token:"+rule.ServiceToken)
+		}
+		if rule.AnyServiceToken {
+			result = append(result, "any_valid_service_token")
+		}
+		if rule.CommonName != "" {
+			result = append(result, "common_name:"+rule.CommonName)
+		}
+		if rule.Certificate {
+			result = append(result, "certificate")
+		}
+		if rule.Everyone {
+			result = append(result, "everyone")
+		}
+		if rule.AuthMethod != "" {
+			result = append(result, "auth_method:"+strings.ToLower(rule.AuthMethod))
+		}
 	}
 	sort.Strings(result)
 	return result
@@ -459,24 +1362,18 @@ func hasManagedTag(tags []string, managedTag string) bool {
 }
 
 func policyRefsEqual(left []cloudflare.AccessPolicyRef, right []cloudflare.AccessPolicyRef) bool {
-	if len(left) != len(right) {
-		return false
-	}
-	leftKeys := normalizePolicyRefs(left)
-	rightKeys := normalizePolicyRefs(right)
-	for i := range leftKeys {
-		if leftKeys[i] != rightKeys[i] {
-			return false
-		}
-	}
-	return true
+	return slices.Equal(normalizePolicyRefs(left), normalizePolicyRefs(right))
 }
 
+// normalizePolicyRefs returns "id@precedence" keys ordered by precedence, and
+// by ID for equal precedences, so refs collected in a different order compare
+// equal while a changed precedence does not.
 func normalizePolicyRefs(refs []cloudflare.AccessPolicyRef) []string {
-	ordered := make([]struct {
+	type orderedRef struct {
 		ID    string
 		Order int
-	}, 0, len(refs))
+	}
+	ordered := make([]orderedRef, 0, len(refs))
 	for index, ref := range refs {
 		if ref.ID == "" {
 			continue
@@ -485,20 +1382,20 @@ func normalizePolicyRefs(refs []cloudflare.AccessPolicyRef) []string {
 		if order == 0 {
 			order = index + 1
 		}
-		ordered = append(ordered, struct {
-			ID    string
-			Order int
-		}{ID: ref.ID, Order: order})
+		ordered = append(ordered, orderedRef{ID: ref.ID, Order: order})
 	}
 	if len(ordered) == 0 {
 		return nil
 	}
-	sort.SliceStable(ordered, func(i, j int) bool {
-		return ordered[i].Order < ordered[j].Order
+	sort.Slice(ordered, func(i, j int) bool {
+		if ordered[i].Order != ordered[j].Order {
+			return ordered[i].Order < ordered[j].Order
+		}
+		return ordered[i].ID < ordered[j].ID
 	})
 	result := make([]string, 0, len(ordered))
 	for _, item := range ordered {
-		result = append(result, item.ID)
+		result = append(result, fmt.Sprintf("%s@%d", item.ID, item.Order))
 	}
 	return result
 }
@@ -1,8 +1,12 @@
 package access
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"log/slog"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/cloudflare"
@@ -14,7 +18,7 @@ const testManagedBy = "test-managed"
 func TestEnsurePoliciesIDOnlyReference(t *testing.T) {
 	api := &stubAccessAPI{}
 	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
-	engine := NewEngine(api, logger, false, true, testManagedBy)
+	engine := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy})
 
 	app := model.AccessAppSpec{
 		Name: "app",
@@ -23,7 +27,10 @@ func TestEnsurePoliciesIDOnlyReference(t *testing.T) {
 		},
 	}
 
-	refs, ok := engine.ensurePolicies(context.Background(), app, map[string]cloudflare.AccessPolicyRecord{}, map[string][]cloudflare.AccessPolicyRecord{})
+	refs, ok, err := engine.ensurePolicies(context.Background(), app, map[string]cloudflare.AccessPolicyRecord{}, map[string][]cloudflare.AccessPolicyRecord{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
 	if !ok {
 		t.Fatalf("expected ok to be true")
 	}
@@ -35,10 +42,43 @@ func TestEnsurePoliciesIDOnlyReference(t *testing.T) {
 	}
 }
 
+func TestEnsurePoliciesUsesExplicitPrecedence(t *testing.T) {
+	api := &stubAccessAPI{}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy})
+
+	app := model.AccessAppSpec{
+		Name: "app",
+		Policies: []model.AccessPolicySpec{
+			{ID: "policy-b", Managed: false},
+			{ID: "policy-a", Precedence: 1, Managed: false},
+			{ID: "policy-c", Managed: false},
+		},
+	}
+
+	refs, _, err := engine.ensurePolicies(context.Background(), app, map[string]cloudflare.AccessPolicyRecord{}, map[string][]cloudflare.AccessPolicyRecord{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []cloudflare.AccessPolicyRef{{ID: "policy-b", Precedence: 2}, {ID: "policy-a", Precedence: 1}, {ID: "policy-c", Precedence: 3}}
+	if !slices.Equal(refs, want) {
+		t.Fatalf("expected explicit precedence kept and label order filling the gaps, got %+v", refs)
+	}
+
+	reordered := []cloudflare.AccessPolicyRef{want[2], want[0], want[1]}
+	if !policyRefsEqual(reordered, refs) {
+		t.Fatalf("expected refs in a different order to compare equal")
+	}
+	changed := []cloudflare.AccessPolicyRef{{ID: "policy-a", Precedence: 10}, want[0], want[2]}
+	if policyRefsEqual(changed, refs) {
+		t.Fatalf("expected a changed precedence to require an update")
+	}
+}
+
 func TestEnsurePoliciesNameOnlyReference(t *testing.T) {
 	api := &stubAccessAPI{}
 	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
-	engine := NewEngine(api, logger, false, true, testManagedBy)
+	engine := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy})
 
 	app := model.AccessAppSpec{
 		Name: "app",
@@ -50,7 +90,10 @@ func TestEnsurePoliciesNameOnlyReference(t *testing.T) {
 		"existing": []cloudflare.AccessPolicyRecord{{ID: "policy-1", Name: "Existing"}},
 	}
 
-	refs, ok := engine.ensurePolicies(context.Background(), app, map[string]cloudflare.AccessPolicyRecord{}, policyByName)
+	refs, ok, err := engine.ensurePolicies(context.Background(), app, map[string]cloudflare.AccessPolicyRecord{}, policyByName)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
 	if !ok {
 		t.Fatalf("expected ok to be true")
 	}
@@ -65,7 +108,7 @@ func TestEnsurePoliciesNameOnlyReference(t *testing.T) {
 func TestEnsurePoliciesManagedMissingStops(t *testing.T) {
 	api := &stubAccessAPI{}
 	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
-	engine := NewEngine(api, logger, false, true, testManagedBy)
+	engine := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy})
 
 	app := model.AccessAppSpec{
 		Name: "app",
@@ -74,16 +117,49 @@ func TestEnsurePoliciesManagedMissingStops(t *testing.T) {
 		},
 	}
 
-	_, ok := engine.ensurePolicies(context.Background(), app, map[string]cloudflare.AccessPolicyRecord{}, map[string][]cloudflare.AccessPolicyRecord{})
+	_, ok, _ := engine.ensurePolicies(context.Background(), app, map[string]cloudflare.AccessPolicyRecord{}, map[string][]cloudflare.AccessPolicyRecord{})
 	if ok {
 		t.Fatalf("expected ok to be false when managed policy id is missing")
 	}
 }
 
+func TestEnsurePoliciesUpdatesPolicyManagedByID(t *testing.T) {
+	api := &stubAccessAPI{}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy})
+
+	app := model.AccessAppSpec{
+		Name: "app",
+		Policies: []model.AccessPolicySpec{
+			{ID: "policy-1", Action: "allow", IncludeEmails: []string{"new@example.com"}, Managed: true},
+		},
+	}
+	policyByID := map[string]cloudflare.AccessPolicyRecord{
+		"policy-1": {ID: "policy-1", Name: "renamed-in-dashboard", Action: "allow", Include: []cloudflare.AccessRule{{Email: "old@example.com"}}},
+	}
+
+	refs, ok, err := engine.ensurePolicies(context.Background(), app, policyByID, map[string][]cloudflare.AccessPolicyRecord{})
+	if err != nil || !ok {
+		t.Fatalf("unexpected result: ok=%v err=%v", ok, err)
+	}
+	if len(refs) != 1 || refs[0].ID != "policy-1" {
+		t.Fatalf("unexpected policy refs: %+v", refs)
+	}
+	if api.updatePolicyCalls != 1 {
+		t.Fatalf("expected the policy to be updated by id, got %d updates", api.updatePolicyCalls)
+	}
+	if want := "renamed-in-dashboard"; api.lastPolicyInput.Name != want {
+		t.Fatalf("expected the current name to be kept as %q, got %q", want, api.lastPolicyInput.Name)
+	}
+	if len(api.lastPolicyInput.Include) != 1 || api.lastPolicyInput.Include[0].Email != "new@example.com" {
+		t.Fatalf("expected the label rules to be written, got %+v", api.lastPolicyInput.Include)
+	}
+}
+
 func TestUpdatePolicyIfNeededDryRun(t *testing.T) {
 	api := &stubAccessAPI{}
 	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
-	engine := NewEngine(api, logger, true, true, testManagedBy)
+	engine := NewEngine(api, logger, Options{DryRun: true, Manage: true, ManagedBy: testManagedBy})
 
 	spec := model.AccessPolicySpec{
 		Name:          "policy",
@@ -110,7 +186,7 @@ func TestUpdatePolicyIfNeededDryRun(t *testing.T) {
 func TestReconcileSkipsCreateWhenManageDisabled(t *testing.T) {
 	api := &stubAccessAPI{}
 	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
-	engine := NewEngine(api, logger, false, false, testManagedBy)
+	engine := NewEngine(api, logger, Options{ManagedBy: testManagedBy})
 
 	apps := []model.AccessAppSpec{
 		{
@@ -122,7 +198,7 @@ func TestReconcileSkipsCreateWhenManageDisabled(t *testing.T) {
 		},
 	}
 
-	if err := engine.Reconcile(context.Background(), apps); err != nil {
+	if _, err := engine.Reconcile(context.Background(), apps); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	if api.createAppCalls != 0 {
@@ -130,6 +206,84 @@ func TestReconcileSkipsCreateWhenManageDisabled(t *testing.T) {
 	}
 }
 
+func TestReconcileWarnsWhenRecreatedAppGetsNewAUD(t *testing.T) {
+	api := &stubAccessAPI{
+		listApps: []cloudflare.AccessAppRecord{
+			{ID: "app-1", AUD: "aud-old", Name: "app", Domain: "app.example.com", Type: "self_hosted", Policies: []cloudflare.AccessPolicyRef{{ID: "policy-1", Precedence: 1}}},
+		},
+		createAppAUD: "aud-new",
+	}
+	var output bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&output, nil))
+	engine := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy})
+
+	apps := []model.AccessAppSpec{
+		{
+			Name:   "app",
+			Domain: "app.example.com",
+			Policies: []model.AccessPolicySpec{
+				{ID: "policy-1", Managed: false},
+			},
+		},
+	}
+	for cycle := 0; cycle < 2; cycle++ {
+		if _, err := engine.Reconcile(context.Background(), apps); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if strings.Contains(output.String(), "recreated") {
+		t.Fatalf("expected no warning for an existing app, got:\n%s", output.String())
+	}
+	if strings.Count(output.String(), `level=INFO msg="found access app" app=app id=app-1 aud=aud-old`) != 1 {
+		t.Fatalf("expected the AUD of an existing app to be logged at Info once, got:\n%s", output.String())
+	}
+
+	// The app was deleted in the dashboard, so the next sync recreates it.
+	api.listApps = nil
+	if _, err := engine.Reconcile(context.Background(), apps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	logs := output.String()
+	if !strings.Contains(logs, `msg="created access app" app=app id=created aud=aud-new`) {
+		t.Fatalf("expected the new AUD to be logged on create, got:\n%s", logs)
+	}
+	if !strings.Contains(logs, `msg="access app was recreated with a new AUD; update the JWT audience its backends validate" app=app previous_aud=aud-old aud=aud-new`) {
+		t.Fatalf("expected a warning naming both AUDs, got:\n%s", logs)
+	}
+}
+
+func TestReconcileCreatesBookmarkAppWithoutPolicies(t *testing.T) {
+	api := &stubAccessAPI{}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy})
+
+	apps := []model.AccessAppSpec{
+		{
+			Name:   "docs",
+			Domain: "https://docs.example.com",
+			Type:   "bookmark",
+		},
+	}
+
+	result, err := engine.Reconcile(context.Background(), apps)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.createAppCalls != 1 || api.createPolicyCalls != 0 {
+		t.Fatalf("expected one app and no policies, got %d apps and %d policies", api.createAppCalls, api.createPolicyCalls)
+	}
+	if result.Count(model.ResourceAccessApp, model.ActionCreated) != 1 || len(result.Changes) != 1 {
+		t.Fatalf("expected one created app in the result, got %+v", result.Changes)
+	}
+	input := api.lastAppInput
+	if input.Type != "bookmark" || input.Domain != "https://docs.example.com" || len(input.Policies) != 0 {
+		t.Fatalf("unexpected bookmark input: %+v", input)
+	}
+	if !hasManagedTag(input.Tags, engine.managedTag) {
+		t.Fatalf("expected managed tag on bookmark app, got %v", input.Tags)
+	}
+}
+
 func TestReconcileEnsuresAccessTags(t *testing.T) {
 	api := &stubAccessAPI{
 		listApps: []cloudflare.AccessAppRecord{
@@ -137,7 +291,7 @@ func TestReconcileEnsuresAccessTags(t *testing.T) {
 		},
 	}
 	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
-	engine := NewEngine(api, logger, false, true, testManagedBy)
+	engine := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy})
 
 	apps := []model.AccessAppSpec{
 		{
@@ -151,7 +305,7 @@ func TestReconcileEnsuresAccessTags(t *testing.T) {
 		},
 	}
 
-	if err := engine.Reconcile(context.Background(), apps); err != nil {
+	if _, err := engine.Reconcile(context.Background(), apps); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
@@ -164,7 +318,7 @@ func TestReconcileEnsuresAccessTags(t *testing.T) {
 func TestBuildAppInputUsesExplicitTags(t *testing.T) {
 	api := &stubAccessAPI{}
 	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
-	engine := NewEngine(api, logger, false, true, testManagedBy)
+	engine := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy})
 
 	spec := model.AccessAppSpec{
 		Name:    "app",
@@ -180,74 +334,1108 @@ func TestBuildAppInputUsesExplicitTags(t *testing.T) {
 	}
 }
 
-func TestDeleteOrphanedAppsDeletesManaged(t *testing.T) {
+func TestAppDifferencesComparesLauncherVisibilityOnlyWhenSet(t *testing.T) {
 	api := &stubAccessAPI{}
 	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
-	engine := NewEngine(api, logger, false, true, testManagedBy)
+	engine := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy})
 
-	existing := []cloudflare.AccessAppRecord{
-		{ID: "app-1", Name: "app", Tags: []string{model.AccessManagedTag(testManagedBy)}},
+	record := cloudflare.AccessAppRecord{
+		ID:                 "app-1",
+		Name:               "app",
+		Domain:             "app.example.com",
+		Type:               "self_hosted",
+		AppLauncherVisible: true,
 	}
-	engine.deleteOrphanedApps(context.Background(), existing, map[string]struct{}{})
 
-	if api.deleteAppCalls != 1 {
-		t.Fatalf("expected 1 delete call, got %d", api.deleteAppCalls)
+	unset := engine.buildAppInput(model.AccessAppSpec{Name: "app", Domain: "app.example.com"}, nil, nil, false)
+	if len(engine.appDifferences(record, unset)) > 0 {
+		t.Fatalf("expected no update when app launcher visibility is unset")
+	}
+
+	hidden := false
+	input := engine.buildAppInput(model.AccessAppSpec{Name: "app", Domain: "app.example.com", AppLauncherVisible: &hidden}, nil, nil, false)
+	if len(engine.appDifferences(record, input)) == 0 {
+		t.Fatalf("expected update when app launcher visibility differs")
 	}
 }
 
-type testWriter struct {
-	t *testing.T
+func TestAppDifferencesDetectsTypeChange(t *testing.T) {
+	api := &stubAccessAPI{}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy})
+
+	record := cloudflare.AccessAppRecord{ID: "app-1", Name: "app", Domain: "app.example.com", Type: "self_hosted"}
+
+	unset := engine.buildAppInput(model.AccessAppSpec{Name: "app", Domain: "app.example.com"}, nil, nil, false)
+	if unset.Type != "self_hosted" {
+		t.Fatalf("expected default type self_hosted, got %q", unset.Type)
+	}
+	if len(engine.appDifferences(record, unset)) > 0 {
+		t.Fatalf("expected no update when type is unset")
+	}
+
+	ssh := engine.buildAppInput(model.AccessAppSpec{Name: "app", Domain: "app.example.com", Type: "ssh"}, nil, nil, false)
+	if len(engine.appDifferences(record, ssh)) == 0 {
+		t.Fatalf("expected update when type changes")
+	}
 }
 
-func (w testWriter) Write(p []byte) (n int, err error) {
-	w.t.Log(string(p))
-	return len(p), nil
+func TestReconcilePreservesUnsetLauncherSettingsOnUpdate(t *testing.T) {
+	api := &stubAccessAPI{
+		listApps: []cloudflare.AccessAppRecord{
+			{ID: "app-1", Name: "app", Domain: "app.example.com", Type: "self_hosted", AppLauncherVisible: false, LogoURL: "https://example.com/old.png", AutoRedirect: true, SkipInterstitial: true, HTTPOnlyCookie: true, SameSiteCookie: "strict"},
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy})
+
+	apps := []model.AccessAppSpec{
+		{
+			Name:   "app",
+			Domain: "app.example.com",
+			Policies: []model.AccessPolicySpec{
+				{ID: "policy-1", Managed: false},
+			},
+		},
+	}
+
+	if _, err := engine.Reconcile(context.Background(), apps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.updateAppCalls != 1 {
+		t.Fatalf("expected 1 app update, got %d", api.updateAppCalls)
+	}
+	input := api.lastAppInput
+	if input.AutoRedirect == nil || !*input.AutoRedirect {
+		t.Fatalf("expected existing auto redirect to be preserved, got %+v", input.AutoRedirect)
+	}
+	if input.SkipInterstitial == nil || !*input.SkipInterstitial || input.HTTPOnlyCookie == nil || !*input.HTTPOnlyCookie {
+		t.Fatalf("expected existing cookie settings to be preserved, got %+v", input)
+	}
+	if input.SameSiteCookie == nil || *input.SameSiteCookie != "strict" {
+		t.Fatalf("expected existing same-site cookie to be preserved, got %+v", input.SameSiteCookie)
+	}
+	if input.AppLauncherVisible == nil || *input.AppLauncherVisible {
+		t.Fatalf("expected existing app launcher visibility to be preserved, got %+v", input.AppLauncherVisible)
+	}
+	if input.LogoURL == nil || *input.LogoURL != "https://example.com/old.png" {
+		t.Fatalf("expected existing logo URL to be preserved, got %+v", input.LogoURL)
+	}
 }
 
-type stubAccessAPI struct {
-	listApps          []cloudflare.AccessAppRecord
-	listPolicies      []cloudflare.AccessPolicyRecord
-	createAppCalls    int
-	updateAppCalls    int
-	deleteAppCalls    int
-	createPolicyCalls int
-	updatePolicyCalls int
-	ensureTagCalls    int
-	ensureTagNames    []string
-	ensureTagErrors   map[string]error
+func TestReconcileResolvesAllowedIdentityProviders(t *testing.T) {
+	api := &stubAccessAPI{
+		identityProviders: []cloudflare.IdentityProvider{
+			{ID: "idp-google", Name: "Google", Type: "google"},
+			{ID: "idp-github", Name: "GitHub", Type: "github"},
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy})
+
+	apps := []model.AccessAppSpec{
+		{
+			Name:        "app",
+			Domain:      "app.example.com",
+			AllowedIdPs: []string{"google", "idp-github"},
+			Policies: []model.AccessPolicySpec{
+				{ID: "policy-1", Managed: false},
+			},
+		},
+	}
+
+	if _, err := engine.Reconcile(context.Background(), apps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.listIdPCalls != 1 {
+		t.Fatalf("expected identity providers to be listed once, got %d", api.listIdPCalls)
+	}
+	if api.createAppCalls != 1 {
+		t.Fatalf("expected 1 app create, got %d", api.createAppCalls)
+	}
+	if !stringSetsEqual(api.lastAppInput.AllowedIdPs, []string{"idp-google", "idp-github"}) {
+		t.Fatalf("unexpected allowed IdPs: %+v", api.lastAppInput.AllowedIdPs)
+	}
 }
 
-func (api *stubAccessAPI) ListAccessApps(ctx context.Context) ([]cloudflare.AccessAppRecord, error) {
-	return api.listApps, nil
+func TestReconcileResolvesCustomPages(t *testing.T) {
+	api := &stubAccessAPI{
+		customPages: []cloudflare.CustomPage{
+			{ID: "page-denied", Name: "Branded denied", Type: "identity_denied"},
+			{ID: "page-forbidden", Name: "Forbidden", Type: "forbidden"},
+			{ID: "page-dup-1", Name: "Duplicate"},
+			{ID: "page-dup-2", Name: "duplicate"},
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy})
+
+	apps := []model.AccessAppSpec{
+		{
+			Name:        "app",
+			Domain:      "app.example.com",
+			CustomPages: []string{"branded denied", "page-forbidden"},
+			Policies:    []model.AccessPolicySpec{{ID: "policy-1"}},
+		},
+		{
+			Name:        "ambiguous",
+			Domain:      "ambiguous.example.com",
+			CustomPages: []string{"Duplicate"},
+			Policies:    []model.AccessPolicySpec{{ID: "policy-1"}},
+		},
+	}
+
+	if _, err := engine.Reconcile(context.Background(), apps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.listPageCalls != 1 {
+		t.Fatalf("expected custom pages to be listed once, got %d", api.listPageCalls)
+	}
+	if api.createAppCalls != 1 {
+		t.Fatalf("expected only the resolvable app to be created, got %d", api.createAppCalls)
+	}
+	if !stringSetsEqual(api.lastAppInput.CustomPages, []string{"page-denied", "page-forbidden"}) {
+		t.Fatalf("unexpected custom pages: %+v", api.lastAppInput.CustomPages)
+	}
+
+	record := cloudflare.AccessAppRecord{Name: "app", Domain: "app.example.com", Type: "self_hosted", CustomPages: []string{"page-forbidden", "page-denied"}}
+	input := cloudflare.AccessAppInput{Name: "app", Domain: "app.example.com", Type: "self_hosted"}
+	if len(engine.appDifferences(record, input)) > 0 {
+		t.Fatalf("expected no update when custom pages are unset")
+	}
+	input.CustomPages = []string{"page-denied", "page-forbidden"}
+	if len(engine.appDifferences(record, input)) > 0 {
+		t.Fatalf("expected custom pages to be compared as a set")
+	}
+	input.CustomPages = []string{"page-denied"}
+	if len(engine.appDifferences(record, input)) == 0 {
+		t.Fatalf("expected update when custom pages differ")
+	}
 }
 
-func (api *stubAccessAPI) CreateAccessApp(ctx context.Context, input cloudflare.AccessAppInput) (cloudflare.AccessAppRecord, error) {
-	api.createAppCalls++
-	return cloudflare.AccessAppRecord{ID: "created", Name: input.Name, Domain: input.Domain, Policies: input.Policies, Tags: input.Tags}, nil
+func TestAppDifferencesComparesCORSOnlyWhenSet(t *testing.T) {
+	engine := NewEngine(nil, slog.New(slog.NewTextHandler(testWriter{t}, nil)), Options{Manage: true, ManagedBy: testManagedBy})
+	record := cloudflare.AccessAppRecord{
+		Name:   "app",
+		Domain: "app.example.com",
+		Type:   "self_hosted",
+		CORS:   &cloudflare.AccessCORS{AllowedOrigins: []string{"https://a.example.com", "https://b.example.com"}, AllowAllMethods: true, AllowAllHeaders: true},
+	}
+
+	input := engine.buildAppInput(model.AccessAppSpec{Name: "app", Domain: "app.example.com"}, nil, nil, false)
+	if len(engine.appDifferences(record, input)) > 0 {
+		t.Fatalf("expected no update when CORS is unset")
+	}
+	preserveUnsetAppSettings(&input, record)
+	if input.CORS != record.CORS {
+		t.Fatalf("expected existing CORS settings to be preserved, got %+v", input.CORS)
+	}
+
+	spec := model.AccessAppSpec{
+		Name:   "app",
+		Domain: "app.example.com",
+		CORS:   &model.AccessCORSSpec{AllowedOrigins: []string{"https://b.example.com", "https://a.example.com"}, AllowAllMethods: true, AllowAllHeaders: true},
+	}
+	if len(engine.appDifferences(record, engine.buildAppInput(spec, nil, nil, false))) > 0 {
+		t.Fatalf("expected CORS origins to be compared as a set")
+	}
+	spec.CORS.AllowCredentials = true
+	if len(engine.appDifferences(record, engine.buildAppInput(spec, nil, nil, false))) == 0 {
+		t.Fatalf("expected update when CORS settings differ")
+	}
 }
 
-func (api *stubAccessAPI) UpdateAccessApp(ctx context.Context, id string, input cloudflare.AccessAppInput) (cloudflare.AccessAppRecord, error) {
-	api.updateAppCalls++
-	return cloudflare.AccessAppRecord{ID: id, Name: input.Name, Domain: input.Domain, Policies: input.Policies, Tags: input.Tags}, nil
+func TestReconcileSkipsAppWithUnresolvedIdentityProvider(t *testing.T) {
+	api := &stubAccessAPI{
+		identityProviders: []cloudflare.IdentityProvider{
+			{ID: "idp-1", Name: "Okta"},
+			{ID: "idp-2", Name: "okta"},
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy})
+
+	apps := []model.AccessAppSpec{
+		{Name: "missing", Domain: "missing.example.com", AllowedIdPs: []string{"Azure"}},
+		{Name: "ambiguous", Domain: "ambiguous.example.com", AllowedIdPs: []string{"Okta"}},
+	}
+
+	if _, err := engine.Reconcile(context.Background(), apps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.createAppCalls != 0 {
+		t.Fatalf("expected apps with unresolved IdPs to be skipped, got %d create calls", api.createAppCalls)
+	}
 }
 
-func (api *stubAccessAPI) DeleteAccessApp(ctx context.Context, id string) error {
-	api.deleteAppCalls++
-	return nil
+func TestAppDifferencesComparesAllowedIdPsOnlyWhenSet(t *testing.T) {
+	engine := NewEngine(nil, slog.New(slog.NewTextHandler(testWriter{t}, nil)), Options{Manage: true, ManagedBy: testManagedBy})
+	record := cloudflare.AccessAppRecord{Name: "app", Domain: "app.example.com", Type: "self_hosted", AllowedIdPs: []string{"idp-1"}}
+
+	unset := cloudflare.AccessAppInput{Name: "app", Domain: "app.example.com", Type: "self_hosted"}
+	if len(engine.appDifferences(record, unset)) > 0 {
+		t.Fatalf("expected no update when allowed IdPs are unset")
+	}
+	changed := unset
+	changed.AllowedIdPs = []string{"idp-1", "idp-2"}
+	if len(engine.appDifferences(record, changed)) == 0 {
+		t.Fatalf("expected update when allowed IdPs differ")
+	}
 }
 
-func (api *stubAccessAPI) ListAccessPolicies(ctx context.Context) ([]cloudflare.AccessPolicyRecord, error) {
-	return api.listPolicies, nil
+func TestAppDifferencesComparesDenySettingsOnlyWhenSet(t *testing.T) {
+	engine := NewEngine(nil, slog.New(slog.NewTextHandler(testWriter{t}, nil)), Options{Manage: true, ManagedBy: testManagedBy})
+	record := cloudflare.AccessAppRecord{Name: "app", Domain: "app.example.com", Type: "self_hosted", DenyMessage: "Denied", DenyURL: "https://example.com/denied"}
+
+	unset := cloudflare.AccessAppInput{Name: "app", Domain: "app.example.com", Type: "self_hosted"}
+	if len(engine.appDifferences(record, unset)) > 0 {
+		t.Fatalf("expected no update when deny settings are unset")
+	}
+	message := "Ask the compliance team"
+	changedMessage := unset
+	changedMessage.DenyMessage = &message
+	if len(engine.appDifferences(record, changedMessage)) == 0 {
+		t.Fatalf("expected update when deny message differs")
+	}
+	denyURL := "https://example.com/other"
+	changedURL := unset
+	changedURL.DenyURL = &denyURL
+	if len(engine.appDifferences(record, changedURL)) == 0 {
+		t.Fatalf("expected update when deny URL differs")
+	}
 }
 
-func (api *stubAccessAPI) CreateAccessPolicy(ctx context.Context, input cloudflare.AccessPolicyInput) (cloudflare.AccessPolicyRecord, error) {
-	api.createPolicyCalls++
-	return cloudflare.AccessPolicyRecord{ID: "policy", Name: input.Name, Action: input.Action, Include: input.Include}, nil
+func TestAppDifferencesComparesAutoRedirectOnlyWhenSet(t *testing.T) {
+	engine := NewEngine(nil, slog.New(slog.NewTextHandler(testWriter{t}, nil)), Options{Manage: true, ManagedBy: testManagedBy})
+	record := cloudflare.AccessAppRecord{Name: "app", Domain: "app.example.com", Type: "self_hosted", AutoRedirect: true}
+
+	unset := cloudflare.AccessAppInput{Name: "app", Domain: "app.example.com", Type: "self_hosted"}
+	if len(engine.appDifferences(record, unset)) > 0 {
+		t.Fatalf("expected no update when auto redirect is unset")
+	}
+	disabled := false
+	changed := unset
+	changed.AutoRedirect = &disabled
+	if len(engine.appDifferences(record, changed)) == 0 {
+		t.Fatalf("expected update when auto redirect differs")
+	}
 }
 
-func (api *stubAccessAPI) UpdateAccessPolicy(ctx context.Context, id string, input cloudflare.AccessPolicyInput) (cloudflare.AccessPolicyRecord, error) {
-	api.updatePolicyCalls++
-	return cloudflare.AccessPolicyRecord{ID: id, Name: input.Name, Action: input.Action, Include: input.Include}, nil
+func TestAppDifferencesComparesCookieSettingsOnlyWhenSet(t *testing.T) {
+	engine := NewEngine(nil, slog.New(slog.NewTextHandler(testWriter{t}, nil)), Options{Manage: true, ManagedBy: testManagedBy})
+	record := cloudflare.AccessAppRecord{Name: "app", Domain: "app.example.com", Type: "self_hosted", SkipInterstitial: true, HTTPOnlyCookie: true, SameSiteCookie: "lax"}
+
+	unset := cloudflare.AccessAppInput{Name: "app", Domain: "app.example.com", Type: "self_hosted"}
+	if len(engine.appDifferences(record, unset)) > 0 {
+		t.Fatalf("expected no update when cookie settings are unset")
+	}
+	enabled := true
+	sameSite := "lax"
+	unchanged := unset
+	unchanged.SkipInterstitial = &enabled
+	unchanged.HTTPOnlyCookie = &enabled
+	unchanged.SameSiteCookie = &sameSite
+	if len(engine.appDifferences(record, unchanged)) > 0 {
+		t.Fatalf("expected no update when cookie settings match")
+	}
+	strict := "strict"
+	changed := unchanged
+	changed.SameSiteCookie = &strict
+	if len(engine.appDifferences(record, changed)) == 0 {
+		t.Fatalf("expected update when same-site cookie differs")
+	}
+	skipLauncher := unchanged
+	skipLauncher.SkipLauncherLogin = &enabled
+	if len(engine.appDifferences(record, skipLauncher)) == 0 {
+		t.Fatalf("expected update when skip app launcher login differs")
+	}
+}
+
+func TestReconcileCarriesIsolationRequiredThroughCreateAndUpdate(t *testing.T) {
+	api := &stubAccessAPI{}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy})
+	required := true
+	apps := []model.AccessAppSpec{
+		{
+			Name:              "internal",
+			Domain:            "internal.example.com",
+			IsolationRequired: &required,
+			Policies:          []model.AccessPolicySpec{{ID: "policy-1", Managed: false}},
+		},
+	}
+
+	if _, err := engine.Reconcile(context.Background(), apps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.createAppCalls != 1 || api.lastAppInput.IsolationRequired == nil || !*api.lastAppInput.IsolationRequired {
+		t.Fatalf("expected the app to be created with isolation required, got %d creates and %+v", api.createAppCalls, api.lastAppInput.IsolationRequired)
+	}
+
+	api.listApps = []cloudflare.AccessAppRecord{
+		{ID: "app-1", Name: "internal", Domain: "internal.example.com", Type: "self_hosted", Tags: []string{model.AccessManagedTag(testManagedBy)}, Policies: []cloudflare.AccessPolicyRef{{ID: "policy-1", Precedence: 1}}},
+	}
+	if _, err := engine.Reconcile(context.Background(), apps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.updateAppCalls != 1 || api.lastAppInput.IsolationRequired == nil || !*api.lastAppInput.IsolationRequired {
+		t.Fatalf("expected the app to be updated to require isolation, got %d updates and %+v", api.updateAppCalls, api.lastAppInput.IsolationRequired)
+	}
+
+	api.listApps[0].IsolationRequired = true
+	if _, err := engine.Reconcile(context.Background(), apps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.updateAppCalls != 1 {
+		t.Fatalf("expected no update once isolation matches, got %d updates", api.updateAppCalls)
+	}
+
+	apps[0].IsolationRequired = nil
+	apps[0].SkipInterstitial = &required
+	if _, err := engine.Reconcile(context.Background(), apps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.lastAppInput.IsolationRequired == nil || !*api.lastAppInput.IsolationRequired {
+		t.Fatalf("expected isolation to keep its current value when the label is unset, got %+v", api.lastAppInput.IsolationRequired)
+	}
+}
+
+func TestReconcileClearsRemovedDenySettingsOnManagedApps(t *testing.T) {
+	api := &stubAccessAPI{
+		listApps: []cloudflare.AccessAppRecord{
+			{ID: "app-1", Name: "managed", Domain: "managed.example.com", Type: "self_hosted", Tags: []string{model.AccessManagedTag(testManagedBy)}, Policies: []cloudflare.AccessPolicyRef{{ID: "policy-1", Precedence: 1}}, DenyMessage: "Denied", DenyURL: "https://example.com/denied"},
+			{ID: "app-2", Name: "adopted", Domain: "adopted.example.com", Type: "self_hosted", Policies: []cloudflare.AccessPolicyRef{{ID: "policy-1", Precedence: 1}}, DenyMessage: "Denied"},
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy})
+
+	message, denyURL := "Denied", "https://example.com/denied"
+	labelled := []model.AccessAppSpec{
+		{Name: "managed", Domain: "managed.example.com", DenyMessage: &message, DenyURL: &denyURL, Policies: []model.AccessPolicySpec{{ID: "policy-1"}}},
+	}
+	if _, err := engine.Reconcile(context.Background(), labelled); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.updateAppCalls != 0 {
+		t.Fatalf("expected managed app to be up-to-date, got %d updates", api.updateAppCalls)
+	}
+
+	apps := []model.AccessAppSpec{
+		{Name: "managed", Domain: "managed.example.com", Policies: []model.AccessPolicySpec{{ID: "policy-1"}}},
+	}
+	if _, err := engine.Reconcile(context.Background(), apps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.updateAppCalls != 1 {
+		t.Fatalf("expected managed app to be updated, got %d updates", api.updateAppCalls)
+	}
+	input := api.lastAppInput
+	if input.DenyMessage == nil || *input.DenyMessage != "" || input.DenyURL == nil || *input.DenyURL != "" {
+		t.Fatalf("expected deny settings to be cleared, got message=%+v url=%+v", input.DenyMessage, input.DenyURL)
+	}
+
+	api.updateAppCalls = 0
+	adopted := []model.AccessAppSpec{
+		{Name: "adopted", Domain: "adopted.example.com", Policies: []model.AccessPolicySpec{{ID: "policy-1"}}},
+	}
+	if _, err := engine.Reconcile(context.Background(), adopted); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.updateAppCalls != 1 {
+		t.Fatalf("expected adopted app to be updated for the managed tag, got %d updates", api.updateAppCalls)
+	}
+	if api.lastAppInput.DenyMessage == nil || *api.lastAppInput.DenyMessage != "Denied" {
+		t.Fatalf("expected adopted app deny message to be preserved, got %+v", api.lastAppInput.DenyMessage)
+	}
+}
+
+func TestReconcileKeepsDashboardDenySettingsOnAdoptedApps(t *testing.T) {
+	api := &stubAccessAPI{
+		listApps: []cloudflare.AccessAppRecord{
+			{ID: "app-1", Name: "adopted", Domain: "adopted.example.com", Type: "self_hosted", Policies: []cloudflare.AccessPolicyRef{{ID: "policy-1", Precedence: 1}}, DenyURL: "https://example.com/denied"},
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy})
+
+	apps := []model.AccessAppSpec{
+		{Name: "adopted", Domain: "adopted.example.com", Policies: []model.AccessPolicySpec{{ID: "policy-1"}}},
+	}
+	if _, err := engine.Reconcile(context.Background(), apps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.updateAppCalls != 1 {
+		t.Fatalf("expected adopted app to be updated for the managed tag, got %d updates", api.updateAppCalls)
+	}
+	// The second cycle sees the app with the managed tag.
+	api.listApps[0].Tags = []string{model.AccessManagedTag(testManagedBy)}
+	api.updateAppCalls = 0
+	if _, err := engine.Reconcile(context.Background(), apps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.updateAppCalls != 0 {
+		t.Fatalf("expected adopted app to keep its dashboard deny URL, got %d updates with url=%+v", api.updateAppCalls, api.lastAppInput.DenyURL)
+	}
+}
+
+func TestReconcileTagsAdoptedAppForOrphanCleanup(t *testing.T) {
+	api := &stubAccessAPI{
+		listApps: []cloudflare.AccessAppRecord{
+			{ID: "app-1", Name: "legacy", Domain: "legacy.example.com", Type: "self_hosted", Tags: []string{"team"}, Policies: []cloudflare.AccessPolicyRef{{ID: "policy-1", Precedence: 1}}},
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy})
+	apps := []model.AccessAppSpec{
+		{Name: "legacy", Domain: "legacy.example.com", Policies: []model.AccessPolicySpec{{ID: "policy-1"}}},
+	}
+
+	if _, err := engine.Reconcile(context.Background(), apps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.updateAppCalls != 1 {
+		t.Fatalf("expected the untagged app to be updated, got %d updates", api.updateAppCalls)
+	}
+	tags := api.lastAppInput.Tags
+	if !hasManagedTag(tags, engine.managedTag) || !slices.Contains(tags, "team") {
+		t.Fatalf("expected the managed tag to be added next to the existing tags, got %v", tags)
+	}
+
+	api.listApps[0].Tags = tags
+	if _, err := engine.Reconcile(context.Background(), nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.deleteAppCalls != 1 {
+		t.Fatalf("expected the adopted app to be deleted once its labels are gone, got %d deletes", api.deleteAppCalls)
+	}
+}
+
+func TestReconcileResolvesIncludeGroups(t *testing.T) {
+	api := &stubAccessAPI{
+		accessGroups: []cloudflare.AccessGroup{
+			{ID: "group-admins", Name: "Admins"},
+			{ID: "group-staff", Name: "Staff"},
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy})
+
+	apps := []model.AccessAppSpec{
+		{
+			Name:   "app",
+			Domain: "app.example.com",
+			Policies: []model.AccessPolicySpec{
+				{Name: "groups", Action: "allow", IncludeGroups: []string{"admins", "group-staff"}, Managed: true},
+			},
+		},
+		{
+			Name:   "unknown",
+			Domain: "unknown.example.com",
+			Policies: []model.AccessPolicySpec{
+				{Name: "unknown", Action: "allow", IncludeGroups: []string{"Contractors"}, Managed: true},
+			},
+		},
+	}
+
+	if _, err := engine.Reconcile(context.Background(), apps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.createPolicyCalls != 1 || api.createAppCalls != 1 {
+		t.Fatalf("expected only the resolvable app to be created, got %d policies and %d apps", api.createPolicyCalls, api.createAppCalls)
+	}
+	include := api.lastPolicyInput.Include
+	if len(include) != 2 || include[0].Group != "group-admins" || include[1].Group != "group-staff" {
+		t.Fatalf("expected group names resolved to IDs, got %+v", include)
+	}
+	if apps[0].Policies[0].IncludeGroups[0] != "admins" {
+		t.Fatalf("expected input specs to stay unchanged, got %+v", apps[0].Policies[0].IncludeGroups)
+	}
+}
+
+func TestReconcileResolvesIncludeServiceTokens(t *testing.T) {
+	api := &stubAccessAPI{
+		serviceTokens: []cloudflare.ServiceToken{
+			{ID: "token-ci", Name: "CI"},
+			{ID: "token-backup", Name: "backup"},
+			{ID: "token-backup-2", Name: "Backup"},
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy})
+
+	apps := []model.AccessAppSpec{
+		{
+			Name:   "app",
+			Domain: "app.example.com",
+			Policies: []model.AccessPolicySpec{
+				{Name: "automation", Action: "non_identity", IncludeServiceTokens: []string{"ci"}, IncludeAnyServiceToken: true, Managed: true},
+			},
+		},
+		{
+			Name:   "ambiguous",
+			Domain: "ambiguous.example.com",
+			Policies: []model.AccessPolicySpec{
+				{Name: "backup", Action: "non_identity", IncludeServiceTokens: []string{"backup"}, Managed: true},
+			},
+		},
+	}
+
+	if _, err := engine.Reconcile(context.Background(), apps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.createPolicyCalls != 1 || api.createAppCalls != 1 {
+		t.Fatalf("expected only the resolvable app to be created, got %d policies and %d apps", api.createPolicyCalls, api.createAppCalls)
+	}
+	include := api.lastPolicyInput.Include
+	if len(include) != 2 || include[0].ServiceToken != "token-ci" || !include[1].AnyServiceToken {
+		t.Fatalf("expected service token names resolved to IDs, got %+v", include)
+	}
+	if api.lastPolicyInput.Action != "non_identity" {
+		t.Fatalf("expected non_identity action, got %q", api.lastPolicyInput.Action)
+	}
+}
+
+func TestPolicyDifferencesComparesServiceTokens(t *testing.T) {
+	spec := model.AccessPolicySpec{Name: "automation", Action: "non_identity", IncludeServiceTokens: []string{"token-1"}, Managed: true}
+	record := cloudflare.AccessPolicyRecord{ID: "policy-1", Name: "automation", Action: "non_identity", Include: []cloudflare.AccessRule{{ServiceToken: "token-1"}}}
+	if len(policyDifferences(spec, record)) > 0 {
+		t.Fatalf("expected matching service token include to need no update")
+	}
+	record.Include = []cloudflare.AccessRule{{AnyServiceToken: true}}
+	if len(policyDifferences(spec, record)) == 0 {
+		t.Fatalf("expected a specific service token to differ from any service token")
+	}
+}
+
+func TestPolicyDifferencesComparesCertificates(t *testing.T) {
+	spec := model.AccessPolicySpec{Name: "devices", Action: "allow", IncludeCommonNames: []string{"device-01"}, IncludeCertificate: true, Managed: true}
+	record := cloudflare.AccessPolicyRecord{ID: "policy-1", Name: "devices", Action: "allow", Include: []cloudflare.AccessRule{{Certificate: true}, {CommonName: "device-01"}}}
+	if len(policyDifferences(spec, record)) > 0 {
+		t.Fatalf("expected matching certificate includes to need no update")
+	}
+	record.Include = []cloudflare.AccessRule{{CommonName: "device-02"}, {Certificate: true}}
+	if len(policyDifferences(spec, record)) == 0 {
+		t.Fatalf("expected common name changes to need an update")
+	}
+}
+
+func TestPolicyDifferencesComparesGroups(t *testing.T) {
+	spec := model.AccessPolicySpec{Name: "groups", Action: "allow", IncludeGroups: []string{"group-1"}, Managed: true}
+	record := cloudflare.AccessPolicyRecord{ID: "policy-1", Name: "groups", Action: "allow", Include: []cloudflare.AccessRule{{Group: "group-1"}}}
+	if len(policyDifferences(spec, record)) > 0 {
+		t.Fatalf("expected matching group include to need no update")
+	}
+	spec.IncludeGroups = []string{"group-2"}
+	if len(policyDifferences(spec, record)) == 0 {
+		t.Fatalf("expected differing group include to need an update")
+	}
+}
+
+func TestPolicyDifferencesComparesEmailDomains(t *testing.T) {
+	spec := model.AccessPolicySpec{Name: "company", Action: "allow", IncludeEmailDomains: []string{"example.com"}, Managed: true}
+	record := cloudflare.AccessPolicyRecord{ID: "policy-1", Name: "company", Action: "allow", Include: []cloudflare.AccessRule{{EmailDomain: "Example.com"}}}
+	if len(policyDifferences(spec, record)) > 0 {
+		t.Fatalf("expected matching email domain include to need no update")
+	}
+	record.Include = []cloudflare.AccessRule{{Email: "example.com"}}
+	if len(policyDifferences(spec, record)) == 0 {
+		t.Fatalf("expected email and email domain rules to be distinct")
+	}
+}
+
+func TestPolicyDifferencesComparesCountries(t *testing.T) {
+	spec := model.AccessPolicySpec{Name: "europe", Action: "allow", IncludeCountries: []string{"FR", "DE"}, Managed: true}
+	record := cloudflare.AccessPolicyRecord{ID: "policy-1", Name: "europe", Action: "allow", Include: []cloudflare.AccessRule{{Country: "de"}, {Country: "FR"}}}
+	if len(policyDifferences(spec, record)) > 0 {
+		t.Fatalf("expected matching country includes to need no update")
+	}
+	record.Include = []cloudflare.AccessRule{{Country: "FR"}}
+	if len(policyDifferences(spec, record)) == 0 {
+		t.Fatalf("expected a missing country to need an update")
+	}
+}
+
+func TestPolicyDifferencesComparesRequireAuthMethod(t *testing.T) {
+	spec := model.AccessPolicySpec{Name: "mfa", Action: "allow", IncludeEveryone: true, RequireAuthMethod: "mfa", Managed: true}
+	record := cloudflare.AccessPolicyRecord{ID: "policy-1", Name: "mfa", Action: "allow", Include: []cloudflare.AccessRule{{Everyone: true}}, Require: []cloudflare.AccessRule{{AuthMethod: "MFA"}}}
+	if len(policyDifferences(spec, record)) > 0 {
+		t.Fatalf("expected matching require rule to need no update")
+	}
+	record.Require = nil
+	if len(policyDifferences(spec, record)) == 0 {
+		t.Fatalf("expected a missing require rule to need an update")
+	}
+	spec.RequireAuthMethod = ""
+	record.Require = []cloudflare.AccessRule{{AuthMethod: "mfa"}}
+	if len(policyDifferences(spec, record)) == 0 {
+		t.Fatalf("expected a removed require rule to need an update")
+	}
+}
+
+func TestReconcileBypassPolicyWithIPIncludes(t *testing.T) {
+	suffix := model.AccessPolicyManagedSuffix(testManagedBy)
+	spec := model.AccessPolicySpec{Name: "health", Action: "bypass", IncludeIPs: []string{"192.0.2.0/24"}, Managed: true}
+	apps := []model.AccessAppSpec{{Name: "app", Domain: "app.example.com", Policies: []model.AccessPolicySpec{spec}}}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+
+	api := &stubAccessAPI{}
+	if _, err := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy}).Reconcile(context.Background(), apps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.createPolicyCalls != 1 || api.lastPolicyInput.Action != "bypass" || len(api.lastPolicyInput.Include) != 1 || api.lastPolicyInput.Include[0].IP != "192.0.2.0/24" {
+		t.Fatalf("expected bypass policy to be created, got %d creates and %+v", api.createPolicyCalls, api.lastPolicyInput)
+	}
+
+	api = &stubAccessAPI{
+		listPolicies: []cloudflare.AccessPolicyRecord{
+			{ID: "policy-1", Name: "health" + suffix, Action: "bypass", Include: []cloudflare.AccessRule{{IP: "198.51.100.0/24"}}},
+		},
+	}
+	if _, err := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy}).Reconcile(context.Background(), apps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.updatePolicyCalls != 1 || api.lastPolicyInput.Include[0].IP != "192.0.2.0/24" {
+		t.Fatalf("expected bypass policy IPs to be updated, got %d updates and %+v", api.updatePolicyCalls, api.lastPolicyInput)
+	}
+
+	api = &stubAccessAPI{
+		listPolicies: []cloudflare.AccessPolicyRecord{
+			{ID: "policy-1", Name: "health" + suffix, Action: "BYPASS", Include: []cloudflare.AccessRule{{IP: "192.0.2.0/24"}}},
+		},
+	}
+	if _, err := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy}).Reconcile(context.Background(), apps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.createPolicyCalls != 0 || api.updatePolicyCalls != 0 {
+		t.Fatalf("expected unchanged bypass policy to be left alone, got %d creates and %d updates", api.createPolicyCalls, api.updatePolicyCalls)
+	}
+}
+
+func TestResolveAccessAppMatchesPathDomains(t *testing.T) {
+	api := &stubAccessAPI{
+		listApps: []cloudflare.AccessAppRecord{
+			{ID: "app-root", Name: "app", Domain: "app.example.com", Type: "self_hosted", Policies: []cloudflare.AccessPolicyRef{{ID: "policy-1", Precedence: 1}}, Tags: []string{model.AccessManagedTag(testManagedBy)}},
+			{ID: "app-admin", Name: "app", Domain: "APP.example.com/Admin", Type: "self_hosted", Policies: []cloudflare.AccessPolicyRef{{ID: "policy-1", Precedence: 1}}, Tags: []string{model.AccessManagedTag(testManagedBy)}},
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy})
+
+	apps := []model.AccessAppSpec{
+		{Name: "app", Domain: "app.example.com/Admin", Policies: []model.AccessPolicySpec{{ID: "policy-1"}}},
+		{Name: "app", Domain: "app.example.com/admin", Policies: []model.AccessPolicySpec{{ID: "policy-1"}}},
+	}
+	if _, err := engine.Reconcile(context.Background(), apps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.createAppCalls != 1 {
+		t.Fatalf("expected the lowercase path to be a distinct app, got %d creates", api.createAppCalls)
+	}
+	if api.updateAppCalls != 0 {
+		t.Fatalf("expected a hostname casing difference not to update the path app, got %d updates", api.updateAppCalls)
+	}
+	if api.deleteAppCalls != 1 {
+		t.Fatalf("expected only the root app to be deleted, got %d deletes", api.deleteAppCalls)
+	}
+}
+
+func TestPolicyDifferencesComparesEveryone(t *testing.T) {
+	spec := model.AccessPolicySpec{Name: "public", Action: "allow", IncludeEveryone: true, Managed: true}
+	record := cloudflare.AccessPolicyRecord{ID: "policy-1", Name: "public", Action: "allow", Include: []cloudflare.AccessRule{{Everyone: true}}}
+	if len(policyDifferences(spec, record)) > 0 {
+		t.Fatalf("expected matching everyone include to need no update")
+	}
+	record.Include = []cloudflare.AccessRule{{Email: "a@example.com"}}
+	if len(policyDifferences(spec, record)) == 0 {
+		t.Fatalf("expected everyone include to differ from an email include")
+	}
+}
+
+func TestReconcileFiltersAppListByManagedTagWhenOnlyOrphansMatter(t *testing.T) {
+	api := &stubAccessAPI{
+		listApps: []cloudflare.AccessAppRecord{
+			{ID: "app-1", Name: "old", Domain: "old.example.com", Tags: []string{model.AccessManagedTag(testManagedBy)}},
+			{ID: "app-2", Name: "manual", Domain: "manual.example.com"},
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy})
+
+	if _, err := engine.Reconcile(context.Background(), nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(api.listAppTags) != 1 || api.listAppTags[0] != model.AccessManagedTag(testManagedBy) {
+		t.Fatalf("expected app list filtered by managed tag, got %+v", api.listAppTags)
+	}
+	if api.deleteAppCalls != 1 {
+		t.Fatalf("expected only the managed app to be deleted even if the filter is ignored, got %d deletes", api.deleteAppCalls)
+	}
+
+	api.listAppTags = nil
+	apps := []model.AccessAppSpec{{Name: "old", Domain: "old.example.com", Policies: []model.AccessPolicySpec{{ID: "policy-1"}}}}
+	if _, err := engine.Reconcile(context.Background(), apps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(api.listAppTags) != 1 || api.listAppTags[0] != "" {
+		t.Fatalf("expected unfiltered app list when resolving apps, got %+v", api.listAppTags)
+	}
+}
+
+func TestReconcileMarksManagedPoliciesAndDeletesOrphans(t *testing.T) {
+	suffix := model.AccessPolicyManagedSuffix(testManagedBy)
+	api := &stubAccessAPI{
+		listApps: []cloudflare.AccessAppRecord{
+			{ID: "app-1", Name: "app", Domain: "app.example.com", Tags: []string{model.AccessManagedTag(testManagedBy)}, Policies: []cloudflare.AccessPolicyRef{{ID: "policy-staff", Precedence: 1}}},
+			{ID: "app-old", Name: "old", Domain: "old.example.com", Tags: []string{model.AccessManagedTag(testManagedBy)}, Policies: []cloudflare.AccessPolicyRef{{ID: "policy-old", Precedence: 1}}},
+			{ID: "app-manual", Name: "manual", Domain: "manual.example.com", Policies: []cloudflare.AccessPolicyRef{{ID: "policy-shared", Precedence: 1}}},
+		},
+		listPolicies: []cloudflare.AccessPolicyRecord{
+			{ID: "policy-staff", Name: "staff", Action: "allow", Include: []cloudflare.AccessRule{{Email: "a@example.com"}}},
+			{ID: "policy-old", Name: "old" + suffix, Action: "allow", AppCount: 1},
+			{ID: "policy-shared", Name: "shared" + suffix, Action: "allow", AppCount: 1},
+			{ID: "policy-elsewhere", Name: "elsewhere" + suffix, Action: "allow", AppCount: 1},
+			{ID: "policy-manual", Name: "manual", Action: "allow"},
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy})
+
+	apps := []model.AccessAppSpec{
+		{
+			Name:   "app",
+			Domain: "app.example.com",
+			Policies: []model.AccessPolicySpec{
+				{Name: "staff", Action: "allow", IncludeEmails: []string{"a@example.com"}, Managed: true},
+			},
+		},
+	}
+	if _, err := engine.Reconcile(context.Background(), apps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.updatePolicyCalls != 0 {
+		t.Fatalf("expected adopted policy to keep its name without the managed marker, got %d updates and %+v", api.updatePolicyCalls, api.lastPolicyInput)
+	}
+	if len(api.deletedPolicyIDs) != 1 || api.deletedPolicyIDs[0] != "policy-old" {
+		t.Fatalf("expected only the orphaned managed policy to be deleted, got %+v", api.deletedPolicyIDs)
+	}
+
+	// Once its labels are gone, the adopted policy is still left alone.
+	api.deletedPolicyIDs = nil
+	if _, err := engine.Reconcile(context.Background(), nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, id := range api.deletedPolicyIDs {
+		if id == "policy-staff" {
+			t.Fatalf("expected adopted policy to be kept, got deletions %+v", api.deletedPolicyIDs)
+		}
+	}
+}
+
+func TestDriftCheckReportsDifferencesWithoutWriting(t *testing.T) {
+	suffix := model.AccessPolicyManagedSuffix(testManagedBy)
+	managedTag := model.AccessManagedTag(testManagedBy)
+	api := &stubAccessAPI{
+		listApps: []cloudflare.AccessAppRecord{
+			{ID: "app-1", Name: "app", Domain: "app.example.com", Type: "self_hosted", Tags: []string{managedTag}, Policies: []cloudflare.AccessPolicyRef{{ID: "policy-staff", Precedence: 1}}},
+			{ID: "app-old", Name: "old", Domain: "old.example.com", Tags: []string{managedTag}},
+		},
+		listPolicies: []cloudflare.AccessPolicyRecord{
+			{ID: "policy-staff", Name: "staff" + suffix, Action: "allow", Include: []cloudflare.AccessRule{{Email: "old@example.com"}}, AppCount: 1},
+		},
+	}
+	var logs strings.Builder
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	engine := NewEngine(api, logger, Options{Manage: true, DriftCheck: true, ManagedBy: testManagedBy})
+
+	apps := []model.AccessAppSpec{
+		{
+			Name:     "app",
+			Domain:   "app.example.com",
+			Tags:     []string{"team"},
+			TagsSet:  true,
+			Policies: []model.AccessPolicySpec{{Name: "staff", Action: "allow", IncludeEmails: []string{"a@example.com"}, Managed: true}},
+		},
+		{
+			Name:     "new",
+			Domain:   "new.example.com",
+			Policies: []model.AccessPolicySpec{{ID: "policy-staff", Managed: false}},
+		},
+	}
+
+	count, err := engine.DriftCheck(context.Background(), apps)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count != 4 {
+		t.Fatalf("expected 4 differences, got %d:\n%s", count, logs.String())
+	}
+	if api.createAppCalls+api.updateAppCalls+api.deleteAppCalls+api.createPolicyCalls+api.updatePolicyCalls+api.deletePolicyCalls+api.ensureTagCalls != 0 {
+		t.Fatalf("expected no writes during drift check, got %+v", api)
+	}
+	for _, want := range []string{"drift.kind=policy_differs", "drift.fields=[include]", "drift.kind=app_differs", "drift.fields=[tags]", "drift.kind=missing_app", "drift.kind=orphaned_app"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Fatalf("expected %q in drift report:\n%s", want, logs.String())
+		}
+	}
+
+	result, err := engine.Reconcile(context.Background(), apps)
+	if err != nil || result.AccessDrift != 4 {
+		t.Fatalf("expected Reconcile to report 4 differences without failing, got %d (error %v)", result.AccessDrift, err)
+	}
+}
+
+func TestReconcileEnsuresSharedPolicies(t *testing.T) {
+	suffix := model.AccessPolicyManagedSuffix(testManagedBy)
+	api := &stubAccessAPI{
+		listPolicies: []cloudflare.AccessPolicyRecord{
+			{ID: "policy-admins", Name: "admins" + suffix, Action: "allow", Include: []cloudflare.AccessRule{{Email: "old@example.com"}}},
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	shared := []model.AccessPolicySpec{
+		{Name: "admins", Action: "allow", IncludeEmails: []string{"a@example.com"}, Managed: true},
+		{Name: "ops", Action: "allow", IncludeEmails: []string{"ops@example.com"}, Managed: true},
+	}
+	engine := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy, SharedPolicies: shared})
+
+	if _, err := engine.Reconcile(context.Background(), nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.updatePolicyCalls != 1 || api.createPolicyCalls != 1 || api.lastPolicyInput.Name != "ops"+suffix {
+		t.Fatalf("expected unreferenced shared policies to be ensured, got %d updates, %d creates and %+v", api.updatePolicyCalls, api.createPolicyCalls, api.lastPolicyInput)
+	}
+	if api.deletePolicyCalls != 0 {
+		t.Fatalf("expected shared policies to be kept out of orphan cleanup, got %+v", api.deletedPolicyIDs)
+	}
+}
+
+func TestDeleteOrphanedPoliciesSkipsWhenManageDisabled(t *testing.T) {
+	api := &stubAccessAPI{
+		listPolicies: []cloudflare.AccessPolicyRecord{
+			{ID: "policy-old", Name: "old" + model.AccessPolicyManagedSuffix(testManagedBy), Action: "allow"},
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{ManagedBy: testManagedBy})
+
+	if err := engine.deleteOrphanedPolicies(context.Background(), api.listPolicies, nil, map[string]struct{}{}, map[string]struct{}{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.deletePolicyCalls != 0 {
+		t.Fatalf("expected no policy deletes when manage is false, got %d", api.deletePolicyCalls)
+	}
+}
+
+func TestDeleteOrphanedAppsDeletesManaged(t *testing.T) {
+	api := &stubAccessAPI{}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy})
+
+	existing := []cloudflare.AccessAppRecord{
+		{ID: "app-1", Name: "app", Tags: []string{model.AccessManagedTag(testManagedBy)}},
+	}
+	engine.deleteOrphanedApps(context.Background(), existing, map[string]struct{}{})
+
+	if api.deleteAppCalls != 1 {
+		t.Fatalf("expected 1 delete call, got %d", api.deleteAppCalls)
+	}
+}
+
+func TestDeleteOrphanedAppsHoldsBackMassDeletions(t *testing.T) {
+	api := &stubAccessAPI{}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy, Removals: model.NewRemovalGuard(1, false)})
+
+	existing := []cloudflare.AccessAppRecord{
+		{ID: "app-1", Name: "one", Tags: []string{model.AccessManagedTag(testManagedBy)}},
+		{ID: "app-2", Name: "two", Tags: []string{model.AccessManagedTag(testManagedBy)}},
+	}
+	desired := map[string]struct{}{}
+	engine.deleteOrphanedApps(context.Background(), existing, desired)
+	if api.deleteAppCalls != 0 {
+		t.Fatalf("expected deletions beyond the limit to be held back, got %d", api.deleteAppCalls)
+	}
+	if _, kept := desired["app-1"]; !kept {
+		t.Fatalf("expected held-back apps to be treated as desired so their policies are kept")
+	}
+
+	forced := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy, Removals: model.NewRemovalGuard(1, true)})
+	forced.deleteOrphanedApps(context.Background(), existing, map[string]struct{}{})
+	if api.deleteAppCalls != 2 {
+		t.Fatalf("expected SYNC_FORCE_REMOVALS to delete every orphan, got %d", api.deleteAppCalls)
+	}
+}
+
+func TestReconcileKeepsAppsOfProtectedHostnames(t *testing.T) {
+	suffix := model.AccessPolicyManagedSuffix(testManagedBy)
+	managedTag := model.AccessManagedTag(testManagedBy)
+	api := &stubAccessAPI{
+		listApps: []cloudflare.AccessAppRecord{
+			{ID: "app-vpn", Name: "vpn", Domain: "vpn.example.com/admin", Tags: []string{managedTag}, Policies: []cloudflare.AccessPolicyRef{{ID: "policy-vpn", Precedence: 1}}},
+			{ID: "app-old", Name: "old", Domain: "old.example.com", Tags: []string{managedTag}},
+		},
+		listPolicies: []cloudflare.AccessPolicyRecord{
+			{ID: "policy-vpn", Name: "vpn" + suffix, Action: "allow", AppCount: 1},
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy, Protected: model.ProtectedHostnames{"vpn.example.com"}})
+
+	apps := []model.AccessAppSpec{
+		{Name: "hijack", Domain: "VPN.example.com", Policies: []model.AccessPolicySpec{{ID: "policy-1", Managed: false}}},
+	}
+	if _, err := engine.Reconcile(context.Background(), apps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.createAppCalls != 0 || api.updateAppCalls != 0 {
+		t.Fatalf("expected app claiming a protected hostname to be ignored, got %d creates and %d updates", api.createAppCalls, api.updateAppCalls)
+	}
+	if api.deleteAppCalls != 1 {
+		t.Fatalf("expected only the unprotected orphan to be deleted, got %d deletes", api.deleteAppCalls)
+	}
+	if api.deletePolicyCalls != 0 {
+		t.Fatalf("expected policies of protected apps to be kept, got %+v", api.deletedPolicyIDs)
+	}
+}
+
+func TestReconcileReturnsAggregateErrorAndKeepsFailedApps(t *testing.T) {
+	api := &stubAccessAPI{
+		listApps: []cloudflare.AccessAppRecord{
+			{ID: "app-1", Name: "broken", Domain: "broken.example.com", Tags: []string{model.AccessManagedTag(testManagedBy)}},
+		},
+		createPolicyErr: errors.New("boom"),
+	}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{Manage: true, ManagedBy: testManagedBy})
+
+	apps := []model.AccessAppSpec{
+		{
+			Name:   "broken",
+			Domain: "broken.example.com",
+			Policies: []model.AccessPolicySpec{
+				{Name: "new-policy", Action: "allow", IncludeEmails: []string{"a@example.com"}, Managed: true},
+			},
+		},
+		{
+			Name:   "healthy",
+			Domain: "healthy.example.com",
+			Policies: []model.AccessPolicySpec{
+				{ID: "policy-1", Managed: false},
+			},
+		},
+	}
+
+	_, err := engine.Reconcile(context.Background(), apps)
+	if err == nil || !strings.Contains(err.Error(), "1 failure(s)") {
+		t.Fatalf("expected aggregate error with one failure, got %v", err)
+	}
+	if api.createAppCalls != 1 {
+		t.Fatalf("expected healthy app to still be created, got %d create calls", api.createAppCalls)
+	}
+	if api.deleteAppCalls != 0 {
+		t.Fatalf("expected failed app to be kept, got %d delete calls", api.deleteAppCalls)
+	}
+}
+
+type testWriter struct {
+	t *testing.T
+}
+
+func (w testWriter) Write(p []byte) (n int, err error) {
+	w.t.Log(string(p))
+	return len(p), nil
+}
+
+type stubAccessAPI struct {
+	listApps          []cloudflare.AccessAppRecord
+	listPolicies      []cloudflare.AccessPolicyRecord
+	createAppCalls    int
+	createAppAUD      string
+	updateAppCalls    int
+	deleteAppCalls    int
+	createPolicyCalls int
+	updatePolicyCalls int
+	ensureTagCalls    int
+	ensureTagNames    []string
+	ensureTagErrors   map[string]error
+	createPolicyErr   error
+	lastPolicyInput   cloudflare.AccessPolicyInput
+	lastAppInput      cloudflare.AccessAppInput
+	identityProviders []cloudflare.IdentityProvider
+	listIdPCalls      int
+	accessGroups      []cloudflare.AccessGroup
+	listAppTags       []string
+	serviceTokens     []cloudflare.ServiceToken
+	customPages       []cloudflare.CustomPage
+	listPageCalls     int
+	deletePolicyCalls int
+	deletedPolicyIDs  []string
+}
+
+func (api *stubAccessAPI) ListAccessApps(ctx context.Context, tag string) ([]cloudflare.AccessAppRecord, error) {
+	api.listAppTags = append(api.listAppTags, tag)
+	return api.listApps, nil
+}
+
+func (api *stubAccessAPI) CreateAccessApp(ctx context.Context, input cloudflare.AccessAppInput) (cloudflare.AccessAppRecord, error) {
+	api.createAppCalls++
+	api.lastAppInput = input
+	return cloudflare.AccessAppRecord{ID: "created", AUD: api.createAppAUD, Name: input.Name, Domain: input.Domain, Policies: input.Policies, Tags: input.Tags}, nil
+}
+
+func (api *stubAccessAPI) UpdateAccessApp(ctx context.Context, id string, input cloudflare.AccessAppInput) (cloudflare.AccessAppRecord, error) {
+	api.updateAppCalls++
+	api.lastAppInput = input
+	return cloudflare.AccessAppRecord{ID: id, Name: input.Name, Domain: input.Domain, Policies: input.Policies, Tags: input.Tags}, nil
+}
+
+func (api *stubAccessAPI) DeleteAccessApp(ctx context.Context, id string) error {
+	api.deleteAppCalls++
+	return nil
+}
+
+func (api *stubAccessAPI) ListAccessPolicies(ctx context.Context) ([]cloudflare.AccessPolicyRecord, error) {
+	return api.listPolicies, nil
+}
+
+func (api *stubAccessAPI) CreateAccessPolicy(ctx context.Context, input cloudflare.AccessPolicyInput) (cloudflare.AccessPolicyRecord, error) {
+	api.createPolicyCalls++
+	api.lastPolicyInput = input
+	if api.createPolicyErr != nil {
+		return cloudflare.AccessPolicyRecord{}, api.createPolicyErr
+	}
+	return cloudflare.AccessPolicyRecord{ID: "policy", Name: input.Name, Action: input.Action, Include: input.Include}, nil
+}
+
+func (api *stubAccessAPI) UpdateAccessPolicy(ctx context.Context, id string, input cloudflare.AccessPolicyInput) (cloudflare.AccessPolicyRecord, error) {
+	api.updatePolicyCalls++
+	api.lastPolicyInput = input
+	return cloudflare.AccessPolicyRecord{ID: id, Name: input.Name, Action: input.Action, Include: input.Include}, nil
+}
+
+func (api *stubAccessAPI) ListIdentityProviders(ctx context.Context) ([]cloudflare.IdentityProvider, error) {
+	api.listIdPCalls++
+	return api.identityProviders, nil
+}
+
+func (api *stubAccessAPI) ListCustomPages(ctx context.Context) ([]cloudflare.CustomPage, error) {
+	api.listPageCalls++
+	return api.customPages, nil
+}
+
+func (api *stubAccessAPI) ListAccessGroups(ctx context.Context) ([]cloudflare.AccessGroup, error) {
+	return api.accessGroups, nil
+}
+
+func (api *stubAccessAPI) DeleteAccessPolicy(ctx context.Context, id string) error {
+	api.deletePolicyCalls++
+	api.deletedPolicyIDs = append(api.deletedPolicyIDs, id)
+	return nil
+}
+
+func (api *stubAccessAPI) ListServiceTokens(ctx context.Context) ([]cloudflare.ServiceToken, error) {
+	return api.serviceTokens, nil
 }
 
 func (api *stubAccessAPI) EnsureAccessTag(ctx context.Context, name string) error {
@@ -13,11 +13,17 @@ import (
 	"strings"
 	"time"
 
+	"log/slog"
+
 	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/config"
 )
 
 const defaultBaseURL = "https://api.cloudflare.com/client/v4"
 
+// Version is the build version sent in the User-Agent header. Release builds
+// set it with -ldflags "-X github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/cloudflare.Version=v1.2.3".
+var Version = "dev"
+
 // Client implements the Cloudflare API for Tunnel configurations and Access resources.
 type Client struct {
 	baseURL    *url.URL
@@ -26,10 +32,11 @@ type Client struct {
 	token      string
 	userAgent  string
 	httpClient *http.Client
+	limiter    *rateLimiter
 }
 
 // NewClient creates a Cloudflare API client.
-func NewClient(cfg config.CloudflareConfig) (*Client, error) {
+func NewClient(cfg config.CloudflareConfig, logger *slog.Logger) (*Client, error) {
 	base := cfg.BaseURL
 	if base == "" {
 		base = defaultBaseURL
@@ -44,13 +51,44 @@ func NewClient(cfg config.CloudflareConfig) (*Client, error) {
 		accountID: cfg.AccountID,
 		tunnelID:  cfg.TunnelID,
 		token:     cfg.APIToken,
-		userAgent: "docker-cloudflare-tunnel-sync",
+		userAgent: userAgent(Version, cfg.UserAgentSuffix),
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		limiter: newRateLimiter(logger),
 	}, nil
 }
 
+// userAgent builds the User-Agent header, for example
+// "docker-cloudflare-tunnel-sync/v1.2.3 (host=foo)", so requests can be traced
+// back to the build and instance that sent them.
+func userAgent(version, suffix string) string {
+	agent := "docker-cloudflare-tunnel-sync/" + version
+	if suffix = strings.TrimSpace(suffix); suffix != "" {
+		agent += " " + suffix
+	}
+	return agent
+}
+
+// GetTunnel returns the details of the configured tunnel.
+func (client *Client) GetTunnel(ctx context.Context) (Tunnel, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, client.tunnelBase().String(), nil)
+	if err != nil {
+		return Tunnel{}, err
+	}
+	client.addHeaders(request)
+
+	var response apiResponse[tunnelPayload]
+	if err := client.do(request, &response); err != nil {
+		return Tunnel{}, err
+	}
+	if err := response.Err(); err != nil {
+		return Tunnel{}, err
+	}
+
+	return Tunnel{ID: response.Result.ID, Name: response.Result.Name, ConfigSrc: response.Result.ConfigSrc}, nil
+}
+
 // GetConfig returns the current tunnel configuration and ingress rules.
 func (client *Client) GetConfig(ctx context.Context) (TunnelConfig, error) {
 	endpoint := client.configBase().String()
@@ -83,18 +121,21 @@ func (client *Client) GetConfig(ctx context.Context) (TunnelConfig, error) {
 	return TunnelConfig{Ingress: ingress, Raw: config}, nil
 }
 
-// UpdateConfig replaces the tunnel configuration using the supplied ingress rules.
+// UpdateConfig replaces the tunnel configuration using the supplied ingress
+// rules. When Ingress is nil, the ingress in Raw is sent unchanged.
 func (client *Client) UpdateConfig(ctx context.Context, config TunnelConfig) error {
 	payloadConfig := config.Raw
 	if payloadConfig == nil {
 		payloadConfig = make(map[string]json.RawMessage)
 	}
 
-	ingressRaw, err := json.Marshal(config.Ingress)
-	if err != nil {
-		return err
+	if config.Ingress != nil {
+		ingressRaw, err := json.Marshal(config.Ingress)
+		if err != nil {
+			return err
+		}
+		payloadConfig["ingress"] = ingressRaw
 	}
-	payloadConfig["ingress"] = ingressRaw
 
 	payload := configPayload{Config: payloadConfig}
 	body, err := json.Marshal(payload)
@@ -117,10 +158,39 @@ func (client *Client) UpdateConfig(ctx context.Context, config TunnelConfig) err
 	return response.Err()
 }
 
-// ListAccessApps returns all Access applications for the account.
-func (client *Client) ListAccessApps(ctx context.Context) ([]AccessAppRecord, error) {
-	endpoint := client.accessAppsBase().String()
-	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+// ListAccessApps returns the Access applications for the account. When tag is
+// set, only applications carrying that tag are returned; the filter is sent to
+// the API and applied again locally in case the API ignores or rejects it.
+func (client *Client) ListAccessApps(ctx context.Context, tag string) ([]AccessAppRecord, error) {
+	if tag == "" {
+		return client.listAccessApps(ctx, "")
+	}
+
+	apps, err := client.listAccessApps(ctx, tag)
+	if err != nil {
+		apps, err = client.listAccessApps(ctx, "")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	filtered := make([]AccessAppRecord, 0, len(apps))
+	for _, app := range apps {
+		if containsString(app.Tags, tag) {
+			filtered = append(filtered, app)
+		}
+	}
+	return filtered, nil
+}
+
+func (client *Client) listAccessApps(ctx context.Context, tag string) ([]AccessAppRecord, error) {
+	endpoint := client.accessAppsBase()
+	if tag != "" {
+		query := endpoint.Query()
+		query.Set("tag", tag)
+		endpoint.RawQuery = query.Encode()
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -137,12 +207,26 @@ func (client *Client) ListAccessApps(ctx context.Context) ([]AccessAppRecord, er
 	apps := make([]AccessAppRecord, 0, len(response.Result))
 	for _, app := range response.Result {
 		apps = append(apps, AccessAppRecord{
-			ID:       app.ID,
-			Name:     app.Name,
-			Domain:   app.Domain,
-			Type:     app.Type,
-			Policies: parsePolicyRefs(app.Policies),
-			Tags:     app.Tags,
+			ID:                 app.ID,
+			AUD:                app.AUD,
+			Name:               app.Name,
+			Domain:             app.Domain,
+			Type:               app.Type,
+			Policies:           parsePolicyRefs(app.Policies),
+			Tags:               app.Tags,
+			AppLauncherVisible: app.AppLauncherVisible,
+			LogoURL:            app.LogoURL,
+			AllowedIdPs:        app.AllowedIdPs,
+			DenyMessage:        app.CustomDenyMessage,
+			DenyURL:            app.CustomDenyURL,
+			AutoRedirect:       app.AutoRedirectToIdentity,
+			SkipInterstitial:   app.SkipInterstitial,
+			IsolationRequired:  app.IsolationRequired,
+			SkipLauncherLogin:  app.SkipLauncherLoginPage,
+			HTTPOnlyCookie:     app.HTTPOnlyCookieAttribute,
+			SameSiteCookie:     app.SameSiteCookieAttribute,
+			CustomPages:        app.CustomPages,
+			CORS:               decodeCORS(app.CORSHeaders),
 		})
 	}
 
@@ -152,11 +236,24 @@ func (client *Client) ListAccessApps(ctx context.Context) ([]AccessAppRecord, er
 // CreateAccessApp creates a new Access application.
 func (client *Client) CreateAccessApp(ctx context.Context, input AccessAppInput) (AccessAppRecord, error) {
 	payload := accessAppWritePayload{
-		Name:     input.Name,
-		Domain:   input.Domain,
-		Type:     accessAppType(input.Type),
-		Policies: encodePolicyRefs(input.Policies),
-		Tags:     input.Tags,
+		Name:                    input.Name,
+		Domain:                  input.Domain,
+		Type:                    accessAppType(input.Type),
+		Policies:                encodePolicyRefs(input.Policies),
+		Tags:                    input.Tags,
+		AppLauncherVisible:      input.AppLauncherVisible,
+		LogoURL:                 stringValue(input.LogoURL),
+		AllowedIdPs:             input.AllowedIdPs,
+		CustomDenyMessage:       input.DenyMessage,
+		CustomDenyURL:           input.DenyURL,
+		AutoRedirectToIdentity:  input.AutoRedirect,
+		SkipInterstitial:        input.SkipInterstitial,
+		IsolationRequired:       input.IsolationRequired,
+		SkipLauncherLoginPage:   input.SkipLauncherLogin,
+		HTTPOnlyCookieAttribute: input.HTTPOnlyCookie,
+		SameSiteCookieAttribute: input.SameSiteCookie,
+		CustomPages:             input.CustomPages,
+		CORSHeaders:             encodeCORS(input.CORS),
 	}
 
 	return client.writeAccessApp(ctx, http.MethodPost, client.accessAppsBase(), payload)
@@ -165,11 +262,24 @@ func (client *Client) CreateAccessApp(ctx context.Context, input AccessAppInput)
 // UpdateAccessApp updates an existing Access application.
 func (client *Client) UpdateAccessApp(ctx context.Context, id string, input AccessAppInput) (AccessAppRecord, error) {
 	payload := accessAppWritePayload{
-		Name:     input.Name,
-		Domain:   input.Domain,
-		Type:     accessAppType(input.Type),
-		Policies: encodePolicyRefs(input.Policies),
-		Tags:     input.Tags,
+		Name:                    input.Name,
+		Domain:                  input.Domain,
+		Type:                    accessAppType(input.Type),
+		Policies:                encodePolicyRefs(input.Policies),
+		Tags:                    input.Tags,
+		AppLauncherVisible:      input.AppLauncherVisible,
+		LogoURL:                 stringValue(input.LogoURL),
+		AllowedIdPs:             input.AllowedIdPs,
+		CustomDenyMessage:       input.DenyMessage,
+		CustomDenyURL:           input.DenyURL,
+		AutoRedirectToIdentity:  input.AutoRedirect,
+		SkipInterstitial:        input.SkipInterstitial,
+		IsolationRequired:       input.IsolationRequired,
+		SkipLauncherLoginPage:   input.SkipLauncherLogin,
+		HTTPOnlyCookieAttribute: input.HTTPOnlyCookie,
+		SameSiteCookieAttribute: input.SameSiteCookie,
+		CustomPages:             input.CustomPages,
+		CORSHeaders:             encodeCORS(input.CORS),
 	}
 	endpoint := client.accessAppsBase()
 	endpoint.Path = path.Join(endpoint.Path, id)
@@ -213,13 +323,16 @@ func (client *Client) ListAccessPolicies(ctx context.Context) ([]AccessPolicyRec
 
 	policies := make([]AccessPolicyRecord, 0, len(response.Result))
 	for _, policy := range response.Result {
-		include, unsupported := parseAccessRules(policy.Include)
+		include, unsupportedInclude := parseAccessRules(policy.Include)
+		require, unsupportedRequire := parseAccessRules(policy.Require)
 		policies = append(policies, AccessPolicyRecord{
 			ID:                  policy.ID,
 			Name:                policy.Name,
 			Action:              policy.Decision,
 			Include:             include,
-			HasUnsupportedRules: unsupported,
+			Require:             require,
+			HasUnsupportedRules: unsupportedInclude || unsupportedRequire,
+			AppCount:            policy.AppCount,
 		})
 	}
 
@@ -232,6 +345,7 @@ func (client *Client) CreateAccessPolicy(ctx context.Context, input AccessPolicy
 		Name:     input.Name,
 		Decision: input.Action,
 		Include:  buildAccessRules(input.Include),
+		Require:  buildAccessRules(input.Require),
 	}
 
 	return client.writeAccessPolicy(ctx, http.MethodPost, client.accessPoliciesBase(), payload)
@@ -243,12 +357,31 @@ func (client *Client) UpdateAccessPolicy(ctx context.Context, id string, input A
 		Name:     input.Name,
 		Decision: input.Action,
 		Include:  buildAccessRules(input.Include),
+		Require:  buildAccessRules(input.Require),
 	}
 	endpoint := client.accessPoliciesBase()
 	endpoint.Path = path.Join(endpoint.Path, id)
 	return client.writeAccessPolicy(ctx, http.MethodPut, endpoint, payload)
 }
 
+// DeleteAccessPolicy deletes an Access policy.
+func (client *Client) DeleteAccessPolicy(ctx context.Context, id string) error {
+	endpoint := client.accessPoliciesBase()
+	endpoint.Path = path.Join(endpoint.Path, id)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodDelete, endpoint.String(), nil)
+	if err != nil {
+		return err
+	}
+	client.addHeaders(request)
+
+	var response apiResponse[map[string]any]
+	if err := client.do(request, &response); err != nil {
+		return err
+	}
+	return response.Err()
+}
+
 // EnsureAccessTag ensures the Access tag exists.
 func (client *Client) EnsureAccessTag(ctx context.Context, name string) error {
 	if strings.TrimSpace(name) == "" {
@@ -293,11 +426,15 @@ func (client *Client) accessTagExists(ctx context.Context, name string) (bool, e
 	}
 	client.addHeaders(request)
 
+	if err := client.limiter.wait(ctx); err != nil {
+		return false, err
+	}
 	resp, err := client.httpClient.Do(request)
 	if err != nil {
 		return false, err
 	}
 	defer resp.Body.Close()
+	client.limiter.observe(resp.Header)
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -308,7 +445,7 @@ func (client *Client) accessTagExists(ctx context.Context, name string) (bool, e
 		return false, nil
 	}
 	if resp.StatusCode >= http.StatusBadRequest {
-		return false, fmt.Errorf("cloudflare API request failed with status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+		return false, newStatusError(resp, strings.TrimSpace(string(body)))
 	}
 
 	var response apiResponse[accessTagPayload]
@@ -343,12 +480,26 @@ func (client *Client) writeAccessApp(ctx context.Context, method string, endpoin
 	}
 
 	return AccessAppRecord{
-		ID:       response.Result.ID,
-		Name:     response.Result.Name,
-		Domain:   response.Result.Domain,
-		Type:     response.Result.Type,
-		Policies: parsePolicyRefs(response.Result.Policies),
-		Tags:     response.Result.Tags,
+		ID:                 response.Result.ID,
+		AUD:                response.Result.AUD,
+		Name:               response.Result.Name,
+		Domain:             response.Result.Domain,
+		Type:               response.Result.Type,
+		Policies:           parsePolicyRefs(response.Result.Policies),
+		Tags:               response.Result.Tags,
+		AppLauncherVisible: response.Result.AppLauncherVisible,
+		LogoURL:            response.Result.LogoURL,
+		AllowedIdPs:        response.Result.AllowedIdPs,
+		DenyMessage:        response.Result.CustomDenyMessage,
+		DenyURL:            response.Result.CustomDenyURL,
+		AutoRedirect:       response.Result.AutoRedirectToIdentity,
+		SkipInterstitial:   response.Result.SkipInterstitial,
+		IsolationRequired:  response.Result.IsolationRequired,
+		SkipLauncherLogin:  response.Result.SkipLauncherLoginPage,
+		HTTPOnlyCookie:     response.Result.HTTPOnlyCookieAttribute,
+		SameSiteCookie:     response.Result.SameSiteCookieAttribute,
+		CustomPages:        response.Result.CustomPages,
+		CORS:               decodeCORS(response.Result.CORSHeaders),
 	}, nil
 }
 
@@ -373,16 +524,118 @@ func (client *Client) writeAccessPolicy(ctx context.Context, method string, endp
 		return AccessPolicyRecord{}, err
 	}
 
-	include, unsupported := parseAccessRules(response.Result.Include)
+	include, unsupportedInclude := parseAccessRules(response.Result.Include)
+	require, unsupportedRequire := parseAccessRules(response.Result.Require)
 	return AccessPolicyRecord{
 		ID:                  response.Result.ID,
 		Name:                response.Result.Name,
 		Action:              response.Result.Decision,
 		Include:             include,
-		HasUnsupportedRules: unsupported,
+		Require:             require,
+		HasUnsupportedRules: unsupportedInclude || unsupportedRequire,
 	}, nil
 }
 
+// ListIdentityProviders returns the Access identity providers configured for the account.
+func (client *Client) ListIdentityProviders(ctx context.Context) ([]IdentityProvider, error) {
+	endpoint := client.accessIdentityProvidersBase().String()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	client.addHeaders(request)
+
+	var response apiResponse[[]identityProviderPayload]
+	if err := client.do(request, &response); err != nil {
+		return nil, err
+	}
+	if err := response.Err(); err != nil {
+		return nil, err
+	}
+
+	providers := make([]IdentityProvider, 0, len(response.Result))
+	for _, provider := range response.Result {
+		providers = append(providers, IdentityProvider{ID: provider.ID, Name: provider.Name, Type: provider.Type})
+	}
+
+	return providers, nil
+}
+
+// ListCustomPages returns the Access custom pages configured for the account.
+func (client *Client) ListCustomPages(ctx context.Context) ([]CustomPage, error) {
+	endpoint := client.accessCustomPagesBase().String()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	client.addHeaders(request)
+
+	var response apiResponse[[]customPagePayload]
+	if err := client.do(request, &response); err != nil {
+		return nil, err
+	}
+	if err := response.Err(); err != nil {
+		return nil, err
+	}
+
+	pages := make([]CustomPage, 0, len(response.Result))
+	for _, page := range response.Result {
+		pages = append(pages, CustomPage{ID: page.UID, Name: page.Name, Type: page.Type})
+	}
+
+	return pages, nil
+}
+
+// ListAccessGroups returns the Access groups configured for the account.
+func (client *Client) ListAccessGroups(ctx context.Context) ([]AccessGroup, error) {
+	endpoint := client.accessGroupsBase().String()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	client.addHeaders(request)
+
+	var response apiResponse[[]accessGroupPayload]
+	if err := client.do(request, &response); err != nil {
+		return nil, err
+	}
+	if err := response.Err(); err != nil {
+		return nil, err
+	}
+
+	groups := make([]AccessGroup, 0, len(response.Result))
+	for _, group := range response.Result {
+		groups = append(groups, AccessGroup{ID: group.ID, Name: group.Name})
+	}
+
+	return groups, nil
+}
+
+// ListServiceTokens returns the Access service tokens configured for the account.
+func (client *Client) ListServiceTokens(ctx context.Context) ([]ServiceToken, error) {
+	endpoint := client.accessServiceTokensBase().String()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	client.addHeaders(request)
+
+	var response apiResponse[[]serviceTokenPayload]
+	if err := client.do(request, &response); err != nil {
+		return nil, err
+	}
+	if err := response.Err(); err != nil {
+		return nil, err
+	}
+
+	tokens := make([]ServiceToken, 0, len(response.Result))
+	for _, token := range response.Result {
+		tokens = append(tokens, ServiceToken{ID: token.ID, Name: token.Name})
+	}
+
+	return tokens, nil
+}
+
 // ListZones returns all DNS zones for the account.
 func (client *Client) ListZones(ctx context.Context) ([]Zone, error) {
 	zones := []Zone{}
@@ -421,44 +674,53 @@ func (client *Client) ListZones(ctx context.Context) ([]Zone, error) {
 	return zones, nil
 }
 
-// ListDNSRecords returns DNS records for a zone by name and type.
+// ListDNSRecords returns DNS records for a zone by name and type, reading
+// every page.
 func (client *Client) ListDNSRecords(ctx context.Context, zoneID string, recordType string, name string) ([]DNSRecord, error) {
-	endpoint := client.dnsRecordsBase(zoneID)
-	query := endpoint.Query()
-	if recordType != "" {
-		query.Set("type", recordType)
-	}
-	if name != "" {
-		query.Set("name", name)
-	}
-	query.Set("per_page", "100")
-	endpoint.RawQuery = query.Encode()
+	records := []DNSRecord{}
+	page := 1
 
-	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
-	if err != nil {
-		return nil, err
-	}
-	client.addHeaders(request)
+	for {
+		endpoint := client.dnsRecordsBase(zoneID)
+		query := endpoint.Query()
+		if recordType != "" {
+			query.Set("type", recordType)
+		}
+		if name != "" {
+			query.Set("name", name)
+		}
+		query.Set("per_page", "100")
+		query.Set("page", strconv.Itoa(page))
+		endpoint.RawQuery = query.Encode()
 
-	var response apiResponseWithInfo[[]dnsRecordPayload]
-	if err := client.do(request, &response); err != nil {
-		return nil, err
-	}
-	if err := response.Err(); err != nil {
-		return nil, err
-	}
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		client.addHeaders(request)
 
-	records := make([]DNSRecord, 0, len(response.Result))
-	for _, record := range response.Result {
-		records = append(records, DNSRecord{
-			ID:      record.ID,
-			Type:    record.Type,
-			Name:    record.Name,
-			Content: record.Content,
-			Proxied: record.Proxied,
-			Comment: record.Comment,
-			TTL:     record.TTL,
-		})
+		var response apiResponseWithInfo[[]dnsRecordPayload]
+		if err := client.do(request, &response); err != nil {
+			return nil, err
+		}
+		if err := response.Err(); err != nil {
+			return nil, err
+		}
+		for _, record := range response.Result {
+			records = append(records, DNSRecord{
+				ID:      record.ID,
+				Type:    record.Type,
+				Name:    record.Name,
+				Content: record.Content,
+				Proxied: record.Proxied,
+				Comment: record.Comment,
+				TTL:     record.TTL,
+			})
+		}
+		if response.ResultInfo.TotalPages == 0 || page >= response.ResultInfo.TotalPages {
+			break
+		}
+		page++
 	}
 
 	return records, nil
@@ -547,6 +809,12 @@ func (client *Client) addHeaders(request *http.Request) {
 	request.Header.Set("User-Agent", client.userAgent)
 }
 
+func (client *Client) tunnelBase() *url.URL {
+	base := *client.baseURL
+	base.Path = path.Join(base.Path, "accounts", client.accountID, "cfd_tunnel", client.tunnelID)
+	return &base
+}
+
 func (client *Client) configBase() *url.URL {
 	base := *client.baseURL
 	base.Path = path.Join(base.Path, "accounts", client.accountID, "cfd_tunnel", client.tunnelID, "configurations")
@@ -571,6 +839,30 @@ func (client *Client) accessTagsBase() *url.URL {
 	return &base
 }
 
+func (client *Client) accessIdentityProvidersBase() *url.URL {
+	base := *client.baseURL
+	base.Path = path.Join(base.Path, "accounts", client.accountID, "access", "identity_providers")
+	return &base
+}
+
+func (client *Client) accessCustomPagesBase() *url.URL {
+	base := *client.baseURL
+	base.Path = path.Join(base.Path, "accounts", client.accountID, "access", "custom_pages")
+	return &base
+}
+
+func (client *Client) accessGroupsBase() *url.URL {
+	base := *client.baseURL
+	base.Path = path.Join(base.Path, "accounts", client.accountID, "access", "groups")
+	return &base
+}
+
+func (client *Client) accessServiceTokensBase() *url.URL {
+	base := *client.baseURL
+	base.Path = path.Join(base.Path, "accounts", client.accountID, "access", "service_tokens")
+	return &base
+}
+
 func (client *Client) zonesBase() *url.URL {
 	base := *client.baseURL
 	base.Path = path.Join(base.Path, "zones")
@@ -628,6 +920,12 @@ type apiError struct {
 	Message string `json:"message"`
 }
 
+type tunnelPayload struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	ConfigSrc string `json:"config_src"`
+}
+
 type configResult struct {
 	Config map[string]json.RawMessage `json:"config"`
 }
@@ -637,20 +935,58 @@ type configPayload struct {
 }
 
 type accessAppPayload struct {
-	ID       string            `json:"id,omitempty"`
-	Name     string            `json:"name,omitempty"`
-	Domain   string            `json:"domain,omitempty"`
-	Type     string            `json:"type,omitempty"`
-	Policies []json.RawMessage `json:"policies,omitempty"`
-	Tags     []string          `json:"tags,omitempty"`
+	ID                      string             `json:"id,omitempty"`
+	AUD                     string             `json:"aud,omitempty"`
+	Name                    string             `json:"name,omitempty"`
+	Domain                  string             `json:"domain,omitempty"`
+	Type                    string             `json:"type,omitempty"`
+	Policies                []json.RawMessage  `json:"policies,omitempty"`
+	Tags                    []string           `json:"tags,omitempty"`
+	AppLauncherVisible      bool               `json:"app_launcher_visible"`
+	LogoURL                 string             `json:"logo_url,omitempty"`
+	AllowedIdPs             []string           `json:"allowed_idps,omitempty"`
+	CustomDenyMessage       string             `json:"custom_deny_message,omitempty"`
+	CustomDenyURL           string             `json:"custom_deny_url,omitempty"`
+	AutoRedirectToIdentity  bool               `json:"auto_redirect_to_identity"`
+	SkipInterstitial        bool               `json:"skip_interstitial"`
+	IsolationRequired       bool               `json:"isolation_required"`
+	SkipLauncherLoginPage   bool               `json:"skip_app_launcher_login_page"`
+	HTTPOnlyCookieAttribute bool               `json:"http_only_cookie_attribute"`
+	SameSiteCookieAttribute string             `json:"same_site_cookie_attribute,omitempty"`
+	CustomPages             []string           `json:"custom_pages,omitempty"`
+	CORSHeaders             *accessCORSPayload `json:"cors_headers,omitempty"`
 }
 
 type accessAppWritePayload struct {
-	Name     string                   `json:"name,omitempty"`
-	Domain   string                   `json:"domain,omitempty"`
-	Type     string                   `json:"type,omitempty"`
-	Policies []accessPolicyRefPayload `json:"policies,omitempty"`
-	Tags     []string                 `json:"tags,omitempty"`
+	Name                    string                   `json:"name,omitempty"`
+	Domain                  string                   `json:"domain,omitempty"`
+	Type                    string                   `json:"type,omitempty"`
+	Policies                []accessPolicyRefPayload `json:"policies,omitempty"`
+	Tags                    []string                 `json:"tags,omitempty"`
+	AppLauncherVisible      *bool                    `json:"app_launcher_visible,omitempty"`
+	LogoURL                 string                   `json:"logo_url,omitempty"`
+	AllowedIdPs             []string                 `json:"allowed_idps,omitempty"`
+	CustomDenyMessage       *string                  `json:"custom_deny_message,omitempty"`
+	CustomDenyURL           *string                  `json:"custom_deny_url,omitempty"`
+	AutoRedirectToIdentity  *bool                    `json:"auto_redirect_to_identity,omitempty"`
+	SkipInterstitial        *bool                    `json:"skip_interstitial,omitempty"`
+	IsolationRequired       *bool                    `json:"isolation_required,omitempty"`
+	SkipLauncherLoginPage   *bool                    `json:"skip_app_launcher_login_page,omitempty"`
+	HTTPOnlyCookieAttribute *bool                    `json:"http_only_cookie_attribute,omitempty"`
+	SameSiteCookieAttribute *string                  `json:"same_site_cookie_attribute,omitempty"`
+	CustomPages             []string                 `json:"custom_pages,omitempty"`
+	CORSHeaders             *accessCORSPayload       `json:"cors_headers,omitempty"`
+}
+
+type accessCORSPayload struct {
+	AllowedOrigins   []string `json:"allowed_origins,omitempty"`
+	AllowedMethods   []string `json:"allowed_methods,omitempty"`
+	AllowedHeaders   []string `json:"allowed_headers,omitempty"`
+	AllowAllOrigins  bool     `json:"allow_all_origins,omitempty"`
+	AllowAllMethods  bool     `json:"allow_all_methods,omitempty"`
+	AllowAllHeaders  bool     `json:"allow_all_headers,omitempty"`
+	AllowCredentials bool     `json:"allow_credentials,omitempty"`
+	MaxAge           int      `json:"max_age,omitempty"`
 }
 
 type accessPolicyRefPayload struct {
@@ -659,16 +995,45 @@ type accessPolicyRefPayload struct {
 }
 
 type accessPolicyPayload struct {
-	ID       string                         `json:"id,omitempty"`
-	Name     string                         `json:"name"`
-	Decision string                         `json:"decision"`
-	Include  []map[string]map[string]string `json:"include"`
+	ID       string              `json:"id,omitempty"`
+	Name     string              `json:"name"`
+	Decision string              `json:"decision"`
+	Include  []accessRulePayload `json:"include"`
+	Require  []accessRulePayload `json:"require"`
+	AppCount int                 `json:"app_count,omitempty"`
 }
 
+// accessRulePayload is a single Access rule keyed by its type, such as
+// {"email": {"email": "a@example.com"}} or {"everyone": {}}. Values stay raw
+// so rule types with empty or non-string fields still decode.
+type accessRulePayload map[string]json.RawMessage
+
 type accessTagPayload struct {
 	Name string `json:"name"`
 }
 
+type accessGroupPayload struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type serviceTokenPayload struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type identityProviderPayload struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type customPagePayload struct {
+	UID  string `json:"uid"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
 type zonePayload struct {
 	ID   string `json:"id"`
 	Name string `json:"name"`
@@ -694,20 +1059,30 @@ type dnsRecordWritePayload struct {
 }
 
 func (client *Client) do(request *http.Request, response any) error {
+	if err := client.limiter.wait(request.Context()); err != nil {
+		return err
+	}
 	resp, err := client.httpClient.Do(request)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
+	client.limiter.observe(resp.Header)
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return err
 	}
 	if len(body) == 0 {
+		if resp.StatusCode >= http.StatusBadRequest {
+			return newStatusError(resp, "")
+		}
 		return fmt.Errorf("cloudflare API returned empty response with status %s", resp.Status)
 	}
 	if err := json.Unmarshal(body, response); err != nil {
+		if resp.StatusCode >= http.StatusBadRequest {
+			return newStatusError(resp, "")
+		}
 		return fmt.Errorf("cloudflare API returned non-JSON response with status %s: %w", resp.Status, err)
 	}
 
@@ -716,15 +1091,64 @@ func (client *Client) do(request *http.Request, response any) error {
 		if payload, ok := response.(interface{ ErrorSummary() string }); ok {
 			summary = strings.TrimSpace(payload.ErrorSummary())
 		}
-		if summary == "" || summary == "unknown error" {
-			return fmt.Errorf("cloudflare API request failed with status %s", resp.Status)
+		if summary == "unknown error" {
+			summary = ""
 		}
-		return fmt.Errorf("cloudflare API request failed with status %s: %s", resp.Status, summary)
+		return newStatusError(resp, summary)
 	}
 
 	return nil
 }
 
+// StatusError is returned when the Cloudflare API answers with an HTTP error
+// status, so callers can tell missing permissions (401, 403) from other
+// failures. RetryAfter holds the Retry-After delay, when one was sent.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Summary    string
+	RetryAfter time.Duration
+}
+
+func (err *StatusError) Error() string {
+	if err.Summary == "" {
+		return fmt.Sprintf("cloudflare API request failed with status %s", err.Status)
+	}
+	return fmt.Sprintf("cloudflare API request failed with status %s: %s", err.Status, err.Summary)
+}
+
+func encodeCORS(cors *AccessCORS) *accessCORSPayload {
+	if cors == nil {
+		return nil
+	}
+	return &accessCORSPayload{
+		AllowedOrigins:   cors.AllowedOrigins,
+		AllowedMethods:   cors.AllowedMethods,
+		AllowedHeaders:   cors.AllowedHeaders,
+		AllowAllOrigins:  cors.AllowAllOrigins,
+		AllowAllMethods:  cors.AllowAllMethods,
+		AllowAllHeaders:  cors.AllowAllHeaders,
+		AllowCredentials: cors.AllowCredentials,
+		MaxAge:           cors.MaxAge,
+	}
+}
+
+func decodeCORS(payload *accessCORSPayload) *AccessCORS {
+	if payload == nil {
+		return nil
+	}
+	return &AccessCORS{
+		AllowedOrigins:   payload.AllowedOrigins,
+		AllowedMethods:   payload.AllowedMethods,
+		AllowedHeaders:   payload.AllowedHeaders,
+		AllowAllOrigins:  payload.AllowAllOrigins,
+		AllowAllMethods:  payload.AllowAllMethods,
+		AllowAllHeaders:  payload.AllowAllHeaders,
+		AllowCredentials: payload.AllowCredentials,
+		MaxAge:           payload.MaxAge,
+	}
+}
+
 func accessAppType(value string) string {
 	if strings.TrimSpace(value) == "" {
 		return "self_hosted"
@@ -732,6 +1156,13 @@ func accessAppType(value string) string {
 	return value
 }
 
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
 func parsePolicyRefs(raw []json.RawMessage) []AccessPolicyRef {
 	refs := make([]AccessPolicyRef, 0, len(raw))
 	for index, item := range raw {
@@ -770,33 +1201,104 @@ func encodePolicyRefs(refs []AccessPolicyRef) []accessPolicyRefPayload {
 	return payloads
 }
 
-func buildAccessRules(rules []AccessRule) []map[string]map[string]string {
-	result := make([]map[string]map[string]string, 0, len(rules))
+func buildAccessRules(rules []AccessRule) []accessRulePayload {
+	result := make([]accessRulePayload, 0, len(rules))
 	for _, rule := range rules {
 		if rule.Email != "" {
-			result = append(result, map[string]map[string]string{"email": {"email": rule.Email}})
+			result = append(result, newAccessRulePayload("email", map[string]string{"email": rule.Email}))
+		}
+		if rule.EmailDomain != "" {
+			result = append(result, newAccessRulePayload("email_domain", map[string]string{"domain": rule.EmailDomain}))
 		}
 		if rule.IP != "" {
-			result = append(result, map[string]map[string]string{"ip": {"ip": rule.IP}})
+			result = append(result, newAccessRulePayload("ip", map[string]string{"ip": rule.IP}))
+		}
+		if rule.Group != "" {
+			result = append(result, newAccessRulePayload("group", map[string]string{"id": rule.Group}))
+		}
+		if rule.Country != "" {
+			result = append(result, newAccessRulePayload("geo", map[string]string{"country_code": rule.Country}))
+		}
+		if rule.ServiceToken != "" {
+			result = append(result, newAccessRulePayload("service_token", map[string]string{"token_id": rule.ServiceToken}))
+		}
+		if rule.AnyServiceToken {
+			result = append(result, newAccessRulePayload("any_valid_service_token", nil))
+		}
+		if rule.CommonName != "" {
+			result = append(result, newAccessRulePayload("common_name", map[string]string{"common_name": rule.CommonName}))
+		}
+		if rule.Certificate {
+			result = append(result, newAccessRulePayload("certificate", nil))
+		}
+		if rule.Everyone {
+			result = append(result, newAccessRulePayload("everyone", nil))
+		}
+		if rule.AuthMethod != "" {
+			result = append(result, newAccessRulePayload("auth_method", map[string]string{"auth_method": rule.AuthMethod}))
 		}
 	}
 	return result
 }
 
-func parseAccessRules(raw []map[string]map[string]string) ([]AccessRule, bool) {
+func newAccessRulePayload(ruleType string, fields map[string]string) accessRulePayload {
+	if fields == nil {
+		fields = map[string]string{}
+	}
+	// Marshalling a map of strings cannot fail.
+	encoded, _ := json.Marshal(fields)
+	return accessRulePayload{ruleType: encoded}
+}
+
+func parseAccessRules(raw []accessRulePayload) ([]AccessRule, bool) {
 	result := []AccessRule{}
 	unsupported := false
 	for _, entry := range raw {
 		for key, value := range entry {
+			fields := map[string]any{}
+			if err := json.Unmarshal(value, &fields); err != nil {
+				unsupported = true
+				continue
+			}
 			switch key {
 			case "email":
-				if email, ok := value["email"]; ok && email != "" {
+				if email := ruleField(fields, "email"); email != "" {
 					result = append(result, AccessRule{Email: email})
 				}
+			case "email_domain":
+				if domain := ruleField(fields, "domain"); domain != "" {
+					result = append(result, AccessRule{EmailDomain: domain})
+				}
 			case "ip":
-				if ip, ok := value["ip"]; ok && ip != "" {
+				if ip := ruleField(fields, "ip"); ip != "" {
 					result = append(result, AccessRule{IP: ip})
 				}
+			case "group":
+				if group := ruleField(fields, "id"); group != "" {
+					result = append(result, AccessRule{Group: group})
+				}
+			case "geo":
+				if country := ruleField(fields, "country_code"); country != "" {
+					result = append(result, AccessRule{Country: country})
+				}
+			case "service_token":
+				if token := ruleField(fields, "token_id"); token != "" {
+					result = append(result, AccessRule{ServiceToken: token})
+				}
+			case "any_valid_service_token":
+				result = append(result, AccessRule{AnyServiceToken: true})
+			case "common_name":
+				if commonName := ruleField(fields, "common_name"); commonName != "" {
+					result = append(result, AccessRule{CommonName: commonName})
+				}
+			case "certificate":
+				result = append(result, AccessRule{Certificate: true})
+			case "everyone":
+				result = append(result, AccessRule{Everyone: true})
+			case "auth_method":
+				if method := ruleField(fields, "auth_method"); method != "" {
+					result = append(result, AccessRule{AuthMethod: method})
+				}
 			default:
 				unsupported = true
 			}
@@ -805,6 +1307,20 @@ func parseAccessRules(raw []map[string]map[string]string) ([]AccessRule, bool) {
 	return result, unsupported
 }
 
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
+
+func ruleField(fields map[string]any, name string) string {
+	value, _ := fields[name].(string)
+	return value
+}
+
 func joinErrors(errors []apiError) string {
 	if len(errors) == 0 {
 		return "unknown error"
@@ -0,0 +1,62 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/config"
+)
+
+func TestUserAgent(t *testing.T) {
+	if got := userAgent("v1.2.3", ""); got != "docker-cloudflare-tunnel-sync/v1.2.3" {
+		t.Fatalf("unexpected user agent without suffix: %q", got)
+	}
+	if got := userAgent("v1.2.3", " (host=foo) "); got != "docker-cloudflare-tunnel-sync/v1.2.3 (host=foo)" {
+		t.Fatalf("unexpected user agent with suffix: %q", got)
+	}
+}
+
+func TestListDNSRecordsReadsEveryPage(t *testing.T) {
+	const total = 250
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests++
+		if request.URL.Path != "/zones/zone-1/dns_records" || request.URL.Query().Get("type") != "CNAME" {
+			t.Errorf("unexpected request %s", request.URL)
+		}
+		page, _ := strconv.Atoi(request.URL.Query().Get("page"))
+		perPage, _ := strconv.Atoi(request.URL.Query().Get("per_page"))
+		records := []dnsRecordPayload{}
+		for index := (page - 1) * perPage; index < min(page*perPage, total); index++ {
+			records = append(records, dnsRecordPayload{ID: fmt.Sprintf("record-%d", index), Type: "CNAME", Name: fmt.Sprintf("app-%d.example.com", index)})
+		}
+		json.NewEncoder(writer).Encode(apiResponseWithInfo[[]dnsRecordPayload]{
+			Success:    true,
+			Result:     records,
+			ResultInfo: resultInfo{Page: page, PerPage: perPage, TotalPages: (total + perPage - 1) / perPage},
+		})
+	}))
+	defer server.Close()
+
+	client, err := NewClient(config.CloudflareConfig{BaseURL: server.URL, APIToken: "token"}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	records, err := client.ListDNSRecords(context.Background(), "zone-1", "CNAME", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if requests != 3 {
+		t.Fatalf("expected 3 page requests, got %d", requests)
+	}
+	if len(records) != total || records[0].ID != "record-0" || records[total-1].ID != fmt.Sprintf("record-%d", total-1) {
+		t.Fatalf("expected all %d records in order, got %d", total, len(records))
+	}
+}
@@ -0,0 +1,109 @@
+package cloudflare
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"log/slog"
+)
+
+// rateLimitPaceThreshold is the remaining request budget below which the
+// limiter starts spreading requests over the rest of the window.
+const rateLimitPaceThreshold = 20
+
+// rateLimiter paces requests using the X-RateLimit-Remaining and
+// X-RateLimit-Reset headers from previous responses, so large syncs slow down
+// before Cloudflare starts answering with 429.
+type rateLimiter struct {
+	log *slog.Logger
+	now func() time.Time
+
+	mu        sync.Mutex
+	known     bool
+	remaining int
+	reset     time.Time
+}
+
+func newRateLimiter(logger *slog.Logger) *rateLimiter {
+	return &rateLimiter{log: logger, now: time.Now}
+}
+
+// wait blocks until the next request may be sent or the context ends.
+func (limiter *rateLimiter) wait(ctx context.Context) error {
+	delay := limiter.delay()
+	if delay <= 0 {
+		return nil
+	}
+	limiter.log.Debug("pacing Cloudflare API requests", "delay", delay)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// delay returns how long to wait before the next request: nothing while the
+// budget is comfortable, an even share of the window once it runs low, and the
+// full window once it is exhausted.
+func (limiter *rateLimiter) delay() time.Duration {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	if !limiter.known || limiter.remaining > rateLimitPaceThreshold {
+		return 0
+	}
+	untilReset := limiter.reset.Sub(limiter.now())
+	if untilReset <= 0 {
+		limiter.known = false
+		return 0
+	}
+	if limiter.remaining <= 0 {
+		return untilReset
+	}
+	delay := untilReset / time.Duration(limiter.remaining+1)
+	// Each paced request consumes budget, so later waits stay accurate even
+	// before the next response updates the headers.
+	limiter.remaining--
+	return delay
+}
+
+// observe records the rate limit headers of a response.
+func (limiter *rateLimiter) observe(header http.Header) {
+	remaining, err := strconv.Atoi(strings.TrimSpace(header.Get("X-RateLimit-Remaining")))
+	if err != nil {
+		return
+	}
+	reset, ok := parseRateLimitReset(header.Get("X-RateLimit-Reset"), limiter.now())
+	if !ok {
+		return
+	}
+
+	limiter.mu.Lock()
+	limiter.known = true
+	limiter.remaining = remaining
+	limiter.reset = reset
+	limiter.mu.Unlock()
+
+	limiter.log.Debug("Cloudflare API rate limit", "remaining", remaining, "reset", reset.Format(time.RFC3339))
+}
+
+// parseRateLimitReset accepts either the number of seconds until the window
+// resets or a Unix timestamp.
+func parseRateLimitReset(value string, now time.Time) (time.Time, bool) {
+	seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || seconds < 0 {
+		return time.Time{}, false
+	}
+	// Values beyond a day cannot be relative windows, so treat them as epochs.
+	if seconds > int64((24 * time.Hour).Seconds()) {
+		return time.Unix(seconds, 0), true
+	}
+	return now.Add(time.Duration(seconds) * time.Second), true
+}
@@ -0,0 +1,59 @@
+package cloudflare
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterPacesWhenBudgetRunsLow(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	limiter := newRateLimiter(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	limiter.now = func() time.Time { return now }
+
+	if delay := limiter.delay(); delay != 0 {
+		t.Fatalf("expected no delay before any headers, got %s", delay)
+	}
+
+	header := http.Header{}
+	header.Set("X-RateLimit-Remaining", "500")
+	header.Set("X-RateLimit-Reset", "60")
+	limiter.observe(header)
+	if delay := limiter.delay(); delay != 0 {
+		t.Fatalf("expected no delay with a comfortable budget, got %s", delay)
+	}
+
+	header.Set("X-RateLimit-Remaining", "3")
+	limiter.observe(header)
+	if delay := limiter.delay(); delay != 15*time.Second {
+		t.Fatalf("expected an even share of the window, got %s", delay)
+	}
+	if delay := limiter.delay(); delay != 20*time.Second {
+		t.Fatalf("expected paced requests to consume budget, got %s", delay)
+	}
+
+	header.Set("X-RateLimit-Remaining", "0")
+	header.Set("X-RateLimit-Reset", "1700000030")
+	limiter.observe(header)
+	if delay := limiter.delay(); delay != 30*time.Second {
+		t.Fatalf("expected to wait for the window to reset, got %s", delay)
+	}
+
+	now = now.Add(31 * time.Second)
+	if delay := limiter.delay(); delay != 0 {
+		t.Fatalf("expected no delay after the window reset, got %s", delay)
+	}
+}
+
+func TestRateLimiterIgnoresMissingHeaders(t *testing.T) {
+	limiter := newRateLimiter(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	header := http.Header{}
+	header.Set("X-RateLimit-Remaining", "0")
+	limiter.observe(header)
+	if delay := limiter.delay(); delay != 0 {
+		t.Fatalf("expected no delay without a reset header, got %s", delay)
+	}
+}
@@ -19,16 +19,35 @@ type TunnelConfig struct {
 	Raw     map[string]json.RawMessage
 }
 
+// Tunnel describes the configured Cloudflare Tunnel.
+type Tunnel struct {
+	ID   string
+	Name string
+	// ConfigSrc is "cloudflare" for a remotely-managed tunnel and "local" when
+	// cloudflared reads its ingress from a local config file.
+	ConfigSrc string
+}
+
 // API defines the Cloudflare operations used by the tunnel reconciler.
 type API interface {
+	GetTunnel(ctx context.Context) (Tunnel, error)
 	GetConfig(ctx context.Context) (TunnelConfig, error)
 	UpdateConfig(ctx context.Context, config TunnelConfig) error
 }
 
 // AccessRule represents an Access policy include rule.
 type AccessRule struct {
-	Email string
-	IP    string
+	Email           string
+	EmailDomain     string
+	IP              string
+	Group           string
+	Country         string
+	ServiceToken    string
+	AnyServiceToken bool
+	CommonName      string
+	Certificate     bool
+	Everyone        bool
+	AuthMethod      string
 }
 
 // AccessPolicyInput describes the payload to create or update a policy.
@@ -36,6 +55,7 @@ type AccessPolicyInput struct {
 	Name    string
 	Action  string
 	Include []AccessRule
+	Require []AccessRule
 }
 
 // AccessPolicyRecord represents an Access policy returned by the API.
@@ -44,7 +64,9 @@ type AccessPolicyRecord struct {
 	Name                string
 	Action              string
 	Include             []AccessRule
+	Require             []AccessRule
 	HasUnsupportedRules bool
+	AppCount            int
 }
 
 // AccessPolicyRef links a policy to an Access application.
@@ -55,33 +77,105 @@ type AccessPolicyRef struct {
 
 // AccessAppInput describes the payload to create or update an Access application.
 type AccessAppInput struct {
-	Name     string
-	Domain   string
-	Type     string
-	Policies []AccessPolicyRef
-	Tags     []string
+	Name               string
+	Domain             string
+	Type               string
+	Policies           []AccessPolicyRef
+	Tags               []string
+	AppLauncherVisible *bool
+	LogoURL            *string
+	AllowedIdPs        []string
+	DenyMessage        *string
+	DenyURL            *string
+	AutoRedirect       *bool
+	SkipInterstitial   *bool
+	IsolationRequired  *bool
+	SkipLauncherLogin  *bool
+	HTTPOnlyCookie     *bool
+	SameSiteCookie     *string
+	CustomPages        []string
+	CORS               *AccessCORS
+}
+
+// AccessCORS describes the CORS settings of an Access application.
+type AccessCORS struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	AllowAllOrigins  bool
+	AllowAllMethods  bool
+	AllowAllHeaders  bool
+	AllowCredentials bool
+	MaxAge           int
 }
 
-// AccessAppRecord represents an Access application returned by the API.
+// AccessAppRecord represents an Access application returned by the API. AUD
+// is the application audience tag Cloudflare generates for the app; Access
+// puts it in the aud claim of the JWTs it issues.
 type AccessAppRecord struct {
-	ID       string
-	Name     string
-	Domain   string
-	Type     string
-	Policies []AccessPolicyRef
-	Tags     []string
+	ID                 string
+	AUD                string
+	Name               string
+	Domain             string
+	Type               string
+	Policies           []AccessPolicyRef
+	Tags               []string
+	AppLauncherVisible bool
+	LogoURL            string
+	AllowedIdPs        []string
+	DenyMessage        string
+	DenyURL            string
+	AutoRedirect       bool
+	SkipInterstitial   bool
+	IsolationRequired  bool
+	SkipLauncherLogin  bool
+	HTTPOnlyCookie     bool
+	SameSiteCookie     string
+	CustomPages        []string
+	CORS               *AccessCORS
+}
+
+// AccessGroup describes an Access group configured on the account.
+type AccessGroup struct {
+	ID   string
+	Name string
+}
+
+// ServiceToken describes an Access service token configured on the account.
+type ServiceToken struct {
+	ID   string
+	Name string
+}
+
+// IdentityProvider describes an Access identity provider configured on the account.
+type IdentityProvider struct {
+	ID   string
+	Name string
+	Type string
+}
+
+// CustomPage describes an Access custom page configured on the account.
+type CustomPage struct {
+	ID   string
+	Name string
+	Type string
 }
 
 // AccessAPI defines the Cloudflare operations used for Access reconciliation.
 type AccessAPI interface {
-	ListAccessApps(ctx context.Context) ([]AccessAppRecord, error)
+	ListAccessApps(ctx context.Context, tag string) ([]AccessAppRecord, error)
 	CreateAccessApp(ctx context.Context, input AccessAppInput) (AccessAppRecord, error)
 	UpdateAccessApp(ctx context.Context, id string, input AccessAppInput) (AccessAppRecord, error)
 	DeleteAccessApp(ctx context.Context, id string) error
 	ListAccessPolicies(ctx context.Context) ([]AccessPolicyRecord, error)
+	DeleteAccessPolicy(ctx context.Context, id string) error
 	CreateAccessPolicy(ctx context.Context, input AccessPolicyInput) (AccessPolicyRecord, error)
 	UpdateAccessPolicy(ctx context.Context, id string, input AccessPolicyInput) (AccessPolicyRecord, error)
 	EnsureAccessTag(ctx context.Context, name string) error
+	ListIdentityProviders(ctx context.Context) ([]IdentityProvider, error)
+	ListAccessGroups(ctx context.Context) ([]AccessGroup, error)
+	ListServiceTokens(ctx context.Context) ([]ServiceToken, error)
+	ListCustomPages(ctx context.Context) ([]CustomPage, error)
 }
 
 // Zone describes a Cloudflare DNS zone.
@@ -1,47 +1,150 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"log/slog"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/model"
 )
 
 var dockerSecretsDir = "/run/secrets"
 
+const (
+	defaultStateFile       = "/var/lib/docker-cloudflare-tunnel-sync/state.json"
+	defaultTunnelDNSSuffix = "cfargotunnel.com"
+)
+
+// Run modes selected with SYNC_MODE.
+const (
+	ModeSync     = "sync"
+	ModeValidate = "validate"
+	ModeExport   = "export"
+)
+
+// Label sources selected with SYNC_SOURCE.
+const (
+	SourceDocker     = "docker"
+	SourceKubernetes = "kubernetes"
+)
+
+// Docker modes selected with DOCKER_MODE.
+const (
+	DockerModeContainers = "containers"
+	DockerModeSwarm      = "swarm"
+)
+
+var (
+	accountIDPattern  = regexp.MustCompile(`^[0-9a-fA-F]{32}$`)
+	tunnelIDPattern   = regexp.MustCompile(`^([0-9a-fA-F]{32}|[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12})$`)
+	tunnelNamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+)
+
 // Config captures all runtime configuration derived from environment variables and Docker secrets.
 type Config struct {
 	Docker     DockerConfig
+	Kubernetes KubernetesConfig
 	Cloudflare CloudflareConfig
 	Controller ControllerConfig
 	ManagedBy  string
 	LogLevel   slog.Level
+	Mode       string
+	Source     string
 }
 
 type DockerConfig struct {
 	Host       string
 	APIVersion string
+	// CertPath is the DOCKER_CERT_PATH directory holding ca.pem, cert.pem,
+	// and key.pem; TLS is used whenever it is set.
+	CertPath string
+	// TLSVerify is set when DOCKER_TLS_VERIFY is non-empty, matching the
+	// Docker CLI, and requires CertPath.
+	TLSVerify bool
+	// Mode is DockerModeContainers to read labels from running containers, or
+	// DockerModeSwarm to read them from Swarm services.
+	Mode string
+}
+
+// KubernetesConfig locates the API server from inside a pod, when SYNC_SOURCE
+// is kubernetes.
+type KubernetesConfig struct {
+	// APIServer is the host:port from KUBERNETES_SERVICE_HOST and
+	// KUBERNETES_SERVICE_PORT, set by Kubernetes in every pod.
+	APIServer string
+	// Namespace limits the services read to one namespace, from
+	// KUBERNETES_NAMESPACE; empty reads every namespace.
+	Namespace string
 }
 
 type CloudflareConfig struct {
-	APIToken  string
-	AccountID string
-	TunnelID  string
-	BaseURL   string
+	APIToken        string
+	AccountID       string
+	TunnelID        string
+	BaseURL         string
+	TunnelDNSSuffix string
+	UserAgentSuffix string
+	// Tunnels maps the names of the extra tunnels from CF_TUNNEL_IDS to their
+	// IDs. Routes without a cloudflare.tunnel.name label use TunnelID.
+	Tunnels map[string]string
 }
 
 type ControllerConfig struct {
-	PollInterval time.Duration
-	RunOnce      bool
-	DryRun       bool
-	ManageTunnel bool
-	ManageAccess bool
-	ManageDNS    bool
-	DNSZones     []string
-	DeleteDNS    bool
+	PollInterval      time.Duration
+	PollJitter        time.Duration
+	SyncTimeout       time.Duration
+	RouteGracePeriod  time.Duration
+	RunOnce           bool
+	Preflight         bool
+	DryRun            bool
+	ManageTunnel      bool
+	IgnoreConfigSrc   bool
+	DeleteRoutes      bool
+	EnforceRuleOrder  bool
+	PreserveUnmanaged bool
+	AppendFallback    bool
+	FallbackService   string
+	StateFile         string
+	ManageAccess      bool
+	AccessDriftCheck  bool
+	ManageDNS         bool
+	DNSZones          []string
+	DNSConcurrency    int
+	TunnelRetries     int
+	BackupKeep        int
+	MaxRemovals       int
+	ForceRemovals     bool
+	WarpRouting       *bool
+	StrictLabels      bool
+	DeleteDNS         bool
+	Components        Components
+
+	ProtectedHostnames   model.ProtectedHostnames
+	ParkedHostnames      []string
+	ParkedStatus         int
+	DefaultOriginRequest map[string]any
+	AccessPoliciesFile   string
+	RoutesFile           string
+	ErrorReportFile      string
+	BackupDir            string
+	RestoreFrom          string
+}
+
+// Components selects which resources a sync cycle reconciles, from
+// SYNC_COMPONENTS.
+type Components struct {
+	Tunnel bool
+	DNS    bool
+	Access bool
 }
 
 // Load parses configuration from environment variables and Docker secrets.
@@ -51,11 +154,34 @@ func Load() (Config, error) {
 	if err != nil {
 		return Config{}, fmt.Errorf("invalid SYNC_POLL_INTERVAL: %w", err)
 	}
+	pollJitter, err := time.ParseDuration(getEnvDefault("SYNC_POLL_JITTER", "0s"))
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid SYNC_POLL_JITTER: %w", err)
+	}
+	if pollJitter < 0 {
+		return Config{}, fmt.Errorf("invalid SYNC_POLL_JITTER: must not be negative")
+	}
+	syncTimeout, err := time.ParseDuration(getEnvDefault("SYNC_TIMEOUT", "2m"))
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid SYNC_TIMEOUT: %w", err)
+	}
+	if syncTimeout <= 0 {
+		return Config{}, fmt.Errorf("invalid SYNC_TIMEOUT: must be greater than zero")
+	}
+
+	routeGracePeriod, err := parseRouteGracePeriod()
+	if err != nil {
+		return Config{}, err
+	}
 
 	runOnce, err := parseBoolEnv("SYNC_RUN_ONCE", false)
 	if err != nil {
 		return Config{}, err
 	}
+	preflight, err := parseBoolEnv("SYNC_PREFLIGHT", false)
+	if err != nil {
+		return Config{}, err
+	}
 	dryRun, err := parseBoolEnv("SYNC_DRY_RUN", false)
 	if err != nil {
 		return Config{}, err
@@ -64,10 +190,53 @@ func Load() (Config, error) {
 	if err != nil {
 		return Config{}, err
 	}
+	ignoreConfigSrc, err := parseBoolEnv("SYNC_IGNORE_CONFIG_SRC", false)
+	if err != nil {
+		return Config{}, err
+	}
+	deleteRoutes, err := parseBoolEnv("SYNC_DELETE_ROUTES", true)
+	if err != nil {
+		return Config{}, err
+	}
+	enforceRuleOrder, err := parseBoolEnv("SYNC_ENFORCE_RULE_ORDER", true)
+	if err != nil {
+		return Config{}, err
+	}
+	takeOverRules, err := parseBoolEnv("SYNC_TAKE_OVER_RULES", false)
+	if err != nil {
+		return Config{}, err
+	}
+	// Rule ownership is the default; SYNC_TUNNEL_PRESERVE_UNMANAGED=false is
+	// still honored as the older spelling of SYNC_TAKE_OVER_RULES=true.
+	preserveUnmanaged, err := parseBoolEnv("SYNC_TUNNEL_PRESERVE_UNMANAGED", !takeOverRules)
+	if err != nil {
+		return Config{}, err
+	}
+	if preserveUnmanaged && takeOverRules {
+		return Config{}, fmt.Errorf("SYNC_TAKE_OVER_RULES=true conflicts with SYNC_TUNNEL_PRESERVE_UNMANAGED=true")
+	}
+	appendFallback, err := parseBoolEnv("SYNC_TUNNEL_APPEND_FALLBACK", true)
+	if err != nil {
+		return Config{}, err
+	}
+	fallbackService, err := parseFallbackServiceEnv("SYNC_FALLBACK_SERVICE")
+	if err != nil {
+		return Config{}, err
+	}
+	stateFile := getEnvDefault("SYNC_STATE_FILE", defaultStateFile)
+	accessPoliciesFile := strings.TrimSpace(os.Getenv("SYNC_ACCESS_POLICIES_FILE"))
+	routesFile := strings.TrimSpace(os.Getenv("SYNC_ROUTES_FILE"))
+	errorReportFile := strings.TrimSpace(os.Getenv("SYNC_ERROR_REPORT_FILE"))
+	backupDir := strings.TrimSpace(os.Getenv("SYNC_BACKUP_DIR"))
+	restoreFrom := strings.TrimSpace(os.Getenv("SYNC_RESTORE_FROM"))
 	manageAccess, err := parseBoolEnv("SYNC_MANAGED_ACCESS", false)
 	if err != nil {
 		return Config{}, err
 	}
+	accessDriftCheck, err := parseBoolEnv("SYNC_ACCESS_DRIFT_CHECK", false)
+	if err != nil {
+		return Config{}, err
+	}
 	manageDNS, err := parseBoolEnv("SYNC_MANAGED_DNS", false)
 	if err != nil {
 		return Config{}, err
@@ -77,6 +246,59 @@ func Load() (Config, error) {
 		return Config{}, err
 	}
 	dnsZones := parseDNSZonesEnv("SYNC_DNS_ZONES")
+	tunnelRetries, err := parseNonNegativeIntEnv("SYNC_TUNNEL_RETRIES", 3)
+	if err != nil {
+		return Config{}, err
+	}
+	dnsConcurrency, err := parsePositiveIntEnv("SYNC_DNS_CONCURRENCY", 4)
+	if err != nil {
+		return Config{}, err
+	}
+	backupKeep, err := parsePositiveIntEnv("SYNC_BACKUP_KEEP", 10)
+	if err != nil {
+		return Config{}, err
+	}
+	maxRemovals, err := parseNonNegativeIntEnv("SYNC_MAX_REMOVALS", 0)
+	if err != nil {
+		return Config{}, err
+	}
+	forceRemovals, err := parseBoolEnv("SYNC_FORCE_REMOVALS", false)
+	if err != nil {
+		return Config{}, err
+	}
+	warpRouting, err := parseOptionalBoolEnv("SYNC_WARP_ROUTING")
+	if err != nil {
+		return Config{}, err
+	}
+	strictLabels, err := parseBoolEnv("SYNC_STRICT_LABELS", false)
+	if err != nil {
+		return Config{}, err
+	}
+	defaultOriginRequest, err := parseJSONObjectEnv("SYNC_DEFAULT_ORIGIN_REQUEST")
+	if err != nil {
+		return Config{}, err
+	}
+	protectedHostnames, err := parseProtectedHostnamesEnv("SYNC_PROTECTED_HOSTNAMES")
+	if err != nil {
+		return Config{}, err
+	}
+	parkedHostnames, err := parseParkedHostnamesEnv("SYNC_PARKED_HOSTNAMES")
+	if err != nil {
+		return Config{}, err
+	}
+	parkedStatus, err := parseStatusCodeEnv("SYNC_PARKED_STATUS", 404)
+	if err != nil {
+		return Config{}, err
+	}
+	components, err := parseComponentsEnv("SYNC_COMPONENTS")
+	if err != nil {
+		return Config{}, err
+	}
+
+	tunnelDNSSuffix := strings.ToLower(strings.Trim(getEnvDefault("CF_TUNNEL_DNS_SUFFIX", defaultTunnelDNSSuffix), "."))
+	if tunnelDNSSuffix == "" || strings.Contains(tunnelDNSSuffix, "/") {
+		return Config{}, fmt.Errorf("invalid CF_TUNNEL_DNS_SUFFIX %q: expected a domain such as cfargotunnel.com", os.Getenv("CF_TUNNEL_DNS_SUFFIX"))
+	}
 
 	managedBy := strings.TrimSpace(os.Getenv("SYNC_MANAGED_BY"))
 
@@ -85,45 +307,180 @@ func Load() (Config, error) {
 		return Config{}, err
 	}
 
-	apiToken, err := requiredSecretOrEnv("CF_API_TOKEN")
-	if err != nil {
-		return Config{}, err
+	dockerConfig := DockerConfig{
+		Host:       strings.TrimSpace(os.Getenv("DOCKER_HOST")),
+		APIVersion: os.Getenv("DOCKER_API_VERSION"),
+		CertPath:   strings.TrimSpace(os.Getenv("DOCKER_CERT_PATH")),
+		TLSVerify:  os.Getenv("DOCKER_TLS_VERIFY") != "",
+		Mode:       strings.ToLower(strings.TrimSpace(getEnvDefault("DOCKER_MODE", DockerModeContainers))),
 	}
-	accountID, err := requiredSecretOrEnv("CF_ACCOUNT_ID")
-	if err != nil {
+	if err := validateDockerConfig(dockerConfig); err != nil {
 		return Config{}, err
 	}
-	tunnelID, err := requiredSecretOrEnv("CF_TUNNEL_ID")
+	source := strings.ToLower(strings.TrimSpace(getEnvDefault("SYNC_SOURCE", SourceDocker)))
+	kubernetesConfig := KubernetesConfig{Namespace: strings.TrimSpace(os.Getenv("KUBERNETES_NAMESPACE"))}
+	switch source {
+	case SourceDocker:
+	case SourceKubernetes:
+		host := strings.TrimSpace(os.Getenv("KUBERNETES_SERVICE_HOST"))
+		if host == "" {
+			return Config{}, fmt.Errorf("SYNC_SOURCE=kubernetes requires running in a pod: KUBERNETES_SERVICE_HOST is not set")
+		}
+		kubernetesConfig.APIServer = net.JoinHostPort(host, getEnvDefault("KUBERNETES_SERVICE_PORT", "443"))
+	default:
+		return Config{}, fmt.Errorf("invalid SYNC_SOURCE %q: expected %s or %s", source, SourceDocker, SourceKubernetes)
+	}
+	tunnels, err := parseTunnelIDsEnv("CF_TUNNEL_IDS")
 	if err != nil {
 		return Config{}, err
 	}
+	mode := strings.ToLower(getEnvDefault("SYNC_MODE", ModeSync))
+	switch mode {
+	case ModeSync, ModeExport:
+	case ModeValidate:
+		// Validation only reads labels, so Cloudflare credentials are not needed.
+		return Config{Docker: dockerConfig, Kubernetes: kubernetesConfig, Cloudflare: CloudflareConfig{Tunnels: tunnels}, Controller: ControllerConfig{SyncTimeout: syncTimeout, AccessPoliciesFile: accessPoliciesFile, RoutesFile: routesFile}, LogLevel: logLevel, Mode: mode, Source: source}, nil
+	default:
+		return Config{}, fmt.Errorf("invalid SYNC_MODE %q: expected %s, %s, or %s", mode, ModeSync, ModeValidate, ModeExport)
+	}
+
+	// Exporting only prints the ingress built from labels, so it keeps the
+	// sync settings but needs no Cloudflare credentials.
+	var apiToken, accountID, tunnelID string
+	if mode == ModeSync {
+		apiToken, err = requiredSecretOrEnv("CF_API_TOKEN")
+		if err != nil {
+			return Config{}, err
+		}
+		accountID, err = requiredSecretOrEnv("CF_ACCOUNT_ID")
+		if err != nil {
+			return Config{}, err
+		}
+		tunnelID, err = requiredSecretOrEnv("CF_TUNNEL_ID")
+		if err != nil {
+			return Config{}, err
+		}
+		if !accountIDPattern.MatchString(accountID) {
+			return Config{}, fmt.Errorf("invalid CF_ACCOUNT_ID %q: expected a 32-character hexadecimal Cloudflare account ID", accountID)
+		}
+		if !tunnelIDPattern.MatchString(tunnelID) {
+			return Config{}, fmt.Errorf("invalid CF_TUNNEL_ID %q: expected a tunnel UUID (for example c1744f8b-faa1-48a4-9e5c-02ac921467fa)", tunnelID)
+		}
+		for name, id := range tunnels {
+			if strings.EqualFold(strings.ReplaceAll(id, "-", ""), strings.ReplaceAll(tunnelID, "-", "")) {
+				return Config{}, fmt.Errorf("invalid CF_TUNNEL_IDS entry %s: tunnel %s is already CF_TUNNEL_ID", name, id)
+			}
+		}
+	}
 
 	return Config{
-		Docker: DockerConfig{
-			Host:       os.Getenv("DOCKER_HOST"),
-			APIVersion: os.Getenv("DOCKER_API_VERSION"),
-		},
+		Docker:     dockerConfig,
+		Kubernetes: kubernetesConfig,
 		Cloudflare: CloudflareConfig{
-			APIToken:  apiToken,
-			AccountID: accountID,
-			TunnelID:  tunnelID,
-			BaseURL:   os.Getenv("CF_API_BASE_URL"),
+			APIToken:        apiToken,
+			AccountID:       accountID,
+			TunnelID:        tunnelID,
+			BaseURL:         os.Getenv("CF_API_BASE_URL"),
+			TunnelDNSSuffix: tunnelDNSSuffix,
+			UserAgentSuffix: os.Getenv("SYNC_USER_AGENT_SUFFIX"),
+			Tunnels:         tunnels,
 		},
 		Controller: ControllerConfig{
-			PollInterval: parsedInterval,
-			RunOnce:      runOnce,
-			DryRun:       dryRun,
-			ManageTunnel: manageTunnel,
-			ManageAccess: manageAccess,
-			ManageDNS:    manageDNS,
-			DNSZones:     dnsZones,
-			DeleteDNS:    deleteDNS,
+			PollInterval:      parsedInterval,
+			PollJitter:        pollJitter,
+			SyncTimeout:       syncTimeout,
+			RouteGracePeriod:  routeGracePeriod,
+			RunOnce:           runOnce,
+			Preflight:         preflight,
+			DryRun:            dryRun,
+			ManageTunnel:      manageTunnel,
+			IgnoreConfigSrc:   ignoreConfigSrc,
+			DeleteRoutes:      deleteRoutes,
+			EnforceRuleOrder:  enforceRuleOrder,
+			PreserveUnmanaged: preserveUnmanaged,
+			AppendFallback:    appendFallback,
+			FallbackService:   fallbackService,
+			StateFile:         stateFile,
+			ManageAccess:      manageAccess,
+			AccessDriftCheck:  accessDriftCheck,
+			ManageDNS:         manageDNS,
+			DNSZones:          dnsZones,
+			DNSConcurrency:    dnsConcurrency,
+			TunnelRetries:     tunnelRetries,
+			BackupKeep:        backupKeep,
+			MaxRemovals:       maxRemovals,
+			ForceRemovals:     forceRemovals,
+			WarpRouting:       warpRouting,
+			StrictLabels:      strictLabels,
+			DeleteDNS:         deleteDNS,
+			Components:        components,
+
+			ProtectedHostnames:   protectedHostnames,
+			ParkedHostnames:      parkedHostnames,
+			ParkedStatus:         parkedStatus,
+			DefaultOriginRequest: defaultOriginRequest,
+			AccessPoliciesFile:   accessPoliciesFile,
+			RoutesFile:           routesFile,
+			ErrorReportFile:      errorReportFile,
+			BackupDir:            backupDir,
+			RestoreFrom:          restoreFrom,
 		},
 		ManagedBy: managedBy,
 		LogLevel:  logLevel,
+		Mode:      mode,
+		Source:    source,
 	}, nil
 }
 
+// dockerTLSFiles are the files the Docker CLI expects in DOCKER_CERT_PATH.
+var dockerTLSFiles = []string{"ca.pem", "cert.pem", "key.pem"}
+
+// validateDockerConfig checks DOCKER_MODE, the DOCKER_HOST scheme, and the TLS
+// settings up front, so a remote daemon is not silently contacted without TLS.
+func validateDockerConfig(docker DockerConfig) error {
+	if docker.Mode != DockerModeContainers && docker.Mode != DockerModeSwarm {
+		return fmt.Errorf("invalid DOCKER_MODE %q: expected %s or %s", docker.Mode, DockerModeContainers, DockerModeSwarm)
+	}
+	scheme := ""
+	if docker.Host != "" {
+		hostURL, err := url.Parse(docker.Host)
+		if err != nil {
+			return fmt.Errorf("invalid DOCKER_HOST %q: %w (wrap IPv6 addresses in brackets, for example tcp://[2001:db8::1]:2376)", docker.Host, err)
+		}
+		scheme = hostURL.Scheme
+		switch scheme {
+		case "unix", "npipe":
+		case "tcp", "http", "https":
+			if _, _, err := net.SplitHostPort(hostURL.Host); err != nil {
+				return fmt.Errorf("invalid DOCKER_HOST %q: expected host:port, with IPv6 addresses in brackets such as tcp://[2001:db8::1]:2376", docker.Host)
+			}
+		default:
+			return fmt.Errorf("invalid DOCKER_HOST %q: expected a unix://, tcp://, or npipe:// address", docker.Host)
+		}
+	}
+
+	if docker.TLSVerify {
+		if docker.CertPath == "" {
+			return fmt.Errorf("DOCKER_TLS_VERIFY is set but DOCKER_CERT_PATH is empty; set it to a directory containing %s", strings.Join(dockerTLSFiles, ", "))
+		}
+		if scheme != "tcp" && scheme != "https" {
+			return fmt.Errorf("DOCKER_TLS_VERIFY is set but DOCKER_HOST %q is not a tcp:// address", docker.Host)
+		}
+	}
+	if docker.CertPath != "" {
+		missing := []string{}
+		for _, name := range dockerTLSFiles {
+			if _, err := os.Stat(filepath.Join(docker.CertPath, name)); err != nil {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("invalid DOCKER_CERT_PATH %q: missing %s", docker.CertPath, strings.Join(missing, ", "))
+		}
+	}
+	return nil
+}
+
 func requiredSecretOrEnv(key string) (string, error) {
 	if value, ok, err := dockerSecret(key); err != nil {
 		return "", err
@@ -154,6 +511,31 @@ func dockerSecret(key string) (string, bool, error) {
 	return value, true, nil
 }
 
+// parseRouteGracePeriod reads SYNC_ROUTE_GRACE_PERIOD or its alias
+// SYNC_INGRESS_REMOVE_GRACE; when both are set they must match.
+func parseRouteGracePeriod() (time.Duration, error) {
+	period := time.Duration(0)
+	set := false
+	for _, key := range []string{"SYNC_ROUTE_GRACE_PERIOD", "SYNC_INGRESS_REMOVE_GRACE"} {
+		value := strings.TrimSpace(os.Getenv(key))
+		if value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s: %w", key, err)
+		}
+		if parsed < 0 {
+			return 0, fmt.Errorf("invalid %s: must not be negative", key)
+		}
+		if set && parsed != period {
+			return 0, fmt.Errorf("invalid %s: does not match SYNC_ROUTE_GRACE_PERIOD", key)
+		}
+		period, set = parsed, true
+	}
+	return period, nil
+}
+
 func getEnvDefault(key, fallback string) string {
 	value := strings.TrimSpace(os.Getenv(key))
 	if value == "" {
@@ -185,6 +567,218 @@ func parseDNSZonesEnv(key string) []string {
 	return zones
 }
 
+// parseJSONObjectEnv reads a JSON object; an unset or empty value yields nil.
+func parseJSONObjectEnv(key string) (map[string]any, error) {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return nil, nil
+	}
+	object := map[string]any{}
+	if err := json.Unmarshal([]byte(value), &object); err != nil || object == nil {
+		return nil, fmt.Errorf("invalid %s: expected a JSON object", key)
+	}
+	if len(object) == 0 {
+		return nil, nil
+	}
+	return object, nil
+}
+
+// parseProtectedHostnamesEnv reads a comma-separated list of hostnames; a
+// leading "*." protects every subdomain of the rest.
+func parseProtectedHostnamesEnv(key string) (model.ProtectedHostnames, error) {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return nil, nil
+	}
+
+	seen := map[string]struct{}{}
+	protected := model.ProtectedHostnames{}
+	for _, part := range strings.Split(value, ",") {
+		hostname := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(part), "."))
+		if hostname == "" {
+			continue
+		}
+		name := strings.TrimPrefix(hostname, "*.")
+		if name == "" || strings.ContainsAny(name, "*/: ") {
+			return nil, fmt.Errorf("invalid %s entry %q: expected a hostname or *.domain", key, strings.TrimSpace(part))
+		}
+		if _, ok := seen[hostname]; ok {
+			continue
+		}
+		seen[hostname] = struct{}{}
+		protected = append(protected, hostname)
+	}
+	return protected, nil
+}
+
+// parseParkedHostnamesEnv reads a comma-separated list of hostnames. Unlike
+// SYNC_PROTECTED_HOSTNAMES, wildcards are not accepted: each entry becomes its
+// own ingress rule and DNS record.
+func parseParkedHostnamesEnv(key string) ([]string, error) {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return nil, nil
+	}
+
+	seen := map[string]struct{}{}
+	parked := []string{}
+	for _, part := range strings.Split(value, ",") {
+		hostname := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(part), "."))
+		if hostname == "" {
+			continue
+		}
+		if strings.ContainsAny(hostname, "*/: ") || !strings.Contains(hostname, ".") {
+			return nil, fmt.Errorf("invalid %s entry %q: expected a hostname such as parked.example.com", key, strings.TrimSpace(part))
+		}
+		if _, ok := seen[hostname]; ok {
+			continue
+		}
+		seen[hostname] = struct{}{}
+		parked = append(parked, hostname)
+	}
+	return parked, nil
+}
+
+// parseComponentsEnv reads a comma-separated list of tunnel, dns, and access;
+// an unset value enables all three.
+func parseComponentsEnv(key string) (Components, error) {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return Components{Tunnel: true, DNS: true, Access: true}, nil
+	}
+
+	components := Components{}
+	for _, part := range strings.Split(value, ",") {
+		switch strings.ToLower(strings.TrimSpace(part)) {
+		case "tunnel":
+			components.Tunnel = true
+		case "dns":
+			components.DNS = true
+		case "access":
+			components.Access = true
+		case "":
+		default:
+			return Components{}, fmt.Errorf("invalid %s entry %q: expected tunnel, dns, or access", key, strings.TrimSpace(part))
+		}
+	}
+	if components == (Components{}) {
+		return Components{}, fmt.Errorf("invalid %s %q: expected at least one of tunnel, dns, or access", key, value)
+	}
+	return components, nil
+}
+
+// parseTunnelIDsEnv reads extra tunnels as comma-separated name=id pairs,
+// such as lab=c1744f8b-faa1-48a4-9e5c-02ac921467fa. Names are lowercased.
+func parseTunnelIDsEnv(key string) (map[string]string, error) {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return nil, nil
+	}
+
+	tunnels := map[string]string{}
+	seen := map[string]string{}
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, id, ok := strings.Cut(part, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		id = strings.TrimSpace(id)
+		if !ok || !tunnelNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid %s entry %q: expected name=tunnel-id with a name of lowercase letters, digits, and dashes", key, part)
+		}
+		if !tunnelIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("invalid %s entry %q: expected a tunnel UUID (for example c1744f8b-faa1-48a4-9e5c-02ac921467fa)", key, part)
+		}
+		if _, ok := tunnels[name]; ok {
+			return nil, fmt.Errorf("invalid %s: tunnel name %s is listed more than once", key, name)
+		}
+		normalizedID := strings.ToLower(strings.ReplaceAll(id, "-", ""))
+		if other, ok := seen[normalizedID]; ok {
+			return nil, fmt.Errorf("invalid %s: tunnel %s is listed as both %s and %s", key, id, other, name)
+		}
+		seen[normalizedID] = name
+		tunnels[name] = id
+	}
+	if len(tunnels) == 0 {
+		return nil, nil
+	}
+	return tunnels, nil
+}
+
+// parseFallbackServiceEnv reads the catch-all ingress service. It accepts the
+// service forms cloudflared allows on a catch-all rule: http_status:<code>,
+// hello_world, a unix socket, or an origin URL.
+func parseFallbackServiceEnv(key string) (string, error) {
+	value := getEnvDefault(key, model.FallbackService)
+	switch {
+	case strings.HasPrefix(value, "http_status:"):
+		code, err := strconv.Atoi(strings.TrimPrefix(value, "http_status:"))
+		if err != nil || code < 100 || code > 599 {
+			return "", fmt.Errorf("invalid %s %q: expected an HTTP status code such as http_status:404", key, value)
+		}
+	case value == "hello_world":
+	case strings.HasPrefix(value, "unix:/"), strings.HasPrefix(value, "unix+tls:/"):
+	default:
+		parsed, err := url.Parse(value)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return "", fmt.Errorf("invalid %s %q: expected http_status:<code>, hello_world, a unix socket, or a URL such as http://error-pages:8080", key, value)
+		}
+	}
+	return value, nil
+}
+
+func parseStatusCodeEnv(key string, fallback int) (int, error) {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 100 || parsed > 599 {
+		return 0, fmt.Errorf("invalid %s: expected an HTTP status code between 100 and 599, got %q", key, value)
+	}
+	return parsed, nil
+}
+
+func parsePositiveIntEnv(key string, fallback int) (int, error) {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 1 {
+		return 0, fmt.Errorf("invalid %s: expected a positive integer, got %q", key, value)
+	}
+	return parsed, nil
+}
+
+func parseNonNegativeIntEnv(key string, fallback int) (int, error) {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 0 {
+		return 0, fmt.Errorf("invalid %s: expected a non-negative integer, got %q", key, value)
+	}
+	return parsed, nil
+}
+
+// parseOptionalBoolEnv returns nil when key is unset, so the setting is left
+// alone rather than defaulted.
+func parseOptionalBoolEnv(key string) (*bool, error) {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := parseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return &parsed, nil
+}
+
 func parseBoolEnv(key string, fallback bool) (bool, error) {
 	value := strings.TrimSpace(os.Getenv(key))
 	if value == "" {
@@ -1,17 +1,29 @@
 package config
 
 import (
+	"maps"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
+)
+
+const (
+	testAccountID   = "0123456789abcdef0123456789abcdef"
+	testTunnelID    = "c1744f8b-faa1-48a4-9e5c-02ac921467fa"
+	secretAccountID = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	secretTunnelID  = "11111111-2222-3333-4444-555555555555"
+	envAccountID    = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	envTunnelID     = "66666666-7777-8888-9999-000000000000"
 )
 
 func TestLoadParsesDNSZones(t *testing.T) {
 	withDockerSecretsDir(t, t.TempDir())
 	t.Setenv("CF_API_TOKEN", "token")
-	t.Setenv("CF_ACCOUNT_ID", "account")
-	t.Setenv("CF_TUNNEL_ID", "tunnel")
+	t.Setenv("CF_ACCOUNT_ID", testAccountID)
+	t.Setenv("CF_TUNNEL_ID", testTunnelID)
 	t.Setenv("SYNC_DNS_ZONES", "darkdragon.fr, cf.darkdragon.fr. ,darkdragon.fr,,CF.Darkdragon.FR")
 
 	cfg, err := Load()
@@ -28,8 +40,8 @@ func TestLoadParsesDNSZones(t *testing.T) {
 func TestLoadDefaultsEmptyDNSZones(t *testing.T) {
 	withDockerSecretsDir(t, t.TempDir())
 	t.Setenv("CF_API_TOKEN", "token")
-	t.Setenv("CF_ACCOUNT_ID", "account")
-	t.Setenv("CF_TUNNEL_ID", "tunnel")
+	t.Setenv("CF_ACCOUNT_ID", testAccountID)
+	t.Setenv("CF_TUNNEL_ID", testTunnelID)
 	t.Setenv("SYNC_DNS_ZONES", "  , ,  ")
 
 	cfg, err := Load()
@@ -42,15 +54,77 @@ func TestLoadDefaultsEmptyDNSZones(t *testing.T) {
 	}
 }
 
+func TestLoadParsesDNSConcurrency(t *testing.T) {
+	withDockerSecretsDir(t, t.TempDir())
+	t.Setenv("CF_API_TOKEN", "token")
+	t.Setenv("CF_ACCOUNT_ID", testAccountID)
+	t.Setenv("CF_TUNNEL_ID", testTunnelID)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Controller.DNSConcurrency != 4 {
+		t.Fatalf("expected default DNS concurrency 4, got %d", cfg.Controller.DNSConcurrency)
+	}
+
+	t.Setenv("SYNC_DNS_CONCURRENCY", "8")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Controller.DNSConcurrency != 8 {
+		t.Fatalf("expected DNS concurrency 8, got %d", cfg.Controller.DNSConcurrency)
+	}
+
+	for _, value := range []string{"0", "-1", "many"} {
+		t.Setenv("SYNC_DNS_CONCURRENCY", value)
+		if _, err := Load(); err == nil {
+			t.Fatalf("expected error for SYNC_DNS_CONCURRENCY=%q", value)
+		}
+	}
+}
+
+func TestLoadParsesTunnelRetries(t *testing.T) {
+	withDockerSecretsDir(t, t.TempDir())
+	t.Setenv("CF_API_TOKEN", "token")
+	t.Setenv("CF_ACCOUNT_ID", testAccountID)
+	t.Setenv("CF_TUNNEL_ID", testTunnelID)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Controller.TunnelRetries != 3 {
+		t.Fatalf("expected default tunnel retries 3, got %d", cfg.Controller.TunnelRetries)
+	}
+
+	t.Setenv("SYNC_TUNNEL_RETRIES", "0")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Controller.TunnelRetries != 0 {
+		t.Fatalf("expected retries to be disabled, got %d", cfg.Controller.TunnelRetries)
+	}
+
+	for _, value := range []string{"-1", "many"} {
+		t.Setenv("SYNC_TUNNEL_RETRIES", value)
+		if _, err := Load(); err == nil {
+			t.Fatalf("expected error for SYNC_TUNNEL_RETRIES=%q", value)
+		}
+	}
+}
+
 func TestLoadReadsSensitiveValuesFromDockerSecrets(t *testing.T) {
 	secretDir := t.TempDir()
 	withDockerSecretsDir(t, secretDir)
 	writeDockerSecret(t, secretDir, "CF_API_TOKEN", " secret-token\n")
-	writeDockerSecret(t, secretDir, "CF_ACCOUNT_ID", " secret-account\n")
-	writeDockerSecret(t, secretDir, "CF_TUNNEL_ID", " secret-tunnel\n")
+	writeDockerSecret(t, secretDir, "CF_ACCOUNT_ID", " "+secretAccountID+"\n")
+	writeDockerSecret(t, secretDir, "CF_TUNNEL_ID", " "+secretTunnelID+"\n")
 	t.Setenv("CF_API_TOKEN", "env-token")
-	t.Setenv("CF_ACCOUNT_ID", "env-account")
-	t.Setenv("CF_TUNNEL_ID", "env-tunnel")
+	t.Setenv("CF_ACCOUNT_ID", envAccountID)
+	t.Setenv("CF_TUNNEL_ID", envTunnelID)
 
 	cfg, err := Load()
 	if err != nil {
@@ -60,10 +134,10 @@ func TestLoadReadsSensitiveValuesFromDockerSecrets(t *testing.T) {
 	if cfg.Cloudflare.APIToken != "secret-token" {
 		t.Fatalf("unexpected API token: got %q", cfg.Cloudflare.APIToken)
 	}
-	if cfg.Cloudflare.AccountID != "secret-account" {
+	if cfg.Cloudflare.AccountID != secretAccountID {
 		t.Fatalf("unexpected account ID: got %q", cfg.Cloudflare.AccountID)
 	}
-	if cfg.Cloudflare.TunnelID != "secret-tunnel" {
+	if cfg.Cloudflare.TunnelID != secretTunnelID {
 		t.Fatalf("unexpected tunnel ID: got %q", cfg.Cloudflare.TunnelID)
 	}
 }
@@ -71,8 +145,8 @@ func TestLoadReadsSensitiveValuesFromDockerSecrets(t *testing.T) {
 func TestLoadFallsBackToEnvWhenDockerSecretsAreMissing(t *testing.T) {
 	withDockerSecretsDir(t, t.TempDir())
 	t.Setenv("CF_API_TOKEN", "env-token")
-	t.Setenv("CF_ACCOUNT_ID", "env-account")
-	t.Setenv("CF_TUNNEL_ID", "env-tunnel")
+	t.Setenv("CF_ACCOUNT_ID", envAccountID)
+	t.Setenv("CF_TUNNEL_ID", envTunnelID)
 
 	cfg, err := Load()
 	if err != nil {
@@ -82,14 +156,583 @@ func TestLoadFallsBackToEnvWhenDockerSecretsAreMissing(t *testing.T) {
 	if cfg.Cloudflare.APIToken != "env-token" {
 		t.Fatalf("unexpected API token: got %q", cfg.Cloudflare.APIToken)
 	}
-	if cfg.Cloudflare.AccountID != "env-account" {
+	if cfg.Cloudflare.AccountID != envAccountID {
 		t.Fatalf("unexpected account ID: got %q", cfg.Cloudflare.AccountID)
 	}
-	if cfg.Cloudflare.TunnelID != "env-tunnel" {
+	if cfg.Cloudflare.TunnelID != envTunnelID {
 		t.Fatalf("unexpected tunnel ID: got %q", cfg.Cloudflare.TunnelID)
 	}
 }
 
+func TestLoadParsesSyncTimeout(t *testing.T) {
+	withDockerSecretsDir(t, t.TempDir())
+	t.Setenv("CF_API_TOKEN", "token")
+	t.Setenv("CF_ACCOUNT_ID", testAccountID)
+	t.Setenv("CF_TUNNEL_ID", testTunnelID)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Controller.SyncTimeout != 2*time.Minute {
+		t.Fatalf("unexpected default sync timeout: got %s", cfg.Controller.SyncTimeout)
+	}
+
+	t.Setenv("SYNC_TIMEOUT", "45s")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Controller.SyncTimeout != 45*time.Second {
+		t.Fatalf("unexpected sync timeout: got %s", cfg.Controller.SyncTimeout)
+	}
+
+	t.Setenv("SYNC_TIMEOUT", "0s")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected error for non-positive SYNC_TIMEOUT")
+	}
+}
+
+func TestLoadParsesRouteGracePeriod(t *testing.T) {
+	withDockerSecretsDir(t, t.TempDir())
+	t.Setenv("CF_API_TOKEN", "token")
+	t.Setenv("CF_ACCOUNT_ID", testAccountID)
+	t.Setenv("CF_TUNNEL_ID", testTunnelID)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Controller.RouteGracePeriod != 0 {
+		t.Fatalf("expected no grace period by default, got %s", cfg.Controller.RouteGracePeriod)
+	}
+
+	t.Setenv("SYNC_INGRESS_REMOVE_GRACE", "60s")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Controller.RouteGracePeriod != time.Minute {
+		t.Fatalf("expected the alias to set the grace period, got %s", cfg.Controller.RouteGracePeriod)
+	}
+
+	t.Setenv("SYNC_ROUTE_GRACE_PERIOD", "1m")
+	if _, err := Load(); err != nil {
+		t.Fatalf("expected matching grace periods to be accepted, got %v", err)
+	}
+
+	t.Setenv("SYNC_ROUTE_GRACE_PERIOD", "2m")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected error when SYNC_INGRESS_REMOVE_GRACE does not match SYNC_ROUTE_GRACE_PERIOD")
+	}
+
+	t.Setenv("SYNC_INGRESS_REMOVE_GRACE", "")
+	t.Setenv("SYNC_ROUTE_GRACE_PERIOD", "-1s")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected error for negative SYNC_ROUTE_GRACE_PERIOD")
+	}
+}
+
+func TestLoadParsesPollJitter(t *testing.T) {
+	withDockerSecretsDir(t, t.TempDir())
+	t.Setenv("CF_API_TOKEN", "token")
+	t.Setenv("CF_ACCOUNT_ID", testAccountID)
+	t.Setenv("CF_TUNNEL_ID", testTunnelID)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Controller.PollJitter != 0 {
+		t.Fatalf("expected no jitter by default, got %s", cfg.Controller.PollJitter)
+	}
+
+	t.Setenv("SYNC_POLL_JITTER", "5s")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Controller.PollJitter != 5*time.Second {
+		t.Fatalf("unexpected poll jitter: got %s", cfg.Controller.PollJitter)
+	}
+
+	t.Setenv("SYNC_POLL_JITTER", "-1s")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected error for negative SYNC_POLL_JITTER")
+	}
+}
+
+func TestLoadParsesTunnelDNSSuffix(t *testing.T) {
+	withDockerSecretsDir(t, t.TempDir())
+	t.Setenv("CF_API_TOKEN", "token")
+	t.Setenv("CF_ACCOUNT_ID", testAccountID)
+	t.Setenv("CF_TUNNEL_ID", testTunnelID)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Cloudflare.TunnelDNSSuffix != "cfargotunnel.com" {
+		t.Fatalf("unexpected default tunnel DNS suffix: got %q", cfg.Cloudflare.TunnelDNSSuffix)
+	}
+
+	t.Setenv("CF_TUNNEL_DNS_SUFFIX", ".CFArgoTunnel.com.cn.")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Cloudflare.TunnelDNSSuffix != "cfargotunnel.com.cn" {
+		t.Fatalf("unexpected tunnel DNS suffix: got %q", cfg.Cloudflare.TunnelDNSSuffix)
+	}
+
+	t.Setenv("CF_TUNNEL_DNS_SUFFIX", "https://example.com/")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected error for malformed CF_TUNNEL_DNS_SUFFIX")
+	}
+}
+
+func TestLoadParsesComponents(t *testing.T) {
+	withDockerSecretsDir(t, t.TempDir())
+	t.Setenv("CF_API_TOKEN", "token")
+	t.Setenv("CF_ACCOUNT_ID", testAccountID)
+	t.Setenv("CF_TUNNEL_ID", testTunnelID)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Controller.Components != (Components{Tunnel: true, DNS: true, Access: true}) {
+		t.Fatalf("expected all components by default, got %+v", cfg.Controller.Components)
+	}
+
+	t.Setenv("SYNC_COMPONENTS", " DNS, access ,")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Controller.Components != (Components{DNS: true, Access: true}) {
+		t.Fatalf("unexpected components: %+v", cfg.Controller.Components)
+	}
+
+	t.Setenv("SYNC_COMPONENTS", "tunnel,ingress")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected error for unknown SYNC_COMPONENTS entry")
+	}
+	t.Setenv("SYNC_COMPONENTS", " , ")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected error for empty SYNC_COMPONENTS")
+	}
+}
+
+func TestLoadParsesProtectedHostnames(t *testing.T) {
+	withDockerSecretsDir(t, t.TempDir())
+	t.Setenv("CF_API_TOKEN", "token")
+	t.Setenv("CF_ACCOUNT_ID", testAccountID)
+	t.Setenv("CF_TUNNEL_ID", testTunnelID)
+	t.Setenv("SYNC_PROTECTED_HOSTNAMES", " Mail.Example.com., *.vpn.example.com,,mail.example.com")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	protected := cfg.Controller.ProtectedHostnames
+	if len(protected) != 2 || protected[0] != "mail.example.com" || protected[1] != "*.vpn.example.com" {
+		t.Fatalf("unexpected protected hostnames: %+v", protected)
+	}
+	if !protected.Match("a.b.vpn.example.com") || protected.Match("vpn.example.com") || protected.Match("evilvpn.example.com") {
+		t.Fatalf("unexpected wildcard matching for %+v", protected)
+	}
+
+	for _, value := range []string{"mail.*.example.com", "*.", "https://mail.example.com"} {
+		t.Setenv("SYNC_PROTECTED_HOSTNAMES", value)
+		if _, err := Load(); err == nil {
+			t.Fatalf("expected error for SYNC_PROTECTED_HOSTNAMES=%q", value)
+		}
+	}
+}
+
+func TestLoadParsesParkedHostnames(t *testing.T) {
+	withDockerSecretsDir(t, t.TempDir())
+	t.Setenv("CF_API_TOKEN", "token")
+	t.Setenv("CF_ACCOUNT_ID", testAccountID)
+	t.Setenv("CF_TUNNEL_ID", testTunnelID)
+	t.Setenv("SYNC_PARKED_HOSTNAMES", " Parked.Example.com., other.example.net,,parked.example.com")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	parked := cfg.Controller.ParkedHostnames
+	if len(parked) != 2 || parked[0] != "parked.example.com" || parked[1] != "other.example.net" {
+		t.Fatalf("unexpected parked hostnames: %+v", parked)
+	}
+	if cfg.Controller.ParkedStatus != 404 {
+		t.Fatalf("expected default parked status 404, got %d", cfg.Controller.ParkedStatus)
+	}
+
+	t.Setenv("SYNC_PARKED_STATUS", "410")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Controller.ParkedStatus != 410 {
+		t.Fatalf("expected parked status 410, got %d", cfg.Controller.ParkedStatus)
+	}
+
+	for _, value := range []string{"*.example.com", "localhost", "https://parked.example.com"} {
+		t.Setenv("SYNC_PARKED_HOSTNAMES", value)
+		if _, err := Load(); err == nil {
+			t.Fatalf("expected error for SYNC_PARKED_HOSTNAMES=%q", value)
+		}
+	}
+	t.Setenv("SYNC_PARKED_HOSTNAMES", "parked.example.com")
+	for _, value := range []string{"99", "600", "gone"} {
+		t.Setenv("SYNC_PARKED_STATUS", value)
+		if _, err := Load(); err == nil {
+			t.Fatalf("expected error for SYNC_PARKED_STATUS=%q", value)
+		}
+	}
+}
+
+func TestLoadParsesDefaultOriginRequest(t *testing.T) {
+	withDockerSecretsDir(t, t.TempDir())
+	t.Setenv("CF_API_TOKEN", "token")
+	t.Setenv("CF_ACCOUNT_ID", testAccountID)
+	t.Setenv("CF_TUNNEL_ID", testTunnelID)
+	t.Setenv("SYNC_DEFAULT_ORIGIN_REQUEST", `{"noTLSVerify":false,"connectTimeout":"10s"}`)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defaults := cfg.Controller.DefaultOriginRequest
+	if len(defaults) != 2 || defaults["noTLSVerify"] != false || defaults["connectTimeout"] != "10s" {
+		t.Fatalf("unexpected default originRequest: %+v", defaults)
+	}
+
+	for _, value := range []string{"[]", "null", "connectTimeout=10s"} {
+		t.Setenv("SYNC_DEFAULT_ORIGIN_REQUEST", value)
+		if _, err := Load(); err == nil {
+			t.Fatalf("expected error for SYNC_DEFAULT_ORIGIN_REQUEST=%q", value)
+		}
+	}
+}
+
+func TestLoadParsesRuleOwnership(t *testing.T) {
+	withDockerSecretsDir(t, t.TempDir())
+	t.Setenv("CF_API_TOKEN", "token")
+	t.Setenv("CF_ACCOUNT_ID", testAccountID)
+	t.Setenv("CF_TUNNEL_ID", testTunnelID)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.Controller.PreserveUnmanaged {
+		t.Fatalf("expected unmanaged rules to be preserved by default")
+	}
+
+	t.Setenv("SYNC_TAKE_OVER_RULES", "true")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Controller.PreserveUnmanaged {
+		t.Fatalf("expected SYNC_TAKE_OVER_RULES to disable rule ownership")
+	}
+
+	t.Setenv("SYNC_TUNNEL_PRESERVE_UNMANAGED", "true")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected error for conflicting ownership settings")
+	}
+
+	t.Setenv("SYNC_TAKE_OVER_RULES", "")
+	t.Setenv("SYNC_TUNNEL_PRESERVE_UNMANAGED", "false")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Controller.PreserveUnmanaged {
+		t.Fatalf("expected SYNC_TUNNEL_PRESERVE_UNMANAGED=false to take over rules")
+	}
+}
+
+func TestLoadParsesFallbackService(t *testing.T) {
+	withDockerSecretsDir(t, t.TempDir())
+	t.Setenv("CF_API_TOKEN", "token")
+	t.Setenv("CF_ACCOUNT_ID", testAccountID)
+	t.Setenv("CF_TUNNEL_ID", testTunnelID)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Controller.FallbackService != "http_status:404" {
+		t.Fatalf("expected default fallback service, got %q", cfg.Controller.FallbackService)
+	}
+
+	for _, value := range []string{"http_status:503", "http://error-pages:8080", "hello_world", "unix:/run/errors.sock"} {
+		t.Setenv("SYNC_FALLBACK_SERVICE", value)
+		cfg, err = Load()
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", value, err)
+		}
+		if cfg.Controller.FallbackService != value {
+			t.Fatalf("expected fallback service %q, got %q", value, cfg.Controller.FallbackService)
+		}
+	}
+
+	for _, value := range []string{"http_status:abc", "http_status:999", "error-pages:8080"} {
+		t.Setenv("SYNC_FALLBACK_SERVICE", value)
+		if _, err := Load(); err == nil {
+			t.Fatalf("expected error for SYNC_FALLBACK_SERVICE %q", value)
+		}
+	}
+}
+
+func TestLoadValidatesDockerHostAndTLS(t *testing.T) {
+	withDockerSecretsDir(t, t.TempDir())
+	t.Setenv("CF_API_TOKEN", "token")
+	t.Setenv("CF_ACCOUNT_ID", testAccountID)
+	t.Setenv("CF_TUNNEL_ID", testTunnelID)
+
+	t.Setenv("DOCKER_HOST", "tcp://[2001:db8::1]:2376")
+	if _, err := Load(); err != nil {
+		t.Fatalf("unexpected error for bracketed IPv6 host: %v", err)
+	}
+	for _, host := range []string{"tcp://2001:db8::1:2376", "ssh://user@docker", "tcp://"} {
+		t.Setenv("DOCKER_HOST", host)
+		if _, err := Load(); err == nil {
+			t.Fatalf("expected error for DOCKER_HOST %q", host)
+		}
+	}
+
+	t.Setenv("DOCKER_HOST", "tcp://docker.example.com:2376")
+	t.Setenv("DOCKER_TLS_VERIFY", "1")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "DOCKER_CERT_PATH is empty") {
+		t.Fatalf("expected missing DOCKER_CERT_PATH error, got %v", err)
+	}
+
+	certPath := t.TempDir()
+	t.Setenv("DOCKER_CERT_PATH", certPath)
+	if err := os.WriteFile(filepath.Join(certPath, "ca.pem"), []byte("ca"), 0o600); err != nil {
+		t.Fatalf("write ca.pem: %v", err)
+	}
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "missing cert.pem, key.pem") {
+		t.Fatalf("expected missing certificate files error, got %v", err)
+	}
+
+	for _, name := range []string{"cert.pem", "key.pem"} {
+		if err := os.WriteFile(filepath.Join(certPath, name), []byte(name), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.Docker.TLSVerify || cfg.Docker.CertPath != certPath {
+		t.Fatalf("unexpected Docker TLS config: %+v", cfg.Docker)
+	}
+
+	t.Setenv("DOCKER_HOST", "unix:///var/run/docker.sock")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "not a tcp:// address") {
+		t.Fatalf("expected TLS host scheme error, got %v", err)
+	}
+}
+
+func TestLoadDockerMode(t *testing.T) {
+	withDockerSecretsDir(t, t.TempDir())
+	t.Setenv("CF_API_TOKEN", "token")
+	t.Setenv("CF_ACCOUNT_ID", testAccountID)
+	t.Setenv("CF_TUNNEL_ID", testTunnelID)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Docker.Mode != DockerModeContainers {
+		t.Fatalf("expected containers mode by default, got %q", cfg.Docker.Mode)
+	}
+
+	t.Setenv("DOCKER_MODE", "Swarm")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Docker.Mode != DockerModeSwarm {
+		t.Fatalf("expected swarm mode, got %q", cfg.Docker.Mode)
+	}
+
+	t.Setenv("DOCKER_MODE", "kubernetes")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "invalid DOCKER_MODE") {
+		t.Fatalf("expected invalid DOCKER_MODE error, got %v", err)
+	}
+}
+
+func TestLoadParsesWarpRouting(t *testing.T) {
+	withDockerSecretsDir(t, t.TempDir())
+	t.Setenv("CF_API_TOKEN", "token")
+	t.Setenv("CF_ACCOUNT_ID", testAccountID)
+	t.Setenv("CF_TUNNEL_ID", testTunnelID)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Controller.WarpRouting != nil {
+		t.Fatalf("expected warp-routing to be unmanaged by default, got %v", *cfg.Controller.WarpRouting)
+	}
+
+	t.Setenv("SYNC_WARP_ROUTING", "false")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Controller.WarpRouting == nil || *cfg.Controller.WarpRouting {
+		t.Fatalf("expected warp-routing to be disabled, got %v", cfg.Controller.WarpRouting)
+	}
+
+	t.Setenv("SYNC_WARP_ROUTING", "maybe")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "SYNC_WARP_ROUTING") {
+		t.Fatalf("expected invalid SYNC_WARP_ROUTING error, got %v", err)
+	}
+}
+
+func TestLoadParsesTunnelIDs(t *testing.T) {
+	withDockerSecretsDir(t, t.TempDir())
+	t.Setenv("CF_API_TOKEN", "token")
+	t.Setenv("CF_ACCOUNT_ID", testAccountID)
+	t.Setenv("CF_TUNNEL_ID", testTunnelID)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Cloudflare.Tunnels != nil {
+		t.Fatalf("expected no extra tunnels by default, got %v", cfg.Cloudflare.Tunnels)
+	}
+
+	t.Setenv("CF_TUNNEL_IDS", " Lab=b1744f8b-faa1-48a4-9e5c-02ac921467fa, prod-2=a1744f8bfaa148a49e5c02ac921467fa ")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{"lab": "b1744f8b-faa1-48a4-9e5c-02ac921467fa", "prod-2": "a1744f8bfaa148a49e5c02ac921467fa"}
+	if !maps.Equal(cfg.Cloudflare.Tunnels, want) {
+		t.Fatalf("expected tunnels %v, got %v", want, cfg.Cloudflare.Tunnels)
+	}
+
+	for value, message := range map[string]string{
+		"lab":                   "expected name=tunnel-id",
+		"lab_1=" + testTunnelID: "expected name=tunnel-id",
+		"lab=not-a-uuid":        "expected a tunnel UUID",
+		"lab=b1744f8b-faa1-48a4-9e5c-02ac921467fa,LAB=a1744f8bfaa148a49e5c02ac921467fa":  "listed more than once",
+		"lab=b1744f8b-faa1-48a4-9e5c-02ac921467fa,prod=b1744f8bfaa148a49e5c02ac921467fa": "listed as both lab and prod",
+		"lab=" + testTunnelID: "is already CF_TUNNEL_ID",
+	} {
+		t.Setenv("CF_TUNNEL_IDS", value)
+		if _, err := Load(); err == nil || !strings.Contains(err.Error(), message) {
+			t.Fatalf("expected %q error for %q, got %v", message, value, err)
+		}
+	}
+}
+
+func TestLoadKubernetesSource(t *testing.T) {
+	withDockerSecretsDir(t, t.TempDir())
+	t.Setenv("CF_API_TOKEN", "token")
+	t.Setenv("CF_ACCOUNT_ID", testAccountID)
+	t.Setenv("CF_TUNNEL_ID", testTunnelID)
+	t.Setenv("SYNC_SOURCE", "kubernetes")
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "KUBERNETES_SERVICE_HOST is not set") {
+		t.Fatalf("expected missing KUBERNETES_SERVICE_HOST error, got %v", err)
+	}
+
+	t.Setenv("KUBERNETES_SERVICE_HOST", "10.96.0.1")
+	t.Setenv("KUBERNETES_SERVICE_PORT", "443")
+	t.Setenv("KUBERNETES_NAMESPACE", "apps")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Source != SourceKubernetes || cfg.Kubernetes.APIServer != "10.96.0.1:443" || cfg.Kubernetes.Namespace != "apps" {
+		t.Fatalf("unexpected Kubernetes config: source %q, %+v", cfg.Source, cfg.Kubernetes)
+	}
+
+	t.Setenv("SYNC_SOURCE", "nomad")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "invalid SYNC_SOURCE") {
+		t.Fatalf("expected invalid SYNC_SOURCE error, got %v", err)
+	}
+}
+
+func TestLoadValidateModeSkipsCloudflareCredentials(t *testing.T) {
+	withDockerSecretsDir(t, t.TempDir())
+	t.Setenv("SYNC_MODE", "Validate")
+	t.Setenv("SYNC_TIMEOUT", "30s")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Mode != ModeValidate {
+		t.Fatalf("unexpected mode: got %q", cfg.Mode)
+	}
+	if cfg.Controller.SyncTimeout != 30*time.Second {
+		t.Fatalf("expected sync timeout to apply to validation, got %s", cfg.Controller.SyncTimeout)
+	}
+
+	t.Setenv("SYNC_MODE", "lint")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected error for unknown SYNC_MODE")
+	}
+}
+
+func TestLoadExportModeKeepsSyncSettingsWithoutCredentials(t *testing.T) {
+	withDockerSecretsDir(t, t.TempDir())
+	t.Setenv("SYNC_MODE", "export")
+	t.Setenv("SYNC_FALLBACK_SERVICE", "http_status:503")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Mode != ModeExport {
+		t.Fatalf("unexpected mode: got %q", cfg.Mode)
+	}
+	if cfg.Controller.FallbackService != "http_status:503" || !cfg.Controller.AppendFallback {
+		t.Fatalf("expected the ingress settings to apply to the export, got %+v", cfg.Controller)
+	}
+	if cfg.Cloudflare.APIToken != "" {
+		t.Fatalf("expected no Cloudflare credentials in export mode")
+	}
+}
+
+func TestLoadRejectsMalformedCloudflareIDs(t *testing.T) {
+	withDockerSecretsDir(t, t.TempDir())
+	t.Setenv("CF_API_TOKEN", "token")
+	t.Setenv("CF_ACCOUNT_ID", testAccountID)
+	t.Setenv("CF_TUNNEL_ID", "000")
+
+	_, err := Load()
+	if err == nil || !strings.Contains(err.Error(), "invalid CF_TUNNEL_ID") {
+		t.Fatalf("expected CF_TUNNEL_ID validation error, got %v", err)
+	}
+
+	t.Setenv("CF_TUNNEL_ID", "c1744f8bfaa148a49e5c02ac921467fa")
+	t.Setenv("CF_ACCOUNT_ID", "my-account")
+	_, err = Load()
+	if err == nil || !strings.Contains(err.Error(), "invalid CF_ACCOUNT_ID") {
+		t.Fatalf("expected CF_ACCOUNT_ID validation error, got %v", err)
+	}
+
+	t.Setenv("CF_ACCOUNT_ID", strings.ToUpper(testAccountID))
+	if _, err := Load(); err != nil {
+		t.Fatalf("expected 32-hex tunnel ID and uppercase account ID to be accepted, got %v", err)
+	}
+}
+
 func withDockerSecretsDir(t *testing.T, dir string) {
 	t.Helper()
 	previous := dockerSecretsDir
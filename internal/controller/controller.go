@@ -2,92 +2,285 @@ package controller
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"slices"
 	"time"
 
 	"log/slog"
 
 	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/access"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/config"
 	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/dns"
 	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/docker"
 	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/labels"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/model"
 	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/reconcile"
 )
 
+// maxFailureBackoff caps the wait between syncs after repeated failures.
+const maxFailureBackoff = 5 * time.Minute
+
+// ContainerSource lists the containers, or equivalent entries such as Swarm or
+// Kubernetes services, whose labels define routes.
+type ContainerSource interface {
+	ListRunningContainers(ctx context.Context) ([]docker.ContainerInfo, error)
+}
+
 // Controller polls Docker and reconciles ingress, DNS, and Access resources.
+// It holds one tunnel engine per tunnel, keyed by the CF_TUNNEL_IDS name; the
+// CF_TUNNEL_ID tunnel has the empty name. failures counts the syncs failed in
+// a row, which lengthen the wait before the next one.
 type Controller struct {
-	docker       *docker.Adapter
+	source       ContainerSource
 	parser       *labels.Parser
-	reconciler   *reconcile.Engine
+	reconcilers  map[string]*reconcile.Engine
 	dnsEngine    *dns.Engine
 	accessEngine *access.Engine
+	components   config.Components
+	errorReport  *ErrorReport
+	strictLabels bool
+	static       *staticRoutes
+	parked       *parkedRoutes
+	grace        *routeGrace
 	interval     time.Duration
+	jitter       time.Duration
+	timeout      time.Duration
+	failures     int
 	log          *slog.Logger
 }
 
-func NewController(dockerAdapter *docker.Adapter, parser *labels.Parser, reconciler *reconcile.Engine, dnsEngine *dns.Engine, accessEngine *access.Engine, interval time.Duration, logger *slog.Logger) *Controller {
+// Options configures a Controller. DNSEngine and AccessEngine are nil when
+// their component is disabled.
+type Options struct {
+	Reconcilers     map[string]*reconcile.Engine
+	DNSEngine       *dns.Engine
+	AccessEngine    *access.Engine
+	Components      config.Components
+	ErrorReport     *ErrorReport
+	StrictLabels    bool
+	RoutesFile      string
+	ParkedHostnames []string
+	ParkedStatus    int
+	Interval        time.Duration
+	Jitter          time.Duration
+	Timeout         time.Duration
+	GracePeriod     time.Duration
+}
+
+func NewController(source ContainerSource, parser *labels.Parser, logger *slog.Logger, options Options) *Controller {
 	return &Controller{
-		docker:       dockerAdapter,
+		source:       source,
 		parser:       parser,
-		reconciler:   reconciler,
-		dnsEngine:    dnsEngine,
-		accessEngine: accessEngine,
-		interval:     interval,
+		reconcilers:  options.Reconcilers,
+		dnsEngine:    options.DNSEngine,
+		accessEngine: options.AccessEngine,
+		components:   options.Components,
+		errorReport:  options.ErrorReport,
+		strictLabels: options.StrictLabels,
+		static:       newStaticRoutes(options.RoutesFile),
+		parked:       newParkedRoutes(options.ParkedHostnames, options.ParkedStatus, logger),
+		grace:        newRouteGrace(options.GracePeriod, logger),
+		interval:     options.Interval,
+		jitter:       options.Jitter,
+		timeout:      options.Timeout,
 		log:          logger,
 	}
 }
 
 func (controller *Controller) Run(ctx context.Context, runOnce bool) error {
-	if err := controller.syncOnce(ctx); err != nil {
-		controller.log.Error("initial sync failed", "error", err)
-	}
+	controller.runCycle(ctx, "initial sync failed")
 	if runOnce {
 		return nil
 	}
 
-	ticker := time.NewTicker(controller.interval)
-	defer ticker.Stop()
+	timer := time.NewTimer(controller.nextDelay())
+	defer timer.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case <-ticker.C:
-			if err := controller.syncOnce(ctx); err != nil {
-				controller.log.Error("sync failed", "error", err)
-			}
+		case <-timer.C:
+			controller.runCycle(ctx, "sync failed")
+			timer.Reset(controller.nextDelay())
+		}
+	}
+}
+
+// nextDelay returns the poll interval plus a random share of the configured
+// jitter, so instances started together drift apart instead of polling in step.
+// After failed syncs the interval doubles with each failure in a row, up to
+// maxFailureBackoff, so an outage does not fill the logs with the same error;
+// the first successful sync restores it.
+func (controller *Controller) nextDelay() time.Duration {
+	delay := controller.backoff()
+	if controller.jitter <= 0 {
+		return delay
+	}
+	return delay + rand.N(controller.jitter)
+}
+
+// backoff returns the interval lengthened for the failures in a row. An
+// interval already above maxFailureBackoff is kept as is.
+func (controller *Controller) backoff() time.Duration {
+	delay := controller.interval
+	for range controller.failures {
+		if delay >= maxFailureBackoff {
+			break
+		}
+		delay = min(delay*2, maxFailureBackoff)
+	}
+	return max(delay, controller.interval)
+}
+
+// runCycle runs a single sync bounded by the configured timeout so a hung
+// Docker or Cloudflare call cannot block the loop indefinitely, and counts
+// the failures in a row for nextDelay.
+func (controller *Controller) runCycle(ctx context.Context, failureMessage string) {
+	cycleCtx, cancel := context.WithTimeout(ctx, controller.timeout)
+	defer cancel()
+
+	err := controller.syncOnce(cycleCtx)
+	timedOut := errors.Is(cycleCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil
+	if err == nil && !timedOut {
+		if controller.failures > 0 {
+			controller.log.Info("sync succeeded; restoring the poll interval", "failed_syncs", controller.failures, "interval", controller.interval)
+		}
+		controller.failures = 0
+		return
+	}
+	controller.failures++
+	if timedOut {
+		controller.log.Error("sync cycle aborted after timeout; SYNC_TIMEOUT exceeded", "timeout", controller.timeout, "error", err, "next_sync_in", controller.backoff())
+		return
+	}
+	controller.log.Error(failureMessage, "error", err, "next_sync_in", controller.backoff())
+}
+
+// routesForTunnel returns the routes that belong to the named tunnel.
+func routesForTunnel(routes []model.RouteSpec, name string) []model.RouteSpec {
+	selected := make([]model.RouteSpec, 0, len(routes))
+	for _, route := range routes {
+		if route.Tunnel == name {
+			selected = append(selected, route)
 		}
 	}
+	return selected
+}
+
+// Validate lists running containers from source and returns every tunnel and Access label
+// error and warning, and every error in the routes file when routesFile is set, without
+// contacting Cloudflare.
+func Validate(ctx context.Context, source ContainerSource, parser *labels.Parser, routesFile string) ([]error, error) {
+	containers, err := source.ListRunningContainers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	_, validationErrors, loadErr := parseRoutes(containers, parser, newStaticRoutes(routesFile))
+	if loadErr != nil {
+		validationErrors = append([]error{loadErr}, validationErrors...)
+	}
+	_, accessErrors := parser.ParseAccessContainers(containers)
+	return append(validationErrors, accessErrors...), nil
 }
 
 func (controller *Controller) syncOnce(ctx context.Context) error {
-	containers, err := controller.docker.ListRunningContainers(ctx)
+	containers, err := controller.source.ListRunningContainers(ctx)
 	if err != nil {
 		return err
 	}
 
-	desiredRoutes, errors := controller.parser.ParseContainers(containers)
-	for _, parseErr := range errors {
-		controller.log.Warn("label parsing error", "error", parseErr)
+	labelErrors := []error{}
+	var desiredRoutes []model.RouteSpec
+	if controller.components.Tunnel || controller.components.DNS {
+		var parseErrors []error
+		var loadErr error
+		desiredRoutes, parseErrors, loadErr = parseRoutes(containers, controller.parser, controller.static)
+		if loadErr != nil {
+			controller.log.Error("failed to load routes file; keeping the routes of the last successful load", "error", loadErr)
+		}
+		routeErrors, warnings := labels.SplitWarnings(parseErrors)
+		for _, parseErr := range routeErrors {
+			controller.log.Warn("label parsing error", "error", parseErr)
+		}
+		for _, warning := range warnings {
+			controller.log.Warn("label warning", "warning", warning)
+		}
+		labelErrors = append(labelErrors, routeErrors...)
+	}
+
+	var accessApps []model.AccessAppSpec
+	if controller.components.Access {
+		var accessErrors []error
+		accessApps, accessErrors = controller.parser.ParseAccessContainers(containers)
+		for _, parseErr := range accessErrors {
+			controller.log.Warn("access label parsing error", "error", parseErr)
+		}
+		labelErrors = append(labelErrors, accessErrors...)
 	}
 
-	if err := controller.reconciler.Reconcile(ctx, desiredRoutes); err != nil {
-		return err
+	if controller.errorReport != nil {
+		if err := controller.errorReport.Write(labelErrors); err != nil {
+			controller.log.Error("failed to write error report", "error", err)
+		}
+	}
+	// With SYNC_STRICT_LABELS a single typo skips the whole cycle rather than
+	// applying the routes that happened to parse.
+	if controller.strictLabels && len(labelErrors) > 0 {
+		return fmt.Errorf("skipping sync: %d label errors with SYNC_STRICT_LABELS=true: %w", len(labelErrors), errors.Join(labelErrors...))
 	}
 
-	if controller.dnsEngine != nil {
-		if err := controller.dnsEngine.Reconcile(ctx, desiredRoutes); err != nil {
-			controller.log.Error("DNS sync failed", "error", err)
+	// Parked hostnames are added after the grace period, so a hostname whose
+	// label just disappeared keeps its route until the grace period ends.
+	desiredRoutes = controller.parked.apply(controller.grace.applyRoutes(desiredRoutes))
+	accessApps = controller.grace.applyApps(accessApps)
+
+	result := model.SyncResult{}
+	if controller.components.Tunnel {
+		// Each tunnel only sees its own routes, so it never removes the rules
+		// of another, and a failing tunnel does not stop the others. DNS and
+		// Access still wait for every tunnel, so no record points to a tunnel
+		// that is missing its rule.
+		tunnelErrors := []error{}
+		for _, name := range slices.Sorted(maps.Keys(controller.reconcilers)) {
+			tunnelResult, err := controller.reconcilers[name].Reconcile(ctx, routesForTunnel(desiredRoutes, name))
+			if err != nil {
+				if name != "" {
+					err = fmt.Errorf("tunnel %s: %w", name, err)
+				}
+				tunnelErrors = append(tunnelErrors, err)
+				continue
+			}
+			result.Merge(tunnelResult)
+		}
+		if len(tunnelErrors) > 0 {
+			return errors.Join(tunnelErrors...)
 		}
 	}
 
-	if controller.accessEngine == nil {
-		return nil
+	// DNS failures do not stop Access, but still fail the cycle.
+	var dnsErr error
+	if controller.components.DNS {
+		var dnsResult model.SyncResult
+		dnsResult, dnsErr = controller.dnsEngine.Reconcile(ctx, desiredRoutes)
+		if dnsErr != nil {
+			controller.log.Error("DNS sync failed", "error", dnsErr)
+		}
+		result.Merge(dnsResult)
 	}
 
-	accessApps, accessErrors := controller.parser.ParseAccessContainers(containers)
-	for _, parseErr := range accessErrors {
-		controller.log.Warn("access label parsing error", "error", parseErr)
+	var accessErr error
+	if controller.components.Access {
+		var accessResult model.SyncResult
+		accessResult, accessErr = controller.accessEngine.Reconcile(ctx, accessApps)
+		result.Merge(accessResult)
 	}
 
-	return controller.accessEngine.Reconcile(ctx, accessApps)
+	// One line per cycle; the engines log each change themselves.
+	controller.log.Info("sync cycle complete", "summary", result.Summary(), "changes", len(result.Changes), "unmatched_hostnames", result.UnmatchedHostnames, "access_drift", result.AccessDrift)
+	return errors.Join(dnsErr, accessErr)
 }
@@ -0,0 +1,196 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"log/slog"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/cloudflare"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/config"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/dns"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/docker"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/labels"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/model"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/reconcile"
+)
+
+type stubSource struct {
+	containers []docker.ContainerInfo
+}
+
+func (source stubSource) ListRunningContainers(context.Context) ([]docker.ContainerInfo, error) {
+	return source.containers, nil
+}
+
+func TestSyncOnceStrictLabelsSkipsCycleOnParseErrors(t *testing.T) {
+	source := stubSource{containers: []docker.ContainerInfo{
+		{ID: "1", Name: "good", Labels: map[string]string{labels.LabelEnable: "true", labels.LabelHost: "good.example.com", labels.LabelService: "http://good"}},
+		{ID: "2", Name: "typo", Labels: map[string]string{labels.LabelEnable: "true", labels.LabelHost: "typo.example.com"}},
+	}}
+	// The reconciler is nil, so reaching it would panic: strict mode has to
+	// return before anything is applied.
+	controller := NewController(source, labels.NewParser(), slog.New(slog.NewTextHandler(io.Discard, nil)), Options{Components: config.Components{Tunnel: true}, StrictLabels: true})
+
+	err := controller.syncOnce(context.Background())
+	if err == nil {
+		t.Fatalf("expected label errors to abort the sync")
+	}
+	if !strings.Contains(err.Error(), "SYNC_STRICT_LABELS") || !strings.Contains(err.Error(), "container typo") {
+		t.Fatalf("expected the aggregated label errors, got %v", err)
+	}
+}
+
+func TestSyncOnceStrictLabelsIgnoresWarnings(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	source := stubSource{containers: []docker.ContainerInfo{
+		{ID: "1", Name: "maintenance-a", Labels: map[string]string{labels.LabelEnable: "true", labels.LabelFallback: "true", labels.LabelService: "http://maintenance-a"}},
+		{ID: "2", Name: "maintenance-b", Labels: map[string]string{labels.LabelEnable: "true", labels.LabelFallback: "true", labels.LabelService: "http://maintenance-b"}},
+	}}
+	api := &stubTunnelAPI{config: cloudflare.TunnelConfig{Ingress: []cloudflare.IngressRule{{Service: model.FallbackService}}}}
+	engine := reconcile.NewEngine(api, logger, reconcile.Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService})
+	controller := NewController(source, labels.NewParser(), logger, Options{Reconcilers: map[string]*reconcile.Engine{"": engine}, Components: config.Components{Tunnel: true}, StrictLabels: true})
+
+	if err := controller.syncOnce(context.Background()); err != nil {
+		t.Fatalf("expected a second fallback claimant not to skip the cycle, got %v", err)
+	}
+	if api.updated == nil || api.updated.Ingress[0].Service != "http://maintenance-a" {
+		t.Fatalf("expected the lowest container ID to be the fallback, got %+v", api.updated)
+	}
+}
+
+type stubTunnelAPI struct {
+	config  cloudflare.TunnelConfig
+	err     error
+	updated *cloudflare.TunnelConfig
+}
+
+func (api *stubTunnelAPI) GetTunnel(context.Context) (cloudflare.Tunnel, error) {
+	return cloudflare.Tunnel{}, nil
+}
+
+func (api *stubTunnelAPI) GetConfig(context.Context) (cloudflare.TunnelConfig, error) {
+	return api.config, api.err
+}
+
+func (api *stubTunnelAPI) UpdateConfig(_ context.Context, config cloudflare.TunnelConfig) error {
+	api.updated = &config
+	return nil
+}
+
+func TestSyncOnceReconcilesEachTunnelWithItsOwnRoutes(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	source := stubSource{containers: []docker.ContainerInfo{
+		{ID: "1", Name: "app", Labels: map[string]string{labels.LabelEnable: "true", labels.LabelHost: "app.example.com", labels.LabelService: "http://app"}},
+		{ID: "2", Name: "lab", Labels: map[string]string{labels.LabelEnable: "true", labels.LabelHost: "lab.example.com", labels.LabelService: "http://lab", labels.LabelTunnelName: "lab"}},
+	}}
+	broken := &stubTunnelAPI{err: errors.New("boom")}
+	lab := &stubTunnelAPI{config: cloudflare.TunnelConfig{Ingress: []cloudflare.IngressRule{{Service: model.FallbackService}}}}
+	newEngine := func(api cloudflare.API) *reconcile.Engine {
+		return reconcile.NewEngine(api, logger, reconcile.Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService})
+	}
+	reconcilers := map[string]*reconcile.Engine{"": newEngine(broken), "lab": newEngine(lab)}
+	controller := NewController(source, labels.NewParserWithSharedPolicies(nil, []string{"lab"}), logger, Options{Reconcilers: reconcilers, Components: config.Components{Tunnel: true}})
+
+	err := controller.syncOnce(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("expected the failing tunnel's error, got %v", err)
+	}
+	if lab.updated == nil {
+		t.Fatalf("expected the lab tunnel to be reconciled despite the other tunnel failing")
+	}
+	if len(lab.updated.Ingress) != 2 || lab.updated.Ingress[0].Hostname != "lab.example.com" {
+		t.Fatalf("expected only the lab route on the lab tunnel, got %+v", lab.updated.Ingress)
+	}
+}
+
+// failingZoneDNSAPI lists two zones and fails to list the records of
+// failZoneID.
+type failingZoneDNSAPI struct {
+	failZoneID string
+	created    []string
+}
+
+func (api *failingZoneDNSAPI) ListZones(context.Context) ([]cloudflare.Zone, error) {
+	return []cloudflare.Zone{{ID: "zone-example-com", Name: "example.com"}, {ID: "zone-example-org", Name: "example.org"}}, nil
+}
+
+func (api *failingZoneDNSAPI) ListDNSRecords(_ context.Context, zoneID string, _ string, _ string) ([]cloudflare.DNSRecord, error) {
+	if zoneID == api.failZoneID {
+		return nil, errors.New("zone unavailable")
+	}
+	return nil, nil
+}
+
+func (api *failingZoneDNSAPI) CreateDNSRecord(_ context.Context, _ string, input cloudflare.DNSRecordInput) (cloudflare.DNSRecord, error) {
+	api.created = append(api.created, input.Name)
+	return cloudflare.DNSRecord{ID: input.Name, Name: input.Name}, nil
+}
+
+func (api *failingZoneDNSAPI) UpdateDNSRecord(context.Context, string, string, cloudflare.DNSRecordInput) (cloudflare.DNSRecord, error) {
+	return cloudflare.DNSRecord{}, nil
+}
+
+func (api *failingZoneDNSAPI) DeleteDNSRecord(context.Context, string, string) error {
+	return nil
+}
+
+func TestSyncOnceFailsCycleWhenADNSZoneFails(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	source := stubSource{containers: []docker.ContainerInfo{
+		{ID: "1", Name: "app", Labels: map[string]string{labels.LabelEnable: "true", labels.LabelHost: "app.example.com", labels.LabelService: "http://app"}},
+		{ID: "2", Name: "web", Labels: map[string]string{labels.LabelEnable: "true", labels.LabelHost: "web.example.org", labels.LabelService: "http://web"}},
+	}}
+	api := &failingZoneDNSAPI{failZoneID: "zone-example-com"}
+	dnsEngine := dns.NewEngine(api, logger, dns.Options{Manage: true, TunnelID: "tunnel-id", TunnelSuffix: "cfargotunnel.com", ManagedBy: "test", Concurrency: 1})
+	controller := NewController(source, labels.NewParser(), logger, Options{DNSEngine: dnsEngine, Components: config.Components{DNS: true}})
+
+	err := controller.syncOnce(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "zone unavailable") {
+		t.Fatalf("expected the DNS zone failure to fail the cycle, got %v", err)
+	}
+	if len(api.created) != 1 || api.created[0] != "web.example.org" {
+		t.Fatalf("expected the other zone to be synced, got %v", api.created)
+	}
+}
+
+func TestNextDelayBacksOffAfterFailuresUpToCap(t *testing.T) {
+	controller := NewController(nil, nil, slog.New(slog.NewTextHandler(io.Discard, nil)), Options{Interval: 30 * time.Second})
+
+	for failures, want := range []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute, maxFailureBackoff, maxFailureBackoff} {
+		controller.failures = failures
+		if got := controller.nextDelay(); got != want {
+			t.Fatalf("expected %s after %d failures, got %s", want, failures, got)
+		}
+	}
+
+	controller.interval = 10 * time.Minute
+	controller.failures = 3
+	if got := controller.nextDelay(); got != 10*time.Minute {
+		t.Fatalf("expected an interval above the cap to be kept, got %s", got)
+	}
+}
+
+func TestRunCycleResetsBackoffOnSuccess(t *testing.T) {
+	source := stubSource{containers: []docker.ContainerInfo{
+		{ID: "1", Name: "typo", Labels: map[string]string{labels.LabelEnable: "true", labels.LabelHost: "typo.example.com"}},
+	}}
+	controller := NewController(source, labels.NewParser(), slog.New(slog.NewTextHandler(io.Discard, nil)), Options{Components: config.Components{Tunnel: true}, StrictLabels: true, Interval: time.Second, Timeout: time.Minute})
+
+	controller.runCycle(context.Background(), "sync failed")
+	controller.runCycle(context.Background(), "sync failed")
+	if controller.failures != 2 {
+		t.Fatalf("expected two failures in a row, got %d", controller.failures)
+	}
+
+	controller.source = stubSource{}
+	controller.components = config.Components{}
+	controller.runCycle(context.Background(), "sync failed")
+	if controller.failures != 0 || controller.nextDelay() != time.Second {
+		t.Fatalf("expected a successful sync to restore the interval, got %d failures", controller.failures)
+	}
+}
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+
+	"log/slog"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/cloudflare"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/labels"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/reconcile"
+)
+
+// exportedRule is an ingress rule in the schema of cloudflared's config.yaml.
+type exportedRule struct {
+	Hostname      string         `yaml:"hostname,omitempty"`
+	Path          string         `yaml:"path,omitempty"`
+	Service       string         `yaml:"service"`
+	OriginRequest map[string]any `yaml:"originRequest,omitempty"`
+}
+
+type exportedConfig struct {
+	Ingress []exportedRule `yaml:"ingress"`
+}
+
+// Export lists running containers from source and returns, as cloudflared
+// config.yaml ingress blocks, the rules each tunnel engine would write to an
+// empty configuration, including SYNC_PARKED_HOSTNAMES, with every label error
+// and warning. Nothing is written to Cloudflare. With several tunnels, each
+// gets its own YAML document headed by a comment naming it.
+func Export(ctx context.Context, source ContainerSource, parser *labels.Parser, routesFile string, parkedHostnames []string, parkedStatus int, reconcilers map[string]*reconcile.Engine, logger *slog.Logger) ([]byte, []error, error) {
+	containers, err := source.ListRunningContainers(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	routes, labelErrors, loadErr := parseRoutes(containers, parser, newStaticRoutes(routesFile))
+	if loadErr != nil {
+		labelErrors = append([]error{loadErr}, labelErrors...)
+	}
+	routes = newParkedRoutes(parkedHostnames, parkedStatus, logger).apply(routes)
+
+	var output bytes.Buffer
+	names := slices.Sorted(maps.Keys(reconcilers))
+	for index, name := range names {
+		if index > 0 {
+			output.WriteString("---\n")
+		}
+		if len(names) > 1 {
+			if name == "" {
+				output.WriteString("# tunnel: CF_TUNNEL_ID\n")
+			} else {
+				fmt.Fprintf(&output, "# tunnel: %s\n", name)
+			}
+		}
+		rules := reconcilers[name].DesiredIngress(routesForTunnel(routes, name))
+		document, err := exportIngress(rules)
+		if err != nil {
+			return nil, labelErrors, err
+		}
+		output.Write(document)
+	}
+	return output.Bytes(), labelErrors, nil
+}
+
+// exportIngress encodes rules as a cloudflared ingress block, with each
+// originRequest decoded so it is written as YAML rather than JSON.
+func exportIngress(rules []cloudflare.IngressRule) ([]byte, error) {
+	config := exportedConfig{Ingress: make([]exportedRule, 0, len(rules))}
+	for _, rule := range rules {
+		exported := exportedRule{Hostname: rule.Hostname, Path: rule.Path, Service: rule.Service}
+		if len(rule.OriginRequest) > 0 {
+			if err := json.Unmarshal(rule.OriginRequest, &exported.OriginRequest); err != nil {
+				return nil, fmt.Errorf("decode originRequest of %s: %w", rule.Hostname, err)
+			}
+		}
+		config.Ingress = append(config.Ingress, exported)
+	}
+	var document bytes.Buffer
+	encoder := yaml.NewEncoder(&document)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(config); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return document.Bytes(), nil
+}
@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"log/slog"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/docker"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/labels"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/model"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/reconcile"
+)
+
+func TestExportWritesCloudflaredIngress(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	source := stubSource{containers: []docker.ContainerInfo{
+		{ID: "1", Name: "app", Labels: map[string]string{
+			labels.LabelEnable:            "true",
+			labels.LabelHost:              "app.example.com",
+			labels.LabelService:           "https://app:8443",
+			labels.LabelPath:              "/api",
+			labels.LabelOriginNoTLSVerify: "true",
+			labels.LabelOriginRaw:         `{"connectTimeout":"30s"}`,
+		}},
+		{ID: "2", Name: "lab", Labels: map[string]string{labels.LabelEnable: "true", labels.LabelHost: "lab.example.com", labels.LabelService: "http://lab", labels.LabelTunnelName: "lab"}},
+		{ID: "3", Name: "broken", Labels: map[string]string{labels.LabelEnable: "true", labels.LabelHost: "broken.example.com"}},
+	}}
+	newEngine := func() *reconcile.Engine {
+		return reconcile.NewEngine(nil, logger, reconcile.Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService})
+	}
+
+	output, labelErrors, err := Export(context.Background(), source, labels.NewParserWithSharedPolicies(nil, []string{"lab"}), "", nil, 0, map[string]*reconcile.Engine{"": newEngine()}, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(labelErrors) != 1 {
+		t.Fatalf("expected the broken container's error, got %v", labelErrors)
+	}
+	want := `ingress:
+  - hostname: app.example.com
+    path: /api
+    service: https://app:8443
+    originRequest:
+      connectTimeout: 30s
+      noTLSVerify: true
+  - service: http_status:404
+`
+	if string(output) != want {
+		t.Fatalf("expected ingress\n%s\ngot\n%s", want, output)
+	}
+
+	output, _, err = Export(context.Background(), source, labels.NewParserWithSharedPolicies(nil, []string{"lab"}), "", nil, 0, map[string]*reconcile.Engine{"": newEngine(), "lab": newEngine()}, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantLab := `---
+# tunnel: lab
+ingress:
+  - hostname: lab.example.com
+    service: http://lab
+  - service: http_status:404
+`
+	if got := string(output); !strings.HasPrefix(got, "# tunnel: CF_TUNNEL_ID\ningress:\n") || !strings.HasSuffix(got, wantLab) {
+		t.Fatalf("expected one document per tunnel, got\n%s", got)
+	}
+}
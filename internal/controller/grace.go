@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"slices"
+	"sort"
+	"time"
+
+	"log/slog"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/model"
+)
+
+// routeGrace keeps routes and Access apps that vanish from the labels for a
+// grace period, so containers recreated between two cycles do not lose their
+// routes, DNS records, and Access apps in the meantime. State is in memory
+// only.
+type routeGrace struct {
+	period time.Duration
+	now    func() time.Time
+	log    *slog.Logger
+	routes map[string]*retainedSpec[model.RouteSpec]
+	apps   map[string]*retainedSpec[model.AccessAppSpec]
+}
+
+// retainedSpec is the last desired state of an item; absentSince is zero while
+// the item is still defined by labels.
+type retainedSpec[T any] struct {
+	spec        T
+	absentSince time.Time
+}
+
+func newRouteGrace(period time.Duration, logger *slog.Logger) *routeGrace {
+	return &routeGrace{
+		period: period,
+		now:    time.Now,
+		log:    logger,
+		routes: map[string]*retainedSpec[model.RouteSpec]{},
+		apps:   map[string]*retainedSpec[model.AccessAppSpec]{},
+	}
+}
+
+// applyRoutes returns desired plus the routes still within their grace period.
+func (grace *routeGrace) applyRoutes(desired []model.RouteSpec) []model.RouteSpec {
+	if grace.period <= 0 {
+		return desired
+	}
+	return applyGrace(grace, grace.routes, desired, func(route model.RouteSpec) string {
+		return route.Key.String()
+	}, func(route model.RouteSpec) model.SourceRef {
+		return route.Source
+	}, "route", "rule")
+}
+
+// applyApps returns desired plus the Access apps still within their grace
+// period.
+func (grace *routeGrace) applyApps(desired []model.AccessAppSpec) []model.AccessAppSpec {
+	if grace.period <= 0 {
+		return desired
+	}
+	return applyGrace(grace, grace.apps, desired, func(app model.AccessAppSpec) string {
+		return app.Name + "@" + model.NormalizeAccessDomain(app.Domain)
+	}, func(app model.AccessAppSpec) model.SourceRef {
+		return app.Source
+	}, "access app", "app")
+}
+
+func applyGrace[T any](grace *routeGrace, memory map[string]*retainedSpec[T], desired []T, keyOf func(T) string, sourceOf func(T) model.SourceRef, kind string, keyAttr string) []T {
+	now := grace.now()
+	present := make(map[string]struct{}, len(desired))
+	for _, item := range desired {
+		key := keyOf(item)
+		present[key] = struct{}{}
+		memory[key] = &retainedSpec[T]{spec: item}
+	}
+
+	keys := make([]string, 0, len(memory))
+	for key := range memory {
+		if _, ok := present[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	result := slices.Clip(desired)
+	for _, key := range keys {
+		entry := memory[key]
+		if entry.absentSince.IsZero() {
+			entry.absentSince = now
+		}
+		remaining := grace.period - now.Sub(entry.absentSince)
+		if remaining <= 0 {
+			grace.log.Info("grace period expired; removing "+kind, keyAttr, key, "source_container", sourceOf(entry.spec).ContainerName)
+			delete(memory, key)
+			continue
+		}
+		grace.log.Info("keeping "+kind+" of missing container during grace period", keyAttr, key, "source_container", sourceOf(entry.spec).ContainerName, "remaining", remaining.Round(time.Second))
+		result = append(result, entry.spec)
+	}
+	return result
+}
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"log/slog"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/model"
+)
+
+func TestRouteGraceKeepsMissingRoutesUntilDeadline(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	grace := newRouteGrace(2*time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	grace.now = func() time.Time { return now }
+
+	app := model.RouteSpec{Key: model.RouteKey{Hostname: "app.example.com"}, Service: "http://app"}
+	other := model.RouteSpec{Key: model.RouteKey{Hostname: "other.example.com"}, Service: "http://other"}
+	if routes := grace.applyRoutes([]model.RouteSpec{app, other}); len(routes) != 2 {
+		t.Fatalf("expected both routes, got %+v", routes)
+	}
+
+	now = now.Add(30 * time.Second)
+	routes := grace.applyRoutes([]model.RouteSpec{other})
+	if len(routes) != 2 || routes[1].Key != app.Key {
+		t.Fatalf("expected missing route to be kept, got %+v", routes)
+	}
+
+	now = now.Add(time.Minute)
+	if routes := grace.applyRoutes([]model.RouteSpec{other}); len(routes) != 2 {
+		t.Fatalf("expected missing route to be kept within the grace period, got %+v", routes)
+	}
+
+	now = now.Add(time.Minute)
+	if routes := grace.applyRoutes([]model.RouteSpec{other}); len(routes) != 1 {
+		t.Fatalf("expected missing route to be removed after the grace period, got %+v", routes)
+	}
+}
+
+func TestRouteGraceResetsWhenItemReturns(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	grace := newRouteGrace(time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	grace.now = func() time.Time { return now }
+
+	app := model.AccessAppSpec{Name: "app", Domain: "app.example.com"}
+	grace.applyApps([]model.AccessAppSpec{app})
+	now = now.Add(50 * time.Second)
+	if apps := grace.applyApps(nil); len(apps) != 1 {
+		t.Fatalf("expected missing app to be kept, got %+v", apps)
+	}
+	grace.applyApps([]model.AccessAppSpec{app})
+
+	now = now.Add(50 * time.Second)
+	if apps := grace.applyApps(nil); len(apps) != 1 {
+		t.Fatalf("expected grace period to restart after the app returned, got %+v", apps)
+	}
+}
+
+func TestRouteGraceDisabledByDefault(t *testing.T) {
+	grace := newRouteGrace(0, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	grace.applyRoutes([]model.RouteSpec{{Key: model.RouteKey{Hostname: "app.example.com"}}})
+	if routes := grace.applyRoutes(nil); len(routes) != 0 {
+		t.Fatalf("expected no retained routes without a grace period, got %+v", routes)
+	}
+}
@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"strconv"
+
+	"log/slog"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/model"
+)
+
+// parkedSource names SYNC_PARKED_HOSTNAMES as the source of parked routes in
+// logs.
+const parkedSource = "SYNC_PARKED_HOSTNAMES"
+
+// parkedRoutes adds a route returning a fixed HTTP status for each
+// SYNC_PARKED_HOSTNAMES entry, so an unused domain gets an ingress rule and a
+// DNS record like any label-defined route, and loses both once it leaves the
+// list. A hostname defined by labels or the routes file keeps that route.
+type parkedRoutes struct {
+	hostnames []string
+	service   string
+	log       *slog.Logger
+}
+
+// newParkedRoutes returns nil when hostnames is empty.
+func newParkedRoutes(hostnames []string, status int, logger *slog.Logger) *parkedRoutes {
+	if len(hostnames) == 0 {
+		return nil
+	}
+	return &parkedRoutes{hostnames: hostnames, service: "http_status:" + strconv.Itoa(status), log: logger}
+}
+
+// apply appends the parked routes to routes, skipping parked hostnames that
+// routes already define. Parked routes belong to the CF_TUNNEL_ID tunnel.
+func (parked *parkedRoutes) apply(routes []model.RouteSpec) []model.RouteSpec {
+	if parked == nil {
+		return routes
+	}
+	claimed := map[string]model.SourceRef{}
+	for _, route := range routes {
+		if !route.Fallback {
+			claimed[route.Key.Hostname] = route.Source
+		}
+	}
+
+	result := append([]model.RouteSpec{}, routes...)
+	for _, hostname := range parked.hostnames {
+		if source, found := claimed[hostname]; found {
+			parked.log.Warn("parked hostname is defined by labels; using the label route", "hostname", hostname, "source_container", source.ContainerName)
+			continue
+		}
+		result = append(result, model.RouteSpec{
+			Key:     model.RouteKey{Hostname: hostname},
+			Service: parked.service,
+			Source:  model.SourceRef{ContainerName: parkedSource},
+		})
+	}
+	return result
+}
@@ -0,0 +1,37 @@
+package controller
+
+import (
+	"io"
+	"testing"
+
+	"log/slog"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/model"
+)
+
+func TestParkedRoutesSkipHostnamesDefinedByLabels(t *testing.T) {
+	parked := newParkedRoutes([]string{"parked.example.com", "app.example.com"}, 410, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	routes := []model.RouteSpec{
+		{Key: model.RouteKey{Hostname: "app.example.com", Path: "/api"}, Service: "http://app", Source: model.SourceRef{ContainerName: "app"}},
+	}
+
+	result := parked.apply(routes)
+	if len(result) != 2 {
+		t.Fatalf("expected the label route and one parked route, got %+v", result)
+	}
+	if result[0].Service != "http://app" {
+		t.Fatalf("expected the label route to be kept, got %+v", result[0])
+	}
+	want := model.RouteSpec{Key: model.RouteKey{Hostname: "parked.example.com"}, Service: "http_status:410", Source: model.SourceRef{ContainerName: parkedSource}}
+	if result[1].Key != want.Key || result[1].Service != want.Service || result[1].Source != want.Source || result[1].Tunnel != "" {
+		t.Fatalf("expected %+v, got %+v", want, result[1])
+	}
+	if len(routes) != 1 {
+		t.Fatalf("expected the input routes to be left untouched")
+	}
+
+	var disabled *parkedRoutes
+	if got := disabled.apply(routes); len(got) != 1 {
+		t.Fatalf("expected no parked routes without SYNC_PARKED_HOSTNAMES, got %+v", got)
+	}
+}
@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/cloudflare"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/config"
+)
+
+// PreflightAPI is the read-only part of the Cloudflare API used by Preflight.
+type PreflightAPI interface {
+	GetConfig(ctx context.Context) (cloudflare.TunnelConfig, error)
+	ListZones(ctx context.Context) ([]cloudflare.Zone, error)
+	ListDNSRecords(ctx context.Context, zoneID string, recordType string, name string) ([]cloudflare.DNSRecord, error)
+	ListAccessApps(ctx context.Context, tag string) ([]cloudflare.AccessAppRecord, error)
+}
+
+// Preflight makes one minimal read call per enabled component before the
+// first sync and returns an error for each call that fails. A 401 or 403
+// answer names the API token permission that is most likely missing.
+func Preflight(ctx context.Context, api PreflightAPI, components config.Components) []error {
+	failures := []error{}
+	if components.Tunnel {
+		if _, err := api.GetConfig(ctx); err != nil {
+			failures = append(failures, preflightError("read tunnel configuration", "Account > Cloudflare Tunnel > Edit", err))
+		}
+	}
+	if components.DNS {
+		zones, err := api.ListZones(ctx)
+		if err != nil {
+			failures = append(failures, preflightError("list zones", "Zone > Zone > Read", err))
+		} else if len(zones) > 0 {
+			if _, err := api.ListDNSRecords(ctx, zones[0].ID, "CNAME", ""); err != nil {
+				failures = append(failures, preflightError("list DNS records in zone "+zones[0].Name, "Zone > DNS > Edit", err))
+			}
+		}
+	}
+	if components.Access {
+		if _, err := api.ListAccessApps(ctx, ""); err != nil {
+			failures = append(failures, preflightError("list Access applications", "Account > Access: Apps and Policies > Edit", err))
+		}
+	}
+	return failures
+}
+
+func preflightError(action string, permission string, err error) error {
+	var statusErr *cloudflare.StatusError
+	if errors.As(err, &statusErr) && (statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden) {
+		return fmt.Errorf("%s: API token is missing the %s permission: %w", action, permission, err)
+	}
+	return fmt.Errorf("%s: %w", action, err)
+}
@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/cloudflare"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/config"
+)
+
+func TestPreflightNamesMissingPermissions(t *testing.T) {
+	api := &stubPreflightAPI{
+		zones:      []cloudflare.Zone{{ID: "zone-1", Name: "example.com"}},
+		recordsErr: &cloudflare.StatusError{StatusCode: http.StatusForbidden, Status: "403 Forbidden", Summary: "Authentication error"},
+		appsErr:    errors.New("connection reset"),
+	}
+
+	failures := Preflight(context.Background(), api, config.Components{Tunnel: true, DNS: true, Access: true})
+	if len(failures) != 2 {
+		t.Fatalf("expected 2 failures, got %v", failures)
+	}
+	if !strings.Contains(failures[0].Error(), "list DNS records in zone example.com: API token is missing the Zone > DNS > Edit permission") {
+		t.Fatalf("expected missing DNS permission, got %v", failures[0])
+	}
+	if !strings.Contains(failures[1].Error(), "list Access applications: connection reset") || strings.Contains(failures[1].Error(), "permission") {
+		t.Fatalf("expected plain error for a non-permission failure, got %v", failures[1])
+	}
+}
+
+func TestPreflightSkipsDisabledComponents(t *testing.T) {
+	api := &stubPreflightAPI{
+		configErr: &cloudflare.StatusError{StatusCode: http.StatusUnauthorized, Status: "401 Unauthorized"},
+	}
+
+	if failures := Preflight(context.Background(), api, config.Components{DNS: true}); len(failures) != 0 {
+		t.Fatalf("expected no failures, got %v", failures)
+	}
+	if api.configCalls != 0 || api.appCalls != 0 {
+		t.Fatalf("expected only DNS to be checked, got %d config and %d app calls", api.configCalls, api.appCalls)
+	}
+}
+
+type stubPreflightAPI struct {
+	configErr   error
+	zones       []cloudflare.Zone
+	recordsErr  error
+	appsErr     error
+	configCalls int
+	appCalls    int
+}
+
+func (api *stubPreflightAPI) GetConfig(ctx context.Context) (cloudflare.TunnelConfig, error) {
+	api.configCalls++
+	return cloudflare.TunnelConfig{}, api.configErr
+}
+
+func (api *stubPreflightAPI) ListZones(ctx context.Context) ([]cloudflare.Zone, error) {
+	return api.zones, nil
+}
+
+func (api *stubPreflightAPI) ListDNSRecords(ctx context.Context, zoneID string, recordType string, name string) ([]cloudflare.DNSRecord, error) {
+	return nil, api.recordsErr
+}
+
+func (api *stubPreflightAPI) ListAccessApps(ctx context.Context, tag string) ([]cloudflare.AccessAppRecord, error) {
+	api.appCalls++
+	return nil, api.appsErr
+}
@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/labels"
+)
+
+// ErrorReport writes the label errors of the latest sync cycle to a JSON file
+// keyed by container name, so problems can be inspected without reading logs.
+// The Docker socket is mounted read-only, so containers themselves are never
+// annotated.
+type ErrorReport struct {
+	path string
+	now  func() time.Time
+}
+
+type errorReportFile struct {
+	UpdatedAt  string              `json:"updated_at"`
+	Containers map[string][]string `json:"containers"`
+	Other      []string            `json:"other,omitempty"`
+}
+
+// NewErrorReport returns a report written to path, or nil when path is empty.
+func NewErrorReport(path string) *ErrorReport {
+	if path == "" {
+		return nil
+	}
+	return &ErrorReport{path: path, now: time.Now}
+}
+
+// Write replaces the report with the given errors. Errors carrying a
+// labels.ContainerError are listed under that container; the rest are listed
+// under "other". Containers without errors are omitted.
+func (report *ErrorReport) Write(labelErrors []error) error {
+	decoded := errorReportFile{
+		UpdatedAt:  report.now().UTC().Format(time.RFC3339),
+		Containers: map[string][]string{},
+	}
+	for _, labelErr := range labelErrors {
+		message := labelErr.Error()
+		var containerErr *labels.ContainerError
+		if !errors.As(labelErr, &containerErr) {
+			decoded.Other = append(decoded.Other, message)
+			continue
+		}
+		name := containerErr.Container
+		decoded.Containers[name] = append(decoded.Containers[name], strings.TrimPrefix(message, "container "+name+": "))
+	}
+
+	content, err := json.MarshalIndent(decoded, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(report.path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create error report directory %s: %w", dir, err)
+	}
+	temp, err := os.CreateTemp(dir, ".errors-*.json")
+	if err != nil {
+		return fmt.Errorf("write error report %s: %w", report.path, err)
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(append(content, '\n')); err != nil {
+		temp.Close()
+		return fmt.Errorf("write error report %s: %w", report.path, err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("write error report %s: %w", report.path, err)
+	}
+	if err := os.Rename(temp.Name(), report.path); err != nil {
+		return fmt.Errorf("write error report %s: %w", report.path, err)
+	}
+	return nil
+}
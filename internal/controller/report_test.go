@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/labels"
+)
+
+func TestErrorReportGroupsErrorsByContainer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reports", "errors.json")
+	report := NewErrorReport(path)
+	report.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	labelErrors := []error{
+		&labels.ContainerError{Container: "app", Err: errors.New("missing required cloudflare.tunnel.service label")},
+		fmt.Errorf("%w; skipping", &labels.ContainerError{Container: "app-2", Err: errors.New("invalid cloudflare.tunnel.enable label: invalid syntax")}),
+		errors.New("container app: duplicate route definition for app.example.com"),
+	}
+	if err := report.Write(labelErrors); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read report: %v", err)
+	}
+	var decoded errorReportFile
+	if err := json.Unmarshal(content, &decoded); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	if decoded.UpdatedAt != "2024-01-02T03:04:05Z" {
+		t.Fatalf("unexpected timestamp %q", decoded.UpdatedAt)
+	}
+	if len(decoded.Containers) != 2 {
+		t.Fatalf("expected errors for two containers, got %+v", decoded.Containers)
+	}
+	if got := decoded.Containers["app"]; len(got) != 1 || got[0] != "missing required cloudflare.tunnel.service label" {
+		t.Fatalf("unexpected errors for app: %v", got)
+	}
+	if got := decoded.Containers["app-2"]; len(got) != 1 || got[0] != "invalid cloudflare.tunnel.enable label: invalid syntax; skipping" {
+		t.Fatalf("unexpected errors for app-2: %v", got)
+	}
+	if len(decoded.Other) != 1 {
+		t.Fatalf("expected one unattributed error, got %v", decoded.Other)
+	}
+
+	if err := report.Write(nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	content, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read report: %v", err)
+	}
+	decoded = errorReportFile{}
+	if err := json.Unmarshal(content, &decoded); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	if len(decoded.Containers) != 0 || len(decoded.Other) != 0 {
+		t.Fatalf("expected cleared report, got %+v", decoded)
+	}
+}
+
+func TestNewErrorReportDisabledWithoutPath(t *testing.T) {
+	if NewErrorReport("") != nil {
+		t.Fatalf("expected nil report for empty path")
+	}
+}
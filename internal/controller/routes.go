@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"slices"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/docker"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/labels"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/model"
+)
+
+// staticRoutes loads the SYNC_ROUTES_FILE entries every cycle. When the file
+// cannot be loaded, the entries of the last successful load are kept, so a
+// typo does not remove the routes the file defines.
+type staticRoutes struct {
+	path string
+	last []docker.ContainerInfo
+}
+
+// newStaticRoutes returns nil when path is empty.
+func newStaticRoutes(path string) *staticRoutes {
+	if path == "" {
+		return nil
+	}
+	return &staticRoutes{path: path}
+}
+
+// load returns the file entries as containers carrying route labels. On error
+// it returns the entries of the last successful load with the error.
+func (routes *staticRoutes) load() ([]docker.ContainerInfo, error) {
+	if routes == nil {
+		return nil, nil
+	}
+	containers, err := labels.LoadRoutesFile(routes.path)
+	if err != nil {
+		return routes.last, err
+	}
+	routes.last = containers
+	return containers, nil
+}
+
+// parseRoutes returns the routes defined by the containers' labels and by the
+// routes file, with every label error, and the error loading the file, if any.
+// File entries are parsed as containers, so duplicates across labels and the
+// file are detected like duplicates across containers.
+func parseRoutes(containers []docker.ContainerInfo, parser *labels.Parser, static *staticRoutes) ([]model.RouteSpec, []error, error) {
+	fileContainers, loadErr := static.load()
+	routes, parseErrors := parser.ParseContainers(append(slices.Clip(containers), fileContainers...))
+	return routes, parseErrors, loadErr
+}
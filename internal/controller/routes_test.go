@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStaticRoutesKeepsLastLoadOnError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	if err := os.WriteFile(path, []byte("routes:\n  - hostname: nas.example.com\n    service: https://192.0.2.10:5001\n"), 0o600); err != nil {
+		t.Fatalf("write routes file: %v", err)
+	}
+	routes := newStaticRoutes(path)
+
+	if containers, err := routes.load(); err != nil || len(containers) != 1 {
+		t.Fatalf("expected 1 route, got %+v (error %v)", containers, err)
+	}
+
+	if err := os.WriteFile(path, []byte("routes: [unclosed"), 0o600); err != nil {
+		t.Fatalf("write routes file: %v", err)
+	}
+	if containers, err := routes.load(); err == nil || len(containers) != 1 {
+		t.Fatalf("expected the last loaded route to be kept with the error, got %+v (error %v)", containers, err)
+	}
+
+	if err := os.WriteFile(path, []byte("routes: []\n"), 0o600); err != nil {
+		t.Fatalf("write routes file: %v", err)
+	}
+	if containers, err := routes.load(); err != nil || len(containers) != 0 {
+		t.Fatalf("expected no routes, got %+v (error %v)", containers, err)
+	}
+}
+
+func TestStaticRoutesDisabledWithoutPath(t *testing.T) {
+	routes := newStaticRoutes("")
+	if containers, err := routes.load(); routes != nil || containers != nil || err != nil {
+		t.Fatalf("expected no routes file without a path")
+	}
+}
@@ -2,20 +2,30 @@ package dns
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
 
 	"log/slog"
 
 	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/cloudflare"
 	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/model"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/state"
 	"golang.org/x/net/publicsuffix"
 )
 
 const (
 	dnsRecordType = "CNAME"
 	dnsRecordTTL  = 1
+	// apexRecordName is the record name Cloudflare uses for the zone apex.
+	apexRecordName = "@"
+	// dnsCommentSeparator joins the managed marker and a
+	// cloudflare.tunnel.dns.comment note in the record comment.
+	dnsCommentSeparator = "; "
 )
 
 // Engine reconciles DNS records for tunnel hostnames.
@@ -27,169 +37,513 @@ type Engine struct {
 	delete          bool
 	configuredZones []string
 	tunnelID        string
+	tunnelSuffix    string
 	managedComment  string
+	// tracked records the hostnames whose DNS records this controller
+	// manages, so a hostname that disappears from the labels is told apart
+	// from one it never managed. It may be nil.
+	tracked *state.Store
+	// protected hostnames are never created, updated, or deleted, from
+	// SYNC_PROTECTED_HOSTNAMES.
+	protected model.ProtectedHostnames
+	// concurrency bounds how many zones are synced at once, from
+	// SYNC_DNS_CONCURRENCY.
+	concurrency int
+	// removals holds back a zone's deletions when they exceed
+	// SYNC_MAX_REMOVALS; nil when unlimited.
+	removals *model.RemovalGuard
+	// tunnels maps the CF_TUNNEL_IDS names to their IDs; routes with a
+	// tunnel name point their records to that tunnel instead of tunnelID.
+	tunnels map[string]string
+	// unmatched holds the hostnames last reported as matching no zone in the
+	// account, so each is warned about once rather than every sync.
+	unmatched map[string]struct{}
 }
 
-func NewEngine(api cloudflare.DNSAPI, logger *slog.Logger, dryRun bool, manage bool, delete bool, configuredZones []string, tunnelID string, managedBy string) *Engine {
+// Options configures an Engine; each field sets the Engine field of the same
+// name, except ManagedBy, from which the managed record comment is built.
+type Options struct {
+	DryRun          bool
+	Manage          bool
+	Delete          bool
+	ConfiguredZones []string
+	TunnelID        string
+	TunnelSuffix    string
+	ManagedBy       string
+	Tracked         *state.Store
+	Protected       model.ProtectedHostnames
+	Concurrency     int
+	Removals        *model.RemovalGuard
+	Tunnels         map[string]string
+}
+
+func NewEngine(api cloudflare.DNSAPI, logger *slog.Logger, options Options) *Engine {
 	return &Engine{
 		api:             api,
 		log:             logger,
-		dryRun:          dryRun,
-		manage:          manage,
-		delete:          delete,
-		configuredZones: append([]string(nil), configuredZones...),
-		tunnelID:        tunnelID,
-		managedComment:  model.DNSManagedComment(managedBy),
+		dryRun:          options.DryRun,
+		manage:          options.Manage,
+		delete:          options.Delete,
+		configuredZones: append([]string(nil), options.ConfiguredZones...),
+		tunnelID:        options.TunnelID,
+		tunnelSuffix:    options.TunnelSuffix,
+		managedComment:  model.DNSManagedComment(options.ManagedBy),
+		tracked:         options.Tracked,
+		protected:       options.Protected,
+		concurrency:     options.Concurrency,
+		removals:        options.Removals,
+		tunnels:         options.Tunnels,
+		unmatched:       map[string]struct{}{},
 	}
 }
 
 type zonePlan struct {
-	requiredZones   map[string]struct{}
-	hostnamesByZone map[string][]string
+	requiredZones    map[string]struct{}
+	hostnamesByZone  map[string][]string
+	sourceByHostname map[string]model.SourceRef
+	// proxiedByHostname holds explicit cloudflare.tunnel.dns.proxied values;
+	// hostnames without one keep the proxied state of their existing record.
+	proxiedByHostname map[string]*bool
+	// commentByHostname holds explicit cloudflare.tunnel.dns.comment notes;
+	// hostnames without one keep the note of their existing record.
+	commentByHostname map[string]*string
+	// removedByZone holds hostnames recorded in the state file that no
+	// route defines anymore.
+	removedByZone map[string][]string
+	// tunnelByHostname holds the tunnel name of each hostname's routes.
+	tunnelByHostname map[string]string
 }
 
 type hostnameZoneState struct {
-	explicitZones   map[string]struct{}
-	invalidExplicit bool
+	explicitZones      map[string]struct{}
+	invalidExplicit    bool
+	proxied            *bool
+	conflictingProxied bool
+	comment            *string
+	conflictingComment bool
+	tunnel             string
+	conflictingTunnel  bool
+	source             model.SourceRef
 }
 
-func (engine *Engine) Reconcile(ctx context.Context, routes []model.RouteSpec) error {
+// Reconcile syncs the tunnel CNAME records of the routes' hostnames. The
+// result lists each record created, updated, or deleted, including in dry-run.
+func (engine *Engine) Reconcile(ctx context.Context, routes []model.RouteSpec) (model.SyncResult, error) {
 	if !engine.manage {
-		return nil
+		return model.SyncResult{}, nil
 	}
 
-	plan := buildZonePlan(routes, engine.log)
+	plan := buildZonePlan(engine.withoutProtectedRoutes(routes), engine.log)
+	plan.removedByZone = engine.removedHostnames(routes)
 	selectedZones := engine.selectedZones(plan)
 	if len(selectedZones) == 0 {
 		engine.log.Debug("no DNS zones selected from managed hostnames or configured cleanup zones; DNS sync skipped")
-		return nil
+		return model.SyncResult{}, nil
 	}
 
 	zones, err := engine.api.ListZones(ctx)
 	if err != nil {
-		return err
+		return model.SyncResult{}, err
 	}
+	unmatched := engine.warnUnmatchedHostnames(plan, zones)
 	if len(zones) == 0 {
 		engine.log.Warn("no zones returned for account; DNS sync skipped")
-		return nil
+		return model.SyncResult{UnmatchedHostnames: unmatched}, nil
 	}
 
+	warnOverlappingZones(plan, zones, engine.log)
 	orderedZones := filterZones(zones, selectedZones, engine.log)
 	if len(orderedZones) == 0 {
 		engine.log.Warn("no matching Cloudflare zones found for managed hostnames or configured cleanup zones; DNS sync skipped")
-		return nil
+		return model.SyncResult{UnmatchedHostnames: unmatched}, nil
 	}
 
-	for _, zone := range orderedZones {
-		zoneName := normalizeDNSName(zone.Name)
-		knownHostnames := append([]string(nil), plan.hostnamesByZone[zoneName]...)
-		if len(knownHostnames) == 0 && !engine.delete {
-			continue
-		}
+	// Zones are synced best-effort and up to SYNC_DNS_CONCURRENCY at a time:
+	// a failure in one zone is collected and the remaining zones are still
+	// processed. Results are merged in zone order once every zone is done.
+	results := make([]zoneResult, len(orderedZones))
+	slots := make(chan struct{}, max(engine.concurrency, 1))
+	var wait sync.WaitGroup
+	for index, zone := range orderedZones {
+		wait.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wait.Done()
+			defer func() { <-slots }()
+			results[index] = engine.reconcileZone(ctx, zone, plan)
+		}()
+	}
+	wait.Wait()
+
+	failures := []error{}
+	managedHostnames := []string{}
+	forgottenHostnames := []string{}
+	synced := model.SyncResult{UnmatchedHostnames: unmatched}
+	for _, result := range results {
+		failures = append(failures, result.failures...)
+		managedHostnames = append(managedHostnames, result.managed...)
+		forgottenHostnames = append(forgottenHostnames, result.forgotten...)
+		synced.Merge(result.changes)
+	}
 
-		byName := map[string]struct{}{}
-		for _, hostname := range knownHostnames {
-			byName[hostname] = struct{}{}
-		}
+	if err := engine.trackHostnames(managedHostnames, forgottenHostnames); err != nil {
+		engine.log.Error("failed to save state file", "error", err)
+		failures = append(failures, err)
+	}
 
-		if engine.delete {
-			if len(knownHostnames) == 0 {
-				engine.log.Debug("scanning configured DNS zone for orphan cleanup", "zone", zone.Name)
-			}
+	if len(failures) > 0 {
+		return synced, fmt.Errorf("DNS reconciliation completed with %d failure(s): %w", len(failures), errors.Join(failures...))
+	}
+	return synced, nil
+}
 
-			records, err := engine.api.ListDNSRecords(ctx, zone.ID, dnsRecordType, "")
-			if err != nil {
-				engine.log.Error("failed to list DNS records", "zone", zone.Name, "error", err)
+// zoneResult collects what one zone's sync did, so zones can run
+// concurrently and be merged afterwards.
+type zoneResult struct {
+	failures  []error
+	managed   []string
+	forgotten []string
+	changes   model.SyncResult
+}
+
+// reconcileZone syncs the records of one zone. Records within a zone are
+// handled serially.
+func (engine *Engine) reconcileZone(ctx context.Context, zone cloudflare.Zone, plan zonePlan) zoneResult {
+	result := zoneResult{}
+	zoneName := normalizeDNSName(zone.Name)
+	knownHostnames := append([]string(nil), plan.hostnamesByZone[zoneName]...)
+	removedHostnames := map[string]struct{}{}
+	for _, hostname := range plan.removedByZone[zoneName] {
+		removedHostnames[hostname] = struct{}{}
+	}
+	if len(knownHostnames) == 0 && len(removedHostnames) == 0 && !engine.delete {
+		return result
+	}
+
+	byName := map[string]struct{}{}
+	for _, hostname := range knownHostnames {
+		byName[hostname] = struct{}{}
+	}
+
+	if engine.delete && len(knownHostnames) == 0 {
+		engine.log.Debug("scanning configured DNS zone for orphan cleanup", "zone", zone.Name)
+	}
+
+	// One listing per zone serves both orphan cleanup and per-hostname
+	// lookups, instead of one request per hostname.
+	zoneRecords, err := engine.api.ListDNSRecords(ctx, zone.ID, dnsRecordType, "")
+	if err != nil {
+		engine.log.Error("failed to list DNS records", "zone", zone.Name, "error", err)
+		result.failures = append(result.failures, fmt.Errorf("list DNS records in zone %s: %w", zone.Name, err))
+		return result
+	}
+	recordsByName := map[string][]cloudflare.DNSRecord{}
+	for _, record := range zoneRecords {
+		hostname := normalizeDNSName(record.Name)
+		recordsByName[hostname] = append(recordsByName[hostname], record)
+	}
+
+	for _, hostname := range plan.removedByZone[zoneName] {
+		if len(recordsByName[hostname]) == 0 {
+			engine.log.Debug("hostname removed from labels has no DNS record; forgetting it", "hostname", hostname, "zone", zone.Name)
+			result.forgotten = append(result.forgotten, hostname)
+		}
+	}
+
+	deletions := []cloudflare.DNSRecord{}
+	if engine.delete || len(removedHostnames) > 0 {
+		for _, record := range zoneRecords {
+			hostname := normalizeDNSName(record.Name)
+			if _, ok := byName[hostname]; ok {
 				continue
 			}
-
-			for _, record := range records {
-				hostname := strings.ToLower(strings.TrimSuffix(record.Name, "."))
-				if _, ok := byName[hostname]; ok {
-					continue
-				}
-				if record.Comment != engine.managedComment {
-					continue
-				}
-				engine.log.Warn("deleting managed DNS record no longer desired", "hostname", hostname, "zone", zone.Name)
-				if engine.dryRun {
-					continue
-				}
-				if err := engine.api.DeleteDNSRecord(ctx, zone.ID, record.ID); err != nil {
-					engine.log.Error("failed to delete DNS record", "hostname", hostname, "zone", zone.Name, "error", err)
+			_, removed := removedHostnames[hostname]
+			// A hostname this controller managed stays deletable when the
+			// comment was edited, as long as it still points to the tunnel.
+			managed := engine.hasManagedComment(record.Comment) || (removed && engine.isTunnelTarget(record.Content))
+			if !managed {
+				if removed {
+					engine.log.Info("hostname removed from labels but its DNS record is no longer managed; keeping it", "hostname", hostname, "zone", zone.Name)
+					result.forgotten = append(result.forgotten, hostname)
 				}
+				continue
 			}
-		}
-
-		for _, hostname := range knownHostnames {
-			records, err := engine.api.ListDNSRecords(ctx, zone.ID, dnsRecordType, hostname)
-			if err != nil {
-				engine.log.Error("failed to list DNS records", "hostname", hostname, "zone", zone.Name, "error", err)
+			if engine.protected.Match(hostname) {
+				engine.log.Debug("keeping DNS record of protected hostname", "hostname", hostname, "zone", zone.Name)
 				continue
 			}
-			if len(records) > 1 {
-				engine.log.Warn("multiple DNS records found; skipping", "hostname", hostname, "zone", zone.Name)
+			if !engine.delete {
+				if removed {
+					engine.log.Info("hostname removed from labels; keeping its DNS record because SYNC_DELETE_DNS is false", "hostname", hostname, "zone", zone.Name)
+					result.forgotten = append(result.forgotten, hostname)
+				}
 				continue
 			}
+			deletions = append(deletions, record)
+		}
+	}
 
-			desired := cloudflare.DNSRecordInput{
-				Type:    dnsRecordType,
-				Name:    hostname,
-				Content: engine.tunnelTarget(),
-				Proxied: true,
-				TTL:     dnsRecordTTL,
-				Comment: engine.managedComment,
-			}
+	deletedHostnames := make([]string, 0, len(deletions))
+	for _, record := range deletions {
+		deletedHostnames = append(deletedHostnames, normalizeDNSName(record.Name))
+	}
+	if !engine.removals.Allow("dns:"+zoneName, deletedHostnames) {
+		engine.log.Error("DNS sync would delete more records in zone than SYNC_MAX_REMOVALS allows; keeping them until the next sync asks for the same deletions or SYNC_FORCE_REMOVALS=true", "zone", zone.Name, "records", len(deletions), "limit", engine.removals.Limit())
+		deletions = nil
+	}
+	for _, record := range deletions {
+		hostname := normalizeDNSName(record.Name)
+		if _, removed := removedHostnames[hostname]; removed {
+			engine.log.Warn("deleting DNS record of hostname removed from labels", "hostname", hostname, "zone", zone.Name)
+		} else {
+			engine.log.Warn("deleting managed DNS record never recorded by this controller", "hostname", hostname, "zone", zone.Name)
+		}
+		if engine.dryRun {
+			result.changes.Add(model.ResourceDNSRecord, model.ActionDeleted, hostname)
+			continue
+		}
+		if err := engine.api.DeleteDNSRecord(ctx, zone.ID, record.ID); err != nil {
+			engine.log.Error("failed to delete DNS record", "hostname", hostname, "zone", zone.Name, "error", err)
+			result.failures = append(result.failures, fmt.Errorf("delete DNS record %s: %w", hostname, err))
+			continue
+		}
+		result.changes.Add(model.ResourceDNSRecord, model.ActionDeleted, hostname)
+		result.forgotten = append(result.forgotten, hostname)
+	}
 
-			if len(records) == 0 {
-				engine.log.Info("creating DNS record", "hostname", hostname, "zone", zone.Name)
-				if engine.dryRun {
+	for _, hostname := range knownHostnames {
+		source := plan.sourceByHostname[hostname].ContainerName
+		records := recordsByName[hostname]
+		if len(records) > 1 {
+			engine.log.Warn("multiple DNS records found; skipping", "hostname", hostname, "zone", zone.Name, "source_container", source)
+			continue
+		}
+
+		target, ok := engine.tunnelTarget(plan.tunnelByHostname[hostname])
+		if !ok {
+			engine.log.Warn("route names a tunnel missing from CF_TUNNEL_IDS; skipping", "hostname", hostname, "zone", zone.Name, "source_container", source, "tunnel", plan.tunnelByHostname[hostname])
+			continue
+		}
+		proxied := plan.proxiedByHostname[hostname]
+		apex := hostname == zoneName
+		name := hostname
+		if apex {
+			name = apexRecordName
+		}
+		desired := cloudflare.DNSRecordInput{
+			Type:    dnsRecordType,
+			Name:    name,
+			Content: target,
+			Proxied: proxied == nil || *proxied,
+			TTL:     dnsRecordTTL,
+			Comment: engine.recordComment(plan.commentByHostname[hostname], nil),
+		}
+
+		if len(records) == 0 {
+			if apex {
+				// Cloudflare flattens a CNAME at the apex, but it cannot sit
+				// next to the A/AAAA records a zone apex usually has.
+				conflicts, err := engine.apexConflicts(ctx, zone)
+				if err != nil {
+					engine.log.Error("failed to list apex DNS records", "hostname", hostname, "zone", zone.Name, "source_container", source, "error", err)
+					result.failures = append(result.failures, fmt.Errorf("list apex DNS records in zone %s: %w", zone.Name, err))
 					continue
 				}
-				_, err := engine.api.CreateDNSRecord(ctx, zone.ID, desired)
-				if err != nil {
-					engine.log.Error("failed to create DNS record", "hostname", hostname, "zone", zone.Name, "error", err)
+				if len(conflicts) > 0 {
+					engine.log.Warn("zone apex already has records that a CNAME cannot coexist with; skipping", "hostname", hostname, "zone", zone.Name, "source_container", source, "types", conflicts)
+					continue
 				}
-				continue
-			}
-
-			record := records[0]
-			if record.Type != dnsRecordType {
-				engine.log.Warn("existing DNS record has non-CNAME type; skipping", "hostname", hostname, "zone", zone.Name, "type", record.Type)
-				continue
 			}
-			if !engine.isManagedRecord(record, desired) {
-				engine.log.Warn("existing DNS record is not managed; skipping", "hostname", hostname, "zone", zone.Name)
+			engine.log.Info("creating DNS record", "hostname", hostname, "zone", zone.Name, "source_container", source, "apex", apex)
+			if engine.dryRun {
+				result.changes.Add(model.ResourceDNSRecord, model.ActionCreated, hostname)
 				continue
 			}
-			if dnsRecordEqual(record, desired) {
-				engine.log.Debug("DNS record up-to-date", "hostname", hostname, "zone", zone.Name)
+			_, err := engine.api.CreateDNSRecord(ctx, zone.ID, desired)
+			if err != nil {
+				engine.log.Error("failed to create DNS record", "hostname", hostname, "zone", zone.Name, "source_container", source, "error", err)
+				result.failures = append(result.failures, fmt.Errorf("create DNS record %s: %w", hostname, err))
 				continue
 			}
+			result.changes.Add(model.ResourceDNSRecord, model.ActionCreated, hostname)
+			result.managed = append(result.managed, hostname)
+			continue
+		}
 
-			engine.log.Info("updating DNS record", "hostname", hostname, "zone", zone.Name)
-			if engine.dryRun {
-				continue
-			}
-			_, err = engine.api.UpdateDNSRecord(ctx, zone.ID, record.ID, desired)
-			if err != nil {
-				engine.log.Error("failed to update DNS record", "hostname", hostname, "zone", zone.Name, "error", err)
+		record := records[0]
+		if record.Type != dnsRecordType {
+			engine.log.Warn("existing DNS record has non-CNAME type; skipping", "hostname", hostname, "zone", zone.Name, "source_container", source, "type", record.Type)
+			continue
+		}
+		if !engine.isManagedRecord(record, desired) {
+			engine.log.Warn("existing DNS record is not managed; skipping", "hostname", hostname, "zone", zone.Name, "source_container", source)
+			continue
+		}
+		if proxied == nil && record.Proxied != desired.Proxied {
+			// Without an explicit label, a record grey-clouded by hand stays
+			// that way instead of being flipped back on every cycle.
+			engine.log.Debug("keeping proxied state of existing DNS record", "hostname", hostname, "zone", zone.Name, "source_container", source, "proxied", record.Proxied)
+			desired.Proxied = record.Proxied
+		}
+		desired.Comment = engine.recordComment(plan.commentByHostname[hostname], &record)
+		if dnsRecordEqual(record, desired) {
+			engine.log.Debug("DNS record up-to-date", "hostname", hostname, "zone", zone.Name, "source_container", source)
+			result.managed = append(result.managed, hostname)
+			continue
+		}
+
+		engine.log.Info("updating DNS record", "hostname", hostname, "zone", zone.Name, "source_container", source)
+		if engine.dryRun {
+			result.changes.Add(model.ResourceDNSRecord, model.ActionUpdated, hostname)
+			continue
+		}
+		_, err = engine.api.UpdateDNSRecord(ctx, zone.ID, record.ID, desired)
+		if err != nil {
+			engine.log.Error("failed to update DNS record", "hostname", hostname, "zone", zone.Name, "source_container", source, "error", err)
+			result.failures = append(result.failures, fmt.Errorf("update DNS record %s: %w", hostname, err))
+			continue
+		}
+		result.changes.Add(model.ResourceDNSRecord, model.ActionUpdated, hostname)
+		result.managed = append(result.managed, hostname)
+	}
+
+	return result
+}
+
+// withoutProtectedRoutes drops routes whose hostname is protected, so their
+// DNS records are left as they are.
+func (engine *Engine) withoutProtectedRoutes(routes []model.RouteSpec) []model.RouteSpec {
+	if len(engine.protected) == 0 {
+		return routes
+	}
+	kept := make([]model.RouteSpec, 0, len(routes))
+	for _, route := range routes {
+		if engine.protected.Match(route.Key.Hostname) {
+			engine.log.Warn("route claims a protected hostname; leaving its DNS record untouched", "hostname", route.Key.Hostname, "source_container", route.Source.ContainerName)
+			continue
+		}
+		kept = append(kept, route)
+	}
+	return kept
+}
+
+// removedHostnames returns, by zone, the hostnames recorded in the state file
+// that none of the routes defines anymore. Protected hostnames are skipped.
+func (engine *Engine) removedHostnames(routes []model.RouteSpec) map[string][]string {
+	if engine.tracked == nil {
+		return nil
+	}
+	desired := map[string]struct{}{}
+	for _, route := range routes {
+		desired[normalizeDNSName(route.Key.Hostname)] = struct{}{}
+	}
+
+	removed := map[string][]string{}
+	for _, hostname := range engine.tracked.DNSHostnames() {
+		if _, ok := desired[hostname]; ok {
+			continue
+		}
+		if engine.protected.Match(hostname) {
+			continue
+		}
+		zone, err := autoZoneForHostname(hostname)
+		if err != nil {
+			engine.log.Debug("failed to derive DNS zone of removed hostname; skipping", "hostname", hostname, "error", err)
+			continue
+		}
+		removed[zone] = append(removed[zone], hostname)
+	}
+	return removed
+}
+
+// trackHostnames records the hostnames whose records are managed and forgets
+// the ones handled after their removal from the labels.
+func (engine *Engine) trackHostnames(managed []string, forgotten []string) error {
+	if engine.tracked == nil || engine.dryRun {
+		return nil
+	}
+	changed := engine.tracked.AddDNSHostnames(managed)
+	if engine.tracked.RemoveDNSHostnames(forgotten) {
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return engine.tracked.Save()
+}
+
+// apexConflicts returns the types of the records at the zone apex that
+// prevent creating a CNAME there.
+func (engine *Engine) apexConflicts(ctx context.Context, zone cloudflare.Zone) ([]string, error) {
+	records, err := engine.api.ListDNSRecords(ctx, zone.ID, "", zone.Name)
+	if err != nil {
+		return nil, err
+	}
+	types := []string{}
+	for _, record := range records {
+		if record.Type == "A" || record.Type == "AAAA" || record.Type == dnsRecordType {
+			if !slices.Contains(types, record.Type) {
+				types = append(types, record.Type)
 			}
 		}
 	}
+	return types, nil
+}
 
-	return nil
+// tunnelTarget returns the CNAME target of the named tunnel, or of
+// CF_TUNNEL_ID when name is empty.
+func (engine *Engine) tunnelTarget(name string) (string, bool) {
+	tunnelID := engine.tunnelID
+	if name != "" {
+		var ok bool
+		if tunnelID, ok = engine.tunnels[name]; !ok {
+			return "", false
+		}
+	}
+	return fmt.Sprintf("%s.%s", tunnelID, engine.tunnelSuffix), true
 }
 
-func (engine *Engine) tunnelTarget() string {
-	return fmt.Sprintf("%s.cfargotunnel.com", engine.tunnelID)
+// isTunnelTarget reports whether content points to any configured tunnel, so
+// a hostname moved between tunnels is still recognized as managed.
+func (engine *Engine) isTunnelTarget(content string) bool {
+	if target, _ := engine.tunnelTarget(""); strings.EqualFold(content, target) {
+		return true
+	}
+	for name := range engine.tunnels {
+		if target, _ := engine.tunnelTarget(name); strings.EqualFold(content, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasManagedComment reports whether comment is the managed marker, alone or
+// followed by a cloudflare.tunnel.dns.comment note.
+func (engine *Engine) hasManagedComment(comment string) bool {
+	return comment == engine.managedComment || strings.HasPrefix(comment, engine.managedComment+dnsCommentSeparator)
+}
+
+// recordComment returns the managed marker followed by the note, if any. A
+// nil note keeps the comment of an existing managed record, so a note added
+// by hand after the marker is not removed.
+func (engine *Engine) recordComment(note *string, record *cloudflare.DNSRecord) string {
+	if note == nil {
+		if record != nil && engine.hasManagedComment(record.Comment) {
+			return record.Comment
+		}
+		return engine.managedComment
+	}
+	if *note == "" {
+		return engine.managedComment
+	}
+	return engine.managedComment + dnsCommentSeparator + *note
 }
 
 func (engine *Engine) isManagedRecord(record cloudflare.DNSRecord, desired cloudflare.DNSRecordInput) bool {
-	if record.Comment == engine.managedComment {
+	if engine.hasManagedComment(record.Comment) {
 		return true
 	}
-	return strings.EqualFold(record.Content, desired.Content)
+	return strings.EqualFold(record.Content, desired.Content) || engine.isTunnelTarget(record.Content)
 }
 
 func (engine *Engine) selectedZones(plan zonePlan) map[string]struct{} {
@@ -197,6 +551,9 @@ func (engine *Engine) selectedZones(plan zonePlan) map[string]struct{} {
 	for zone := range plan.requiredZones {
 		selected[zone] = struct{}{}
 	}
+	for zone := range plan.removedByZone {
+		selected[zone] = struct{}{}
+	}
 	if !engine.delete {
 		return selected
 	}
@@ -227,9 +584,26 @@ func buildZonePlan(routes []model.RouteSpec, logger *slog.Logger) zonePlan {
 
 		state, ok := states[hostname]
 		if !ok {
-			state = &hostnameZoneState{explicitZones: map[string]struct{}{}}
+			state = &hostnameZoneState{explicitZones: map[string]struct{}{}, tunnel: route.Tunnel, source: route.Source}
 			states[hostname] = state
 		}
+		if route.Tunnel != state.tunnel {
+			state.conflictingTunnel = true
+		}
+
+		if route.DNSProxied != nil {
+			if state.proxied != nil && *state.proxied != *route.DNSProxied {
+				state.conflictingProxied = true
+			}
+			state.proxied = route.DNSProxied
+		}
+
+		if route.DNSComment != nil {
+			if state.comment != nil && *state.comment != *route.DNSComment {
+				state.conflictingComment = true
+			}
+			state.comment = route.DNSComment
+		}
 
 		if route.DNSZoneOverride == "" {
 			continue
@@ -237,12 +611,12 @@ func buildZonePlan(routes []model.RouteSpec, logger *slog.Logger) zonePlan {
 
 		zone := normalizeDNSName(route.DNSZoneOverride)
 		if zone == "" {
-			logger.Warn("configured DNS zone override is empty; skipping hostname", "hostname", hostname)
+			logger.Warn("configured DNS zone override is empty; skipping hostname", "hostname", hostname, "source_container", route.Source.ContainerName)
 			state.invalidExplicit = true
 			continue
 		}
 		if !hostnameMatchesZone(hostname, zone) {
-			logger.Warn("configured DNS zone override does not match hostname; skipping hostname", "hostname", hostname, "zone", zone)
+			logger.Warn("configured DNS zone override does not match hostname; skipping hostname", "hostname", hostname, "zone", zone, "source_container", route.Source.ContainerName)
 			state.invalidExplicit = true
 			continue
 		}
@@ -251,14 +625,24 @@ func buildZonePlan(routes []model.RouteSpec, logger *slog.Logger) zonePlan {
 	}
 
 	plan := zonePlan{
-		requiredZones:   map[string]struct{}{},
-		hostnamesByZone: map[string][]string{},
+		requiredZones:     map[string]struct{}{},
+		hostnamesByZone:   map[string][]string{},
+		sourceByHostname:  map[string]model.SourceRef{},
+		proxiedByHostname: map[string]*bool{},
+		commentByHostname: map[string]*string{},
+		tunnelByHostname:  map[string]string{},
 	}
 
 	for hostname, state := range states {
 		if state.invalidExplicit {
 			continue
 		}
+		if state.conflictingTunnel {
+			// A hostname has a single CNAME, so its paths cannot be split
+			// across tunnels.
+			logger.Warn("routes of hostname name different tunnels; skipping hostname", "hostname", hostname, "source_container", state.source.ContainerName)
+			continue
+		}
 
 		zone, ok := selectZoneForHostname(hostname, state, logger)
 		if !ok {
@@ -267,6 +651,18 @@ func buildZonePlan(routes []model.RouteSpec, logger *slog.Logger) zonePlan {
 
 		plan.requiredZones[zone] = struct{}{}
 		plan.hostnamesByZone[zone] = append(plan.hostnamesByZone[zone], hostname)
+		plan.sourceByHostname[hostname] = state.source
+		plan.tunnelByHostname[hostname] = state.tunnel
+		if state.conflictingComment {
+			logger.Warn("conflicting DNS comment labels for hostname; keeping existing comment", "hostname", hostname, "source_container", state.source.ContainerName)
+		} else {
+			plan.commentByHostname[hostname] = state.comment
+		}
+		if state.conflictingProxied {
+			logger.Warn("conflicting DNS proxied labels for hostname; keeping existing proxied state", "hostname", hostname, "source_container", state.source.ContainerName)
+			continue
+		}
+		plan.proxiedByHostname[hostname] = state.proxied
 	}
 
 	for zone := range plan.hostnamesByZone {
@@ -311,6 +707,66 @@ func filterZones(zones []cloudflare.Zone, requiredZones map[string]struct{}, log
 	return orderZones(filtered)
 }
 
+// warnOverlappingZones warns about each hostname that more than one
+// accessible zone could hold, such as a delegated dev.example.com zone next to
+// example.com, naming the zone that was chosen for it.
+func warnOverlappingZones(plan zonePlan, zones []cloudflare.Zone, logger *slog.Logger) {
+	chosen := map[string]string{}
+	for zone, hostnames := range plan.hostnamesByZone {
+		for _, hostname := range hostnames {
+			chosen[hostname] = zone
+		}
+	}
+	hostnames := make([]string, 0, len(chosen))
+	for hostname := range chosen {
+		hostnames = append(hostnames, hostname)
+	}
+	sort.Strings(hostnames)
+
+	for _, hostname := range hostnames {
+		matches := []string{}
+		for _, zone := range zones {
+			if name := normalizeDNSName(zone.Name); hostnameMatchesZone(hostname, name) {
+				matches = append(matches, name)
+			}
+		}
+		if len(matches) < 2 {
+			continue
+		}
+		sort.Strings(matches)
+		logger.Warn("hostname matches more than one Cloudflare zone; set cloudflare.tunnel.dns.zone to pick another", "hostname", hostname, "zones", strings.Join(matches, ","), "chosen_zone", chosen[hostname], "source_container", plan.sourceByHostname[hostname].ContainerName)
+	}
+}
+
+// warnUnmatchedHostnames warns about each desired hostname whose zone is not
+// among the account's zones, such as a typo or a domain held by another
+// Cloudflare account: its ingress rule is written but no DNS record is. A
+// hostname is warned about again only after it matched a zone or left the
+// routes in between.
+// It returns the number of unmatched hostnames.
+func (engine *Engine) warnUnmatchedHostnames(plan zonePlan, zones []cloudflare.Zone) int {
+	accessible := map[string]struct{}{}
+	for _, zone := range zones {
+		accessible[normalizeDNSName(zone.Name)] = struct{}{}
+	}
+
+	unmatched := map[string]struct{}{}
+	for _, zone := range slices.Sorted(maps.Keys(plan.hostnamesByZone)) {
+		if _, found := accessible[zone]; found {
+			continue
+		}
+		for _, hostname := range plan.hostnamesByZone[zone] {
+			unmatched[hostname] = struct{}{}
+			if _, reported := engine.unmatched[hostname]; reported {
+				continue
+			}
+			engine.log.Warn("hostname matches no Cloudflare zone in the account; no DNS record is created for it", "hostname", hostname, "zone", zone, "source_container", plan.sourceByHostname[hostname].ContainerName)
+		}
+	}
+	engine.unmatched = unmatched
+	return len(unmatched)
+}
+
 func selectZoneForHostname(hostname string, state *hostnameZoneState, logger *slog.Logger) (string, bool) {
 	if len(state.explicitZones) > 1 {
 		zones := make([]string, 0, len(state.explicitZones))
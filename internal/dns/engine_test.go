@@ -2,12 +2,18 @@ package dns
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/cloudflare"
 	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/model"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/state"
 )
 
 const testManagedBy = "test-managed"
@@ -44,11 +50,47 @@ func TestBuildZonePlanSkipsConflictingExplicitOverrides(t *testing.T) {
 	}
 }
 
+func TestBuildZonePlanKeepsSourceContainer(t *testing.T) {
+	plan := buildZonePlan([]model.RouteSpec{
+		{Key: model.RouteKey{Hostname: "app.example.com"}, Service: "http://app", Source: model.SourceRef{ContainerID: "1", ContainerName: "web"}},
+		{Key: model.RouteKey{Hostname: "app.example.com", Path: "/api"}, Service: "http://api", Source: model.SourceRef{ContainerID: "2", ContainerName: "api"}},
+	}, testLogger())
+
+	if source := plan.sourceByHostname["app.example.com"]; source.ContainerName != "web" {
+		t.Fatalf("expected first route source to be kept, got %+v", source)
+	}
+}
+
+func TestWarnOverlappingZonesNamesChosenZone(t *testing.T) {
+	plan := buildZonePlan([]model.RouteSpec{
+		{Key: model.RouteKey{Hostname: "app.dev.example.com"}, Service: "http://app", Source: model.SourceRef{ContainerName: "web"}},
+		{Key: model.RouteKey{Hostname: "www.example.org"}, Service: "http://www"},
+	}, testLogger())
+	var output strings.Builder
+	logger := slog.New(slog.NewTextHandler(&output, nil))
+
+	warnOverlappingZones(plan, []cloudflare.Zone{
+		{ID: "zone-example-com", Name: "example.com"},
+		{ID: "zone-dev-example-com", Name: "dev.example.com"},
+		{ID: "zone-example-org", Name: "example.org"},
+	}, logger)
+
+	logged := output.String()
+	if strings.Count(logged, "hostname matches more than one Cloudflare zone") != 1 {
+		t.Fatalf("expected one overlap warning, got %q", logged)
+	}
+	for _, want := range []string{"hostname=app.dev.example.com", "zones=dev.example.com,example.com", "chosen_zone=example.com", "source_container=web"} {
+		if !strings.Contains(logged, want) {
+			t.Fatalf("expected %q in %q", want, logged)
+		}
+	}
+}
+
 func TestReconcileManageDisabledSkipsAPICalls(t *testing.T) {
 	api := &stubDNSAPI{}
-	engine := NewEngine(api, testLogger(), false, false, true, nil, "tunnel-id", testManagedBy)
+	engine := NewEngine(api, testLogger(), Options{Delete: true, TunnelID: "tunnel-id", TunnelSuffix: "cfargotunnel.com", ManagedBy: testManagedBy, Concurrency: 1})
 
-	err := engine.Reconcile(context.Background(), []model.RouteSpec{{Key: model.RouteKey{Hostname: "app.example.com"}, Service: "http://app"}})
+	_, err := engine.Reconcile(context.Background(), []model.RouteSpec{{Key: model.RouteKey{Hostname: "app.example.com"}, Service: "http://app"}})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -68,9 +110,9 @@ func TestReconcileSkipsUnrelatedZones(t *testing.T) {
 			{ID: "zone-unrelated-net", Name: "unrelated.net"},
 		},
 	}
-	engine := NewEngine(api, testLogger(), true, true, false, nil, "tunnel-id", testManagedBy)
+	engine := NewEngine(api, testLogger(), Options{DryRun: true, Manage: true, TunnelID: "tunnel-id", TunnelSuffix: "cfargotunnel.com", ManagedBy: testManagedBy, Concurrency: 1})
 
-	err := engine.Reconcile(context.Background(), []model.RouteSpec{
+	_, err := engine.Reconcile(context.Background(), []model.RouteSpec{
 		{Key: model.RouteKey{Hostname: "app.example.com"}, Service: "http://app"},
 		{Key: model.RouteKey{Hostname: "api.example.org"}, Service: "http://api"},
 	})
@@ -83,6 +125,245 @@ func TestReconcileSkipsUnrelatedZones(t *testing.T) {
 	assertZoneNotQueried(t, api.listDNSRecordsCalls, "zone-unrelated-net")
 }
 
+func TestReconcileWarnsOnceAboutHostnamesMatchingNoZone(t *testing.T) {
+	api := &stubDNSAPI{zones: []cloudflare.Zone{{ID: "zone-example-com", Name: "example.com"}}}
+	var output strings.Builder
+	logger := slog.New(slog.NewTextHandler(&output, nil))
+	engine := NewEngine(api, logger, Options{DryRun: true, Manage: true, TunnelID: "tunnel-id", TunnelSuffix: "cfargotunnel.com", ManagedBy: testManagedBy, Concurrency: 1})
+	routes := []model.RouteSpec{
+		{Key: model.RouteKey{Hostname: "app.example.com"}, Service: "http://app"},
+		{Key: model.RouteKey{Hostname: "app.exmaple.com"}, Service: "http://app", Source: model.SourceRef{ContainerName: "web"}},
+	}
+	const warning = "hostname matches no Cloudflare zone in the account"
+
+	for cycle := 1; cycle <= 2; cycle++ {
+		result, err := engine.Reconcile(context.Background(), routes)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.UnmatchedHostnames != 1 {
+			t.Fatalf("cycle %d: expected one unmatched hostname, got %d", cycle, result.UnmatchedHostnames)
+		}
+	}
+	logged := output.String()
+	if strings.Count(logged, warning) != 1 {
+		t.Fatalf("expected a single warning across cycles, got %q", logged)
+	}
+	for _, want := range []string{"hostname=app.exmaple.com", "zone=exmaple.com", "source_container=web"} {
+		if !strings.Contains(logged, want) {
+			t.Fatalf("expected %q in %q", want, logged)
+		}
+	}
+
+	// Once the hostname is fixed, a later typo is reported again.
+	if _, err := engine.Reconcile(context.Background(), routes[:1]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := engine.Reconcile(context.Background(), routes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Count(output.String(), warning) != 2 {
+		t.Fatalf("expected the warning again after the hostname matched, got %q", output.String())
+	}
+}
+
+func TestReconcileReturnsZoneFailuresAfterSyncingOtherZones(t *testing.T) {
+	api := &stubDNSAPI{
+		zones: []cloudflare.Zone{
+			{ID: "zone-example-com", Name: "example.com"},
+			{ID: "zone-example-org", Name: "example.org"},
+		},
+		listErrors: map[string]error{"zone-example-com": errors.New("boom")},
+	}
+	engine := NewEngine(api, testLogger(), Options{Manage: true, TunnelID: "tunnel-id", TunnelSuffix: "cfargotunnel.com", ManagedBy: testManagedBy, Concurrency: 1})
+
+	_, err := engine.Reconcile(context.Background(), []model.RouteSpec{
+		{Key: model.RouteKey{Hostname: "app.example.com"}, Service: "http://app"},
+		{Key: model.RouteKey{Hostname: "api.example.org"}, Service: "http://api"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "list DNS records in zone example.com: boom") {
+		t.Fatalf("expected zone failure to be returned, got %v", err)
+	}
+	if api.createCalls != 1 {
+		t.Fatalf("expected the healthy zone to still be synced, got %d creates", api.createCalls)
+	}
+}
+
+func TestReconcileUsesConfiguredTunnelDNSSuffix(t *testing.T) {
+	api := &stubDNSAPI{
+		zones: []cloudflare.Zone{{ID: "zone-example-com", Name: "example.com"}},
+		recordsByQuery: map[string][]cloudflare.DNSRecord{
+			"zone-example-com|": {
+				{ID: "record-1", Type: "CNAME", Name: "existing.example.com", Content: "tunnel-id.cfargotunnel.com.cn", Proxied: true, TTL: 1},
+			},
+		},
+	}
+	engine := NewEngine(api, testLogger(), Options{Manage: true, TunnelID: "tunnel-id", TunnelSuffix: "cfargotunnel.com.cn", ManagedBy: testManagedBy, Concurrency: 1})
+
+	_, err := engine.Reconcile(context.Background(), []model.RouteSpec{
+		{Key: model.RouteKey{Hostname: "existing.example.com"}, Service: "http://existing"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.updateCalls != 1 {
+		t.Fatalf("expected record on the configured suffix to be adopted, got %d updates", api.updateCalls)
+	}
+	if api.lastInput.Content != "tunnel-id.cfargotunnel.com.cn" {
+		t.Fatalf("unexpected tunnel target: %q", api.lastInput.Content)
+	}
+}
+
+func TestReconcilePointsRecordsToTheRouteTunnel(t *testing.T) {
+	api := &stubDNSAPI{
+		zones: []cloudflare.Zone{{ID: "zone-example-com", Name: "example.com"}},
+		recordsByQuery: map[string][]cloudflare.DNSRecord{
+			"zone-example-com|": {
+				{ID: "record-1", Type: "CNAME", Name: "moved.example.com", Content: "tunnel-id.cfargotunnel.com", Proxied: true, TTL: 1},
+			},
+		},
+	}
+	engine := NewEngine(api, testLogger(), Options{Manage: true, TunnelID: "tunnel-id", TunnelSuffix: "cfargotunnel.com", ManagedBy: testManagedBy, Concurrency: 1, Tunnels: map[string]string{"lab": "lab-id"}})
+
+	_, err := engine.Reconcile(context.Background(), []model.RouteSpec{
+		{Key: model.RouteKey{Hostname: "moved.example.com"}, Service: "http://moved", Tunnel: "lab"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.updateCalls != 1 || api.lastInput.Content != "lab-id.cfargotunnel.com" {
+		t.Fatalf("expected the record to move to the lab tunnel, got %d updates to %q", api.updateCalls, api.lastInput.Content)
+	}
+}
+
+func TestBuildZonePlanSkipsHostnameSplitAcrossTunnels(t *testing.T) {
+	plan := buildZonePlan([]model.RouteSpec{
+		{Key: model.RouteKey{Hostname: "app.example.com"}, Service: "http://app"},
+		{Key: model.RouteKey{Hostname: "app.example.com", Path: "/lab"}, Service: "http://lab", Tunnel: "lab"},
+		{Key: model.RouteKey{Hostname: "lab.example.com"}, Service: "http://lab", Tunnel: "lab"},
+	}, testLogger())
+
+	if hosts := plan.hostnamesByZone["example.com"]; len(hosts) != 1 || hosts[0] != "lab.example.com" {
+		t.Fatalf("expected only lab.example.com to be planned, got %+v", hosts)
+	}
+	if tunnel := plan.tunnelByHostname["lab.example.com"]; tunnel != "lab" {
+		t.Fatalf("expected lab.example.com on the lab tunnel, got %q", tunnel)
+	}
+}
+
+func TestReconcileKeepsGreyCloudedRecordWithoutProxiedLabel(t *testing.T) {
+	comment := model.DNSManagedComment(testManagedBy)
+	api := &stubDNSAPI{
+		zones: []cloudflare.Zone{{ID: "zone-example-com", Name: "example.com"}},
+		recordsByQuery: map[string][]cloudflare.DNSRecord{
+			"zone-example-com|": {
+				{ID: "record-1", Type: "CNAME", Name: "grey.example.com", Content: "tunnel-id.cfargotunnel.com", Proxied: false, TTL: 1, Comment: comment},
+				{ID: "record-2", Type: "CNAME", Name: "forced.example.com", Content: "tunnel-id.cfargotunnel.com", Proxied: false, TTL: 1, Comment: comment},
+			},
+		},
+	}
+	engine := NewEngine(api, testLogger(), Options{Manage: true, TunnelID: "tunnel-id", TunnelSuffix: "cfargotunnel.com", ManagedBy: testManagedBy, Concurrency: 1})
+
+	proxied := true
+	_, err := engine.Reconcile(context.Background(), []model.RouteSpec{
+		{Key: model.RouteKey{Hostname: "grey.example.com"}, Service: "http://grey"},
+		{Key: model.RouteKey{Hostname: "forced.example.com"}, Service: "http://forced", DNSProxied: &proxied},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.updateCalls != 1 {
+		t.Fatalf("expected only the labeled record to be updated, got %d updates", api.updateCalls)
+	}
+	if api.lastInput.Name != "forced.example.com" || !api.lastInput.Proxied {
+		t.Fatalf("expected forced.example.com to be proxied, got %+v", api.lastInput)
+	}
+}
+
+func TestReconcileCombinesCommentLabelWithManagedMarker(t *testing.T) {
+	marker := model.DNSManagedComment(testManagedBy)
+	api := &stubDNSAPI{
+		zones: []cloudflare.Zone{{ID: "zone-example-com", Name: "example.com"}},
+		recordsByQuery: map[string][]cloudflare.DNSRecord{
+			"zone-example-com|": {
+				{ID: "record-1", Type: "CNAME", Name: "noted.example.com", Content: "tunnel-id.cfargotunnel.com", Proxied: true, TTL: 1, Comment: marker + "; owned by the media team"},
+				{ID: "record-2", Type: "CNAME", Name: "labeled.example.com", Content: "tunnel-id.cfargotunnel.com", Proxied: true, TTL: 1, Comment: marker},
+				{ID: "record-3", Type: "CNAME", Name: "gone.example.com", Content: "tunnel-id.cfargotunnel.com", Proxied: true, TTL: 1, Comment: marker + "; old note"},
+			},
+		},
+	}
+	engine := NewEngine(api, testLogger(), Options{Manage: true, Delete: true, TunnelID: "tunnel-id", TunnelSuffix: "cfargotunnel.com", ManagedBy: testManagedBy, Concurrency: 1})
+
+	note := "see runbook 12"
+	_, err := engine.Reconcile(context.Background(), []model.RouteSpec{
+		{Key: model.RouteKey{Hostname: "noted.example.com"}, Service: "http://noted"},
+		{Key: model.RouteKey{Hostname: "labeled.example.com"}, Service: "http://labeled", DNSComment: &note},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.updateCalls != 1 {
+		t.Fatalf("expected only the labeled record to be updated, got %d updates", api.updateCalls)
+	}
+	if want := marker + "; see runbook 12"; api.lastInput.Name != "labeled.example.com" || api.lastInput.Comment != want {
+		t.Fatalf("expected comment %q on labeled.example.com, got %+v", want, api.lastInput)
+	}
+	if len(api.deleteCalls) != 1 || api.deleteCalls[0].recordID != "record-3" {
+		t.Fatalf("expected the managed record with a note to be deleted, got %+v", api.deleteCalls)
+	}
+}
+
+func TestReconcileCreatesUnproxiedRecordFromLabel(t *testing.T) {
+	api := &stubDNSAPI{zones: []cloudflare.Zone{{ID: "zone-example-com", Name: "example.com"}}}
+	engine := NewEngine(api, testLogger(), Options{Manage: true, TunnelID: "tunnel-id", TunnelSuffix: "cfargotunnel.com", ManagedBy: testManagedBy, Concurrency: 1})
+
+	proxied := false
+	_, err := engine.Reconcile(context.Background(), []model.RouteSpec{
+		{Key: model.RouteKey{Hostname: "grey.example.com"}, Service: "http://grey", DNSProxied: &proxied},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.createCalls != 1 || api.lastInput.Proxied {
+		t.Fatalf("expected one unproxied record, got %d creates and %+v", api.createCalls, api.lastInput)
+	}
+}
+
+func TestReconcileCreatesProxiedApexRecord(t *testing.T) {
+	api := &stubDNSAPI{zones: []cloudflare.Zone{{ID: "zone-example-com", Name: "example.com"}}}
+	engine := NewEngine(api, testLogger(), Options{Manage: true, TunnelID: "tunnel-id", TunnelSuffix: "cfargotunnel.com", ManagedBy: testManagedBy, Concurrency: 1})
+
+	_, err := engine.Reconcile(context.Background(), []model.RouteSpec{
+		{Key: model.RouteKey{Hostname: "example.com"}, Service: "http://site"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.createCalls != 1 || api.lastInput.Name != "@" || !api.lastInput.Proxied {
+		t.Fatalf("expected one proxied apex record named @, got %d creates and %+v", api.createCalls, api.lastInput)
+	}
+}
+
+func TestReconcileSkipsApexRecordWhenAddressRecordsExist(t *testing.T) {
+	api := &stubDNSAPI{
+		zones: []cloudflare.Zone{{ID: "zone-example-com", Name: "example.com"}},
+		recordsByQuery: map[string][]cloudflare.DNSRecord{
+			"zone-example-com|example.com": {{ID: "a-1", Type: "A", Name: "example.com", Content: "192.0.2.1"}},
+		},
+	}
+	engine := NewEngine(api, testLogger(), Options{Manage: true, TunnelID: "tunnel-id", TunnelSuffix: "cfargotunnel.com", ManagedBy: testManagedBy, Concurrency: 1})
+
+	_, err := engine.Reconcile(context.Background(), []model.RouteSpec{
+		{Key: model.RouteKey{Hostname: "example.com"}, Service: "http://site"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.createCalls != 0 {
+		t.Fatalf("expected the apex CNAME to be skipped next to an A record, got %d creates", api.createCalls)
+	}
+}
+
 func TestReconcileUsesExplicitOverrideZone(t *testing.T) {
 	api := &stubDNSAPI{
 		zones: []cloudflare.Zone{
@@ -90,9 +371,9 @@ func TestReconcileUsesExplicitOverrideZone(t *testing.T) {
 			{ID: "zone-dev-example-com", Name: "dev.example.com"},
 		},
 	}
-	engine := NewEngine(api, testLogger(), true, true, false, nil, "tunnel-id", testManagedBy)
+	engine := NewEngine(api, testLogger(), Options{DryRun: true, Manage: true, TunnelID: "tunnel-id", TunnelSuffix: "cfargotunnel.com", ManagedBy: testManagedBy, Concurrency: 1})
 
-	err := engine.Reconcile(context.Background(), []model.RouteSpec{{
+	_, err := engine.Reconcile(context.Background(), []model.RouteSpec{{
 		Key:             model.RouteKey{Hostname: "app.dev.example.com"},
 		Service:         "http://app",
 		DNSZoneOverride: "dev.example.com",
@@ -109,9 +390,9 @@ func TestReconcileSkipsHostnameWhenExplicitOverrideIsInvalid(t *testing.T) {
 	api := &stubDNSAPI{
 		zones: []cloudflare.Zone{{ID: "zone-example-com", Name: "example.com"}},
 	}
-	engine := NewEngine(api, testLogger(), true, true, false, nil, "tunnel-id", testManagedBy)
+	engine := NewEngine(api, testLogger(), Options{DryRun: true, Manage: true, TunnelID: "tunnel-id", TunnelSuffix: "cfargotunnel.com", ManagedBy: testManagedBy, Concurrency: 1})
 
-	err := engine.Reconcile(context.Background(), []model.RouteSpec{{
+	_, err := engine.Reconcile(context.Background(), []model.RouteSpec{{
 		Key:             model.RouteKey{Hostname: "app.example.com"},
 		Service:         "http://app",
 		DNSZoneOverride: "dev.example.com",
@@ -147,9 +428,9 @@ func TestReconcileDeleteOnlyTouchesSelectedZones(t *testing.T) {
 			},
 		},
 	}
-	engine := NewEngine(api, testLogger(), false, true, true, nil, "tunnel-id", testManagedBy)
+	engine := NewEngine(api, testLogger(), Options{Manage: true, Delete: true, TunnelID: "tunnel-id", TunnelSuffix: "cfargotunnel.com", ManagedBy: testManagedBy, Concurrency: 1})
 
-	err := engine.Reconcile(context.Background(), []model.RouteSpec{{Key: model.RouteKey{Hostname: "app.example.com"}, Service: "http://app"}})
+	_, err := engine.Reconcile(context.Background(), []model.RouteSpec{{Key: model.RouteKey{Hostname: "app.example.com"}, Service: "http://app"}})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -163,6 +444,73 @@ func TestReconcileDeleteOnlyTouchesSelectedZones(t *testing.T) {
 	assertZoneNotQueried(t, api.listDNSRecordsCalls, "zone-example-org")
 }
 
+func TestReconcileNeverTouchesProtectedHostnames(t *testing.T) {
+	managedComment := model.DNSManagedComment(testManagedBy)
+	api := &stubDNSAPI{
+		zones: []cloudflare.Zone{{ID: "zone-darkdragon-fr", Name: "darkdragon.fr"}},
+		recordsByQuery: map[string][]cloudflare.DNSRecord{
+			"zone-darkdragon-fr|": {
+				{ID: "mail", Name: "mail.darkdragon.fr", Type: dnsRecordType, Comment: managedComment},
+				{ID: "vpn", Name: "vpn.home.darkdragon.fr", Type: dnsRecordType, Comment: managedComment},
+				{ID: "orphan", Name: "old.darkdragon.fr", Type: dnsRecordType, Comment: managedComment},
+			},
+		},
+	}
+	engine := NewEngine(api, testLogger(), Options{Manage: true, Delete: true, ConfiguredZones: []string{"darkdragon.fr"}, TunnelID: "tunnel-id", TunnelSuffix: "cfargotunnel.com", ManagedBy: testManagedBy, Protected: model.ProtectedHostnames{"mail.darkdragon.fr", "*.home.darkdragon.fr"}, Concurrency: 1})
+
+	_, err := engine.Reconcile(context.Background(), []model.RouteSpec{{Key: model.RouteKey{Hostname: "mail.darkdragon.fr"}, Service: "http://mail"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.createCalls != 0 || api.updateCalls != 0 {
+		t.Fatalf("expected protected hostname claimed by labels to be left untouched, got %d creates and %d updates", api.createCalls, api.updateCalls)
+	}
+	if len(api.deleteCalls) != 1 || api.deleteCalls[0].recordID != "orphan" {
+		t.Fatalf("expected only the unprotected orphan to be deleted, got %+v", api.deleteCalls)
+	}
+}
+
+func TestReconcileTracksRemovedHostnames(t *testing.T) {
+	managedComment := model.DNSManagedComment(testManagedBy)
+	records := map[string][]cloudflare.DNSRecord{
+		"zone-example-com|": {
+			{ID: "renamed", Name: "old.example.com", Type: dnsRecordType, Content: "tunnel-id.cfargotunnel.com", Comment: "edited by hand"},
+			{ID: "untracked", Name: "legacy.example.com", Type: dnsRecordType, Content: "tunnel-id.cfargotunnel.com", Comment: managedComment},
+		},
+	}
+	tracked, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tracked.AddDNSHostnames([]string{"old.example.com", "gone.example.com"})
+	routes := []model.RouteSpec{{Key: model.RouteKey{Hostname: "new.example.com"}, Service: "http://app"}}
+
+	api := &stubDNSAPI{zones: []cloudflare.Zone{{ID: "zone-example-com", Name: "example.com"}}, recordsByQuery: records}
+	engine := NewEngine(api, testLogger(), Options{Manage: true, TunnelID: "tunnel-id", TunnelSuffix: "cfargotunnel.com", ManagedBy: testManagedBy, Tracked: tracked, Concurrency: 1})
+	if _, err := engine.Reconcile(context.Background(), routes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(api.deleteCalls) != 0 {
+		t.Fatalf("expected no deletes with SYNC_DELETE_DNS disabled, got %+v", api.deleteCalls)
+	}
+	if hostnames := tracked.DNSHostnames(); len(hostnames) != 1 || hostnames[0] != "new.example.com" {
+		t.Fatalf("expected removed hostnames to be forgotten once reported and the new one tracked, got %+v", hostnames)
+	}
+
+	tracked.AddDNSHostnames([]string{"old.example.com"})
+	api = &stubDNSAPI{zones: []cloudflare.Zone{{ID: "zone-example-com", Name: "example.com"}}, recordsByQuery: records}
+	engine = NewEngine(api, testLogger(), Options{Manage: true, Delete: true, TunnelID: "tunnel-id", TunnelSuffix: "cfargotunnel.com", ManagedBy: testManagedBy, Tracked: tracked, Concurrency: 1})
+	if _, err := engine.Reconcile(context.Background(), routes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(api.deleteCalls) != 2 || api.deleteCalls[0].recordID != "renamed" || api.deleteCalls[1].recordID != "untracked" {
+		t.Fatalf("expected the removed hostname and the managed orphan to be deleted, got %+v", api.deleteCalls)
+	}
+	if tracked.HasDNSHostname("old.example.com") {
+		t.Fatalf("expected deleted hostname to be forgotten")
+	}
+}
+
 func TestReconcileDeleteScansConfiguredZonesWithoutRoutes(t *testing.T) {
 	managedComment := model.DNSManagedComment(testManagedBy)
 	api := &stubDNSAPI{
@@ -173,9 +521,9 @@ func TestReconcileDeleteScansConfiguredZonesWithoutRoutes(t *testing.T) {
 			},
 		},
 	}
-	engine := NewEngine(api, testLogger(), false, true, true, []string{"darkdragon.fr"}, "tunnel-id", testManagedBy)
+	engine := NewEngine(api, testLogger(), Options{Manage: true, Delete: true, ConfiguredZones: []string{"darkdragon.fr"}, TunnelID: "tunnel-id", TunnelSuffix: "cfargotunnel.com", ManagedBy: testManagedBy, Concurrency: 1})
 
-	err := engine.Reconcile(context.Background(), nil)
+	result, err := engine.Reconcile(context.Background(), nil)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -185,15 +533,71 @@ func TestReconcileDeleteScansConfiguredZonesWithoutRoutes(t *testing.T) {
 	if len(api.deleteCalls) != 1 {
 		t.Fatalf("expected configured cleanup zone to delete orphan record, got %d", len(api.deleteCalls))
 	}
+	if result.Count(model.ResourceDNSRecord, model.ActionDeleted) != 1 || len(result.Changes) != 1 {
+		t.Fatalf("expected one deleted DNS record in the result, got %+v", result.Changes)
+	}
 	assertZoneQueried(t, api.listDNSRecordsCalls, "zone-darkdragon-fr")
 	assertZoneNotQueriedForName(t, api.listDNSRecordsCalls, "zone-darkdragon-fr", "test-cf.darkdragon.fr")
 }
 
+func TestReconcileDeletesOrphansBeyondOneListPage(t *testing.T) {
+	const total = 250
+	comment := model.DNSManagedComment(testManagedBy)
+	records := make([]cloudflare.DNSRecord, 0, total)
+	for index := range total {
+		records = append(records, cloudflare.DNSRecord{ID: fmt.Sprintf("record-%d", index), Type: "CNAME", Name: fmt.Sprintf("app-%d.example.com", index), Content: "tunnel-id.cfargotunnel.com", Proxied: true, TTL: 1, Comment: comment})
+	}
+	api := &stubDNSAPI{zones: []cloudflare.Zone{{ID: "zone-example-com", Name: "example.com"}}, recordsByQuery: map[string][]cloudflare.DNSRecord{"zone-example-com|": records}}
+	engine := NewEngine(api, testLogger(), Options{Manage: true, Delete: true, TunnelID: "tunnel-id", TunnelSuffix: "cfargotunnel.com", ManagedBy: testManagedBy, Concurrency: 1})
+
+	routes := []model.RouteSpec{{Key: model.RouteKey{Hostname: "app-0.example.com"}, Service: "http://app"}}
+	if _, err := engine.Reconcile(context.Background(), routes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(api.deleteCalls) != total-1 {
+		t.Fatalf("expected every orphaned record to be deleted, got %d deletes", len(api.deleteCalls))
+	}
+	if api.deleteCalls[len(api.deleteCalls)-1].recordID != fmt.Sprintf("record-%d", total-1) {
+		t.Fatalf("expected records past the first page to be deleted, got %+v", api.deleteCalls[len(api.deleteCalls)-1])
+	}
+	if api.updateCalls != 0 || api.createCalls != 0 {
+		t.Fatalf("expected the kept record to be left alone, got %d updates and %d creates", api.updateCalls, api.createCalls)
+	}
+}
+
+func TestReconcileHoldsBackMassDeletionsUntilConfirmed(t *testing.T) {
+	managedComment := model.DNSManagedComment(testManagedBy)
+	api := &stubDNSAPI{
+		zones: []cloudflare.Zone{{ID: "zone-darkdragon-fr", Name: "darkdragon.fr"}},
+		recordsByQuery: map[string][]cloudflare.DNSRecord{
+			"zone-darkdragon-fr|": {
+				{ID: "orphan-1", Name: "a.darkdragon.fr", Type: dnsRecordType, Comment: managedComment},
+				{ID: "orphan-2", Name: "b.darkdragon.fr", Type: dnsRecordType, Comment: managedComment},
+			},
+		},
+	}
+	engine := NewEngine(api, testLogger(), Options{Manage: true, Delete: true, ConfiguredZones: []string{"darkdragon.fr"}, TunnelID: "tunnel-id", TunnelSuffix: "cfargotunnel.com", ManagedBy: testManagedBy, Concurrency: 1, Removals: model.NewRemovalGuard(1, false)})
+
+	if _, err := engine.Reconcile(context.Background(), nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(api.deleteCalls) != 0 {
+		t.Fatalf("expected deletions beyond the limit to be held back, got %d", len(api.deleteCalls))
+	}
+
+	if _, err := engine.Reconcile(context.Background(), nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(api.deleteCalls) != 2 {
+		t.Fatalf("expected the same deletions to proceed on the next sync, got %d", len(api.deleteCalls))
+	}
+}
+
 func TestReconcileConfiguredZonesIgnoredWhenDeleteDisabled(t *testing.T) {
 	api := &stubDNSAPI{}
-	engine := NewEngine(api, testLogger(), false, true, false, []string{"darkdragon.fr"}, "tunnel-id", testManagedBy)
+	engine := NewEngine(api, testLogger(), Options{Manage: true, ConfiguredZones: []string{"darkdragon.fr"}, TunnelID: "tunnel-id", TunnelSuffix: "cfargotunnel.com", ManagedBy: testManagedBy, Concurrency: 1})
 
-	err := engine.Reconcile(context.Background(), nil)
+	_, err := engine.Reconcile(context.Background(), nil)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -224,9 +628,9 @@ func TestReconcileDeleteIncludesConfiguredCleanupZones(t *testing.T) {
 			},
 		},
 	}
-	engine := NewEngine(api, testLogger(), false, true, true, []string{"darkdragon.fr"}, "tunnel-id", testManagedBy)
+	engine := NewEngine(api, testLogger(), Options{Manage: true, Delete: true, ConfiguredZones: []string{"darkdragon.fr"}, TunnelID: "tunnel-id", TunnelSuffix: "cfargotunnel.com", ManagedBy: testManagedBy, Concurrency: 1})
 
-	err := engine.Reconcile(context.Background(), []model.RouteSpec{{Key: model.RouteKey{Hostname: "app.example.com"}, Service: "http://app"}})
+	_, err := engine.Reconcile(context.Background(), []model.RouteSpec{{Key: model.RouteKey{Hostname: "app.example.com"}, Service: "http://app"}})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -237,6 +641,58 @@ func TestReconcileDeleteIncludesConfiguredCleanupZones(t *testing.T) {
 	}
 }
 
+func TestReconcileSyncsZonesConcurrently(t *testing.T) {
+	zones := []cloudflare.Zone{}
+	routes := []model.RouteSpec{}
+	for _, name := range []string{"a.com", "b.com", "c.com", "d.com", "e.com"} {
+		zones = append(zones, cloudflare.Zone{ID: "zone-" + name, Name: name})
+		routes = append(routes, model.RouteSpec{Key: model.RouteKey{Hostname: "app." + name}, Service: "http://app"})
+	}
+	api := &stubDNSAPI{zones: zones, listErrors: map[string]error{"zone-c.com": errors.New("boom")}}
+	engine := NewEngine(api, testLogger(), Options{Manage: true, TunnelID: "tunnel-id", TunnelSuffix: "cfargotunnel.com", ManagedBy: testManagedBy, Concurrency: 3})
+
+	_, err := engine.Reconcile(context.Background(), routes)
+	if err == nil || !strings.Contains(err.Error(), "1 failure(s)") || !strings.Contains(err.Error(), "list DNS records in zone c.com") {
+		t.Fatalf("expected the failing zone to be reported, got %v", err)
+	}
+	if api.createCalls != 4 {
+		t.Fatalf("expected records in the other zones to be created, got %d creates", api.createCalls)
+	}
+}
+
+func TestReconcileListsZoneRecordsOnce(t *testing.T) {
+	managedComment := model.DNSManagedComment(testManagedBy)
+	api := &stubDNSAPI{
+		zones: []cloudflare.Zone{{ID: "zone-example-com", Name: "example.com"}},
+		recordsByQuery: map[string][]cloudflare.DNSRecord{
+			"zone-example-com|": {
+				{ID: "managed", Name: "app.example.com", Type: dnsRecordType, Content: "old.cfargotunnel.com", Proxied: true, Comment: managedComment},
+				{ID: "dup-1", Name: "dup.example.com", Type: dnsRecordType, Comment: managedComment},
+				{ID: "dup-2", Name: "dup.example.com", Type: dnsRecordType, Comment: managedComment},
+			},
+		},
+	}
+	engine := NewEngine(api, testLogger(), Options{Manage: true, TunnelID: "tunnel-id", TunnelSuffix: "cfargotunnel.com", ManagedBy: testManagedBy, Concurrency: 1})
+
+	_, err := engine.Reconcile(context.Background(), []model.RouteSpec{
+		{Key: model.RouteKey{Hostname: "app.example.com"}, Service: "http://app"},
+		{Key: model.RouteKey{Hostname: "dup.example.com"}, Service: "http://dup"},
+		{Key: model.RouteKey{Hostname: "new.example.com"}, Service: "http://new"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(api.listDNSRecordsCalls) != 1 {
+		t.Fatalf("expected a single zone-wide DNS listing, got %+v", api.listDNSRecordsCalls)
+	}
+	if api.updateCalls != 1 {
+		t.Fatalf("expected the stale managed record to be updated, got %d updates", api.updateCalls)
+	}
+	if api.createCalls != 1 {
+		t.Fatalf("expected the missing record to be created and duplicates skipped, got %d creates", api.createCalls)
+	}
+}
+
 func testLogger() *slog.Logger {
 	return slog.New(slog.NewTextHandler(io.Discard, nil))
 }
@@ -256,7 +712,13 @@ type stubDNSAPI struct {
 	recordsByQuery      map[string][]cloudflare.DNSRecord
 	listZonesCalls      int
 	listDNSRecordsCalls []dnsListCall
+	createCalls         int
+	updateCalls         int
 	deleteCalls         []dnsDeleteCall
+	listErrors          map[string]error
+	lastInput           cloudflare.DNSRecordInput
+	// mu guards the fields above when zones are synced concurrently.
+	mu sync.Mutex
 }
 
 func (api *stubDNSAPI) ListZones(ctx context.Context) ([]cloudflare.Zone, error) {
@@ -265,7 +727,12 @@ func (api *stubDNSAPI) ListZones(ctx context.Context) ([]cloudflare.Zone, error)
 }
 
 func (api *stubDNSAPI) ListDNSRecords(ctx context.Context, zoneID string, recordType string, name string) ([]cloudflare.DNSRecord, error) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
 	api.listDNSRecordsCalls = append(api.listDNSRecordsCalls, dnsListCall{zoneID: zoneID, name: name})
+	if err := api.listErrors[zoneID]; err != nil {
+		return nil, err
+	}
 	if api.recordsByQuery == nil {
 		return nil, nil
 	}
@@ -273,14 +740,24 @@ func (api *stubDNSAPI) ListDNSRecords(ctx context.Context, zoneID string, record
 }
 
 func (api *stubDNSAPI) CreateDNSRecord(ctx context.Context, zoneID string, input cloudflare.DNSRecordInput) (cloudflare.DNSRecord, error) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	api.createCalls++
+	api.lastInput = input
 	return cloudflare.DNSRecord{}, nil
 }
 
 func (api *stubDNSAPI) UpdateDNSRecord(ctx context.Context, zoneID string, recordID string, input cloudflare.DNSRecordInput) (cloudflare.DNSRecord, error) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	api.updateCalls++
+	api.lastInput = input
 	return cloudflare.DNSRecord{}, nil
 }
 
 func (api *stubDNSAPI) DeleteDNSRecord(ctx context.Context, zoneID string, recordID string) error {
+	api.mu.Lock()
+	defer api.mu.Unlock()
 	api.deleteCalls = append(api.deleteCalls, dnsDeleteCall{zoneID: zoneID, recordID: recordID})
 	return nil
 }
@@ -2,10 +2,15 @@ package docker
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
 	"strings"
 
+	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/tlsconfig"
 
 	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/config"
 )
@@ -13,11 +18,17 @@ import (
 // Adapter provides read-only access to the Docker API.
 type Adapter struct {
 	client *client.Client
+	swarm  bool
 }
 
 // NewAdapter creates a Docker adapter configured from environment variables.
 func NewAdapter(cfg config.DockerConfig) (*Adapter, error) {
-	opts := []client.Opt{client.FromEnv, client.WithAPIVersionNegotiation()}
+	opts := []client.Opt{client.WithAPIVersionNegotiation()}
+	// The TLS transport has to be in place before WithHost configures it for
+	// the daemon address.
+	if cfg.CertPath != "" {
+		opts = append(opts, withTLSClientConfig(cfg))
+	}
 	if cfg.Host != "" {
 		opts = append(opts, client.WithHost(cfg.Host))
 	}
@@ -30,11 +41,36 @@ func NewAdapter(cfg config.DockerConfig) (*Adapter, error) {
 		return nil, err
 	}
 
-	return &Adapter{client: dockerClient}, nil
+	return &Adapter{client: dockerClient, swarm: cfg.Mode == config.DockerModeSwarm}, nil
+}
+
+// withTLSClientConfig mirrors the Docker CLI: certificates come from
+// DOCKER_CERT_PATH and the daemon certificate is only verified when
+// DOCKER_TLS_VERIFY is set.
+func withTLSClientConfig(cfg config.DockerConfig) client.Opt {
+	return func(dockerClient *client.Client) error {
+		tlsConfig, err := tlsconfig.Client(tlsconfig.Options{
+			CAFile:             filepath.Join(cfg.CertPath, "ca.pem"),
+			CertFile:           filepath.Join(cfg.CertPath, "cert.pem"),
+			KeyFile:            filepath.Join(cfg.CertPath, "key.pem"),
+			InsecureSkipVerify: !cfg.TLSVerify,
+		})
+		if err != nil {
+			return fmt.Errorf("load Docker TLS certificates from %s: %w", cfg.CertPath, err)
+		}
+		return client.WithHTTPClient(&http.Client{
+			Transport:     &http.Transport{TLSClientConfig: tlsConfig},
+			CheckRedirect: client.CheckRedirect,
+		})(dockerClient)
+	}
 }
 
-// ListRunningContainers returns all running containers with their labels.
+// ListRunningContainers returns all running containers with their labels. In
+// Swarm mode it returns the services instead, see listServices.
 func (adapter *Adapter) ListRunningContainers(ctx context.Context) ([]ContainerInfo, error) {
+	if adapter.swarm {
+		return adapter.listServices(ctx)
+	}
 	containers, err := adapter.client.ContainerList(ctx, container.ListOptions{All: false})
 	if err != nil {
 		return nil, err
@@ -55,3 +91,28 @@ func (adapter *Adapter) ListRunningContainers(ctx context.Context) ([]ContainerI
 
 	return results, nil
 }
+
+// listServices returns the Swarm services with their service labels, keyed by
+// service ID and named after the service. Replicated services scaled to zero
+// are skipped like stopped containers. It requires a manager node.
+func (adapter *Adapter) listServices(ctx context.Context) ([]ContainerInfo, error) {
+	services, err := adapter.client.ServiceList(ctx, types.ServiceListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ContainerInfo, 0, len(services))
+	for _, service := range services {
+		replicated := service.Spec.Mode.Replicated
+		if replicated != nil && replicated.Replicas != nil && *replicated.Replicas == 0 {
+			continue
+		}
+		results = append(results, ContainerInfo{
+			ID:     service.ID,
+			Name:   service.Spec.Name,
+			Labels: service.Spec.Labels,
+		})
+	}
+
+	return results, nil
+}
@@ -0,0 +1,140 @@
+package kubernetes
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/config"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/docker"
+)
+
+// serviceAccountDir holds the token and CA certificate Kubernetes mounts in
+// every pod.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// listPageSize is the number of services requested per page.
+const listPageSize = 500
+
+// Adapter provides read-only access to Kubernetes services through the API
+// server, authenticated with the pod's service account.
+type Adapter struct {
+	baseURL    *url.URL
+	namespace  string
+	tokenPath  string
+	httpClient *http.Client
+}
+
+// NewAdapter creates a Kubernetes adapter for the API server of the cluster
+// the controller runs in.
+func NewAdapter(cfg config.KubernetesConfig) (*Adapter, error) {
+	caPath := filepath.Join(serviceAccountDir, "ca.crt")
+	caPEM, err := os.ReadFile(caPath)
+	if err != nil {
+		return nil, fmt.Errorf("read Kubernetes CA certificate: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("invalid Kubernetes CA certificate %s", caPath)
+	}
+	return &Adapter{
+		baseURL:   &url.URL{Scheme: "https", Host: cfg.APIServer},
+		namespace: cfg.Namespace,
+		tokenPath: filepath.Join(serviceAccountDir, "token"),
+		httpClient: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+	}, nil
+}
+
+type serviceList struct {
+	Metadata struct {
+		Continue string `json:"continue"`
+	} `json:"metadata"`
+	Items []struct {
+		Metadata struct {
+			UID         string            `json:"uid"`
+			Name        string            `json:"name"`
+			Namespace   string            `json:"namespace"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+	} `json:"items"`
+}
+
+// ListRunningContainers returns the services with their annotations as labels,
+// keyed by service UID and named namespace/name, so the parser reads the
+// cloudflare.tunnel.* annotations like container labels. Services are used
+// rather than pods because every replica of a pod carries the same
+// annotations and would define the same routes again.
+func (adapter *Adapter) ListRunningContainers(ctx context.Context) ([]docker.ContainerInfo, error) {
+	endpoint := *adapter.baseURL
+	endpoint.Path = "/api/v1/services"
+	if adapter.namespace != "" {
+		endpoint.Path = "/api/v1/namespaces/" + url.PathEscape(adapter.namespace) + "/services"
+	}
+
+	results := []docker.ContainerInfo{}
+	next := ""
+	for {
+		query := url.Values{}
+		query.Set("limit", strconv.Itoa(listPageSize))
+		if next != "" {
+			query.Set("continue", next)
+		}
+		endpoint.RawQuery = query.Encode()
+
+		var page serviceList
+		if err := adapter.get(ctx, endpoint.String(), &page); err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			results = append(results, docker.ContainerInfo{
+				ID:     item.Metadata.UID,
+				Name:   item.Metadata.Namespace + "/" + item.Metadata.Name,
+				Labels: item.Metadata.Annotations,
+			})
+		}
+		if page.Metadata.Continue == "" {
+			return results, nil
+		}
+		next = page.Metadata.Continue
+	}
+}
+
+// get reads the token on every request, since Kubernetes rotates projected
+// service account tokens.
+func (adapter *Adapter) get(ctx context.Context, endpoint string, target any) error {
+	token, err := os.ReadFile(adapter.tokenPath)
+	if err != nil {
+		return fmt.Errorf("read Kubernetes service account token: %w", err)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	request.Header.Set("Accept", "application/json")
+
+	response, err := adapter.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("list Kubernetes services: %s", response.Status)
+	}
+	if err := json.NewDecoder(response.Body).Decode(target); err != nil {
+		return fmt.Errorf("decode Kubernetes services: %w", err)
+	}
+	return nil
+}
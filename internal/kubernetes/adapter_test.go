@@ -0,0 +1,72 @@
+package kubernetes
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListRunningContainersReadsServiceAnnotations(t *testing.T) {
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenPath, []byte("secret-token\n"), 0o600); err != nil {
+		t.Fatalf("write token: %v", err)
+	}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path != "/api/v1/namespaces/apps/services" {
+			t.Errorf("unexpected path %s", request.URL.Path)
+		}
+		if got := request.Header.Get("Authorization"); got != "Bearer secret-token" {
+			t.Errorf("unexpected authorization header %q", got)
+		}
+		if request.URL.Query().Get("continue") == "" {
+			writer.Write([]byte(`{"metadata": {"continue": "page-2"}, "items": [{"metadata": {"uid": "uid-1", "name": "web", "namespace": "apps", "annotations": {"cloudflare.tunnel.enable": "true"}}}]}`))
+			return
+		}
+		writer.Write([]byte(`{"metadata": {}, "items": [{"metadata": {"uid": "uid-2", "name": "db", "namespace": "apps"}}]}`))
+	}))
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("parse server URL: %v", err)
+	}
+	adapter := &Adapter{baseURL: serverURL, namespace: "apps", tokenPath: tokenPath, httpClient: server.Client()}
+
+	containers, err := adapter.ListRunningContainers(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(containers) != 2 {
+		t.Fatalf("expected services from both pages, got %+v", containers)
+	}
+	if containers[0].ID != "uid-1" || containers[0].Name != "apps/web" || containers[0].Labels["cloudflare.tunnel.enable"] != "true" {
+		t.Fatalf("unexpected first service: %+v", containers[0])
+	}
+	if containers[1].ID != "uid-2" || containers[1].Name != "apps/db" {
+		t.Fatalf("unexpected second service: %+v", containers[1])
+	}
+}
+
+func TestListRunningContainersReportsAPIErrors(t *testing.T) {
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenPath, []byte("token"), 0o600); err != nil {
+		t.Fatalf("write token: %v", err)
+	}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		http.Error(writer, "forbidden", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("parse server URL: %v", err)
+	}
+	adapter := &Adapter{baseURL: serverURL, tokenPath: tokenPath, httpClient: server.Client()}
+	if _, err := adapter.ListRunningContainers(context.Background()); err == nil {
+		t.Fatalf("expected an error for a forbidden request")
+	}
+}
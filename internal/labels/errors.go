@@ -0,0 +1,56 @@
+package labels
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Warning is a label problem the parser resolved on its own, such as a second
+// container claiming the fallback rule. It is returned among the parse errors
+// so callers can log it, but it is not a label error: it is left out of the
+// error report and of SYNC_STRICT_LABELS.
+type Warning struct {
+	Err error
+}
+
+func (warning *Warning) Error() string {
+	return warning.Err.Error()
+}
+
+func (warning *Warning) Unwrap() error {
+	return warning.Err
+}
+
+// SplitWarnings separates the warnings from the label errors in errs.
+func SplitWarnings(errs []error) ([]error, []error) {
+	labelErrors := []error{}
+	warnings := []error{}
+	for _, err := range errs {
+		var warning *Warning
+		if errors.As(err, &warning) {
+			warnings = append(warnings, err)
+			continue
+		}
+		labelErrors = append(labelErrors, err)
+	}
+	return labelErrors, warnings
+}
+
+// ContainerError is a label error of one container. Error reports use
+// Container to group errors, rather than parsing the message.
+type ContainerError struct {
+	Container string
+	Err       error
+}
+
+func containerErrorf(container string, format string, args ...any) error {
+	return &ContainerError{Container: container, Err: fmt.Errorf(format, args...)}
+}
+
+func (containerErr *ContainerError) Error() string {
+	return "container " + containerErr.Container + ": " + containerErr.Err.Error()
+}
+
+func (containerErr *ContainerError) Unwrap() error {
+	return containerErr.Err
+}
@@ -1,7 +1,13 @@
 package labels
 
 import (
+	"encoding/json"
 	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -14,33 +20,126 @@ const (
 	LabelPrefix            = "cloudflare.tunnel."
 	LabelEnable            = LabelPrefix + "enable"
 	LabelHost              = LabelPrefix + "hostname"
+	LabelHosts             = LabelPrefix + "hostnames"
 	LabelDNSZone           = LabelPrefix + "dns.zone"
+	LabelDNSProxied        = LabelPrefix + "dns.proxied"
+	LabelDNSComment        = LabelPrefix + "dns.comment"
 	LabelPath              = LabelPrefix + "path"
 	LabelService           = LabelPrefix + "service"
 	LabelOriginServerName  = LabelPrefix + "origin.server-name"
 	LabelOriginNoTLSVerify = LabelPrefix + "origin.no-tls-verify"
+	LabelOriginCAPool      = LabelPrefix + "origin.ca-pool"
+	LabelOriginRaw         = LabelPrefix + "origin.raw"
+	LabelOriginProxyType   = LabelPrefix + "origin.proxy-type"
+	LabelOriginProxyAddr   = LabelPrefix + "origin.proxy-address"
+	LabelOriginProxyPort   = LabelPrefix + "origin.proxy-port"
+	LabelOriginBastionMode = LabelPrefix + "origin.bastion-mode"
+	LabelOriginInherit     = LabelPrefix + "origin.inherit"
+	LabelAccessEmails      = LabelPrefix + "access.emails"
+	LabelFallback          = LabelPrefix + "fallback"
+	LabelTunnelName        = LabelPrefix + "name"
 
-	AccessLabelPrefix       = "cloudflare.access."
-	AccessLabelEnable       = AccessLabelPrefix + "enable"
-	AccessLabelAppName      = AccessLabelPrefix + "app.name"
-	AccessLabelAppDomain    = AccessLabelPrefix + "app.domain"
-	AccessLabelAppID        = AccessLabelPrefix + "app.id"
-	AccessLabelAppTags      = AccessLabelPrefix + "app.tags"
-	AccessLabelPolicyPrefix = AccessLabelPrefix + "policy."
+	AccessLabelPrefix      = "cloudflare.access."
+	AccessLabelEnable      = AccessLabelPrefix + "enable"
+	AccessLabelAppName     = AccessLabelPrefix + "app.name"
+	AccessLabelAppDomain   = AccessLabelPrefix + "app.domain"
+	AccessLabelAppPath     = AccessLabelPrefix + "app.path"
+	AccessLabelAppID       = AccessLabelPrefix + "app.id"
+	AccessLabelAppTags     = AccessLabelPrefix + "app.tags"
+	AccessLabelAppLauncher = AccessLabelPrefix + "app.launcher-visible"
+	AccessLabelAppType     = AccessLabelPrefix + "app.type"
+	AccessLabelAppURL      = AccessLabelPrefix + "app.url"
+	AccessLabelAppLogoURL  = AccessLabelPrefix + "app.logo-url"
+	AccessLabelAppIdPs     = AccessLabelPrefix + "app.allowed-idps"
+	AccessLabelAppDenyMsg  = AccessLabelPrefix + "app.deny-message"
+	AccessLabelAppDenyURL  = AccessLabelPrefix + "app.deny-url"
+	// Aliases matching the Cloudflare field names.
+	AccessLabelAppCustomDenyMsg = AccessLabelPrefix + "app.custom-deny-message"
+	AccessLabelAppCustomDenyURL = AccessLabelPrefix + "app.custom-deny-url"
+	AccessLabelAppRedirect      = AccessLabelPrefix + "app.auto-redirect"
+	AccessLabelAppMerge         = AccessLabelPrefix + "app.merge"
+
+	AccessLabelAppSkipInterstitial = AccessLabelPrefix + "app.skip-interstitial"
+	AccessLabelAppIsolation        = AccessLabelPrefix + "app.isolation-required"
+	AccessLabelAppSkipLauncher     = AccessLabelPrefix + "app.skip-app-launcher-login"
+	AccessLabelAppHTTPOnlyCookie   = AccessLabelPrefix + "app.http-only-cookie"
+	AccessLabelAppSameSiteCookie   = AccessLabelPrefix + "app.same-site-cookie"
+	AccessLabelAppCustomPages      = AccessLabelPrefix + "app.custom-pages"
+
+	AccessLabelAppCORSOrigins     = AccessLabelPrefix + "app.cors.allowed-origins"
+	AccessLabelAppCORSMethods     = AccessLabelPrefix + "app.cors.allowed-methods"
+	AccessLabelAppCORSHeaders     = AccessLabelPrefix + "app.cors.allowed-headers"
+	AccessLabelAppCORSCredentials = AccessLabelPrefix + "app.cors.allow-credentials"
+	AccessLabelAppCORSMaxAge      = AccessLabelPrefix + "app.cors.max-age"
+	AccessLabelPolicyPrefix       = AccessLabelPrefix + "policy."
 )
 
+var emailDomainPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]*[a-z0-9])?\.)+[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// countryCodes holds the ISO 3166-1 alpha-2 codes accepted by Access geo rules.
+var countryCodes = func() map[string]struct{} {
+	codes := map[string]struct{}{}
+	for _, code := range strings.Fields(
+		"AD AE AF AG AI AL AM AO AQ AR AS AT AU AW AX AZ BA BB BD BE " +
+			"BF BG BH BI BJ BL BM BN BO BQ BR BS BT BV BW BY BZ CA CC CD " +
+			"CF CG CH CI CK CL CM CN CO CR CU CV CW CX CY CZ DE DJ DK DM " +
+			"DO DZ EC EE EG EH ER ES ET FI FJ FK FM FO FR GA GB GD GE GF " +
+			"GG GH GI GL GM GN GP GQ GR GS GT GU GW GY HK HM HN HR HT HU " +
+			"ID IE IL IM IN IO IQ IR IS IT JE JM JO JP KE KG KH KI KM KN " +
+			"KP KR KW KY KZ LA LB LC LI LK LR LS LT LU LV LY MA MC MD ME " +
+			"MF MG MH MK ML MM MN MO MP MQ MR MS MT MU MV MW MX MY MZ NA " +
+			"NC NE NF NG NI NL NO NP NR NU NZ OM PA PE PF PG PH PK PL PM " +
+			"PN PR PS PT PW PY QA RE RO RS RU RW SA SB SC SD SE SG SH SI " +
+			"SJ SK SL SM SN SO SR SS ST SV SX SY SZ TC TD TF TG TH TJ TK " +
+			"TL TM TN TO TR TT TV TW TZ UA UG UM US UY UZ VA VC VE VG VI " +
+			"VN VU WF WS YE YT ZA ZM ZW") {
+		codes[code] = struct{}{}
+	}
+	return codes
+}()
+
+// authMethods holds the RFC 8176 authentication method references accepted by
+// Access auth_method rules.
+var authMethods = map[string]struct{}{
+	"face": {}, "fpt": {}, "geo": {}, "hwk": {}, "iris": {}, "kba": {}, "mca": {},
+	"mfa": {}, "otp": {}, "pin": {}, "pop": {}, "pwd": {}, "rba": {}, "retina": {},
+	"sc": {}, "sms": {}, "swk": {}, "tel": {}, "user": {}, "vbm": {}, "wia": {},
+}
+
 // Parser converts Docker labels into desired Cloudflare ingress rules.
-type Parser struct{}
+type Parser struct {
+	sharedPolicies map[string]model.AccessPolicySpec
+	// tunnels holds the CF_TUNNEL_IDS names cloudflare.tunnel.name may refer to.
+	tunnels map[string]struct{}
+}
 
 func NewParser() *Parser {
 	return &Parser{}
 }
 
-// ParseContainers returns desired tunnel ingress rules and any validation errors.
+// NewParserWithSharedPolicies returns a parser that resolves name-only Access
+// policy references against account-level policy definitions, and accepts the
+// given tunnel names in cloudflare.tunnel.name labels.
+func NewParserWithSharedPolicies(policies []model.AccessPolicySpec, tunnels []string) *Parser {
+	shared := make(map[string]model.AccessPolicySpec, len(policies))
+	for _, policy := range policies {
+		shared[strings.ToLower(policy.Name)] = policy
+	}
+	names := make(map[string]struct{}, len(tunnels))
+	for _, name := range tunnels {
+		names[name] = struct{}{}
+	}
+	return &Parser{sharedPolicies: shared, tunnels: names}
+}
+
+// ParseContainers returns desired tunnel ingress rules and any validation
+// errors, among them Warnings for problems it resolved itself.
 func (parser *Parser) ParseContainers(containers []docker.ContainerInfo) ([]model.RouteSpec, []error) {
 	errors := []error{}
 	desired := []model.RouteSpec{}
 	desiredKeys := map[model.RouteKey]struct{}{}
+	// The fallback is the catch-all of one tunnel, so each tunnel has its own.
+	fallbackOwners := map[string]string{}
 
 	sorted := make([]docker.ContainerInfo, len(containers))
 	copy(sorted, containers)
@@ -56,52 +155,111 @@ func (parser *Parser) ParseContainers(containers []docker.ContainerInfo) ([]mode
 		flag, err := strconv.ParseBool(enabled)
 		if err != nil || !flag {
 			if err != nil {
-				errors = append(errors, fmt.Errorf("container %s: invalid %s label: %w", container.Name, LabelEnable, err))
+				errors = append(errors, containerErrorf(container.Name, "invalid %s label: %w", LabelEnable, err))
 			}
 			continue
 		}
 
-		hostname := strings.TrimSpace(container.Labels[LabelHost])
+		hostnames := baseHostnames(container.Labels[LabelHost], container.Labels[LabelHosts])
 		service := strings.TrimSpace(container.Labels[LabelService])
 		path := strings.TrimSpace(container.Labels[LabelPath])
 
-		if hostname == "" {
-			errors = append(errors, fmt.Errorf("container %s: missing required %s label", container.Name, LabelHost))
+		tunnel, err := parser.parseTunnelLabel(container.Name, container.Labels, LabelTunnelName, "")
+		if err != nil {
+			errors = append(errors, err)
+			continue
+		}
+
+		fallback, err := parseFallbackLabel(container.Name, container.Labels)
+		if err != nil {
+			errors = append(errors, err)
+			continue
+		}
+		if fallback {
+			route, ok, fallbackErrors := parseFallbackRoute(container, service, hostnames, path)
+			errors = append(errors, fallbackErrors...)
+			if ok {
+				route.Tunnel = tunnel
+				if owner, taken := fallbackOwners[tunnel]; taken {
+					errors = append(errors, &Warning{Err: containerErrorf(container.Name, "%s is also set on container %s; keeping %s as fallback", LabelFallback, owner, owner)})
+				} else {
+					fallbackOwners[tunnel] = container.Name
+					desired = append(desired, route)
+				}
+			}
+			continue
+		}
+
+		if len(hostnames) == 0 {
+			errors = append(errors, containerErrorf(container.Name, "missing required %s label", LabelHost))
 			continue
 		}
 		if service == "" {
-			errors = append(errors, fmt.Errorf("container %s: missing required %s label", container.Name, LabelService))
+			errors = append(errors, containerErrorf(container.Name, "missing required %s label", LabelService))
 			continue
 		}
 		if path != "" && !strings.HasPrefix(path, "/") {
-			errors = append(errors, fmt.Errorf("container %s: %s must start with '/'", container.Name, LabelPath))
+			errors = append(errors, containerErrorf(container.Name, "%s must start with '/'", LabelPath))
+			continue
+		}
+		if err := validateService(container.Name, LabelService, service); err != nil {
+			errors = append(errors, err)
 			continue
 		}
 
-		originServerName, originNoTLSVerify, err := parseOriginLabels(container.Name, container.Labels, LabelOriginServerName, LabelOriginNoTLSVerify)
+		origin, err := parseOriginLabels(container.Name, container.Labels, "")
 		if err != nil {
 			errors = append(errors, err)
 			continue
 		}
+		inheritOrigin := false
+		if inheritValue, hasInherit := container.Labels[LabelOriginInherit]; hasInherit {
+			inheritOrigin, err = strconv.ParseBool(strings.TrimSpace(inheritValue))
+			if err != nil {
+				errors = append(errors, containerErrorf(container.Name, "invalid %s label: %w", LabelOriginInherit, err))
+				continue
+			}
+		}
 
 		dnsZone, err := parseDNSZoneLabel(container.Name, container.Labels, LabelDNSZone)
 		if err != nil {
 			errors = append(errors, err)
 		}
+		dnsProxied, err := parseDNSProxiedLabel(container.Name, container.Labels, LabelDNSProxied)
+		if err != nil {
+			errors = append(errors, err)
+		}
+		dnsComment, err := parseDNSCommentLabel(container.Name, container.Labels, LabelDNSComment)
+		if err != nil {
+			errors = append(errors, err)
+		}
 
-		key := model.RouteKey{Hostname: hostname, Path: path}
+		// Every base hostname gets its own rule with the same service and
+		// origin settings.
 		source := model.SourceRef{ContainerID: container.ID, ContainerName: container.Name}
-		if err := appendRouteSpec(&desired, desiredKeys, model.RouteSpec{
-			Key:              key,
-			Service:          service,
-			DNSZoneOverride:  dnsZone,
-			OriginServerName: originServerName,
-			NoTLSVerify:      originNoTLSVerify,
-			Source:           source,
-		}); err != nil {
-			errors = append(errors, err)
+		for _, hostname := range hostnames {
+			if err := appendRouteSpec(&desired, desiredKeys, model.RouteSpec{
+				Key:              model.RouteKey{Hostname: hostname, Path: path},
+				Service:          service,
+				DNSZoneOverride:  dnsZone,
+				DNSProxied:       dnsProxied,
+				DNSComment:       dnsComment,
+				OriginServerName: origin.serverName,
+				NoTLSVerify:      origin.noTLSVerify,
+				CAPool:           origin.caPool,
+				ProxyType:        origin.proxyType,
+				ProxyAddress:     origin.proxyAddress,
+				ProxyPort:        origin.proxyPort,
+				BastionMode:      origin.bastionMode,
+				OriginRaw:        origin.raw,
+				Tunnel:           tunnel,
+				Source:           source,
+			}); err != nil {
+				errors = append(errors, err)
+			}
 		}
 
+		baseOrigin := origin
 		hostSuffixes := collectSuffixes(container.Labels, LabelHost)
 		serviceSuffixes := collectSuffixes(container.Labels, LabelService)
 
@@ -110,7 +268,7 @@ func (parser *Parser) ParseContainers(containers []docker.ContainerInfo) ([]mode
 			if _, ok := serviceSuffixes[suffix]; ok {
 				continue
 			}
-			errors = append(errors, fmt.Errorf("container %s: %s.%s is set without matching %s.%s; skipping", container.Name, LabelHost, suffix, LabelService, suffix))
+			errors = append(errors, containerErrorf(container.Name, "%s.%s is set without matching %s.%s; skipping", LabelHost, suffix, LabelService, suffix))
 		}
 
 		serviceSuffixList := sortedSuffixes(serviceSuffixes)
@@ -118,7 +276,7 @@ func (parser *Parser) ParseContainers(containers []docker.ContainerInfo) ([]mode
 			if _, ok := hostSuffixes[suffix]; ok {
 				continue
 			}
-			errors = append(errors, fmt.Errorf("container %s: %s.%s is set without matching %s.%s; skipping", container.Name, LabelService, suffix, LabelHost, suffix))
+			errors = append(errors, containerErrorf(container.Name, "%s.%s is set without matching %s.%s; skipping", LabelService, suffix, LabelHost, suffix))
 		}
 
 		for _, suffix := range hostSuffixList {
@@ -129,44 +287,73 @@ func (parser *Parser) ParseContainers(containers []docker.ContainerInfo) ([]mode
 			hostnameKey := LabelHost + "." + suffix
 			serviceKey := LabelService + "." + suffix
 			pathKey := LabelPath + "." + suffix
-			originServerNameKey := LabelOriginServerName + "." + suffix
-			originNoTLSVerifyKey := LabelOriginNoTLSVerify + "." + suffix
 
-			hostname := strings.TrimSpace(container.Labels[hostnameKey])
+			hostname := strings.ToLower(strings.TrimSpace(container.Labels[hostnameKey]))
 			service := strings.TrimSpace(container.Labels[serviceKey])
 			path := strings.TrimSpace(container.Labels[pathKey])
 			if hostname == "" {
-				errors = append(errors, fmt.Errorf("container %s: %s cannot be empty; skipping", container.Name, hostnameKey))
+				errors = append(errors, containerErrorf(container.Name, "%s cannot be empty; skipping", hostnameKey))
 				continue
 			}
 			if service == "" {
-				errors = append(errors, fmt.Errorf("container %s: %s cannot be empty; skipping", container.Name, serviceKey))
+				errors = append(errors, containerErrorf(container.Name, "%s cannot be empty; skipping", serviceKey))
 				continue
 			}
 			if path != "" && !strings.HasPrefix(path, "/") {
-				errors = append(errors, fmt.Errorf("container %s: %s must start with '/'; skipping", container.Name, pathKey))
+				errors = append(errors, containerErrorf(container.Name, "%s must start with '/'; skipping", pathKey))
+				continue
+			}
+			if err := validateService(container.Name, serviceKey, service); err != nil {
+				errors = append(errors, fmt.Errorf("%w; skipping", err))
 				continue
 			}
 
-			originServerName, originNoTLSVerify, err := parseOriginLabels(container.Name, container.Labels, originServerNameKey, originNoTLSVerifyKey)
+			origin, err := parseOriginLabels(container.Name, container.Labels, suffix)
 			if err != nil {
 				errors = append(errors, fmt.Errorf("%w; skipping", err))
 				continue
 			}
+			if inheritOrigin {
+				origin = origin.inherit(baseOrigin)
+			}
 
 			dnsZoneKey := LabelDNSZone + "." + suffix
 			dnsZone, err := parseDNSZoneLabel(container.Name, container.Labels, dnsZoneKey)
 			if err != nil {
 				errors = append(errors, err)
 			}
+			dnsProxied, err := parseDNSProxiedLabel(container.Name, container.Labels, LabelDNSProxied+"."+suffix)
+			if err != nil {
+				errors = append(errors, err)
+			}
+			dnsComment, err := parseDNSCommentLabel(container.Name, container.Labels, LabelDNSComment+"."+suffix)
+			if err != nil {
+				errors = append(errors, err)
+			}
+			// A suffix route goes to the base route's tunnel unless it names
+			// its own.
+			suffixTunnel, err := parser.parseTunnelLabel(container.Name, container.Labels, LabelTunnelName+"."+suffix, tunnel)
+			if err != nil {
+				errors = append(errors, fmt.Errorf("%w; skipping", err))
+				continue
+			}
 
 			key := model.RouteKey{Hostname: hostname, Path: path}
 			if err := appendRouteSpec(&desired, desiredKeys, model.RouteSpec{
 				Key:              key,
 				Service:          service,
 				DNSZoneOverride:  dnsZone,
-				OriginServerName: originServerName,
-				NoTLSVerify:      originNoTLSVerify,
+				DNSProxied:       dnsProxied,
+				DNSComment:       dnsComment,
+				OriginServerName: origin.serverName,
+				NoTLSVerify:      origin.noTLSVerify,
+				CAPool:           origin.caPool,
+				ProxyType:        origin.proxyType,
+				ProxyAddress:     origin.proxyAddress,
+				ProxyPort:        origin.proxyPort,
+				BastionMode:      origin.bastionMode,
+				OriginRaw:        origin.raw,
+				Tunnel:           suffixTunnel,
 				Source:           source,
 			}); err != nil {
 				errors = append(errors, err)
@@ -177,6 +364,93 @@ func (parser *Parser) ParseContainers(containers []docker.ContainerInfo) ([]mode
 	return desired, errors
 }
 
+func parseFallbackLabel(containerName string, labels map[string]string) (bool, error) {
+	value, ok := labels[LabelFallback]
+	if !ok {
+		return false, nil
+	}
+	parsed, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		return false, containerErrorf(containerName, "invalid %s label: %w", LabelFallback, err)
+	}
+	return parsed, nil
+}
+
+// parseFallbackRoute builds the catch-all rule for a container that declares
+// itself the fallback. Hostnames and path do not apply to a catch-all rule.
+func parseFallbackRoute(container docker.ContainerInfo, service string, hostnames []string, path string) (model.RouteSpec, bool, []error) {
+	errors := []error{}
+	if service == "" {
+		errors = append(errors, containerErrorf(container.Name, "missing required %s label", LabelService))
+		return model.RouteSpec{}, false, errors
+	}
+	if err := validateService(container.Name, LabelService, service); err != nil {
+		errors = append(errors, err)
+		return model.RouteSpec{}, false, errors
+	}
+	if len(hostnames) > 0 || path != "" {
+		errors = append(errors, containerErrorf(container.Name, "%s and %s are ignored when %s=true", LabelHost, LabelPath, LabelFallback))
+	}
+
+	origin, err := parseOriginLabels(container.Name, container.Labels, "")
+	if err != nil {
+		errors = append(errors, err)
+		return model.RouteSpec{}, false, errors
+	}
+
+	return model.RouteSpec{
+		Service:          service,
+		OriginServerName: origin.serverName,
+		NoTLSVerify:      origin.noTLSVerify,
+		CAPool:           origin.caPool,
+		ProxyType:        origin.proxyType,
+		ProxyAddress:     origin.proxyAddress,
+		ProxyPort:        origin.proxyPort,
+		BastionMode:      origin.bastionMode,
+		OriginRaw:        origin.raw,
+		Fallback:         true,
+		Source:           model.SourceRef{ContainerID: container.ID, ContainerName: container.Name},
+	}, true, errors
+}
+
+// parseTunnelLabel returns the CF_TUNNEL_IDS tunnel named by label, or
+// fallback when the label is not set.
+func (parser *Parser) parseTunnelLabel(containerName string, labels map[string]string, label string, fallback string) (string, error) {
+	value, ok := labels[label]
+	if !ok {
+		return fallback, nil
+	}
+	name := strings.ToLower(strings.TrimSpace(value))
+	if name == "" {
+		return "", containerErrorf(containerName, "%s cannot be empty", label)
+	}
+	if _, known := parser.tunnels[name]; !known {
+		return "", containerErrorf(containerName, "%s %q is not a tunnel listed in CF_TUNNEL_IDS", label, name)
+	}
+	return name, nil
+}
+
+// baseHostnames returns the cloudflare.tunnel.hostname value followed by the
+// cloudflare.tunnel.hostnames entries, lowercased and without repeats.
+// Hostnames are case-insensitive; lowercasing them matches the rules and
+// records Cloudflare keeps, so a mixed-case label does not flap.
+func baseHostnames(hostname string, list string) []string {
+	hostnames := []string{}
+	seen := map[string]struct{}{}
+	for _, entry := range append([]string{strings.TrimSpace(hostname)}, splitCommaList(list)...) {
+		entry = strings.ToLower(entry)
+		if entry == "" {
+			continue
+		}
+		if _, ok := seen[entry]; ok {
+			continue
+		}
+		seen[entry] = struct{}{}
+		hostnames = append(hostnames, entry)
+	}
+	return hostnames
+}
+
 func appendRouteSpec(desired *[]model.RouteSpec, desiredKeys map[model.RouteKey]struct{}, route model.RouteSpec) error {
 	if _, exists := desiredKeys[route.Key]; exists {
 		return fmt.Errorf("duplicate route definition for %s", route.Key.String())
@@ -211,26 +485,176 @@ func sortedSuffixes(set map[string]struct{}) []string {
 	return items
 }
 
-func parseOriginLabels(containerName string, labels map[string]string, serverNameLabel string, noTLSVerifyLabel string) (*string, *bool, error) {
-	var originServerName *string
+// unixServiceSchemes lists the cloudflared service prefixes that proxy to a Unix socket.
+var unixServiceSchemes = []string{"unix+tls:", "unix:"}
+
+// validateService checks service shapes that need more than a non-empty value.
+// Unix socket services carry a filesystem path instead of host:port, so they
+// are kept verbatim and only require an absolute socket path.
+func validateService(containerName string, serviceLabel string, service string) error {
+	for _, scheme := range unixServiceSchemes {
+		if !strings.HasPrefix(service, scheme) {
+			continue
+		}
+		socketPath := strings.TrimPrefix(service, scheme)
+		if !strings.HasPrefix(socketPath, "/") {
+			return containerErrorf(containerName, "%s unix socket path must be absolute", serviceLabel)
+		}
+		return nil
+	}
+	return nil
+}
+
+// originLabels holds the originRequest keys managed through
+// cloudflare.tunnel.origin.* labels; nil fields are unset.
+type originLabels struct {
+	serverName   *string
+	noTLSVerify  *bool
+	caPool       *string
+	proxyType    *string
+	proxyAddress *string
+	proxyPort    *uint16
+	bastionMode  *bool
+	raw          map[string]any
+}
+
+// inherit fills the keys a suffix route leaves unset from the base route, as
+// enabled by cloudflare.tunnel.origin.inherit. Keys set on the suffix route,
+// including an explicit false, win; origin.raw objects are merged key by key.
+func (origin originLabels) inherit(base originLabels) originLabels {
+	if origin.serverName == nil {
+		origin.serverName = base.serverName
+	}
+	if origin.noTLSVerify == nil {
+		origin.noTLSVerify = base.noTLSVerify
+	}
+	if origin.caPool == nil {
+		origin.caPool = base.caPool
+	}
+	if origin.proxyType == nil {
+		origin.proxyType = base.proxyType
+	}
+	if origin.proxyAddress == nil {
+		origin.proxyAddress = base.proxyAddress
+	}
+	if origin.proxyPort == nil {
+		origin.proxyPort = base.proxyPort
+	}
+	if origin.bastionMode == nil {
+		origin.bastionMode = base.bastionMode
+	}
+	if len(base.raw) > 0 {
+		raw := make(map[string]any, len(base.raw)+len(origin.raw))
+		maps.Copy(raw, base.raw)
+		maps.Copy(raw, origin.raw)
+		origin.raw = raw
+	}
+	return origin
+}
+
+// parseOriginLabels reads the origin labels of the base route, or of a suffix
+// route when suffix is not empty.
+func parseOriginLabels(containerName string, labels map[string]string, suffix string) (originLabels, error) {
+	serverNameLabel := LabelOriginServerName
+	noTLSVerifyLabel := LabelOriginNoTLSVerify
+	caPoolLabel := LabelOriginCAPool
+	proxyTypeLabel := LabelOriginProxyType
+	proxyAddressLabel := LabelOriginProxyAddr
+	proxyPortLabel := LabelOriginProxyPort
+	bastionModeLabel := LabelOriginBastionMode
+	rawLabel := LabelOriginRaw
+	if suffix != "" {
+		serverNameLabel += "." + suffix
+		noTLSVerifyLabel += "." + suffix
+		caPoolLabel += "." + suffix
+		proxyTypeLabel += "." + suffix
+		proxyAddressLabel += "." + suffix
+		proxyPortLabel += "." + suffix
+		bastionModeLabel += "." + suffix
+		rawLabel += "." + suffix
+	}
+
+	origin := originLabels{}
 	if originServerNameValue, hasOriginServerName := labels[serverNameLabel]; hasOriginServerName {
 		trimmedServerName := strings.TrimSpace(originServerNameValue)
 		if trimmedServerName == "" {
-			return nil, nil, fmt.Errorf("container %s: %s cannot be empty", containerName, serverNameLabel)
+			return originLabels{}, containerErrorf(containerName, "%s cannot be empty", serverNameLabel)
 		}
-		originServerName = &trimmedServerName
+		origin.serverName = &trimmedServerName
 	}
 
-	var originNoTLSVerify *bool
 	if originNoTLSVerifyValue, hasOriginNoTLSVerify := labels[noTLSVerifyLabel]; hasOriginNoTLSVerify {
 		parsedNoTLSVerify, err := strconv.ParseBool(strings.TrimSpace(originNoTLSVerifyValue))
 		if err != nil {
-			return nil, nil, fmt.Errorf("container %s: invalid %s label: %w", containerName, noTLSVerifyLabel, err)
+			return originLabels{}, containerErrorf(containerName, "invalid %s label: %w", noTLSVerifyLabel, err)
+		}
+		origin.noTLSVerify = &parsedNoTLSVerify
+	}
+
+	if caPoolValue, hasCAPool := labels[caPoolLabel]; hasCAPool {
+		trimmedCAPool := strings.TrimSpace(caPoolValue)
+		if trimmedCAPool == "" {
+			return originLabels{}, containerErrorf(containerName, "%s cannot be empty", caPoolLabel)
 		}
-		originNoTLSVerify = &parsedNoTLSVerify
+		origin.caPool = &trimmedCAPool
 	}
 
-	return originServerName, originNoTLSVerify, nil
+	if proxyTypeValue, hasProxyType := labels[proxyTypeLabel]; hasProxyType {
+		// cloudflared runs an HTTP proxy for an empty proxyType, so http is
+		// written as "".
+		var proxyType string
+		switch strings.ToLower(strings.TrimSpace(proxyTypeValue)) {
+		case "http":
+		case "socks":
+			proxyType = "socks"
+		default:
+			return originLabels{}, containerErrorf(containerName, "invalid %s label %q: expected http or socks", proxyTypeLabel, proxyTypeValue)
+		}
+		origin.proxyType = &proxyType
+	}
+
+	if proxyAddressValue, hasProxyAddress := labels[proxyAddressLabel]; hasProxyAddress {
+		trimmedProxyAddress := strings.TrimSpace(proxyAddressValue)
+		if net.ParseIP(trimmedProxyAddress) == nil {
+			return originLabels{}, containerErrorf(containerName, "invalid %s label %q: expected an IP address", proxyAddressLabel, proxyAddressValue)
+		}
+		origin.proxyAddress = &trimmedProxyAddress
+	}
+
+	if proxyPortValue, hasProxyPort := labels[proxyPortLabel]; hasProxyPort {
+		parsedProxyPort, err := strconv.ParseUint(strings.TrimSpace(proxyPortValue), 10, 16)
+		if err != nil {
+			return originLabels{}, containerErrorf(containerName, "invalid %s label %q: expected a port from 0 to 65535", proxyPortLabel, proxyPortValue)
+		}
+		proxyPort := uint16(parsedProxyPort)
+		origin.proxyPort = &proxyPort
+	}
+
+	if bastionModeValue, hasBastionMode := labels[bastionModeLabel]; hasBastionMode {
+		parsedBastionMode, err := strconv.ParseBool(strings.TrimSpace(bastionModeValue))
+		if err != nil {
+			return originLabels{}, containerErrorf(containerName, "invalid %s label: %w", bastionModeLabel, err)
+		}
+		origin.bastionMode = &parsedBastionMode
+	}
+
+	if rawValue, hasRaw := labels[rawLabel]; hasRaw {
+		raw := map[string]any{}
+		if err := json.Unmarshal([]byte(rawValue), &raw); err != nil || raw == nil {
+			return originLabels{}, containerErrorf(containerName, "%s must be a JSON object", rawLabel)
+		}
+		// Keys with a dedicated label are managed by that label alone.
+		for _, dedicated := range [][2]string{{"originServerName", serverNameLabel}, {"noTLSVerify", noTLSVerifyLabel}, {"caPool", caPoolLabel}, {"proxyType", proxyTypeLabel}, {"proxyAddress", proxyAddressLabel}, {"proxyPort", proxyPortLabel}, {"bastionMode", bastionModeLabel}} {
+			if _, ok := raw[dedicated[0]]; ok {
+				return originLabels{}, containerErrorf(containerName, "%s cannot set %s; use %s", rawLabel, dedicated[0], dedicated[1])
+			}
+		}
+		if len(raw) > 0 {
+			origin.raw = raw
+		}
+	}
+
+	return origin, nil
 }
 
 func parseDNSZoneLabel(containerName string, labels map[string]string, zoneLabel string) (string, error) {
@@ -241,12 +665,42 @@ func parseDNSZoneLabel(containerName string, labels map[string]string, zoneLabel
 
 	trimmed := strings.TrimSpace(zoneValue)
 	if trimmed == "" {
-		return "", fmt.Errorf("container %s: %s cannot be empty", containerName, zoneLabel)
+		return "", containerErrorf(containerName, "%s cannot be empty", zoneLabel)
 	}
 
 	return strings.ToLower(strings.TrimSuffix(trimmed, ".")), nil
 }
 
+// parseDNSProxiedLabel returns nil when the label is unset, so DNS sync keeps
+// the proxied state of an existing record.
+func parseDNSProxiedLabel(containerName string, labels map[string]string, proxiedLabel string) (*bool, error) {
+	proxiedValue, hasProxied := labels[proxiedLabel]
+	if !hasProxied {
+		return nil, nil
+	}
+
+	parsed, err := strconv.ParseBool(strings.TrimSpace(proxiedValue))
+	if err != nil {
+		return nil, containerErrorf(containerName, "invalid %s label: %w", proxiedLabel, err)
+	}
+	return &parsed, nil
+}
+
+// parseDNSCommentLabel returns nil when the label is unset, so DNS sync keeps
+// the note of an existing record. An empty value clears the note.
+func parseDNSCommentLabel(containerName string, labels map[string]string, commentLabel string) (*string, error) {
+	commentValue, hasComment := labels[commentLabel]
+	if !hasComment {
+		return nil, nil
+	}
+
+	comment := strings.TrimSpace(commentValue)
+	if strings.ContainsAny(comment, "\r\n") {
+		return nil, containerErrorf(containerName, "invalid %s label: must be a single line", commentLabel)
+	}
+	return &comment, nil
+}
+
 // ParseAccessContainers returns desired Access apps and any validation errors.
 func (parser *Parser) ParseAccessContainers(containers []docker.ContainerInfo) ([]model.AccessAppSpec, []error) {
 	errors := []error{}
@@ -259,75 +713,778 @@ func (parser *Parser) ParseAccessContainers(containers []docker.ContainerInfo) (
 	})
 
 	for _, container := range sorted {
-		enabledValue, hasEnable := container.Labels[AccessLabelEnable]
-		if !hasEnable {
+		for _, scope := range accessScopes(container.Labels) {
+			app, ok, appErrors := parseAccessApp(container, scope)
+			errors = append(errors, appErrors...)
+			if !ok {
+				continue
+			}
+			if err := parser.applySharedPolicies(container, &app); err != nil {
+				errors = append(errors, err)
+				continue
+			}
+
+			key := accessAppKey{Name: app.Name, Domain: model.NormalizeAccessDomain(app.Domain)}
+			if existing, exists := desired[key]; exists {
+				if !existing.Merge || !app.Merge {
+					errors = append(errors, fmt.Errorf("duplicate access app definition for %s; set %s=true on every definition to merge them", key.String(), AccessLabelAppMerge))
+					continue
+				}
+				merged, err := mergeAccessApps(existing, app)
+				if err != nil {
+					errors = append(errors, containerErrorf(container.Name, "cannot merge access app %s: %w", key.String(), err))
+					continue
+				}
+				desired[key] = merged
+				continue
+			}
+			desired[key] = app
+		}
+	}
+
+	explicitDomains := map[string]struct{}{}
+	for _, app := range desired {
+		explicitDomains[model.NormalizeAccessDomain(app.Domain)] = struct{}{}
+	}
+	for _, container := range sorted {
+		shorthandApps, shorthandErrors := parseAccessShorthand(container)
+		errors = append(errors, shorthandErrors...)
+		for _, app := range shorthandApps {
+			if _, exists := explicitDomains[model.NormalizeAccessDomain(app.Domain)]; exists {
+				errors = append(errors, containerErrorf(container.Name, "%s ignored for %s; explicit %s labels take precedence", LabelAccessEmails, app.Domain, AccessLabelPrefix+"*"))
+				continue
+			}
+			key := accessAppKey{Name: app.Name, Domain: model.NormalizeAccessDomain(app.Domain)}
+			if _, exists := desired[key]; exists {
+				errors = append(errors, fmt.Errorf("duplicate access app definition for %s", key.String()))
+				continue
+			}
+			desired[key] = app
+		}
+	}
+
+	result := make([]model.AccessAppSpec, 0, len(desired))
+	for _, app := range desired {
+		result = append(result, app)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return accessAppKey{Name: result[i].Name, Domain: result[i].Domain}.String() < accessAppKey{Name: result[j].Name, Domain: result[j].Domain}.String()
+	})
+
+	return result, errors
+}
+
+// applySharedPolicies replaces name-only policy references with matching
+// shared definitions. Redefining a shared policy inline is an error.
+func (parser *Parser) applySharedPolicies(container docker.ContainerInfo, app *model.AccessAppSpec) error {
+	if len(parser.sharedPolicies) == 0 {
+		return nil
+	}
+	policies := make([]model.AccessPolicySpec, 0, len(app.Policies))
+	for _, policy := range app.Policies {
+		shared, ok := parser.sharedPolicies[strings.ToLower(policy.Name)]
+		if !ok || policy.Name == "" {
+			policies = append(policies, policy)
 			continue
 		}
-		enabled, err := strconv.ParseBool(enabledValue)
-		if err != nil || !enabled {
-			if err != nil {
-				errors = append(errors, fmt.Errorf("container %s: invalid %s label: %w", container.Name, AccessLabelEnable, err))
+		if policy.Managed {
+			return containerErrorf(container.Name, "access policy %q for app %s is defined in the shared policy file; reference it by name only", policy.Name, app.Name)
+		}
+		if policy.ID != "" {
+			policies = append(policies, policy)
+			continue
+		}
+		// Precedence belongs to the app's label, not the shared definition.
+		shared.Precedence = policy.Precedence
+		policies = append(policies, shared)
+	}
+	app.Policies = policies
+	return nil
+}
+
+// mergeAccessApps combines two definitions of the same app that both opted in
+// with cloudflare.access.app.merge. Policies are unioned by name, with the
+// include rules of same-named managed policies combined. App settings from the
+// first definition win; the second only fills settings the first leaves unset.
+func mergeAccessApps(existing model.AccessAppSpec, app model.AccessAppSpec) (model.AccessAppSpec, error) {
+	if existing.ID != "" && app.ID != "" && existing.ID != app.ID {
+		return model.AccessAppSpec{}, fmt.Errorf("conflicting app ids %q and %q", existing.ID, app.ID)
+	}
+	merged := existing
+	if merged.ID == "" {
+		merged.ID = app.ID
+	}
+	if merged.Type == "" {
+		merged.Type = app.Type
+	}
+	if !merged.TagsSet {
+		merged.Tags = app.Tags
+		merged.TagsSet = app.TagsSet
+	}
+	if merged.AppLauncherVisible == nil {
+		merged.AppLauncherVisible = app.AppLauncherVisible
+	}
+	if merged.LogoURL == nil {
+		merged.LogoURL = app.LogoURL
+	}
+	if len(merged.AllowedIdPs) == 0 {
+		merged.AllowedIdPs = app.AllowedIdPs
+	}
+	if merged.DenyMessage == nil {
+		merged.DenyMessage = app.DenyMessage
+	}
+	if merged.DenyURL == nil {
+		merged.DenyURL = app.DenyURL
+	}
+	if merged.AutoRedirect == nil {
+		merged.AutoRedirect = app.AutoRedirect
+	}
+	if merged.SkipInterstitial == nil {
+		merged.SkipInterstitial = app.SkipInterstitial
+	}
+	if merged.IsolationRequired == nil {
+		merged.IsolationRequired = app.IsolationRequired
+	}
+	if merged.SkipLauncherLogin == nil {
+		merged.SkipLauncherLogin = app.SkipLauncherLogin
+	}
+	if merged.HTTPOnlyCookie == nil {
+		merged.HTTPOnlyCookie = app.HTTPOnlyCookie
+	}
+	if merged.SameSiteCookie == nil {
+		merged.SameSiteCookie = app.SameSiteCookie
+	}
+	if len(merged.CustomPages) == 0 {
+		merged.CustomPages = app.CustomPages
+	}
+	if merged.CORS == nil {
+		merged.CORS = app.CORS
+	}
+
+	policies := make([]model.AccessPolicySpec, len(existing.Policies), len(existing.Policies)+len(app.Policies))
+	copy(policies, existing.Policies)
+	for _, policy := range app.Policies {
+		index := -1
+		for i, current := range policies {
+			if (policy.Name != "" && strings.EqualFold(current.Name, policy.Name)) || (policy.Name == "" && policy.ID == current.ID) {
+				index = i
+				break
 			}
+		}
+		if index < 0 {
+			policies = append(policies, policy)
 			continue
 		}
+		combined, err := mergeAccessPolicies(policies[index], policy)
+		if err != nil {
+			return model.AccessAppSpec{}, err
+		}
+		policies[index] = combined
+	}
+	merged.Policies = policies
+	return merged, nil
+}
+
+// mergeAccessPolicies unions the include rules of two same-named policies.
+func mergeAccessPolicies(existing model.AccessPolicySpec, policy model.AccessPolicySpec) (model.AccessPolicySpec, error) {
+	label := policyLabel(policy)
+	if existing.Managed != policy.Managed {
+		return model.AccessPolicySpec{}, fmt.Errorf("access policy %s is a reference in one definition and managed in another", label)
+	}
+	if existing.ID != "" && policy.ID != "" && existing.ID != policy.ID {
+		return model.AccessPolicySpec{}, fmt.Errorf("access policy %s has conflicting ids %q and %q", label, existing.ID, policy.ID)
+	}
+	if existing.Precedence != 0 && policy.Precedence != 0 && existing.Precedence != policy.Precedence {
+		return model.AccessPolicySpec{}, fmt.Errorf("access policy %s has conflicting precedences %d and %d", label, existing.Precedence, policy.Precedence)
+	}
+	if existing.Precedence == 0 {
+		existing.Precedence = policy.Precedence
+	}
+	if !existing.Managed {
+		if existing.ID == "" {
+			existing.ID = policy.ID
+		}
+		return existing, nil
+	}
+	if existing.Action != policy.Action {
+		return model.AccessPolicySpec{}, fmt.Errorf("access policy %s has conflicting actions %q and %q", label, existing.Action, policy.Action)
+	}
+	if existing.RequireAuthMethod != "" && policy.RequireAuthMethod != "" && existing.RequireAuthMethod != policy.RequireAuthMethod {
+		return model.AccessPolicySpec{}, fmt.Errorf("access policy %s has conflicting required auth methods %q and %q", label, existing.RequireAuthMethod, policy.RequireAuthMethod)
+	}
+	if existing.ID == "" {
+		existing.ID = policy.ID
+	}
+	if existing.RequireAuthMethod == "" {
+		existing.RequireAuthMethod = policy.RequireAuthMethod
+	}
+	existing.IncludeEmails = unionStrings(existing.IncludeEmails, policy.IncludeEmails)
+	existing.IncludeIPs = unionStrings(existing.IncludeIPs, policy.IncludeIPs)
+	existing.IncludeGroups = unionStrings(existing.IncludeGroups, policy.IncludeGroups)
+	existing.IncludeEmailDomains = unionStrings(existing.IncludeEmailDomains, policy.IncludeEmailDomains)
+	existing.IncludeCountries = unionStrings(existing.IncludeCountries, policy.IncludeCountries)
+	existing.IncludeServiceTokens = unionStrings(existing.IncludeServiceTokens, policy.IncludeServiceTokens)
+	existing.IncludeAnyServiceToken = existing.IncludeAnyServiceToken || policy.IncludeAnyServiceToken
+	existing.IncludeCommonNames = unionStrings(existing.IncludeCommonNames, policy.IncludeCommonNames)
+	existing.IncludeCertificate = existing.IncludeCertificate || policy.IncludeCertificate
+	existing.IncludeEveryone = existing.IncludeEveryone || policy.IncludeEveryone
+	return existing, nil
+}
+
+// policyLabel names a policy in merge errors.
+func policyLabel(policy model.AccessPolicySpec) string {
+	if policy.Name != "" {
+		return fmt.Sprintf("%q", policy.Name)
+	}
+	return fmt.Sprintf("id %q", policy.ID)
+}
 
-		appName := strings.TrimSpace(container.Labels[AccessLabelAppName])
-		appDomain := strings.TrimSpace(container.Labels[AccessLabelAppDomain])
-		appID := strings.TrimSpace(container.Labels[AccessLabelAppID])
-		appTagsValue, hasAppTags := container.Labels[AccessLabelAppTags]
-		appTags := []string(nil)
-		if hasAppTags {
-			appTags = splitCommaList(appTagsValue)
+// unionStrings appends the values from extra that are not already in values.
+func unionStrings(values []string, extra []string) []string {
+	result := append([]string(nil), values...)
+	for _, value := range extra {
+		if !slices.Contains(result, value) {
+			result = append(result, value)
 		}
+	}
+	return result
+}
+
+// bookmarkAppType is the Access app type that links to an external URL.
+const bookmarkAppType = "bookmark"
+
+// supportedAccessAppTypes lists the Access application types that can be set
+// with cloudflare.access.app.type.
+var supportedAccessAppTypes = map[string]struct{}{
+	"self_hosted": {},
+	"ssh":         {},
+	"vnc":         {},
+	"rdp":         {},
+	"bookmark":    {},
+}
+
+// supportedSameSiteCookies lists the values accepted by
+// cloudflare.access.app.same-site-cookie.
+var supportedSameSiteCookies = map[string]struct{}{
+	"none":   {},
+	"lax":    {},
+	"strict": {},
+}
+
+// accessScope selects either the base cloudflare.access.* labels or the
+// cloudflare.access.<suffix>.* labels that pair with a suffix route.
+type accessScope struct {
+	suffix string
+}
+
+// indexed reports whether the scope is a numbered cloudflare.access.<n>.* block,
+// which inherits the base enable label when it has none of its own.
+func (scope accessScope) indexed() bool {
+	index, err := strconv.Atoi(scope.suffix)
+	return err == nil && index > 0
+}
+
+// label maps a base Access label to its scoped equivalent.
+func (scope accessScope) label(base string) string {
+	if scope.suffix == "" {
+		return base
+	}
+	return AccessLabelPrefix + scope.suffix + "." + strings.TrimPrefix(base, AccessLabelPrefix)
+}
 
-		if appName == "" {
-			errors = append(errors, fmt.Errorf("container %s: missing required %s label", container.Name, AccessLabelAppName))
+func (scope accessScope) hostLabel() string {
+	if scope.suffix == "" {
+		return LabelHost
+	}
+	return LabelHost + "." + scope.suffix
+}
+
+// accessScopes returns the base scope followed by every suffix scope that has
+// a cloudflare.access.<suffix>.enable label, and every numbered
+// cloudflare.access.<n>.app.* or .policy.* block, in sorted order.
+func accessScopes(labels map[string]string) []accessScope {
+	scopes := []accessScope{{}}
+	enableField := strings.TrimPrefix(AccessLabelEnable, AccessLabelPrefix)
+	suffixes := map[string]struct{}{}
+	for labelKey := range labels {
+		if !strings.HasPrefix(labelKey, AccessLabelPrefix) {
 			continue
 		}
-		if appDomain == "" {
-			tunnelDomain := strings.TrimSpace(container.Labels[LabelHost])
-			if tunnelDomain == "" {
-				errors = append(errors, fmt.Errorf("container %s: missing %s; set %s or %s", container.Name, AccessLabelAppDomain, AccessLabelAppDomain, LabelHost))
+		if index, field, ok := strings.Cut(strings.TrimPrefix(labelKey, AccessLabelPrefix), "."); ok && (accessScope{suffix: index}).indexed() {
+			if strings.HasPrefix(field, "app.") || strings.HasPrefix(field, "policy.") {
+				suffixes[index] = struct{}{}
 				continue
 			}
-			appDomain = tunnelDomain
 		}
-
-		policies, policyErrors := parseAccessPolicies(container)
-		errors = append(errors, policyErrors...)
-		if len(policies) == 0 {
-			errors = append(errors, fmt.Errorf("container %s: no access policies configured", container.Name))
+		if !strings.HasSuffix(labelKey, "."+enableField) {
 			continue
 		}
-
-		key := accessAppKey{Name: appName, Domain: appDomain}
-		if _, exists := desired[key]; exists {
-			errors = append(errors, fmt.Errorf("duplicate access app definition for %s", key.String()))
+		suffix := strings.TrimSuffix(strings.TrimPrefix(labelKey, AccessLabelPrefix), "."+enableField)
+		if suffix == "" || suffix == "app" || suffix == "policy" || strings.HasPrefix(suffix, "app.") || strings.HasPrefix(suffix, "policy.") {
 			continue
 		}
+		suffixes[suffix] = struct{}{}
+	}
+	for _, suffix := range sortedSuffixes(suffixes) {
+		scopes = append(scopes, accessScope{suffix: suffix})
+	}
+	return scopes
+}
 
-		source := model.SourceRef{ContainerID: container.ID, ContainerName: container.Name}
-		desired[key] = model.AccessAppSpec{
-			ID:       appID,
-			Name:     appName,
-			Domain:   appDomain,
-			Policies: policies,
-			Tags:     appTags,
-			TagsSet:  hasAppTags,
-			Source:   source,
+// parseAccessApp builds the Access app for one scope of a container. It
+// returns false when the scope is not enabled or fails validation.
+func parseAccessApp(container docker.ContainerInfo, scope accessScope) (model.AccessAppSpec, bool, []error) {
+	errors := []error{}
+	enableLabel := scope.label(AccessLabelEnable)
+	enabledValue, hasEnable := container.Labels[enableLabel]
+	if !hasEnable && scope.indexed() {
+		enableLabel = AccessLabelEnable
+		enabledValue, hasEnable = container.Labels[enableLabel]
+	}
+	if !hasEnable {
+		return model.AccessAppSpec{}, false, nil
+	}
+	enabled, err := strconv.ParseBool(enabledValue)
+	if err != nil || !enabled {
+		if err != nil {
+			errors = append(errors, containerErrorf(container.Name, "invalid %s label: %w", enableLabel, err))
 		}
+		return model.AccessAppSpec{}, false, errors
 	}
 
-	result := make([]model.AccessAppSpec, 0, len(desired))
-	for _, app := range desired {
-		result = append(result, app)
+	nameLabel := scope.label(AccessLabelAppName)
+	domainLabel := scope.label(AccessLabelAppDomain)
+	appName := strings.TrimSpace(container.Labels[nameLabel])
+	appDomain := strings.TrimSpace(container.Labels[domainLabel])
+	appID := strings.TrimSpace(container.Labels[scope.label(AccessLabelAppID)])
+	appTagsValue, hasAppTags := container.Labels[scope.label(AccessLabelAppTags)]
+	appTags := []string(nil)
+	if hasAppTags {
+		appTags = splitCommaList(appTagsValue)
 	}
 
-	sort.Slice(result, func(i, j int) bool {
-		return accessAppKey{Name: result[i].Name, Domain: result[i].Domain}.String() < accessAppKey{Name: result[j].Name, Domain: result[j].Domain}.String()
-	})
+	var appLauncherVisible *bool
+	launcherLabel := scope.label(AccessLabelAppLauncher)
+	if launcherValue, hasLauncher := container.Labels[launcherLabel]; hasLauncher {
+		parsedLauncher, err := strconv.ParseBool(strings.TrimSpace(launcherValue))
+		if err != nil {
+			errors = append(errors, containerErrorf(container.Name, "invalid %s label: %w", launcherLabel, err))
+			return model.AccessAppSpec{}, false, errors
+		}
+		appLauncherVisible = &parsedLauncher
+	}
 
-	return result, errors
+	var appLogoURL *string
+	logoLabel := scope.label(AccessLabelAppLogoURL)
+	if logoValue, hasLogo := container.Labels[logoLabel]; hasLogo {
+		trimmedLogo := strings.TrimSpace(logoValue)
+		if err := validateAbsoluteURL(trimmedLogo); err != nil {
+			errors = append(errors, containerErrorf(container.Name, "invalid %s label: %w", logoLabel, err))
+			return model.AccessAppSpec{}, false, errors
+		}
+		appLogoURL = &trimmedLogo
+	}
+
+	var allowedIdPs []string
+	idpsLabel := scope.label(AccessLabelAppIdPs)
+	if idpsValue, hasIdPs := container.Labels[idpsLabel]; hasIdPs {
+		allowedIdPs = splitCommaList(strings.TrimSpace(idpsValue))
+		if len(allowedIdPs) == 0 {
+			errors = append(errors, containerErrorf(container.Name, "%s cannot be empty", idpsLabel))
+			return model.AccessAppSpec{}, false, errors
+		}
+	}
+
+	var customPages []string
+	customPagesLabel := scope.label(AccessLabelAppCustomPages)
+	if customPagesValue, hasCustomPages := container.Labels[customPagesLabel]; hasCustomPages {
+		customPages = splitCommaList(strings.TrimSpace(customPagesValue))
+		if len(customPages) == 0 {
+			errors = append(errors, containerErrorf(container.Name, "%s cannot be empty", customPagesLabel))
+			return model.AccessAppSpec{}, false, errors
+		}
+	}
+
+	cors, err := parseAccessCORS(container, scope)
+	if err != nil {
+		errors = append(errors, err)
+		return model.AccessAppSpec{}, false, errors
+	}
+
+	var autoRedirect *bool
+	redirectLabel := scope.label(AccessLabelAppRedirect)
+	if redirectValue, hasRedirect := container.Labels[redirectLabel]; hasRedirect {
+		parsedRedirect, err := strconv.ParseBool(strings.TrimSpace(redirectValue))
+		if err != nil {
+			errors = append(errors, containerErrorf(container.Name, "invalid %s label: %w", redirectLabel, err))
+			return model.AccessAppSpec{}, false, errors
+		}
+		autoRedirect = &parsedRedirect
+	}
+
+	var skipInterstitial *bool
+	skipInterstitialLabel := scope.label(AccessLabelAppSkipInterstitial)
+	if skipValue, hasSkip := container.Labels[skipInterstitialLabel]; hasSkip {
+		parsedSkip, err := strconv.ParseBool(strings.TrimSpace(skipValue))
+		if err != nil {
+			errors = append(errors, containerErrorf(container.Name, "invalid %s label: %w", skipInterstitialLabel, err))
+			return model.AccessAppSpec{}, false, errors
+		}
+		skipInterstitial = &parsedSkip
+	}
+
+	var isolationRequired *bool
+	isolationLabel := scope.label(AccessLabelAppIsolation)
+	if isolationValue, hasIsolation := container.Labels[isolationLabel]; hasIsolation {
+		parsedIsolation, err := strconv.ParseBool(strings.TrimSpace(isolationValue))
+		if err != nil {
+			errors = append(errors, containerErrorf(container.Name, "invalid %s label: %w", isolationLabel, err))
+			return model.AccessAppSpec{}, false, errors
+		}
+		isolationRequired = &parsedIsolation
+	}
+
+	var skipLauncherLogin *bool
+	skipLauncherLabel := scope.label(AccessLabelAppSkipLauncher)
+	if skipLauncherValue, hasSkipLauncher := container.Labels[skipLauncherLabel]; hasSkipLauncher {
+		parsedSkipLauncher, err := strconv.ParseBool(strings.TrimSpace(skipLauncherValue))
+		if err != nil {
+			errors = append(errors, containerErrorf(container.Name, "invalid %s label: %w", skipLauncherLabel, err))
+			return model.AccessAppSpec{}, false, errors
+		}
+		skipLauncherLogin = &parsedSkipLauncher
+	}
+
+	var httpOnlyCookie *bool
+	httpOnlyLabel := scope.label(AccessLabelAppHTTPOnlyCookie)
+	if httpOnlyValue, hasHTTPOnly := container.Labels[httpOnlyLabel]; hasHTTPOnly {
+		parsedHTTPOnly, err := strconv.ParseBool(strings.TrimSpace(httpOnlyValue))
+		if err != nil {
+			errors = append(errors, containerErrorf(container.Name, "invalid %s label: %w", httpOnlyLabel, err))
+			return model.AccessAppSpec{}, false, errors
+		}
+		httpOnlyCookie = &parsedHTTPOnly
+	}
+
+	var sameSiteCookie *string
+	sameSiteLabel := scope.label(AccessLabelAppSameSiteCookie)
+	if sameSiteValue, hasSameSite := container.Labels[sameSiteLabel]; hasSameSite {
+		normalized := strings.ToLower(strings.TrimSpace(sameSiteValue))
+		if _, ok := supportedSameSiteCookies[normalized]; !ok {
+			errors = append(errors, containerErrorf(container.Name, "invalid %s label %q: expected none, lax, or strict", sameSiteLabel, sameSiteValue))
+			return model.AccessAppSpec{}, false, errors
+		}
+		sameSiteCookie = &normalized
+	}
+
+	merge := false
+	mergeLabel := scope.label(AccessLabelAppMerge)
+	if mergeValue, hasMerge := container.Labels[mergeLabel]; hasMerge {
+		parsedMerge, err := strconv.ParseBool(strings.TrimSpace(mergeValue))
+		if err != nil {
+			errors = append(errors, containerErrorf(container.Name, "invalid %s label: %w", mergeLabel, err))
+			return model.AccessAppSpec{}, false, errors
+		}
+		merge = parsedMerge
+	}
+
+	var denyMessage *string
+	denyMessageLabel, denyMessageValue, hasDenyMessage, err := aliasedLabel(container, scope.label(AccessLabelAppDenyMsg), scope.label(AccessLabelAppCustomDenyMsg))
+	if err != nil {
+		errors = append(errors, err)
+		return model.AccessAppSpec{}, false, errors
+	}
+	if hasDenyMessage {
+		trimmedMessage := strings.TrimSpace(denyMessageValue)
+		if trimmedMessage == "" {
+			errors = append(errors, containerErrorf(container.Name, "%s cannot be empty", denyMessageLabel))
+			return model.AccessAppSpec{}, false, errors
+		}
+		denyMessage = &trimmedMessage
+	}
+
+	var denyURL *string
+	denyURLLabel, denyURLValue, hasDenyURL, err := aliasedLabel(container, scope.label(AccessLabelAppDenyURL), scope.label(AccessLabelAppCustomDenyURL))
+	if err != nil {
+		errors = append(errors, err)
+		return model.AccessAppSpec{}, false, errors
+	}
+	if hasDenyURL {
+		trimmedURL := strings.TrimSpace(denyURLValue)
+		if err := validateAbsoluteURL(trimmedURL); err != nil {
+			errors = append(errors, containerErrorf(container.Name, "invalid %s label: %w", denyURLLabel, err))
+			return model.AccessAppSpec{}, false, errors
+		}
+		denyURL = &trimmedURL
+	}
+
+	typeLabel := scope.label(AccessLabelAppType)
+	appType := strings.ToLower(strings.TrimSpace(container.Labels[typeLabel]))
+	if appType != "" {
+		if _, ok := supportedAccessAppTypes[appType]; !ok {
+			errors = append(errors, containerErrorf(container.Name, "%s has unsupported value %q (expected self_hosted, ssh, vnc, rdp, or bookmark)", typeLabel, appType))
+			return model.AccessAppSpec{}, false, errors
+		}
+	}
+
+	if appName == "" {
+		errors = append(errors, containerErrorf(container.Name, "missing required %s label", nameLabel))
+		return model.AccessAppSpec{}, false, errors
+	}
+	urlLabel := scope.label(AccessLabelAppURL)
+	if appType == bookmarkAppType {
+		return parseBookmarkApp(container, scope, model.AccessAppSpec{
+			ID:                 appID,
+			Name:               appName,
+			Type:               appType,
+			Tags:               appTags,
+			TagsSet:            hasAppTags,
+			AppLauncherVisible: appLauncherVisible,
+			LogoURL:            appLogoURL,
+			Merge:              merge,
+			Source:             model.SourceRef{ContainerID: container.ID, ContainerName: container.Name},
+		})
+	}
+	if _, hasURL := container.Labels[urlLabel]; hasURL {
+		errors = append(errors, containerErrorf(container.Name, "%s is only supported when %s is bookmark", urlLabel, typeLabel))
+		return model.AccessAppSpec{}, false, errors
+	}
+	if appDomain == "" {
+		tunnelDomain := strings.TrimSpace(container.Labels[scope.hostLabel()])
+		if tunnelDomain == "" {
+			errors = append(errors, containerErrorf(container.Name, "missing %s; set %s or %s", domainLabel, domainLabel, scope.hostLabel()))
+			return model.AccessAppSpec{}, false, errors
+		}
+		appDomain = tunnelDomain
+	}
+	if strings.Contains(appDomain, "://") {
+		errors = append(errors, containerErrorf(container.Name, "%s must not include a scheme, got %q", domainLabel, appDomain))
+		return model.AccessAppSpec{}, false, errors
+	}
+	pathLabel := scope.label(AccessLabelAppPath)
+	if appPath := strings.TrimSpace(container.Labels[pathLabel]); appPath != "" {
+		if strings.Contains(appDomain, "/") {
+			errors = append(errors, containerErrorf(container.Name, "%s cannot be combined with a path in %s", pathLabel, domainLabel))
+			return model.AccessAppSpec{}, false, errors
+		}
+		appDomain = appDomain + "/" + strings.TrimPrefix(appPath, "/")
+	}
+	appDomain = model.NormalizeAccessDomain(appDomain)
+
+	policies, policyErrors := parseAccessPolicies(container, scope.label(AccessLabelPolicyPrefix))
+	errors = append(errors, policyErrors...)
+	if len(policies) == 0 {
+		errors = append(errors, containerErrorf(container.Name, "no access policies configured for %s", enableLabel))
+		return model.AccessAppSpec{}, false, errors
+	}
+
+	return model.AccessAppSpec{
+		ID:                 appID,
+		Name:               appName,
+		Domain:             appDomain,
+		Type:               appType,
+		Policies:           policies,
+		Tags:               appTags,
+		TagsSet:            hasAppTags,
+		AppLauncherVisible: appLauncherVisible,
+		LogoURL:            appLogoURL,
+		AllowedIdPs:        allowedIdPs,
+		DenyMessage:        denyMessage,
+		DenyURL:            denyURL,
+		AutoRedirect:       autoRedirect,
+		SkipInterstitial:   skipInterstitial,
+		IsolationRequired:  isolationRequired,
+		SkipLauncherLogin:  skipLauncherLogin,
+		HTTPOnlyCookie:     httpOnlyCookie,
+		SameSiteCookie:     sameSiteCookie,
+		CustomPages:        customPages,
+		CORS:               cors,
+		Merge:              merge,
+		Source:             model.SourceRef{ContainerID: container.ID, ContainerName: container.Name},
+	}, true, errors
+}
+
+// parseBookmarkApp completes a bookmark app, which links to an external URL
+// instead of protecting a hostname, so it takes its domain from
+// cloudflare.access.app.url and carries no policies.
+func parseBookmarkApp(container docker.ContainerInfo, scope accessScope, app model.AccessAppSpec) (model.AccessAppSpec, bool, []error) {
+	urlLabel := scope.label(AccessLabelAppURL)
+	appURL := strings.TrimSpace(container.Labels[urlLabel])
+	if appURL == "" {
+		return model.AccessAppSpec{}, false, []error{containerErrorf(container.Name, "missing required %s label for bookmark apps", urlLabel)}
+	}
+	if err := validateAbsoluteURL(appURL); err != nil {
+		return model.AccessAppSpec{}, false, []error{containerErrorf(container.Name, "invalid %s label: %w", urlLabel, err)}
+	}
+	policyPrefix := scope.label(AccessLabelPolicyPrefix)
+	for key := range container.Labels {
+		if strings.HasPrefix(key, policyPrefix) {
+			return model.AccessAppSpec{}, false, []error{containerErrorf(container.Name, "bookmark apps do not use access policies; remove the %s* labels", policyPrefix)}
+		}
+	}
+	app.Domain = appURL
+	return app, true, nil
+}
+
+// parseAccessCORS reads the cloudflare.access.app.cors.* labels. It returns nil
+// when none are set. Unset origins, methods, and headers allow all values, and
+// "*" does the same explicitly.
+func parseAccessCORS(container docker.ContainerInfo, scope accessScope) (*model.AccessCORSSpec, error) {
+	originsLabel := scope.label(AccessLabelAppCORSOrigins)
+	methodsLabel := scope.label(AccessLabelAppCORSMethods)
+	headersLabel := scope.label(AccessLabelAppCORSHeaders)
+	credentialsLabel := scope.label(AccessLabelAppCORSCredentials)
+	maxAgeLabel := scope.label(AccessLabelAppCORSMaxAge)
+
+	configured := false
+	for _, label := range []string{originsLabel, methodsLabel, headersLabel, credentialsLabel, maxAgeLabel} {
+		if _, ok := container.Labels[label]; ok {
+			configured = true
+		}
+	}
+	if !configured {
+		return nil, nil
+	}
+
+	cors := &model.AccessCORSSpec{}
+	var err error
+	cors.AllowedOrigins, cors.AllowAllOrigins, err = parseCORSList(container, originsLabel)
+	if err != nil {
+		return nil, err
+	}
+	for _, origin := range cors.AllowedOrigins {
+		if err := validateAbsoluteURL(origin); err != nil {
+			return nil, containerErrorf(container.Name, "invalid %s label: %w", originsLabel, err)
+		}
+	}
+	cors.AllowedMethods, cors.AllowAllMethods, err = parseCORSList(container, methodsLabel)
+	if err != nil {
+		return nil, err
+	}
+	for index, method := range cors.AllowedMethods {
+		method = strings.ToUpper(method)
+		if _, ok := supportedCORSMethods[method]; !ok {
+			return nil, containerErrorf(container.Name, "invalid %s method %q", methodsLabel, method)
+		}
+		cors.AllowedMethods[index] = method
+	}
+	cors.AllowedHeaders, cors.AllowAllHeaders, err = parseCORSList(container, headersLabel)
+	if err != nil {
+		return nil, err
+	}
+
+	if value, ok := container.Labels[credentialsLabel]; ok {
+		cors.AllowCredentials, err = strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return nil, containerErrorf(container.Name, "invalid %s label: %w", credentialsLabel, err)
+		}
+		if cors.AllowCredentials && cors.AllowAllOrigins {
+			return nil, containerErrorf(container.Name, "%s requires explicit %s", credentialsLabel, originsLabel)
+		}
+	}
+	if value, ok := container.Labels[maxAgeLabel]; ok {
+		cors.MaxAge, err = strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || cors.MaxAge < -1 || cors.MaxAge > 86400 {
+			return nil, containerErrorf(container.Name, "invalid %s label %q: expected seconds between -1 and 86400", maxAgeLabel, value)
+		}
+	}
+	return cors, nil
+}
+
+// parseCORSList returns the listed values, or reports that all values are
+// allowed when the label is unset or "*".
+func parseCORSList(container docker.ContainerInfo, label string) ([]string, bool, error) {
+	value, ok := container.Labels[label]
+	if !ok || strings.TrimSpace(value) == "*" {
+		return nil, true, nil
+	}
+	values := splitCommaList(strings.TrimSpace(value))
+	if len(values) == 0 {
+		return nil, false, containerErrorf(container.Name, "%s cannot be empty", label)
+	}
+	return values, false, nil
+}
+
+// supportedCORSMethods lists the HTTP methods accepted by Access CORS settings.
+var supportedCORSMethods = map[string]struct{}{
+	"GET":     {},
+	"POST":    {},
+	"HEAD":    {},
+	"PUT":     {},
+	"DELETE":  {},
+	"CONNECT": {},
+	"OPTIONS": {},
+	"TRACE":   {},
+	"PATCH":   {},
+}
+
+// parseAccessShorthand synthesizes Access apps from cloudflare.tunnel.access.emails
+// labels: one app per route hostname with a single managed allow policy.
+func parseAccessShorthand(container docker.ContainerInfo) ([]model.AccessAppSpec, []error) {
+	enabledValue, hasEnable := container.Labels[LabelEnable]
+	if !hasEnable {
+		return nil, nil
+	}
+	if enabled, err := strconv.ParseBool(enabledValue); err != nil || !enabled {
+		return nil, nil
+	}
+
+	type shorthandRoute struct {
+		emailsLabel string
+		hostLabel   string
+		pathLabel   string
+	}
+	routes := []shorthandRoute{}
+	if _, ok := container.Labels[LabelAccessEmails]; ok {
+		routes = append(routes, shorthandRoute{emailsLabel: LabelAccessEmails, hostLabel: LabelHost, pathLabel: LabelPath})
+	}
+	for _, suffix := range sortedSuffixes(collectSuffixes(container.Labels, LabelAccessEmails)) {
+		routes = append(routes, shorthandRoute{
+			emailsLabel: LabelAccessEmails + "." + suffix,
+			hostLabel:   LabelHost + "." + suffix,
+			pathLabel:   LabelPath + "." + suffix,
+		})
+	}
+
+	apps := []model.AccessAppSpec{}
+	errors := []error{}
+	source := model.SourceRef{ContainerID: container.ID, ContainerName: container.Name}
+	for _, route := range routes {
+		emails := splitCommaList(strings.TrimSpace(container.Labels[route.emailsLabel]))
+		if len(emails) == 0 {
+			errors = append(errors, containerErrorf(container.Name, "%s cannot be empty", route.emailsLabel))
+			continue
+		}
+		hostname := strings.ToLower(strings.TrimSpace(container.Labels[route.hostLabel]))
+		if hostname == "" {
+			errors = append(errors, containerErrorf(container.Name, "%s requires %s", route.emailsLabel, route.hostLabel))
+			continue
+		}
+
+		path := strings.TrimSpace(container.Labels[route.pathLabel])
+		if path != "" && !strings.HasPrefix(path, "/") {
+			// The route itself is rejected by ParseContainers; nothing to protect.
+			continue
+		}
+
+		domain := hostname + path
+		apps = append(apps, model.AccessAppSpec{
+			Name:   domain,
+			Domain: domain,
+			Policies: []model.AccessPolicySpec{
+				{
+					Name:          domain + " allow",
+					Action:        "allow",
+					IncludeEmails: emails,
+					Managed:       true,
+				},
+			},
+			Source: source,
+		})
+	}
+
+	return apps, errors
 }
 
 type accessAppKey struct {
@@ -340,31 +1497,49 @@ func (key accessAppKey) String() string {
 }
 
 type accessPolicyBuilder struct {
-	ID            string
-	Name          string
-	Action        string
-	IncludeEmails []string
-	IncludeIPs    []string
+	ID                     string
+	Name                   string
+	Action                 string
+	IncludeEmails          []string
+	IncludeIPs             []string
+	IncludeGroups          []string
+	IncludeEmailDomains    []string
+	IncludeCountries       []string
+	IncludeServiceTokens   []string
+	IncludeAnyServiceToken bool
+	IncludeCommonNames     []string
+	IncludeCertificate     bool
+	IncludeEveryone        bool
+	RequireAuthMethod      string
+	Precedence             int
+	// Managed is the explicit policy.N.managed flag; nil derives it from
+	// whether rules are set.
+	Managed *bool
+	Invalid bool
 }
 
-func parseAccessPolicies(container docker.ContainerInfo) ([]model.AccessPolicySpec, []error) {
+func (builder *accessPolicyBuilder) hasIncludes() bool {
+	return len(builder.IncludeEmails) > 0 || len(builder.IncludeEmailDomains) > 0 || len(builder.IncludeIPs) > 0 || len(builder.IncludeGroups) > 0 || len(builder.IncludeCountries) > 0 || len(builder.IncludeServiceTokens) > 0 || builder.IncludeAnyServiceToken || len(builder.IncludeCommonNames) > 0 || builder.IncludeCertificate || builder.IncludeEveryone
+}
+
+func parseAccessPolicies(container docker.ContainerInfo, policyPrefix string) ([]model.AccessPolicySpec, []error) {
 	policies := map[int]*accessPolicyBuilder{}
 	errors := []error{}
 
 	for labelKey, value := range container.Labels {
-		if !strings.HasPrefix(labelKey, AccessLabelPolicyPrefix) {
+		if !strings.HasPrefix(labelKey, policyPrefix) {
 			continue
 		}
-		remainder := strings.TrimPrefix(labelKey, AccessLabelPolicyPrefix)
+		remainder := strings.TrimPrefix(labelKey, policyPrefix)
 		parts := strings.Split(remainder, ".")
 		if len(parts) < 2 {
-			errors = append(errors, fmt.Errorf("container %s: invalid access policy label %s", container.Name, labelKey))
+			errors = append(errors, containerErrorf(container.Name, "invalid access policy label %s", labelKey))
 			continue
 		}
 
 		index, err := strconv.Atoi(parts[0])
 		if err != nil || index < 1 {
-			errors = append(errors, fmt.Errorf("container %s: invalid access policy index in %s", container.Name, labelKey))
+			errors = append(errors, containerErrorf(container.Name, "invalid access policy index in %s", labelKey))
 			continue
 		}
 		field := strings.Join(parts[1:], ".")
@@ -374,20 +1549,8 @@ func parseAccessPolicies(container docker.ContainerInfo) ([]model.AccessPolicySp
 			policies[index] = builder
 		}
 
-		trimmed := strings.TrimSpace(value)
-		switch field {
-		case "name":
-			builder.Name = trimmed
-		case "action":
-			builder.Action = strings.ToLower(trimmed)
-		case "id":
-			builder.ID = trimmed
-		case "include.emails":
-			builder.IncludeEmails = splitCommaList(trimmed)
-		case "include.ips":
-			builder.IncludeIPs = splitCommaList(trimmed)
-		default:
-			errors = append(errors, fmt.Errorf("container %s: unknown access policy label %s", container.Name, labelKey))
+		for _, fieldErr := range builder.set(field, labelKey, value) {
+			errors = append(errors, containerErrorf(container.Name, "%w", fieldErr))
 		}
 	}
 
@@ -398,48 +1561,250 @@ func parseAccessPolicies(container docker.ContainerInfo) ([]model.AccessPolicySp
 	sort.Ints(indexes)
 
 	result := make([]model.AccessPolicySpec, 0, len(indexes))
+	precedenceIndex := map[int]int{}
 	for _, index := range indexes {
-		policy := policies[index]
-		referenceOnly := policy.Action == "" && len(policy.IncludeEmails) == 0 && len(policy.IncludeIPs) == 0
-		managed := !referenceOnly
-		if referenceOnly {
-			if policy.ID == "" && policy.Name == "" {
-				errors = append(errors, fmt.Errorf("container %s: access policy %d missing id or name", container.Name, index))
+		spec, err := policies[index].build()
+		if err != nil {
+			errors = append(errors, containerErrorf(container.Name, "access policy %d %w", index, err))
+			continue
+		}
+		if spec.Precedence > 0 {
+			if other, ok := precedenceIndex[spec.Precedence]; ok {
+				errors = append(errors, containerErrorf(container.Name, "access policies %d and %d both set precedence %d", other, index, spec.Precedence))
 				continue
 			}
+			precedenceIndex[spec.Precedence] = index
 		}
-		if managed {
-			if policy.Name == "" {
-				errors = append(errors, fmt.Errorf("container %s: access policy %d missing name", container.Name, index))
-				continue
+		result = append(result, spec)
+	}
+
+	return result, errors
+}
+
+// set applies one policy field, such as include.emails, to the builder. The
+// label names the field's source in error messages.
+func (builder *accessPolicyBuilder) set(field string, label string, value string) []error {
+	errors := []error{}
+	trimmed := strings.TrimSpace(value)
+	switch field {
+	case "name":
+		builder.Name = trimmed
+	case "action":
+		builder.Action = strings.ToLower(trimmed)
+	case "id":
+		builder.ID = trimmed
+	case "managed":
+		managed, err := strconv.ParseBool(trimmed)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("invalid %s label: %w", label, err))
+			builder.Invalid = true
+			break
+		}
+		builder.Managed = &managed
+	case "precedence":
+		precedence, err := strconv.Atoi(trimmed)
+		if err != nil || precedence < 1 {
+			errors = append(errors, fmt.Errorf("%s: precedence must be a positive integer, got %q", label, trimmed))
+			builder.Invalid = true
+			break
+		}
+		builder.Precedence = precedence
+	case "include.emails":
+		builder.IncludeEmails = splitCommaList(trimmed)
+	case "include.ips":
+		builder.IncludeIPs = splitCommaList(trimmed)
+		for _, ip := range builder.IncludeIPs {
+			if err := validateIncludeIP(ip); err != nil {
+				errors = append(errors, fmt.Errorf("%s: %w", label, err))
+				builder.Invalid = true
 			}
-			switch policy.Action {
-			case "allow", "deny":
-				// valid
-			case "":
-				errors = append(errors, fmt.Errorf("container %s: access policy %d missing action", container.Name, index))
-				continue
-			default:
-				errors = append(errors, fmt.Errorf("container %s: access policy %d has invalid action %q", container.Name, index, policy.Action))
-				continue
+		}
+	case "include.email-domains":
+		builder.IncludeEmailDomains = splitCommaList(strings.ToLower(trimmed))
+		for _, domain := range builder.IncludeEmailDomains {
+			if err := validateEmailDomain(domain); err != nil {
+				errors = append(errors, fmt.Errorf("%s: %w", label, err))
+				builder.Invalid = true
 			}
-			if len(policy.IncludeEmails) == 0 && len(policy.IncludeIPs) == 0 {
-				errors = append(errors, fmt.Errorf("container %s: access policy %d has no include rules", container.Name, index))
-				continue
+		}
+	case "include.countries":
+		builder.IncludeCountries = splitCommaList(strings.ToUpper(trimmed))
+		for _, country := range builder.IncludeCountries {
+			if err := validateCountryCode(country); err != nil {
+				errors = append(errors, fmt.Errorf("%s: %w", label, err))
+				builder.Invalid = true
 			}
 		}
+	case "include.everyone":
+		everyone, err := strconv.ParseBool(trimmed)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("invalid %s label: %w", label, err))
+			builder.Invalid = true
+			break
+		}
+		builder.IncludeEveryone = everyone
+	case "require.auth-method":
+		method := strings.ToLower(trimmed)
+		if _, ok := authMethods[method]; !ok {
+			errors = append(errors, fmt.Errorf("%s: invalid auth method %q: expected a value such as mfa", label, trimmed))
+			builder.Invalid = true
+			break
+		}
+		builder.RequireAuthMethod = method
+	case "include.groups":
+		builder.IncludeGroups = splitCommaList(trimmed)
+	case "include.service-tokens":
+		builder.IncludeServiceTokens = splitCommaList(trimmed)
+	case "include.any-service-token":
+		anyServiceToken, err := strconv.ParseBool(trimmed)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("invalid %s label: %w", label, err))
+			builder.Invalid = true
+			break
+		}
+		builder.IncludeAnyServiceToken = anyServiceToken
+	case "include.common-names":
+		builder.IncludeCommonNames = splitCommaList(trimmed)
+	case "include.valid-certificate":
+		certificate, err := strconv.ParseBool(trimmed)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("invalid %s label: %w", label, err))
+			builder.Invalid = true
+			break
+		}
+		builder.IncludeCertificate = certificate
+	default:
+		errors = append(errors, fmt.Errorf("unknown access policy label %s", label))
+	}
+	return errors
+}
 
-		result = append(result, model.AccessPolicySpec{
-			ID:            policy.ID,
-			Name:          policy.Name,
-			Action:        policy.Action,
-			IncludeEmails: policy.IncludeEmails,
-			IncludeIPs:    policy.IncludeIPs,
-			Managed:       managed,
-		})
+// build validates the collected fields and returns the policy spec. Errors
+// describe the problem relative to the policy, e.g. "missing action".
+//
+// A policy is managed, so its rules and name are kept in sync, when it sets an
+// action or rules; one with only an id or a name is a reference-only. The
+// policy.N.managed flag overrides this: false keeps a policy with rules
+// reference-only, and true with an id manages the policy by id, so its name
+// may be omitted to keep the name it has in Cloudflare.
+func (builder *accessPolicyBuilder) build() (model.AccessPolicySpec, error) {
+	if builder.Invalid {
+		return model.AccessPolicySpec{}, fmt.Errorf("has invalid include rules; skipping")
+	}
+	hasRules := builder.Action != "" || builder.hasIncludes() || builder.RequireAuthMethod != ""
+	referenceOnly := !hasRules
+	if builder.Managed != nil {
+		if *builder.Managed && !hasRules {
+			return model.AccessPolicySpec{}, fmt.Errorf("sets managed=true without an action and include rules")
+		}
+		referenceOnly = !*builder.Managed
+	}
+	if referenceOnly && builder.ID == "" && builder.Name == "" {
+		return model.AccessPolicySpec{}, fmt.Errorf("missing id or name")
+	}
+	includeEveryone := builder.IncludeEveryone
+	if !referenceOnly {
+		managedByID := builder.Managed != nil && builder.ID != ""
+		if builder.Name == "" && !managedByID {
+			return model.AccessPolicySpec{}, fmt.Errorf("missing name")
+		}
+		switch builder.Action {
+		case "allow", "deny", "non_identity", "bypass":
+			// valid
+		case "":
+			return model.AccessPolicySpec{}, fmt.Errorf("missing action")
+		default:
+			return model.AccessPolicySpec{}, fmt.Errorf("has invalid action %q", builder.Action)
+		}
+		if !builder.hasIncludes() && builder.RequireAuthMethod != "" {
+			// Require rules only narrow an include, so apply them to everyone.
+			includeEveryone = true
+		}
+		if !builder.hasIncludes() && !includeEveryone {
+			return model.AccessPolicySpec{}, fmt.Errorf("has no include rules")
+		}
 	}
 
-	return result, errors
+	return model.AccessPolicySpec{
+		ID:                     builder.ID,
+		Name:                   builder.Name,
+		Action:                 builder.Action,
+		IncludeEmails:          builder.IncludeEmails,
+		IncludeIPs:             builder.IncludeIPs,
+		IncludeGroups:          builder.IncludeGroups,
+		IncludeEmailDomains:    builder.IncludeEmailDomains,
+		IncludeCountries:       builder.IncludeCountries,
+		IncludeServiceTokens:   builder.IncludeServiceTokens,
+		IncludeAnyServiceToken: builder.IncludeAnyServiceToken,
+		IncludeCommonNames:     builder.IncludeCommonNames,
+		IncludeCertificate:     builder.IncludeCertificate,
+		IncludeEveryone:        includeEveryone,
+		RequireAuthMethod:      builder.RequireAuthMethod,
+		Precedence:             builder.Precedence,
+		Managed:                !referenceOnly,
+	}, nil
+}
+
+// aliasedLabel looks up a label that may be spelled two ways. It returns the
+// label name that was set, and an error when both are set to different values.
+func aliasedLabel(container docker.ContainerInfo, primary string, alias string) (string, string, bool, error) {
+	primaryValue, hasPrimary := container.Labels[primary]
+	aliasValue, hasAlias := container.Labels[alias]
+	if hasPrimary && hasAlias && strings.TrimSpace(primaryValue) != strings.TrimSpace(aliasValue) {
+		return "", "", false, containerErrorf(container.Name, "%s and %s are both set with different values", primary, alias)
+	}
+	if hasPrimary {
+		return primary, primaryValue, true, nil
+	}
+	return alias, aliasValue, hasAlias, nil
+}
+
+// validateAbsoluteURL accepts http and https URLs with a host.
+func validateAbsoluteURL(value string) error {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("expected an absolute http(s) URL, got %q", value)
+	}
+	return nil
+}
+
+// validateIncludeIP requires CIDR notation because Cloudflare rejects bare IPs
+// in Access ip rules with an opaque error.
+func validateIncludeIP(value string) error {
+	if _, _, err := net.ParseCIDR(value); err == nil {
+		return nil
+	}
+	if net.ParseIP(value) != nil {
+		return fmt.Errorf("invalid include IP %q: expected CIDR notation", value)
+	}
+	return fmt.Errorf("invalid include IP %q: not an IP address or CIDR range", value)
+}
+
+// validateEmailDomain requires a bare domain such as example.com, which is
+// what Access email_domain rules match against.
+func validateEmailDomain(value string) error {
+	if strings.Contains(value, "@") {
+		return fmt.Errorf("invalid include email domain %q: use the bare domain without @", value)
+	}
+	if strings.Contains(value, "://") || strings.Contains(value, "/") {
+		return fmt.Errorf("invalid include email domain %q: use the bare domain without scheme or path", value)
+	}
+	if !emailDomainPattern.MatchString(value) {
+		return fmt.Errorf("invalid include email domain %q: expected a domain such as example.com", value)
+	}
+	return nil
+}
+
+// validateCountryCode requires an ISO 3166-1 alpha-2 code such as FR, which is
+// what Access geo rules match against.
+func validateCountryCode(value string) error {
+	if _, ok := countryCodes[value]; !ok {
+		return fmt.Errorf("invalid include country %q: expected an ISO 3166-1 alpha-2 code such as FR", value)
+	}
+	return nil
 }
 
 func splitCommaList(value string) []string {
@@ -1,10 +1,12 @@
 package labels
 
 import (
+	"maps"
 	"strings"
 	"testing"
 
 	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/docker"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/model"
 )
 
 func TestParseContainers(t *testing.T) {
@@ -55,6 +57,76 @@ func TestParseContainers(t *testing.T) {
 	}
 }
 
+func TestParseContainersLowercasesHostnames(t *testing.T) {
+	containers := []docker.ContainerInfo{
+		{
+			ID:   "a",
+			Name: "app",
+			Labels: map[string]string{
+				LabelEnable:             "true",
+				LabelHost:               "App.Example.COM",
+				LabelService:            "http://app",
+				LabelHost + ".admin":    "Admin.Example.com",
+				LabelService + ".admin": "http://admin",
+			},
+		},
+	}
+
+	routes, errs := NewParser().ParseContainers(containers)
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got %v", errs)
+	}
+	if len(routes) != 2 || routes[0].Key.Hostname != "app.example.com" || routes[1].Key.Hostname != "admin.example.com" {
+		t.Fatalf("expected lowercase hostnames, got %+v", routes)
+	}
+}
+
+func TestParseContainersExpandsHostnamesList(t *testing.T) {
+	containers := []docker.ContainerInfo{
+		{
+			ID:   "a",
+			Name: "web",
+			Labels: map[string]string{
+				LabelEnable:            "true",
+				LabelHost:              "web.example.com",
+				LabelHosts:             "www.example.com, WEB.example.com, example.com",
+				LabelService:           "https://web:443",
+				LabelOriginNoTLSVerify: "true",
+			},
+		},
+		{
+			ID:   "b",
+			Name: "other",
+			Labels: map[string]string{
+				LabelEnable:  "true",
+				LabelHosts:   "other.example.com,www.example.com",
+				LabelService: "http://other",
+			},
+		},
+	}
+
+	routes, errs := NewParser().ParseContainers(containers)
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	assertContains(t, messages, "duplicate route definition for www.example.com")
+	if len(errs) != 1 {
+		t.Fatalf("expected only the cross-container duplicate, got %v", errs)
+	}
+
+	hostnames := []string{}
+	for _, route := range routes {
+		if route.Source.ContainerName == "web" && (route.Service != "https://web:443" || route.NoTLSVerify == nil || !*route.NoTLSVerify) {
+			t.Fatalf("expected every hostname to share the service and origin settings, got %+v", route)
+		}
+		hostnames = append(hostnames, route.Key.Hostname)
+	}
+	if strings.Join(hostnames, ",") != "web.example.com,www.example.com,example.com,other.example.com" {
+		t.Fatalf("unexpected hostnames: %v", hostnames)
+	}
+}
+
 func TestParseContainersWithOriginLabels(t *testing.T) {
 	parser := NewParser()
 
@@ -68,6 +140,8 @@ func TestParseContainersWithOriginLabels(t *testing.T) {
 				LabelService:           "https://app:443",
 				LabelOriginServerName:  "app.internal",
 				LabelOriginNoTLSVerify: "true",
+				LabelOriginCAPool:      "/etc/cloudflared/origin-ca.pem",
+				LabelDNSProxied:        "false",
 			},
 		},
 	}
@@ -86,6 +160,53 @@ func TestParseContainersWithOriginLabels(t *testing.T) {
 	if route.NoTLSVerify == nil || !*route.NoTLSVerify {
 		t.Fatalf("expected no TLS verify to be true, got %+v", route.NoTLSVerify)
 	}
+	if route.CAPool == nil || *route.CAPool != "/etc/cloudflared/origin-ca.pem" {
+		t.Fatalf("expected CA pool to be set, got %+v", route.CAPool)
+	}
+	if route.DNSProxied == nil || *route.DNSProxied {
+		t.Fatalf("expected DNS proxied to be false, got %+v", route.DNSProxied)
+	}
+}
+
+func TestParseContainersDNSCommentLabel(t *testing.T) {
+	parser := NewParser()
+
+	containers := []docker.ContainerInfo{
+		{
+			ID:   "1",
+			Name: "noted",
+			Labels: map[string]string{
+				LabelEnable:                "true",
+				LabelHost:                  "app.example.com",
+				LabelService:               "http://app",
+				LabelDNSComment:            "  owned by the media team ",
+				LabelHost + ".admin":       "admin.example.com",
+				LabelService + ".admin":    "http://app:9000",
+				LabelDNSComment + ".admin": "",
+			},
+		},
+		{
+			ID:     "2",
+			Name:   "multiline",
+			Labels: map[string]string{LabelEnable: "true", LabelHost: "bad.example.com", LabelService: "http://bad", LabelDNSComment: "first\nsecond"},
+		},
+	}
+
+	routes, errs := parser.ParseContainers(containers)
+	if len(errs) != 1 {
+		t.Fatalf("expected one error, got %v", errs)
+	}
+	assertContains(t, []string{errs[0].Error()}, "invalid "+LabelDNSComment+" label: must be a single line")
+	comments := map[string]*string{}
+	for _, route := range routes {
+		comments[route.Key.Hostname] = route.DNSComment
+	}
+	if comment := comments["app.example.com"]; comment == nil || *comment != "owned by the media team" {
+		t.Fatalf("expected the trimmed comment on the base route, got %v", comment)
+	}
+	if comment := comments["admin.example.com"]; comment == nil || *comment != "" {
+		t.Fatalf("expected an empty comment on the suffix route, got %v", comment)
+	}
 }
 
 func TestParseContainersWithSuffixRoutes(t *testing.T) {
@@ -141,6 +262,145 @@ func TestParseContainersWithSuffixRoutes(t *testing.T) {
 	}
 }
 
+func TestParseContainersSuffixRoutesInheritOrigin(t *testing.T) {
+	parser := NewParser()
+
+	baseLabels := map[string]string{
+		LabelEnable:                     "true",
+		LabelHost:                       "app.example.com",
+		LabelService:                    "https://app:8443",
+		LabelOriginServerName:           "app.internal",
+		LabelOriginNoTLSVerify:          "true",
+		LabelOriginRaw:                  `{"connectTimeout":"30s","http2Origin":true}`,
+		LabelHost + ".admin":            "admin.example.com",
+		LabelService + ".admin":         "https://app:9443",
+		LabelHost + ".api":              "api.example.com",
+		LabelService + ".api":           "https://app:7443",
+		LabelOriginServerName + ".api":  "api.internal",
+		LabelOriginNoTLSVerify + ".api": "false",
+		LabelOriginRaw + ".api":         `{"http2Origin":false}`,
+	}
+
+	routes, errs := parser.ParseContainers([]docker.ContainerInfo{{ID: "1", Name: "app", Labels: baseLabels}})
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got %v", errs)
+	}
+	if routes[1].OriginServerName != nil || routes[1].NoTLSVerify != nil || routes[1].OriginRaw != nil {
+		t.Fatalf("expected suffix routes not to inherit without %s, got %+v", LabelOriginInherit, routes[1])
+	}
+
+	inheritLabels := maps.Clone(baseLabels)
+	inheritLabels[LabelOriginInherit] = "true"
+	routes, errs = parser.ParseContainers([]docker.ContainerInfo{{ID: "1", Name: "app", Labels: inheritLabels}})
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got %v", errs)
+	}
+	if len(routes) != 3 {
+		t.Fatalf("expected 3 routes, got %d", len(routes))
+	}
+
+	admin := routes[1]
+	if admin.Key.Hostname != "admin.example.com" {
+		t.Fatalf("expected admin route second, got %s", admin.Key)
+	}
+	if admin.OriginServerName == nil || *admin.OriginServerName != "app.internal" {
+		t.Fatalf("expected admin to inherit the origin server name, got %+v", admin.OriginServerName)
+	}
+	if admin.NoTLSVerify == nil || !*admin.NoTLSVerify {
+		t.Fatalf("expected admin to inherit no TLS verify, got %+v", admin.NoTLSVerify)
+	}
+	if admin.OriginRaw["connectTimeout"] != "30s" || admin.OriginRaw["http2Origin"] != true {
+		t.Fatalf("expected admin to inherit origin.raw, got %+v", admin.OriginRaw)
+	}
+
+	api := routes[2]
+	if api.OriginServerName == nil || *api.OriginServerName != "api.internal" {
+		t.Fatalf("expected api origin server name override, got %+v", api.OriginServerName)
+	}
+	if api.NoTLSVerify == nil || *api.NoTLSVerify {
+		t.Fatalf("expected explicit false to override the inherited no TLS verify, got %+v", api.NoTLSVerify)
+	}
+	if api.OriginRaw["connectTimeout"] != "30s" || api.OriginRaw["http2Origin"] != false {
+		t.Fatalf("expected api origin.raw keys to override inherited ones, got %+v", api.OriginRaw)
+	}
+	if routes[0].OriginRaw["http2Origin"] != true {
+		t.Fatalf("expected base origin.raw to stay untouched, got %+v", routes[0].OriginRaw)
+	}
+
+	inheritLabels[LabelOriginInherit] = "sometimes"
+	_, errs = parser.ParseContainers([]docker.ContainerInfo{{ID: "1", Name: "app", Labels: inheritLabels}})
+	if len(errs) != 1 {
+		t.Fatalf("expected one error, got %v", errs)
+	}
+	assertContains(t, []string{errs[0].Error()}, "invalid "+LabelOriginInherit+" label")
+}
+
+func TestParseContainersAssignsTunnels(t *testing.T) {
+	parser := NewParserWithSharedPolicies(nil, []string{"lab", "prod"})
+
+	containers := []docker.ContainerInfo{
+		{
+			ID:   "1",
+			Name: "app",
+			Labels: map[string]string{
+				LabelEnable:                 "true",
+				LabelHost:                   "app.example.com",
+				LabelService:                "http://app",
+				LabelTunnelName:             "Lab",
+				LabelHost + ".admin":        "admin.example.com",
+				LabelService + ".admin":     "http://app:9000",
+				LabelHost + ".public":       "public.example.com",
+				LabelService + ".public":    "http://app:8000",
+				LabelTunnelName + ".public": "prod",
+				LabelHost + ".typo":         "typo.example.com",
+				LabelService + ".typo":      "http://app:7000",
+				LabelTunnelName + ".typo":   "staging",
+			},
+		},
+		{
+			ID:     "2",
+			Name:   "default",
+			Labels: map[string]string{LabelEnable: "true", LabelHost: "default.example.com", LabelService: "http://default"},
+		},
+		{
+			ID:     "3",
+			Name:   "lab-fallback",
+			Labels: map[string]string{LabelEnable: "true", LabelService: "http://maintenance", LabelFallback: "true", LabelTunnelName: "lab"},
+		},
+		{
+			ID:     "4",
+			Name:   "fallback",
+			Labels: map[string]string{LabelEnable: "true", LabelService: "http://maintenance", LabelFallback: "true"},
+		},
+	}
+
+	routes, errs := parser.ParseContainers(containers)
+	if len(errs) != 1 {
+		t.Fatalf("expected one error, got %v", errs)
+	}
+	assertContains(t, []string{errs[0].Error()}, LabelTunnelName+`.typo "staging" is not a tunnel listed in CF_TUNNEL_IDS`)
+
+	tunnels := map[string]string{}
+	fallbacks := map[string]string{}
+	for _, route := range routes {
+		if route.Fallback {
+			fallbacks[route.Tunnel] = route.Source.ContainerName
+			continue
+		}
+		tunnels[route.Key.Hostname] = route.Tunnel
+	}
+	want := map[string]string{"app.example.com": "lab", "admin.example.com": "lab", "public.example.com": "prod", "default.example.com": ""}
+	if !maps.Equal(tunnels, want) {
+		t.Fatalf("expected tunnels %v, got %v", want, tunnels)
+	}
+	if fallbacks["lab"] != "lab-fallback" || fallbacks[""] != "fallback" {
+		t.Fatalf("expected one fallback per tunnel, got %v", fallbacks)
+	}
+
+	_, errs = NewParser().ParseContainers(containers[:1])
+	assertContains(t, []string{errs[0].Error()}, LabelTunnelName+` "lab" is not a tunnel listed in CF_TUNNEL_IDS`)
+}
+
 func TestParseContainersWithDNSZoneOverride(t *testing.T) {
 	parser := NewParser()
 
@@ -203,6 +463,105 @@ func TestParseContainersWithSuffixDNSZoneOverride(t *testing.T) {
 	}
 }
 
+func TestParseContainersWithUnixSocketServices(t *testing.T) {
+	parser := NewParser()
+
+	containers := []docker.ContainerInfo{
+		{
+			ID:   "1",
+			Name: "http-app",
+			Labels: map[string]string{
+				LabelEnable:  "true",
+				LabelHost:    "app.example.com",
+				LabelService: "http://app:8080",
+			},
+		},
+		{
+			ID:   "2",
+			Name: "unix-app",
+			Labels: map[string]string{
+				LabelEnable:                "true",
+				LabelHost:                  "socket.example.com",
+				LabelService:               "unix:/var/run/app.sock",
+				LabelHost + ".secure":      "secure-socket.example.com",
+				LabelService + ".secure":   "unix+tls:/var/run/app-tls.sock",
+				LabelHost + ".relative":    "relative-socket.example.com",
+				LabelService + ".relative": "unix:run/app.sock",
+			},
+		},
+	}
+
+	routes, errs := parser.ParseContainers(containers)
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %d: %v", len(errs), errs)
+	}
+	assertContains(t, []string{errs[0].Error()}, LabelService+".relative unix socket path must be absolute")
+	if len(routes) != 3 {
+		t.Fatalf("expected 3 routes, got %d", len(routes))
+	}
+	if routes[0].Service != "http://app:8080" {
+		t.Fatalf("expected http service to be preserved, got %s", routes[0].Service)
+	}
+	if routes[1].Service != "unix:/var/run/app.sock" {
+		t.Fatalf("expected unix service to be preserved verbatim, got %s", routes[1].Service)
+	}
+	if routes[2].Service != "unix+tls:/var/run/app-tls.sock" {
+		t.Fatalf("expected unix+tls service to be preserved verbatim, got %s", routes[2].Service)
+	}
+}
+
+func TestParseContainersFallbackRoute(t *testing.T) {
+	parser := NewParser()
+
+	containers := []docker.ContainerInfo{
+		{
+			ID:   "b",
+			Name: "maintenance-b",
+			Labels: map[string]string{
+				LabelEnable:   "true",
+				LabelFallback: "true",
+				LabelService:  "http://maintenance-b:80",
+			},
+		},
+		{
+			ID:   "a",
+			Name: "maintenance-a",
+			Labels: map[string]string{
+				LabelEnable:   "true",
+				LabelFallback: "true",
+				LabelService:  "http://maintenance-a:80",
+			},
+		},
+		{
+			ID:   "c",
+			Name: "app",
+			Labels: map[string]string{
+				LabelEnable:  "true",
+				LabelHost:    "app.example.com",
+				LabelService: "http://app:8080",
+			},
+		},
+	}
+
+	routes, errs := parser.ParseContainers(containers)
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %d: %v", len(errs), errs)
+	}
+	assertContains(t, []string{errs[0].Error()}, "keeping maintenance-a as fallback")
+	if labelErrors, warnings := SplitWarnings(errs); len(labelErrors) != 0 || len(warnings) != 1 {
+		t.Fatalf("expected the second fallback claimant to be a warning, got errors %v and warnings %v", labelErrors, warnings)
+	}
+	if len(routes) != 2 {
+		t.Fatalf("expected 2 routes, got %d", len(routes))
+	}
+	if !routes[0].Fallback || routes[0].Service != "http://maintenance-a:80" || routes[0].Key.Hostname != "" {
+		t.Fatalf("expected lowest container ID to be the fallback, got %+v", routes[0])
+	}
+	if routes[1].Fallback {
+		t.Fatalf("expected regular route not to be a fallback, got %+v", routes[1])
+	}
+}
+
 func TestParseContainersMissingSuffixService(t *testing.T) {
 	parser := NewParser()
 
@@ -331,18 +690,141 @@ func TestParseContainersOriginLabelsValidationErrors(t *testing.T) {
 				LabelOriginNoTLSVerify: "notabool",
 			},
 		},
+		{
+			ID:   "3",
+			Name: "empty-ca-pool",
+			Labels: map[string]string{
+				LabelEnable:       "true",
+				LabelHost:         "app3.example.com",
+				LabelService:      "https://app3:443",
+				LabelOriginCAPool: "",
+			},
+		},
+		{
+			ID:   "4",
+			Name: "raw-not-object",
+			Labels: map[string]string{
+				LabelEnable:    "true",
+				LabelHost:      "app4.example.com",
+				LabelService:   "https://app4:443",
+				LabelOriginRaw: `["connectTimeout"]`,
+			},
+		},
+		{
+			ID:   "5",
+			Name: "raw-dedicated-key",
+			Labels: map[string]string{
+				LabelEnable:    "true",
+				LabelHost:      "app5.example.com",
+				LabelService:   "https://app5:443",
+				LabelOriginRaw: `{"noTLSVerify":true}`,
+			},
+		},
 	}
 
 	routes, errs := parser.ParseContainers(containers)
 	if len(routes) != 0 {
 		t.Fatalf("expected no routes, got %d", len(routes))
 	}
-	if len(errs) != 2 {
-		t.Fatalf("expected 2 errors, got %d: %v", len(errs), errs)
+	if len(errs) != 5 {
+		t.Fatalf("expected 5 errors, got %d: %v", len(errs), errs)
+	}
+	messages := []string{}
+	for _, err := range errs {
+		messages = append(messages, err.Error())
 	}
-	messages := []string{errs[0].Error(), errs[1].Error()}
 	assertContains(t, messages, LabelOriginServerName+" cannot be empty")
 	assertContains(t, messages, "invalid "+LabelOriginNoTLSVerify+" label")
+	assertContains(t, messages, LabelOriginCAPool+" cannot be empty")
+	assertContains(t, messages, LabelOriginRaw+" must be a JSON object")
+	assertContains(t, messages, LabelOriginRaw+" cannot set noTLSVerify; use "+LabelOriginNoTLSVerify)
+}
+
+func TestParseContainersWithProxyOriginLabels(t *testing.T) {
+	parser := NewParser()
+
+	routes, errs := parser.ParseContainers([]docker.ContainerInfo{
+		{
+			ID:   "1",
+			Name: "bastion",
+			Labels: map[string]string{
+				LabelEnable:                     "true",
+				LabelHost:                       "ssh.example.com",
+				LabelService:                    "ssh://bastion:22",
+				LabelOriginProxyType:            "SOCKS",
+				LabelOriginProxyAddr:            "127.0.0.1",
+				LabelOriginProxyPort:            "1080",
+				LabelOriginBastionMode:          "true",
+				LabelHost + ".web":              "web.example.com",
+				LabelService + ".web":           "http://bastion:80",
+				LabelOriginProxyType + ".web":   "http",
+				LabelOriginBastionMode + ".web": "false",
+			},
+		},
+	})
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got %v", errs)
+	}
+	base := routes[0]
+	if base.ProxyType == nil || *base.ProxyType != "socks" || base.ProxyAddress == nil || *base.ProxyAddress != "127.0.0.1" {
+		t.Fatalf("expected socks proxy on 127.0.0.1, got %+v", base)
+	}
+	if base.ProxyPort == nil || *base.ProxyPort != 1080 || base.BastionMode == nil || !*base.BastionMode {
+		t.Fatalf("expected bastion mode on port 1080, got %+v", base)
+	}
+	web := routes[1]
+	if web.ProxyType == nil || *web.ProxyType != "" || web.BastionMode == nil || *web.BastionMode || web.ProxyPort != nil {
+		t.Fatalf("expected an HTTP proxy without bastion mode on the suffix route, got %+v", web)
+	}
+
+	_, errs = parser.ParseContainers([]docker.ContainerInfo{
+		{ID: "2", Name: "bad-type", Labels: map[string]string{LabelEnable: "true", LabelHost: "a.example.com", LabelService: "http://a", LabelOriginProxyType: "socks4"}},
+		{ID: "3", Name: "bad-address", Labels: map[string]string{LabelEnable: "true", LabelHost: "b.example.com", LabelService: "http://b", LabelOriginProxyAddr: "localhost"}},
+		{ID: "4", Name: "bad-port", Labels: map[string]string{LabelEnable: "true", LabelHost: "c.example.com", LabelService: "http://c", LabelOriginProxyPort: "70000"}},
+		{ID: "5", Name: "bad-bastion", Labels: map[string]string{LabelEnable: "true", LabelHost: "d.example.com", LabelService: "http://d", LabelOriginBastionMode: "yes please"}},
+		{ID: "6", Name: "raw-proxy", Labels: map[string]string{LabelEnable: "true", LabelHost: "e.example.com", LabelService: "http://e", LabelOriginRaw: `{"proxyPort":1080}`}},
+	})
+	messages := []string{}
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	assertContains(t, messages, `invalid `+LabelOriginProxyType+` label "socks4": expected http or socks`)
+	assertContains(t, messages, `invalid `+LabelOriginProxyAddr+` label "localhost": expected an IP address`)
+	assertContains(t, messages, `invalid `+LabelOriginProxyPort+` label "70000"`)
+	assertContains(t, messages, "invalid "+LabelOriginBastionMode+" label")
+	assertContains(t, messages, LabelOriginRaw+" cannot set proxyPort; use "+LabelOriginProxyPort)
+}
+
+func TestParseContainersWithOriginRawLabel(t *testing.T) {
+	parser := NewParser()
+
+	routes, errs := parser.ParseContainers([]docker.ContainerInfo{
+		{
+			ID:   "1",
+			Name: "raw-origin",
+			Labels: map[string]string{
+				LabelEnable:             "true",
+				LabelHost:               "app.example.com",
+				LabelService:            "https://app:443",
+				LabelOriginRaw:          `{"connectTimeout":"30s","http2Origin":true}`,
+				LabelHost + ".api":      "api.example.com",
+				LabelService + ".api":   "http://api:8080",
+				LabelOriginRaw + ".api": `{"httpHostHeader":"api.internal"}`,
+			},
+		},
+	})
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got %v", errs)
+	}
+	if len(routes) != 2 {
+		t.Fatalf("expected 2 routes, got %d", len(routes))
+	}
+	if routes[0].OriginRaw["connectTimeout"] != "30s" || routes[0].OriginRaw["http2Origin"] != true {
+		t.Fatalf("unexpected raw origin keys for base route: %+v", routes[0].OriginRaw)
+	}
+	if len(routes[1].OriginRaw) != 1 || routes[1].OriginRaw["httpHostHeader"] != "api.internal" {
+		t.Fatalf("unexpected raw origin keys for suffix route: %+v", routes[1].OriginRaw)
+	}
 }
 
 func TestParseContainersValidationErrors(t *testing.T) {
@@ -458,35 +940,871 @@ func TestParseAccessContainers(t *testing.T) {
 	}
 }
 
-func TestParseAccessContainersIDOnlyPolicy(t *testing.T) {
+func TestParseAccessContainersAppLauncherVisible(t *testing.T) {
 	parser := NewParser()
 
 	containers := []docker.ContainerInfo{
 		{
 			ID:   "1",
-			Name: "access-app",
+			Name: "launcher-visible",
 			Labels: map[string]string{
 				AccessLabelEnable:                "true",
-				AccessLabelAppName:               "id-only",
-				AccessLabelAppDomain:             "id-only.example.com",
+				AccessLabelAppName:               "visible",
+				AccessLabelAppDomain:             "visible.example.com",
+				AccessLabelAppLauncher:           "false",
+				AccessLabelAppLogoURL:            "https://example.com/logo.png",
 				AccessLabelPolicyPrefix + "1.id": "policy-id",
 			},
 		},
+		{
+			ID:   "2",
+			Name: "launcher-unset",
+			Labels: map[string]string{
+				AccessLabelEnable:                "true",
+				AccessLabelAppName:               "unset",
+				AccessLabelAppDomain:             "unset.example.com",
+				AccessLabelPolicyPrefix + "1.id": "policy-id",
+			},
+		},
+		{
+			ID:   "3",
+			Name: "launcher-invalid",
+			Labels: map[string]string{
+				AccessLabelEnable:                "true",
+				AccessLabelAppName:               "invalid",
+				AccessLabelAppDomain:             "invalid.example.com",
+				AccessLabelAppLauncher:           "sometimes",
+				AccessLabelPolicyPrefix + "1.id": "policy-id",
+			},
+		},
+		{
+			ID:   "4",
+			Name: "logo-invalid",
+			Labels: map[string]string{
+				AccessLabelEnable:                "true",
+				AccessLabelAppName:               "logo",
+				AccessLabelAppDomain:             "logo.example.com",
+				AccessLabelAppLogoURL:            "logo.png",
+				AccessLabelPolicyPrefix + "1.id": "policy-id",
+			},
+		},
+	}
+
+	apps, errs := parser.ParseAccessContainers(containers)
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %d: %v", len(errs), errs)
+	}
+	messages := []string{errs[0].Error(), errs[1].Error()}
+	assertContains(t, messages, "invalid "+AccessLabelAppLauncher+" label")
+	assertContains(t, messages, "invalid "+AccessLabelAppLogoURL+" label")
+	if len(apps) != 2 {
+		t.Fatalf("expected 2 apps, got %d", len(apps))
+	}
+	if apps[0].Name != "unset" || apps[0].AppLauncherVisible != nil {
+		t.Fatalf("expected unset app launcher visibility to stay nil, got %+v", apps[0])
+	}
+	if apps[1].Name != "visible" || apps[1].AppLauncherVisible == nil || *apps[1].AppLauncherVisible {
+		t.Fatalf("expected app launcher visibility to be false, got %+v", apps[1])
+	}
+	if apps[1].LogoURL == nil || *apps[1].LogoURL != "https://example.com/logo.png" {
+		t.Fatalf("expected logo URL to be set, got %+v", apps[1].LogoURL)
+	}
+}
+
+func TestParseAccessContainersAllowedIdPs(t *testing.T) {
+	parser := NewParser()
+
+	containers := []docker.ContainerInfo{
+		{
+			ID:   "1",
+			Name: "idps",
+			Labels: map[string]string{
+				AccessLabelEnable:                "true",
+				AccessLabelAppName:               "idps",
+				AccessLabelAppDomain:             "idps.example.com",
+				AccessLabelAppIdPs:               "Google, GitHub",
+				AccessLabelPolicyPrefix + "1.id": "policy-id",
+			},
+		},
+		{
+			ID:   "2",
+			Name: "idps-empty",
+			Labels: map[string]string{
+				AccessLabelEnable:                "true",
+				AccessLabelAppName:               "empty",
+				AccessLabelAppDomain:             "empty.example.com",
+				AccessLabelAppIdPs:               " , ",
+				AccessLabelPolicyPrefix + "1.id": "policy-id",
+			},
+		},
+	}
+
+	apps, errs := parser.ParseAccessContainers(containers)
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %d: %v", len(errs), errs)
+	}
+	assertContains(t, []string{errs[0].Error()}, AccessLabelAppIdPs+" cannot be empty")
+	if len(apps) != 1 {
+		t.Fatalf("expected 1 app, got %d", len(apps))
+	}
+	if len(apps[0].AllowedIdPs) != 2 || apps[0].AllowedIdPs[0] != "Google" || apps[0].AllowedIdPs[1] != "GitHub" {
+		t.Fatalf("unexpected allowed IdPs: %+v", apps[0].AllowedIdPs)
+	}
+}
+
+func TestParseAccessContainersCustomPages(t *testing.T) {
+	parser := NewParser()
+
+	containers := []docker.ContainerInfo{
+		{
+			ID:   "1",
+			Name: "pages",
+			Labels: map[string]string{
+				AccessLabelEnable:                "true",
+				AccessLabelAppName:               "pages",
+				AccessLabelAppDomain:             "pages.example.com",
+				AccessLabelAppCustomPages:        "Branded denied, page-uid",
+				AccessLabelPolicyPrefix + "1.id": "policy-id",
+			},
+		},
+		{
+			ID:   "2",
+			Name: "pages-empty",
+			Labels: map[string]string{
+				AccessLabelEnable:                "true",
+				AccessLabelAppName:               "empty",
+				AccessLabelAppDomain:             "empty.example.com",
+				AccessLabelAppCustomPages:        " , ",
+				AccessLabelPolicyPrefix + "1.id": "policy-id",
+			},
+		},
+	}
+
+	apps, errs := parser.ParseAccessContainers(containers)
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %d: %v", len(errs), errs)
+	}
+	assertContains(t, []string{errs[0].Error()}, AccessLabelAppCustomPages+" cannot be empty")
+	if len(apps) != 1 || strings.Join(apps[0].CustomPages, ",") != "Branded denied,page-uid" {
+		t.Fatalf("unexpected custom pages: %+v", apps)
+	}
+}
+
+func TestParseAccessContainersCORSSettings(t *testing.T) {
+	parser := NewParser()
+
+	app := func(id string, labels map[string]string) docker.ContainerInfo {
+		merged := map[string]string{
+			AccessLabelEnable:                "true",
+			AccessLabelAppName:               "cors-" + id,
+			AccessLabelAppDomain:             "cors-" + id + ".example.com",
+			AccessLabelPolicyPrefix + "1.id": "policy-id",
+		}
+		for key, value := range labels {
+			merged[key] = value
+		}
+		return docker.ContainerInfo{ID: id, Name: "cors-" + id, Labels: merged}
+	}
+	containers := []docker.ContainerInfo{
+		app("1", map[string]string{
+			AccessLabelAppCORSOrigins:     "https://spa.example.com",
+			AccessLabelAppCORSMethods:     "get, post",
+			AccessLabelAppCORSCredentials: "true",
+			AccessLabelAppCORSMaxAge:      "600",
+		}),
+		app("2", map[string]string{
+			AccessLabelAppCORSOrigins: "*",
+		}),
+		app("3", nil),
+		app("4", map[string]string{
+			AccessLabelAppCORSCredentials: "true",
+		}),
+		app("5", map[string]string{
+			AccessLabelAppCORSMethods: "GET,FETCH",
+		}),
+		app("6", map[string]string{
+			AccessLabelAppCORSMaxAge: "forever",
+		}),
+	}
+
+	apps, errs := parser.ParseAccessContainers(containers)
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	assertContains(t, messages, "container cors-4: "+AccessLabelAppCORSCredentials+" requires explicit "+AccessLabelAppCORSOrigins)
+	assertContains(t, messages, `container cors-5: invalid `+AccessLabelAppCORSMethods+` method "FETCH"`)
+	assertContains(t, messages, `container cors-6: invalid `+AccessLabelAppCORSMaxAge+` label "forever"`)
+	if len(apps) != 3 {
+		t.Fatalf("expected 3 apps, got %+v", apps)
+	}
+
+	cors := apps[0].CORS
+	if cors == nil || strings.Join(cors.AllowedOrigins, ",") != "https://spa.example.com" || strings.Join(cors.AllowedMethods, ",") != "GET,POST" {
+		t.Fatalf("unexpected CORS settings: %+v", cors)
+	}
+	if !cors.AllowCredentials || cors.MaxAge != 600 || cors.AllowAllOrigins || cors.AllowAllMethods || !cors.AllowAllHeaders {
+		t.Fatalf("unexpected CORS flags: %+v", cors)
+	}
+	if partial := apps[1].CORS; partial == nil || !partial.AllowAllOrigins || !partial.AllowAllMethods || !partial.AllowAllHeaders {
+		t.Fatalf("expected partial CORS settings to allow all, got %+v", partial)
+	}
+	if apps[2].CORS != nil {
+		t.Fatalf("expected no CORS settings without labels, got %+v", apps[2].CORS)
+	}
+}
+
+func TestParseAccessContainersDenyAndRedirectSettings(t *testing.T) {
+	parser := NewParser()
+
+	containers := []docker.ContainerInfo{
+		{
+			ID:   "1",
+			Name: "deny",
+			Labels: map[string]string{
+				AccessLabelEnable:                "true",
+				AccessLabelAppName:               "deny",
+				AccessLabelAppDomain:             "deny.example.com",
+				AccessLabelAppDenyMsg:            " Contact IT for access. ",
+				AccessLabelAppDenyURL:            "https://example.com/denied",
+				AccessLabelAppRedirect:           "true",
+				AccessLabelPolicyPrefix + "1.id": "policy-id",
+			},
+		},
+		{
+			ID:   "2",
+			Name: "deny-invalid",
+			Labels: map[string]string{
+				AccessLabelEnable:                "true",
+				AccessLabelAppName:               "invalid",
+				AccessLabelAppDomain:             "invalid.example.com",
+				AccessLabelAppDenyURL:            "/denied",
+				AccessLabelPolicyPrefix + "1.id": "policy-id",
+			},
+		},
+		{
+			ID:   "3",
+			Name: "redirect-invalid",
+			Labels: map[string]string{
+				AccessLabelEnable:                "true",
+				AccessLabelAppName:               "redirect",
+				AccessLabelAppDomain:             "redirect.example.com",
+				AccessLabelAppRedirect:           "always",
+				AccessLabelPolicyPrefix + "1.id": "policy-id",
+			},
+		},
+	}
+
+	apps, errs := parser.ParseAccessContainers(containers)
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %d: %v", len(errs), errs)
+	}
+	messages := []string{errs[0].Error(), errs[1].Error()}
+	assertContains(t, messages, "invalid "+AccessLabelAppDenyURL+" label")
+	assertContains(t, messages, "invalid "+AccessLabelAppRedirect+" label")
+	if len(apps) != 1 {
+		t.Fatalf("expected 1 app, got %d", len(apps))
+	}
+	if apps[0].DenyMessage == nil || *apps[0].DenyMessage != "Contact IT for access." {
+		t.Fatalf("expected deny message to be set, got %+v", apps[0].DenyMessage)
+	}
+	if apps[0].DenyURL == nil || *apps[0].DenyURL != "https://example.com/denied" {
+		t.Fatalf("expected deny URL to be set, got %+v", apps[0].DenyURL)
+	}
+	if apps[0].AutoRedirect == nil || !*apps[0].AutoRedirect {
+		t.Fatalf("expected auto redirect to be true, got %+v", apps[0].AutoRedirect)
+	}
+}
+
+func TestParseAccessContainersCookieSettings(t *testing.T) {
+	parser := NewParser()
+
+	containers := []docker.ContainerInfo{
+		{
+			ID:   "1",
+			Name: "cookies",
+			Labels: map[string]string{
+				AccessLabelEnable:                "true",
+				AccessLabelAppName:               "cookies",
+				AccessLabelAppDomain:             "cookies.example.com",
+				AccessLabelAppSkipInterstitial:   "true",
+				AccessLabelAppIsolation:          "true",
+				AccessLabelAppSkipLauncher:       "true",
+				AccessLabelAppHTTPOnlyCookie:     "false",
+				AccessLabelAppSameSiteCookie:     " Lax ",
+				AccessLabelPolicyPrefix + "1.id": "policy-id",
+			},
+		},
+		{
+			ID:   "2",
+			Name: "same-site-invalid",
+			Labels: map[string]string{
+				AccessLabelEnable:                "true",
+				AccessLabelAppName:               "invalid",
+				AccessLabelAppDomain:             "invalid.example.com",
+				AccessLabelAppSameSiteCookie:     "sometimes",
+				AccessLabelPolicyPrefix + "1.id": "policy-id",
+			},
+		},
+		{
+			ID:   "3",
+			Name: "http-only-invalid",
+			Labels: map[string]string{
+				AccessLabelEnable:                "true",
+				AccessLabelAppName:               "http-only",
+				AccessLabelAppDomain:             "http-only.example.com",
+				AccessLabelAppHTTPOnlyCookie:     "maybe",
+				AccessLabelPolicyPrefix + "1.id": "policy-id",
+			},
+		},
+	}
+
+	apps, errs := parser.ParseAccessContainers(containers)
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	assertContains(t, messages, `invalid `+AccessLabelAppSameSiteCookie+` label "sometimes": expected none, lax, or strict`)
+	assertContains(t, messages, "invalid "+AccessLabelAppHTTPOnlyCookie+" label")
+	if len(apps) != 1 {
+		t.Fatalf("expected 1 app, got %d", len(apps))
+	}
+	app := apps[0]
+	if app.SkipInterstitial == nil || !*app.SkipInterstitial {
+		t.Fatalf("expected skip interstitial to be true, got %+v", app.SkipInterstitial)
+	}
+	if app.IsolationRequired == nil || !*app.IsolationRequired {
+		t.Fatalf("expected isolation required to be true, got %+v", app.IsolationRequired)
+	}
+	if app.SkipLauncherLogin == nil || !*app.SkipLauncherLogin {
+		t.Fatalf("expected skip app launcher login to be true, got %+v", app.SkipLauncherLogin)
+	}
+	if app.HTTPOnlyCookie == nil || *app.HTTPOnlyCookie {
+		t.Fatalf("expected http-only cookie to be false, got %+v", app.HTTPOnlyCookie)
+	}
+	if app.SameSiteCookie == nil || *app.SameSiteCookie != "lax" {
+		t.Fatalf("expected same-site cookie to be lax, got %+v", app.SameSiteCookie)
+	}
+}
+
+func TestParseAccessContainersCustomDenyAliases(t *testing.T) {
+	parser := NewParser()
+
+	containers := []docker.ContainerInfo{
+		{
+			ID:   "1",
+			Name: "alias",
+			Labels: map[string]string{
+				AccessLabelEnable:                "true",
+				AccessLabelAppName:               "alias",
+				AccessLabelAppDomain:             "alias.example.com",
+				AccessLabelAppCustomDenyMsg:      "Request access on the wiki",
+				AccessLabelAppCustomDenyURL:      "https://wiki.example.com/access",
+				AccessLabelPolicyPrefix + "1.id": "policy-id",
+			},
+		},
+		{
+			ID:   "2",
+			Name: "conflict",
+			Labels: map[string]string{
+				AccessLabelEnable:                "true",
+				AccessLabelAppName:               "conflict",
+				AccessLabelAppDomain:             "conflict.example.com",
+				AccessLabelAppDenyURL:            "https://example.com/a",
+				AccessLabelAppCustomDenyURL:      "https://example.com/b",
+				AccessLabelPolicyPrefix + "1.id": "policy-id",
+			},
+		},
+		{
+			ID:   "3",
+			Name: "empty",
+			Labels: map[string]string{
+				AccessLabelEnable:                "true",
+				AccessLabelAppName:               "empty",
+				AccessLabelAppDomain:             "empty.example.com",
+				AccessLabelAppCustomDenyMsg:      "  ",
+				AccessLabelPolicyPrefix + "1.id": "policy-id",
+			},
+		},
+	}
+
+	apps, errs := parser.ParseAccessContainers(containers)
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %d: %v", len(errs), errs)
+	}
+	messages := []string{errs[0].Error(), errs[1].Error()}
+	assertContains(t, messages, "are both set with different values")
+	assertContains(t, messages, AccessLabelAppCustomDenyMsg+" cannot be empty")
+	if len(apps) != 1 {
+		t.Fatalf("expected 1 app, got %d", len(apps))
+	}
+	if apps[0].DenyMessage == nil || *apps[0].DenyMessage != "Request access on the wiki" {
+		t.Fatalf("expected deny message from alias label, got %+v", apps[0].DenyMessage)
+	}
+	if apps[0].DenyURL == nil || *apps[0].DenyURL != "https://wiki.example.com/access" {
+		t.Fatalf("expected deny URL from alias label, got %+v", apps[0].DenyURL)
+	}
+}
+
+func TestParseAccessContainersAppPath(t *testing.T) {
+	parser := NewParser()
+
+	containers := []docker.ContainerInfo{
+		{
+			ID:   "1",
+			Name: "path-label",
+			Labels: map[string]string{
+				AccessLabelEnable:                "true",
+				AccessLabelAppName:               "admin",
+				AccessLabelAppDomain:             "app.example.com",
+				AccessLabelAppPath:               "/admin",
+				AccessLabelPolicyPrefix + "1.id": "policy-id",
+			},
+		},
+		{
+			ID:   "2",
+			Name: "path-in-domain",
+			Labels: map[string]string{
+				AccessLabelEnable:                "true",
+				AccessLabelAppName:               "admin",
+				AccessLabelAppDomain:             "App.Example.com/admin",
+				AccessLabelPolicyPrefix + "1.id": "policy-id",
+			},
+		},
+		{
+			ID:   "3",
+			Name: "path-conflict",
+			Labels: map[string]string{
+				AccessLabelEnable:                "true",
+				AccessLabelAppName:               "conflict",
+				AccessLabelAppDomain:             "app.example.com/api",
+				AccessLabelAppPath:               "/v2",
+				AccessLabelPolicyPrefix + "1.id": "policy-id",
+			},
+		},
+		{
+			ID:   "4",
+			Name: "scheme",
+			Labels: map[string]string{
+				AccessLabelEnable:                "true",
+				AccessLabelAppName:               "scheme",
+				AccessLabelAppDomain:             "https://app.example.com",
+				AccessLabelPolicyPrefix + "1.id": "policy-id",
+			},
+		},
+	}
+
+	apps, errs := parser.ParseAccessContainers(containers)
+	if len(errs) != 3 {
+		t.Fatalf("expected 3 errors, got %d: %v", len(errs), errs)
+	}
+	messages := []string{errs[0].Error(), errs[1].Error(), errs[2].Error()}
+	assertContains(t, messages, "duplicate access app definition for admin@app.example.com/admin")
+	assertContains(t, messages, AccessLabelAppPath+" cannot be combined with a path in "+AccessLabelAppDomain)
+	assertContains(t, messages, AccessLabelAppDomain+" must not include a scheme")
+	if len(apps) != 1 || apps[0].Domain != "app.example.com/admin" {
+		t.Fatalf("expected one app scoped to the admin path, got %+v", apps)
+	}
+}
+
+func TestParseAccessContainersShorthandEmails(t *testing.T) {
+	parser := NewParser()
+
+	containers := []docker.ContainerInfo{
+		{
+			ID:   "1",
+			Name: "shorthand",
+			Labels: map[string]string{
+				LabelEnable:                   "true",
+				LabelHost:                     "app.example.com",
+				LabelService:                  "http://app:8080",
+				LabelAccessEmails:             "a@example.com, b@example.com",
+				LabelHost + ".admin":          "app.example.com",
+				LabelService + ".admin":       "http://app:9090",
+				LabelPath + ".admin":          "/admin",
+				LabelAccessEmails + ".admin":  "admin@example.com",
+				LabelHost + ".public":         "public.example.com",
+				LabelService + ".public":      "http://app:8081",
+				LabelAccessEmails + ".public": "ops@example.com",
+			},
+		},
+		{
+			ID:   "2",
+			Name: "explicit",
+			Labels: map[string]string{
+				AccessLabelEnable:                "true",
+				AccessLabelAppName:               "public",
+				AccessLabelAppDomain:             "public.example.com",
+				AccessLabelPolicyPrefix + "1.id": "policy-id",
+			},
+		},
+	}
+
+	apps, errs := parser.ParseAccessContainers(containers)
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %d: %v", len(errs), errs)
+	}
+	assertContains(t, []string{errs[0].Error()}, "explicit "+AccessLabelPrefix+"* labels take precedence")
+	if len(apps) != 3 {
+		t.Fatalf("expected 3 apps, got %d", len(apps))
+	}
+	if apps[0].Domain != "app.example.com/admin" {
+		t.Fatalf("expected suffix shorthand app to include path, got %+v", apps[0])
+	}
+	if apps[1].Domain != "app.example.com" || apps[1].Name != "app.example.com" {
+		t.Fatalf("unexpected base shorthand app: %+v", apps[1])
+	}
+	policy := apps[1].Policies[0]
+	if !policy.Managed || policy.Action != "allow" || len(policy.IncludeEmails) != 2 {
+		t.Fatalf("unexpected shorthand policy: %+v", policy)
+	}
+	if apps[2].Name != "public" || len(apps[2].Policies) != 1 || apps[2].Policies[0].ID != "policy-id" {
+		t.Fatalf("expected explicit app to win, got %+v", apps[2])
+	}
+}
+
+func TestParseAccessContainersSuffixApps(t *testing.T) {
+	parser := NewParser()
+
+	containers := []docker.ContainerInfo{
+		{
+			ID:   "1",
+			Name: "soulsync",
+			Labels: map[string]string{
+				LabelHost:                                             "soulsync.example.com",
+				LabelHost + ".spotify":                                "soulsync-spotify.example.com",
+				AccessLabelEnable:                                     "true",
+				AccessLabelAppName:                                    "soulsync",
+				AccessLabelPolicyPrefix + "1.id":                      "base-policy",
+				AccessLabelPrefix + "spotify.enable":                  "true",
+				AccessLabelPrefix + "spotify.app.name":                "soulsync-spotify",
+				AccessLabelPrefix + "spotify.policy.1.name":           "spotify-users",
+				AccessLabelPrefix + "spotify.policy.1.action":         "allow",
+				AccessLabelPrefix + "spotify.policy.1.include.emails": "dj@example.com",
+				AccessLabelPrefix + "tidal.enable":                    "true",
+				AccessLabelPrefix + "tidal.app.name":                  "soulsync",
+				AccessLabelPrefix + "tidal.app.domain":                "soulsync.example.com",
+				AccessLabelPrefix + "tidal.policy.1.id":               "tidal-policy",
+			},
+		},
+	}
+
+	apps, errs := parser.ParseAccessContainers(containers)
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %d: %v", len(errs), errs)
+	}
+	assertContains(t, []string{errs[0].Error()}, "duplicate access app definition for soulsync@soulsync.example.com")
+	if len(apps) != 2 {
+		t.Fatalf("expected 2 apps, got %d", len(apps))
+	}
+	if apps[0].Name != "soulsync-spotify" || apps[0].Domain != "soulsync-spotify.example.com" {
+		t.Fatalf("expected suffix app domain to default from suffix hostname, got %+v", apps[0])
+	}
+	if len(apps[0].Policies) != 1 || apps[0].Policies[0].Name != "spotify-users" {
+		t.Fatalf("unexpected suffix app policies: %+v", apps[0].Policies)
+	}
+	if apps[1].Name != "soulsync" || apps[1].Domain != "soulsync.example.com" || apps[1].Policies[0].ID != "base-policy" {
+		t.Fatalf("unexpected base app: %+v", apps[1])
+	}
+}
+
+func TestParseAccessContainersIndexedApps(t *testing.T) {
+	parser := NewParser()
+
+	containers := []docker.ContainerInfo{
+		{
+			ID:   "1",
+			Name: "app",
+			Labels: map[string]string{
+				AccessLabelEnable:                              "true",
+				AccessLabelAppName:                             "app",
+				AccessLabelAppDomain:                           "app.example.com",
+				AccessLabelPolicyPrefix + "1.id":               "users-policy",
+				AccessLabelPrefix + "1.app.name":               "admin",
+				AccessLabelPrefix + "1.app.domain":             "admin.app.example.com",
+				AccessLabelPrefix + "1.policy.1.name":          "admins",
+				AccessLabelPrefix + "1.policy.1.action":        "allow",
+				AccessLabelPrefix + "1.policy.1.include.email": "root@example.com",
+				AccessLabelPrefix + "2.app.name":               "reports",
+				AccessLabelPrefix + "2.policy.1.id":            "reports-policy",
+				AccessLabelPrefix + "3.enable":                 "false",
+				AccessLabelPrefix + "3.app.name":               "disabled",
+				AccessLabelPrefix + "3.app.domain":             "disabled.example.com",
+				AccessLabelPrefix + "3.policy.1.id":            "disabled-policy",
+				AccessLabelPrefix + "4.app.name":               "app",
+				AccessLabelPrefix + "4.app.domain":             "APP.example.com",
+				AccessLabelPrefix + "4.policy.1.id":            "other-policy",
+			},
+		},
+	}
+
+	apps, errs := parser.ParseAccessContainers(containers)
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	assertContains(t, messages, "unknown access policy label cloudflare.access.1.policy.1.include.email")
+	assertContains(t, messages, "missing cloudflare.access.2.app.domain; set cloudflare.access.2.app.domain or cloudflare.tunnel.hostname.2")
+	assertContains(t, messages, "duplicate access app definition for app@app.example.com")
+	if len(apps) != 1 || apps[0].Name != "app" || apps[0].Policies[0].ID != "users-policy" {
+		t.Fatalf("expected only the base app, got %+v", apps)
+	}
+
+	containers[0].Labels[AccessLabelPrefix+"1.policy.1.include.emails"] = "root@example.com"
+	delete(containers[0].Labels, AccessLabelPrefix+"1.policy.1.include.email")
+	apps, _ = parser.ParseAccessContainers(containers)
+	if len(apps) != 2 || apps[0].Name != "admin" || apps[0].Domain != "admin.app.example.com" {
+		t.Fatalf("expected indexed app alongside the base app, got %+v", apps)
+	}
+	if len(apps[0].Policies) != 1 || apps[0].Policies[0].Name != "admins" {
+		t.Fatalf("unexpected indexed app policies: %+v", apps[0].Policies)
+	}
+}
+
+func TestParseAccessContainersAppType(t *testing.T) {
+	parser := NewParser()
+
+	containers := []docker.ContainerInfo{
+		{
+			ID:   "1",
+			Name: "ssh-host",
+			Labels: map[string]string{
+				AccessLabelEnable:                "true",
+				AccessLabelAppName:               "ssh",
+				AccessLabelAppDomain:             "ssh.example.com",
+				AccessLabelAppType:               "SSH",
+				AccessLabelPolicyPrefix + "1.id": "policy-id",
+			},
+		},
+		{
+			ID:   "2",
+			Name: "bad-type",
+			Labels: map[string]string{
+				AccessLabelEnable:                "true",
+				AccessLabelAppName:               "bad",
+				AccessLabelAppDomain:             "bad.example.com",
+				AccessLabelAppType:               "warp",
+				AccessLabelPolicyPrefix + "1.id": "policy-id",
+			},
+		},
+	}
+
+	apps, errs := parser.ParseAccessContainers(containers)
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %d: %v", len(errs), errs)
+	}
+	assertContains(t, []string{errs[0].Error()}, AccessLabelAppType+` has unsupported value "warp"`)
+	if len(apps) != 1 || apps[0].Type != "ssh" {
+		t.Fatalf("expected ssh app type, got %+v", apps)
+	}
+}
+
+func TestParseAccessContainersBookmarkApp(t *testing.T) {
+	parser := NewParser()
+
+	containers := []docker.ContainerInfo{
+		{
+			ID:   "1",
+			Name: "docs",
+			Labels: map[string]string{
+				AccessLabelEnable:  "true",
+				AccessLabelAppName: "docs",
+				AccessLabelAppType: "bookmark",
+				AccessLabelAppURL:  "https://docs.example.com/start",
+			},
+		},
+		{
+			ID:   "2",
+			Name: "missing-url",
+			Labels: map[string]string{
+				AccessLabelEnable:  "true",
+				AccessLabelAppName: "missing",
+				AccessLabelAppType: "bookmark",
+			},
+		},
+		{
+			ID:   "3",
+			Name: "with-policy",
+			Labels: map[string]string{
+				AccessLabelEnable:                "true",
+				AccessLabelAppName:               "policy",
+				AccessLabelAppType:               "bookmark",
+				AccessLabelAppURL:                "https://policy.example.com",
+				AccessLabelPolicyPrefix + "1.id": "policy-id",
+			},
+		},
+		{
+			ID:   "4",
+			Name: "url-on-self-hosted",
+			Labels: map[string]string{
+				AccessLabelEnable:                "true",
+				AccessLabelAppName:               "self",
+				AccessLabelAppDomain:             "self.example.com",
+				AccessLabelAppURL:                "https://self.example.com",
+				AccessLabelPolicyPrefix + "1.id": "policy-id",
+			},
+		},
+	}
+
+	apps, errs := parser.ParseAccessContainers(containers)
+	if len(apps) != 1 {
+		t.Fatalf("expected one bookmark app, got %+v", apps)
+	}
+	if apps[0].Type != "bookmark" || apps[0].Domain != "https://docs.example.com/start" || len(apps[0].Policies) != 0 {
+		t.Fatalf("unexpected bookmark app: %+v", apps[0])
+	}
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	if len(messages) != 3 {
+		t.Fatalf("expected 3 errors, got %v", messages)
+	}
+	assertContains(t, messages, "missing required "+AccessLabelAppURL+" label for bookmark apps")
+	assertContains(t, messages, "bookmark apps do not use access policies")
+	assertContains(t, messages, AccessLabelAppURL+" is only supported when "+AccessLabelAppType+" is bookmark")
+}
+
+func TestParseAccessContainersIDOnlyPolicy(t *testing.T) {
+	parser := NewParser()
+
+	containers := []docker.ContainerInfo{
+		{
+			ID:   "1",
+			Name: "access-app",
+			Labels: map[string]string{
+				AccessLabelEnable:                "true",
+				AccessLabelAppName:               "id-only",
+				AccessLabelAppDomain:             "id-only.example.com",
+				AccessLabelPolicyPrefix + "1.id": "policy-id",
+			},
+		},
+	}
+
+	apps, errs := parser.ParseAccessContainers(containers)
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got %v", errs)
+	}
+	if len(apps) != 1 {
+		t.Fatalf("expected 1 app, got %d", len(apps))
+	}
+	policy := apps[0].Policies[0]
+	if policy.Managed {
+		t.Fatalf("expected id-only policy to be unmanaged")
+	}
+	if policy.ID != "policy-id" {
+		t.Fatalf("expected policy id to be policy-id, got %s", policy.ID)
+	}
+}
+
+func TestParseAccessContainersExplicitPolicyManagedFlag(t *testing.T) {
+	parser := NewParser()
+	base := map[string]string{
+		AccessLabelEnable:    "true",
+		AccessLabelAppName:   "app",
+		AccessLabelAppDomain: "app.example.com",
+	}
+	withPolicy := func(policy map[string]string) []docker.ContainerInfo {
+		labels := map[string]string{}
+		for key, value := range base {
+			labels[key] = value
+		}
+		for field, value := range policy {
+			labels[AccessLabelPolicyPrefix+"1."+field] = value
+		}
+		return []docker.ContainerInfo{{ID: "1", Name: "access-app", Labels: labels}}
+	}
+	errorStrings := func(errs []error) []string {
+		messages := []string{}
+		for _, err := range errs {
+			messages = append(messages, err.Error())
+		}
+		return messages
 	}
-
-	apps, errs := parser.ParseAccessContainers(containers)
-	if len(errs) != 0 {
-		t.Fatalf("expected no errors, got %v", errs)
-	}
-	if len(apps) != 1 {
-		t.Fatalf("expected 1 app, got %d", len(apps))
-	}
-	policy := apps[0].Policies[0]
-	if policy.Managed {
-		t.Fatalf("expected id-only policy to be unmanaged")
-	}
-	if policy.ID != "policy-id" {
-		t.Fatalf("expected policy id to be policy-id, got %s", policy.ID)
+
+	apps, errs := parser.ParseAccessContainers(withPolicy(map[string]string{"id": "policy-id", "managed": "true", "action": "allow", "include.emails": "a@example.com"}))
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got %v", errs)
+	}
+	if policy := apps[0].Policies[0]; !policy.Managed || policy.ID != "policy-id" || policy.Name != "" {
+		t.Fatalf("expected a policy managed by id without a name, got %+v", policy)
+	}
+
+	apps, errs = parser.ParseAccessContainers(withPolicy(map[string]string{"name": "team", "managed": "false", "action": "allow", "include.emails": "a@example.com"}))
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got %v", errs)
+	}
+	if apps[0].Policies[0].Managed {
+		t.Fatalf("expected managed=false to keep the policy reference-only")
+	}
+
+	_, errs = parser.ParseAccessContainers(withPolicy(map[string]string{"id": "policy-id", "managed": "true"}))
+	assertContains(t, errorStrings(errs), "access policy 1 sets managed=true without an action and include rules")
+
+	_, errs = parser.ParseAccessContainers(withPolicy(map[string]string{"action": "allow", "include.emails": "a@example.com"}))
+	assertContains(t, errorStrings(errs), "access policy 1 missing name")
+
+	_, errs = parser.ParseAccessContainers(withPolicy(map[string]string{"id": "policy-id", "managed": "maybe"}))
+	assertContains(t, errorStrings(errs), "invalid "+AccessLabelPolicyPrefix+"1.managed label")
+}
+
+func TestParseAccessContainersPolicyPrecedence(t *testing.T) {
+	parser := NewParser()
+
+	containers := []docker.ContainerInfo{
+		{
+			ID:   "1",
+			Name: "access-app",
+			Labels: map[string]string{
+				AccessLabelEnable:                        "true",
+				AccessLabelAppName:                       "ordered",
+				AccessLabelAppDomain:                     "ordered.example.com",
+				AccessLabelPolicyPrefix + "1.id":         "policy-a",
+				AccessLabelPolicyPrefix + "1.precedence": "20",
+				AccessLabelPolicyPrefix + "2.id":         "policy-b",
+			},
+		},
+		{
+			ID:   "2",
+			Name: "invalid",
+			Labels: map[string]string{
+				AccessLabelEnable:                        "true",
+				AccessLabelAppName:                       "invalid",
+				AccessLabelAppDomain:                     "invalid.example.com",
+				AccessLabelPolicyPrefix + "1.id":         "policy-a",
+				AccessLabelPolicyPrefix + "1.precedence": "first",
+			},
+		},
+		{
+			ID:   "3",
+			Name: "duplicate",
+			Labels: map[string]string{
+				AccessLabelEnable:                        "true",
+				AccessLabelAppName:                       "duplicate",
+				AccessLabelAppDomain:                     "duplicate.example.com",
+				AccessLabelPolicyPrefix + "1.id":         "policy-a",
+				AccessLabelPolicyPrefix + "1.precedence": "1",
+				AccessLabelPolicyPrefix + "2.id":         "policy-b",
+				AccessLabelPolicyPrefix + "2.precedence": "1",
+			},
+		},
+	}
+
+	apps, errs := parser.ParseAccessContainers(containers)
+	messages := []string{}
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	assertContains(t, messages, "precedence must be a positive integer")
+	assertContains(t, messages, "access policies 1 and 2 both set precedence 1")
+	var ordered *model.AccessAppSpec
+	for index := range apps {
+		if apps[index].Name == "ordered" {
+			ordered = &apps[index]
+		}
+	}
+	if ordered == nil || len(ordered.Policies) != 2 || ordered.Policies[0].Precedence != 20 || ordered.Policies[1].Precedence != 0 {
+		t.Fatalf("expected explicit precedence on the first policy only, got %+v", ordered.Policies)
 	}
 }
 
@@ -558,6 +1876,429 @@ func TestParseAccessContainersErrors(t *testing.T) {
 	assertContains(t, messages, "invalid access policy index")
 }
 
+func TestParseAccessContainersValidatesIncludeIPs(t *testing.T) {
+	parser := NewParser()
+
+	containers := []docker.ContainerInfo{
+		{
+			ID:   "1",
+			Name: "ip-policies",
+			Labels: map[string]string{
+				AccessLabelEnable:                         "true",
+				AccessLabelAppName:                        "office",
+				AccessLabelAppDomain:                      "office.example.com",
+				AccessLabelPolicyPrefix + "1.name":        "office-v4",
+				AccessLabelPolicyPrefix + "1.action":      "allow",
+				AccessLabelPolicyPrefix + "1.include.ips": "192.0.2.0/24, 2001:db8::/32",
+				AccessLabelPolicyPrefix + "2.name":        "bare-ip",
+				AccessLabelPolicyPrefix + "2.action":      "allow",
+				AccessLabelPolicyPrefix + "2.include.ips": "10.0.0.0/8,10.0.0.1,not-an-ip",
+			},
+		},
+	}
+
+	apps, errs := parser.ParseAccessContainers(containers)
+	if len(apps) != 1 {
+		t.Fatalf("expected 1 app, got %d", len(apps))
+	}
+	if len(apps[0].Policies) != 1 || apps[0].Policies[0].Name != "office-v4" {
+		t.Fatalf("expected only the valid policy to be kept, got %+v", apps[0].Policies)
+	}
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	assertContains(t, messages, `invalid include IP "10.0.0.1": expected CIDR notation`)
+	assertContains(t, messages, `invalid include IP "not-an-ip"`)
+	assertContains(t, messages, "access policy 2 has invalid include rules")
+}
+
+func TestParseAccessContainersIncludeGroups(t *testing.T) {
+	parser := NewParser()
+
+	containers := []docker.ContainerInfo{
+		{
+			ID:   "1",
+			Name: "group-policies",
+			Labels: map[string]string{
+				AccessLabelEnable:                            "true",
+				AccessLabelAppName:                           "internal",
+				AccessLabelAppDomain:                         "internal.example.com",
+				AccessLabelPolicyPrefix + "1.name":           "staff",
+				AccessLabelPolicyPrefix + "1.action":         "allow",
+				AccessLabelPolicyPrefix + "1.include.groups": "Staff, Admins",
+			},
+		},
+	}
+
+	apps, errs := parser.ParseAccessContainers(containers)
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if len(apps) != 1 || len(apps[0].Policies) != 1 {
+		t.Fatalf("expected 1 app with 1 policy, got %+v", apps)
+	}
+	policy := apps[0].Policies[0]
+	if !policy.Managed || len(policy.IncludeGroups) != 2 || policy.IncludeGroups[0] != "Staff" || policy.IncludeGroups[1] != "Admins" {
+		t.Fatalf("unexpected group policy: %+v", policy)
+	}
+}
+
+func TestParseAccessContainersValidatesIncludeEmailDomains(t *testing.T) {
+	parser := NewParser()
+
+	containers := []docker.ContainerInfo{
+		{
+			ID:   "1",
+			Name: "domain-policies",
+			Labels: map[string]string{
+				AccessLabelEnable:                                   "true",
+				AccessLabelAppName:                                  "company",
+				AccessLabelAppDomain:                                "company.example.com",
+				AccessLabelPolicyPrefix + "1.name":                  "company",
+				AccessLabelPolicyPrefix + "1.action":                "allow",
+				AccessLabelPolicyPrefix + "1.include.email-domains": "Example.com, corp.example.org",
+				AccessLabelPolicyPrefix + "2.name":                  "bad-domains",
+				AccessLabelPolicyPrefix + "2.action":                "allow",
+				AccessLabelPolicyPrefix + "2.include.email-domains": "@example.com,https://example.com,example",
+			},
+		},
+	}
+
+	apps, errs := parser.ParseAccessContainers(containers)
+	if len(apps) != 1 {
+		t.Fatalf("expected 1 app, got %d", len(apps))
+	}
+	if len(apps[0].Policies) != 1 {
+		t.Fatalf("expected only the valid policy to be kept, got %+v", apps[0].Policies)
+	}
+	domains := apps[0].Policies[0].IncludeEmailDomains
+	if len(domains) != 2 || domains[0] != "example.com" || domains[1] != "corp.example.org" {
+		t.Fatalf("unexpected email domains: %+v", domains)
+	}
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	assertContains(t, messages, `invalid include email domain "@example.com": use the bare domain without @`)
+	assertContains(t, messages, `invalid include email domain "https://example.com": use the bare domain without scheme or path`)
+	assertContains(t, messages, `invalid include email domain "example": expected a domain such as example.com`)
+	assertContains(t, messages, "access policy 2 has invalid include rules")
+}
+
+func TestParseAccessContainersValidatesIncludeCountries(t *testing.T) {
+	parser := NewParser()
+
+	containers := []docker.ContainerInfo{
+		{
+			ID:   "1",
+			Name: "geo-policies",
+			Labels: map[string]string{
+				AccessLabelEnable:                               "true",
+				AccessLabelAppName:                              "geo",
+				AccessLabelAppDomain:                            "geo.example.com",
+				AccessLabelPolicyPrefix + "1.name":              "europe",
+				AccessLabelPolicyPrefix + "1.action":            "allow",
+				AccessLabelPolicyPrefix + "1.include.countries": "fr, DE",
+				AccessLabelPolicyPrefix + "2.name":              "bad-countries",
+				AccessLabelPolicyPrefix + "2.action":            "allow",
+				AccessLabelPolicyPrefix + "2.include.countries": "FRA,ZZ",
+			},
+		},
+	}
+
+	apps, errs := parser.ParseAccessContainers(containers)
+	if len(apps) != 1 {
+		t.Fatalf("expected 1 app, got %d", len(apps))
+	}
+	if len(apps[0].Policies) != 1 {
+		t.Fatalf("expected only the valid policy to be kept, got %+v", apps[0].Policies)
+	}
+	countries := apps[0].Policies[0].IncludeCountries
+	if len(countries) != 2 || countries[0] != "FR" || countries[1] != "DE" {
+		t.Fatalf("unexpected countries: %+v", countries)
+	}
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	assertContains(t, messages, `invalid include country "FRA": expected an ISO 3166-1 alpha-2 code such as FR`)
+	assertContains(t, messages, `invalid include country "ZZ": expected an ISO 3166-1 alpha-2 code such as FR`)
+	assertContains(t, messages, "access policy 2 has invalid include rules")
+}
+
+func TestParseAccessContainersIncludeCertificates(t *testing.T) {
+	parser := NewParser()
+
+	containers := []docker.ContainerInfo{
+		{
+			ID:   "1",
+			Name: "devices",
+			Labels: map[string]string{
+				AccessLabelEnable:                                       "true",
+				AccessLabelAppName:                                      "devices",
+				AccessLabelAppDomain:                                    "devices.example.com",
+				AccessLabelPolicyPrefix + "1.name":                      "named-devices",
+				AccessLabelPolicyPrefix + "1.action":                    "allow",
+				AccessLabelPolicyPrefix + "1.include.common-names":      "device-01, device-02",
+				AccessLabelPolicyPrefix + "2.name":                      "any-device",
+				AccessLabelPolicyPrefix + "2.action":                    "allow",
+				AccessLabelPolicyPrefix + "2.include.valid-certificate": "true",
+				AccessLabelPolicyPrefix + "3.name":                      "bad",
+				AccessLabelPolicyPrefix + "3.action":                    "allow",
+				AccessLabelPolicyPrefix + "3.include.valid-certificate": "yes please",
+			},
+		},
+	}
+
+	apps, errs := parser.ParseAccessContainers(containers)
+	if len(apps) != 1 || len(apps[0].Policies) != 2 {
+		t.Fatalf("expected the invalid policy to be skipped, got %+v", apps)
+	}
+	policies := apps[0].Policies
+	if strings.Join(policies[0].IncludeCommonNames, ",") != "device-01,device-02" {
+		t.Fatalf("unexpected common name policy: %+v", policies[0])
+	}
+	if !policies[1].IncludeCertificate || !policies[1].Managed {
+		t.Fatalf("expected valid certificate policy, got %+v", policies[1])
+	}
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	assertContains(t, messages, "invalid cloudflare.access.policy.3.include.valid-certificate label")
+}
+
+func TestParseAccessContainersIncludeServiceTokens(t *testing.T) {
+	parser := NewParser()
+
+	containers := []docker.ContainerInfo{
+		{
+			ID:   "1",
+			Name: "automation",
+			Labels: map[string]string{
+				AccessLabelEnable:                                       "true",
+				AccessLabelAppName:                                      "api",
+				AccessLabelAppDomain:                                    "api.example.com",
+				AccessLabelPolicyPrefix + "1.name":                      "ci",
+				AccessLabelPolicyPrefix + "1.action":                    "non_identity",
+				AccessLabelPolicyPrefix + "1.include.service-tokens":    "CI, token-2",
+				AccessLabelPolicyPrefix + "2.name":                      "any-token",
+				AccessLabelPolicyPrefix + "2.action":                    "non_identity",
+				AccessLabelPolicyPrefix + "2.include.any-service-token": "true",
+				AccessLabelPolicyPrefix + "3.name":                      "bad",
+				AccessLabelPolicyPrefix + "3.action":                    "non_identity",
+				AccessLabelPolicyPrefix + "3.include.any-service-token": "sometimes",
+			},
+		},
+	}
+
+	apps, errs := parser.ParseAccessContainers(containers)
+	if len(apps) != 1 {
+		t.Fatalf("expected 1 app, got %d", len(apps))
+	}
+	policies := apps[0].Policies
+	if len(policies) != 2 {
+		t.Fatalf("expected the invalid policy to be skipped, got %+v", policies)
+	}
+	if policies[0].Action != "non_identity" || len(policies[0].IncludeServiceTokens) != 2 || policies[0].IncludeServiceTokens[0] != "CI" || policies[0].IncludeServiceTokens[1] != "token-2" {
+		t.Fatalf("unexpected service token policy: %+v", policies[0])
+	}
+	if !policies[1].IncludeAnyServiceToken || !policies[1].Managed {
+		t.Fatalf("expected any service token policy, got %+v", policies[1])
+	}
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	assertContains(t, messages, "invalid cloudflare.access.policy.3.include.any-service-token label")
+	assertContains(t, messages, "access policy 3 has invalid include rules")
+}
+
+func TestParseAccessContainersRequireAuthMethod(t *testing.T) {
+	parser := NewParser()
+
+	containers := []docker.ContainerInfo{
+		{
+			ID:   "1",
+			Name: "mfa",
+			Labels: map[string]string{
+				AccessLabelEnable:                                 "true",
+				AccessLabelAppName:                                "admin",
+				AccessLabelAppDomain:                              "admin.example.com",
+				AccessLabelPolicyPrefix + "1.name":                "staff-mfa",
+				AccessLabelPolicyPrefix + "1.action":              "allow",
+				AccessLabelPolicyPrefix + "1.include.emails":      "a@example.com",
+				AccessLabelPolicyPrefix + "1.require.auth-method": "MFA",
+				AccessLabelPolicyPrefix + "2.name":                "everyone-mfa",
+				AccessLabelPolicyPrefix + "2.action":              "allow",
+				AccessLabelPolicyPrefix + "2.require.auth-method": "mfa",
+				AccessLabelPolicyPrefix + "3.name":                "bad",
+				AccessLabelPolicyPrefix + "3.action":              "allow",
+				AccessLabelPolicyPrefix + "3.include.everyone":    "true",
+				AccessLabelPolicyPrefix + "3.require.auth-method": "magic",
+			},
+		},
+	}
+
+	apps, errs := parser.ParseAccessContainers(containers)
+	if len(apps) != 1 {
+		t.Fatalf("expected 1 app, got %d", len(apps))
+	}
+	policies := apps[0].Policies
+	if len(policies) != 2 {
+		t.Fatalf("expected the invalid policy to be skipped, got %+v", policies)
+	}
+	if policies[0].RequireAuthMethod != "mfa" || policies[0].IncludeEveryone {
+		t.Fatalf("unexpected require policy: %+v", policies[0])
+	}
+	if policies[1].RequireAuthMethod != "mfa" || !policies[1].IncludeEveryone || !policies[1].Managed {
+		t.Fatalf("expected require-only policy to include everyone, got %+v", policies[1])
+	}
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	assertContains(t, messages, `invalid auth method "magic": expected a value such as mfa`)
+	assertContains(t, messages, "access policy 3 has invalid include rules")
+}
+
+func TestParseAccessContainersAcceptsBypassAction(t *testing.T) {
+	parser := NewParser()
+
+	containers := []docker.ContainerInfo{
+		{
+			ID:   "1",
+			Name: "health",
+			Labels: map[string]string{
+				AccessLabelEnable:                         "true",
+				AccessLabelAppName:                        "health",
+				AccessLabelAppDomain:                      "health.example.com",
+				AccessLabelPolicyPrefix + "1.name":        "health",
+				AccessLabelPolicyPrefix + "1.action":      "Bypass",
+				AccessLabelPolicyPrefix + "1.include.ips": "192.0.2.0/24",
+				AccessLabelPolicyPrefix + "2.name":        "bad",
+				AccessLabelPolicyPrefix + "2.action":      "skip",
+				AccessLabelPolicyPrefix + "2.include.ips": "192.0.2.0/24",
+			},
+		},
+	}
+
+	apps, errs := parser.ParseAccessContainers(containers)
+	if len(apps) != 1 || len(apps[0].Policies) != 1 {
+		t.Fatalf("expected one bypass policy, got %+v", apps)
+	}
+	if apps[0].Policies[0].Action != "bypass" {
+		t.Fatalf("unexpected action: %q", apps[0].Policies[0].Action)
+	}
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	assertContains(t, messages, `access policy 2 has invalid action "skip"`)
+}
+
+func TestParseAccessContainersMergesOptedInApps(t *testing.T) {
+	parser := NewParser()
+
+	base := func(id string, labels map[string]string) docker.ContainerInfo {
+		merged := map[string]string{
+			AccessLabelEnable:    "true",
+			AccessLabelAppName:   "app",
+			AccessLabelAppDomain: "app.example.com",
+		}
+		for key, value := range labels {
+			merged[key] = value
+		}
+		return docker.ContainerInfo{ID: id, Name: "container-" + id, Labels: merged}
+	}
+	containers := []docker.ContainerInfo{
+		base("1", map[string]string{
+			AccessLabelAppMerge:                          "true",
+			AccessLabelAppLauncher:                       "false",
+			AccessLabelPolicyPrefix + "1.name":           "team",
+			AccessLabelPolicyPrefix + "1.action":         "allow",
+			AccessLabelPolicyPrefix + "1.include.emails": "a@example.com",
+		}),
+		base("2", map[string]string{
+			AccessLabelAppMerge:                          "true",
+			AccessLabelAppLogoURL:                        "https://example.com/logo.png",
+			AccessLabelPolicyPrefix + "1.name":           "Team",
+			AccessLabelPolicyPrefix + "1.action":         "allow",
+			AccessLabelPolicyPrefix + "1.include.emails": "b@example.com,a@example.com",
+			AccessLabelPolicyPrefix + "1.include.ips":    "192.0.2.0/24",
+			AccessLabelPolicyPrefix + "2.id":             "extra-policy",
+		}),
+		base("3", map[string]string{
+			AccessLabelAppMerge:                          "true",
+			AccessLabelPolicyPrefix + "1.name":           "team",
+			AccessLabelPolicyPrefix + "1.action":         "deny",
+			AccessLabelPolicyPrefix + "1.include.emails": "c@example.com",
+		}),
+		base("4", map[string]string{
+			AccessLabelPolicyPrefix + "1.id": "other-policy",
+		}),
+	}
+
+	apps, errs := parser.ParseAccessContainers(containers)
+	if len(apps) != 1 || len(apps[0].Policies) != 2 {
+		t.Fatalf("expected one merged app with two policies, got %+v", apps)
+	}
+	app := apps[0]
+	if app.AppLauncherVisible == nil || *app.AppLauncherVisible || app.LogoURL == nil {
+		t.Fatalf("expected app settings from both definitions, got %+v", app)
+	}
+	team := app.Policies[0]
+	if strings.Join(team.IncludeEmails, ",") != "a@example.com,b@example.com" || len(team.IncludeIPs) != 1 {
+		t.Fatalf("expected include rules to be unioned, got %+v", team)
+	}
+	if app.Policies[1].ID != "extra-policy" {
+		t.Fatalf("expected extra policy to be appended, got %+v", app.Policies[1])
+	}
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	assertContains(t, messages, `container container-3: cannot merge access app app@app.example.com: access policy "team" has conflicting actions "allow" and "deny"`)
+	assertContains(t, messages, "duplicate access app definition for app@app.example.com; set cloudflare.access.app.merge=true on every definition to merge them")
+}
+
+func TestParseAccessContainersIncludeEveryone(t *testing.T) {
+	parser := NewParser()
+
+	containers := []docker.ContainerInfo{
+		{
+			ID:   "1",
+			Name: "everyone-policies",
+			Labels: map[string]string{
+				AccessLabelEnable:                              "true",
+				AccessLabelAppName:                             "public",
+				AccessLabelAppDomain:                           "public.example.com",
+				AccessLabelPolicyPrefix + "1.name":             "everyone",
+				AccessLabelPolicyPrefix + "1.action":           "allow",
+				AccessLabelPolicyPrefix + "1.include.everyone": "true",
+				AccessLabelPolicyPrefix + "2.name":             "invalid",
+				AccessLabelPolicyPrefix + "2.action":           "allow",
+				AccessLabelPolicyPrefix + "2.include.everyone": "sure",
+			},
+		},
+	}
+
+	apps, errs := parser.ParseAccessContainers(containers)
+	if len(apps) != 1 || len(apps[0].Policies) != 1 {
+		t.Fatalf("expected 1 app with 1 policy, got %+v", apps)
+	}
+	if policy := apps[0].Policies[0]; !policy.Managed || !policy.IncludeEveryone {
+		t.Fatalf("expected managed everyone policy, got %+v", policy)
+	}
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	assertContains(t, messages, "invalid "+AccessLabelPolicyPrefix+"2.include.everyone label")
+	assertContains(t, messages, "access policy 2 has invalid include rules")
+}
+
 func assertContains(t *testing.T, messages []string, needle string) {
 	t.Helper()
 	for _, message := range messages {
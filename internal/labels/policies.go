@@ -0,0 +1,113 @@
+package labels
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/model"
+)
+
+type sharedPolicyFile struct {
+	Policies []map[string]any `json:"policies"`
+}
+
+// LoadSharedPolicies reads account-level Access policy definitions from a JSON
+// file. Each entry uses the field names of the cloudflare.access.policy.N.*
+// labels, for example:
+//
+//	{"policies": [{"name": "admins", "action": "allow", "include.emails": ["a@example.com"]}]}
+func LoadSharedPolicies(path string) ([]model.AccessPolicySpec, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read access policy file %s: %w", path, err)
+	}
+	var decoded sharedPolicyFile
+	if err := json.Unmarshal(content, &decoded); err != nil {
+		return nil, fmt.Errorf("decode access policy file %s: %w", path, err)
+	}
+	return parseSharedPolicies(path, decoded.Policies)
+}
+
+func parseSharedPolicies(path string, entries []map[string]any) ([]model.AccessPolicySpec, error) {
+	failures := []error{}
+	policies := make([]model.AccessPolicySpec, 0, len(entries))
+	seen := map[string]struct{}{}
+	for position, entry := range entries {
+		index := position + 1
+		builder := &accessPolicyBuilder{}
+		fields := make([]string, 0, len(entry))
+		for field := range entry {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			value, err := sharedPolicyValue(entry[field])
+			if err != nil {
+				failures = append(failures, fmt.Errorf("access policy file %s: policy %d: %s: %w", path, index, field, err))
+				builder.Invalid = true
+				continue
+			}
+			for _, fieldErr := range builder.set(field, field, value) {
+				failures = append(failures, fmt.Errorf("access policy file %s: policy %d: %w", path, index, fieldErr))
+			}
+		}
+
+		spec, err := builder.build()
+		if err != nil {
+			failures = append(failures, fmt.Errorf("access policy file %s: policy %d %w", path, index, err))
+			continue
+		}
+		if !spec.Managed {
+			failures = append(failures, fmt.Errorf("access policy file %s: policy %d must set an action and include rules", path, index))
+			continue
+		}
+		if spec.Name == "" {
+			failures = append(failures, fmt.Errorf("access policy file %s: policy %d missing name", path, index))
+			continue
+		}
+		if spec.Precedence != 0 {
+			failures = append(failures, fmt.Errorf("access policy file %s: policy %d: precedence is set per app with the cloudflare.access.policy.N.precedence label", path, index))
+			continue
+		}
+		key := strings.ToLower(spec.Name)
+		if _, exists := seen[key]; exists {
+			failures = append(failures, fmt.Errorf("access policy file %s: duplicate policy name %q", path, spec.Name))
+			continue
+		}
+		seen[key] = struct{}{}
+		policies = append(policies, spec)
+	}
+
+	if len(failures) > 0 {
+		return nil, errors.Join(failures...)
+	}
+	return policies, nil
+}
+
+// sharedPolicyValue converts a JSON value to the string form used by labels:
+// lists become comma-separated and booleans become "true" or "false".
+func sharedPolicyValue(value any) (string, error) {
+	switch typed := value.(type) {
+	case string:
+		return typed, nil
+	case bool:
+		return strconv.FormatBool(typed), nil
+	case []any:
+		items := make([]string, 0, len(typed))
+		for _, item := range typed {
+			text, ok := item.(string)
+			if !ok {
+				return "", fmt.Errorf("expected a list of strings")
+			}
+			items = append(items, text)
+		}
+		return strings.Join(items, ","), nil
+	default:
+		return "", fmt.Errorf("expected a string, boolean, or list of strings")
+	}
+}
@@ -0,0 +1,108 @@
+package labels
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/docker"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/model"
+)
+
+func TestLoadSharedPolicies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.json")
+	content := `{"policies": [
+		{"name": "admins", "action": "allow", "include.emails": ["a@example.com", "b@example.com"]},
+		{"name": "office", "action": "bypass", "include.ips": "192.0.2.0/24"}
+	]}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write policy file: %v", err)
+	}
+
+	policies, err := LoadSharedPolicies(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(policies) != 2 {
+		t.Fatalf("expected 2 policies, got %+v", policies)
+	}
+	admins := policies[0]
+	if admins.Name != "admins" || !admins.Managed || len(admins.IncludeEmails) != 2 {
+		t.Fatalf("unexpected admins policy: %+v", admins)
+	}
+	if policies[1].Action != "bypass" || len(policies[1].IncludeIPs) != 1 {
+		t.Fatalf("unexpected office policy: %+v", policies[1])
+	}
+}
+
+func TestLoadSharedPoliciesRejectsInvalidEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.json")
+	content := `{"policies": [
+		{"name": "admins", "action": "allow", "include.emails": "a@example.com"},
+		{"name": "Admins", "action": "allow", "include.emails": "b@example.com"},
+		{"name": "reference"},
+		{"name": "bad", "action": "allow", "include.emails": 3}
+	]}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write policy file: %v", err)
+	}
+
+	_, err := LoadSharedPolicies(path)
+	if err == nil {
+		t.Fatalf("expected error for invalid policy file")
+	}
+	messages := strings.Split(err.Error(), "\n")
+	assertContains(t, messages, `duplicate policy name "Admins"`)
+	assertContains(t, messages, "policy 3 must set an action and include rules")
+	assertContains(t, messages, "policy 4: include.emails: expected a string, boolean, or list of strings")
+}
+
+func TestParseAccessContainersResolvesSharedPolicies(t *testing.T) {
+	parser := NewParserWithSharedPolicies([]model.AccessPolicySpec{
+		{Name: "admins", Action: "allow", IncludeEmails: []string{"a@example.com"}, Managed: true},
+	}, nil)
+
+	containers := []docker.ContainerInfo{
+		{
+			ID:   "1",
+			Name: "app",
+			Labels: map[string]string{
+				AccessLabelEnable:                  "true",
+				AccessLabelAppName:                 "app",
+				AccessLabelAppDomain:               "app.example.com",
+				AccessLabelPolicyPrefix + "1.name": "Admins",
+				AccessLabelPolicyPrefix + "2.name": "manual",
+			},
+		},
+		{
+			ID:   "2",
+			Name: "conflict",
+			Labels: map[string]string{
+				AccessLabelEnable:                            "true",
+				AccessLabelAppName:                           "conflict",
+				AccessLabelAppDomain:                         "conflict.example.com",
+				AccessLabelPolicyPrefix + "1.name":           "admins",
+				AccessLabelPolicyPrefix + "1.action":         "allow",
+				AccessLabelPolicyPrefix + "1.include.emails": "b@example.com",
+			},
+		},
+	}
+
+	apps, errs := parser.ParseAccessContainers(containers)
+	if len(apps) != 1 || len(apps[0].Policies) != 2 {
+		t.Fatalf("expected one app with two policies, got %+v", apps)
+	}
+	shared := apps[0].Policies[0]
+	if shared.Name != "admins" || !shared.Managed || len(shared.IncludeEmails) != 1 {
+		t.Fatalf("expected shared policy definition, got %+v", shared)
+	}
+	if apps[0].Policies[1].Managed {
+		t.Fatalf("expected unknown name to stay a reference, got %+v", apps[0].Policies[1])
+	}
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	assertContains(t, messages, `access policy "admins" for app conflict is defined in the shared policy file`)
+}
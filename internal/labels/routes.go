@@ -0,0 +1,133 @@
+package labels
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/docker"
+)
+
+// routeFileIDPrefix starts the ID of every routes file entry. It sorts after
+// the hexadecimal IDs of Docker containers, so ParseContainers keeps the label
+// route when a file entry defines the same hostname and path.
+const routeFileIDPrefix = "routes-file:"
+
+// routeFileFields lists the cloudflare.tunnel.* labels a routes file entry may
+// set, without the prefix.
+var routeFileFields = map[string]struct{}{
+	"hostname":             {},
+	"hostnames":            {},
+	"service":              {},
+	"path":                 {},
+	"origin.server-name":   {},
+	"origin.no-tls-verify": {},
+	"origin.ca-pool":       {},
+	"origin.proxy-type":    {},
+	"origin.proxy-address": {},
+	"origin.proxy-port":    {},
+	"origin.bastion-mode":  {},
+	"origin.raw":           {},
+	"dns.zone":             {},
+	"dns.proxied":          {},
+	"dns.comment":          {},
+	"name":                 {},
+}
+
+type routeFile struct {
+	Routes []map[string]any `yaml:"routes"`
+}
+
+// LoadRoutesFile reads static routes from a YAML or JSON file. Each entry uses
+// the field names of the cloudflare.tunnel.* labels, for example:
+//
+//	{"routes": [{"hostname": "nas.example.com", "service": "https://192.0.2.10:5001", "origin.no-tls-verify": true}]}
+//
+// Entries are returned as containers carrying the equivalent labels, so
+// ParseContainers validates them with the label rules and detects duplicates
+// across labels and the file.
+func LoadRoutesFile(path string) ([]docker.ContainerInfo, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read routes file %s: %w", path, err)
+	}
+	var decoded routeFile
+	if err := yaml.Unmarshal(content, &decoded); err != nil {
+		return nil, fmt.Errorf("decode routes file %s: %w", path, err)
+	}
+
+	failures := []error{}
+	containers := make([]docker.ContainerInfo, 0, len(decoded.Routes))
+	for position, entry := range decoded.Routes {
+		index := position + 1
+		labels := map[string]string{LabelEnable: "true"}
+		fields := make([]string, 0, len(entry))
+		for field := range entry {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			if _, ok := routeFileFields[field]; !ok {
+				failures = append(failures, fmt.Errorf("routes file %s: route %d: unsupported field %q", path, index, field))
+				continue
+			}
+			value, err := routeFileValue(field, entry[field])
+			if err != nil {
+				failures = append(failures, fmt.Errorf("routes file %s: route %d: %s: %w", path, index, field, err))
+				continue
+			}
+			labels[LabelPrefix+field] = value
+		}
+		containers = append(containers, docker.ContainerInfo{
+			ID:     fmt.Sprintf("%s%06d", routeFileIDPrefix, index),
+			Name:   fmt.Sprintf("%s#%d", path, index),
+			Labels: labels,
+		})
+	}
+
+	if len(failures) > 0 {
+		return nil, errors.Join(failures...)
+	}
+	return containers, nil
+}
+
+// routeFileValue converts a decoded value to the string form used by labels;
+// objects, as set for origin.raw, are encoded as JSON. The hostnames field may
+// also be a list, joined with commas like the label.
+func routeFileValue(field string, value any) (string, error) {
+	if list, ok := value.([]any); ok && field == "hostnames" {
+		items := make([]string, 0, len(list))
+		for _, item := range list {
+			text, ok := item.(string)
+			if !ok {
+				return "", fmt.Errorf("expected a list of strings")
+			}
+			items = append(items, text)
+		}
+		return strings.Join(items, ","), nil
+	}
+	switch typed := value.(type) {
+	case string:
+		return typed, nil
+	case bool:
+		return strconv.FormatBool(typed), nil
+	case int:
+		return strconv.Itoa(typed), nil
+	case float64:
+		return strconv.FormatFloat(typed, 'f', -1, 64), nil
+	case map[string]any:
+		encoded, err := json.Marshal(typed)
+		if err != nil {
+			return "", err
+		}
+		return string(encoded), nil
+	default:
+		return "", fmt.Errorf("expected a string, number, boolean, or object")
+	}
+}
@@ -0,0 +1,127 @@
+package labels
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/docker"
+)
+
+func TestLoadRoutesFileMergesWithLabels(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	content := `routes:
+  - hostname: nas.example.com
+    service: https://192.0.2.10:5001
+    origin.no-tls-verify: true
+    origin.raw:
+      connectTimeout: 10s
+  - hostname: app.example.com
+    service: http://other
+  - hostname: proxmox.example.com
+    service: https://192.0.2.20:8006
+    path: admin
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write routes file: %v", err)
+	}
+
+	fileContainers, err := LoadRoutesFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fileContainers) != 3 {
+		t.Fatalf("expected 3 routes, got %+v", fileContainers)
+	}
+
+	containers := append([]docker.ContainerInfo{
+		{
+			ID:   "f00d",
+			Name: "app",
+			Labels: map[string]string{
+				LabelEnable:  "true",
+				LabelHost:    "app.example.com",
+				LabelService: "http://app",
+			},
+		},
+	}, fileContainers...)
+	routes, errs := NewParser().ParseContainers(containers)
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	assertContains(t, messages, "duplicate route definition for app.example.com")
+	assertContains(t, messages, "container "+path+"#3: "+LabelPath+" must start with '/'")
+	if len(routes) != 2 {
+		t.Fatalf("expected the label route and the NAS route, got %+v", routes)
+	}
+	if routes[0].Service != "http://app" {
+		t.Fatalf("expected the label route to win the duplicate, got %+v", routes[0])
+	}
+	nas := routes[1]
+	if nas.Key.Hostname != "nas.example.com" || nas.NoTLSVerify == nil || !*nas.NoTLSVerify || nas.OriginRaw["connectTimeout"] != "10s" {
+		t.Fatalf("unexpected NAS route: %+v", nas)
+	}
+	if nas.Source.ContainerName != path+"#1" {
+		t.Fatalf("expected the file entry as source, got %+v", nas.Source)
+	}
+}
+
+func TestLoadRoutesFileAcceptsJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.json")
+	content := `{"routes": [{"hostname": "nas.example.com", "service": "https://192.0.2.10:5001", "dns.proxied": false}]}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write routes file: %v", err)
+	}
+
+	containers, err := LoadRoutesFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(containers) != 1 || containers[0].Labels[LabelDNSProxied] != "false" || containers[0].Labels[LabelEnable] != "true" {
+		t.Fatalf("unexpected routes: %+v", containers)
+	}
+}
+
+func TestLoadRoutesFileAcceptsHostnamesList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	content := `routes:
+  - hostnames: [nas.example.com, files.example.com]
+    service: https://192.0.2.10:5001
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write routes file: %v", err)
+	}
+
+	containers, err := LoadRoutesFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	routes, errs := NewParser().ParseContainers(containers)
+	if len(errs) != 0 || len(routes) != 2 || routes[1].Key.Hostname != "files.example.com" {
+		t.Fatalf("unexpected routes %+v, errors %v", routes, errs)
+	}
+}
+
+func TestLoadRoutesFileRejectsInvalidEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	content := `routes:
+  - hostname: nas.example.com
+    service: https://192.0.2.10:5001
+    fallback: true
+  - hostname: app.example.com
+    service: [http://a, http://b]
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write routes file: %v", err)
+	}
+
+	_, err := LoadRoutesFile(path)
+	if err == nil {
+		t.Fatalf("expected error for invalid routes file")
+	}
+	messages := strings.Split(err.Error(), "\n")
+	assertContains(t, messages, `route 1: unsupported field "fallback"`)
+	assertContains(t, messages, "route 2: service: expected a string, number, boolean, or object")
+}
@@ -1,22 +1,79 @@
 package model
 
+import "strings"
+
 // AccessAppSpec describes the desired Access application state.
 type AccessAppSpec struct {
-	ID       string
-	Name     string
-	Domain   string
-	Policies []AccessPolicySpec
-	Tags     []string
-	TagsSet  bool
-	Source   SourceRef
+	ID                 string
+	Name               string
+	Domain             string
+	Type               string
+	Policies           []AccessPolicySpec
+	Tags               []string
+	TagsSet            bool
+	AppLauncherVisible *bool
+	LogoURL            *string
+	AllowedIdPs        []string
+	DenyMessage        *string
+	DenyURL            *string
+	AutoRedirect       *bool
+	SkipInterstitial   *bool
+	IsolationRequired  *bool
+	SkipLauncherLogin  *bool
+	HTTPOnlyCookie     *bool
+	SameSiteCookie     *string
+	CustomPages        []string
+	CORS               *AccessCORSSpec
+	Merge              bool
+	Source             SourceRef
+}
+
+// AccessCORSSpec describes the desired CORS settings of an Access app.
+type AccessCORSSpec struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	AllowAllOrigins  bool
+	AllowAllMethods  bool
+	AllowAllHeaders  bool
+	AllowCredentials bool
+	MaxAge           int
 }
 
 // AccessPolicySpec describes the desired Access policy state.
 type AccessPolicySpec struct {
-	ID            string
-	Name          string
-	Action        string
-	IncludeEmails []string
-	IncludeIPs    []string
-	Managed       bool
+	ID                     string
+	Name                   string
+	Action                 string
+	IncludeEmails          []string
+	IncludeIPs             []string
+	IncludeGroups          []string
+	IncludeEmailDomains    []string
+	IncludeCountries       []string
+	IncludeServiceTokens   []string
+	IncludeAnyServiceToken bool
+	IncludeCommonNames     []string
+	IncludeCertificate     bool
+	IncludeEveryone        bool
+	RequireAuthMethod      string
+	// Precedence is set by policy.N.precedence; 0 means the label order.
+	Precedence int
+	Managed    bool
+}
+
+// NormalizeAccessDomain returns the form of an Access app domain used to match
+// apps: the hostname is lowercased and any path is kept as-is, since Access
+// paths are case-sensitive.
+func NormalizeAccessDomain(domain string) string {
+	domain = strings.TrimSpace(domain)
+	// Bookmark apps store a full URL; keep the scheme and normalize the rest.
+	if scheme, rest, ok := strings.Cut(domain, "://"); ok {
+		return strings.ToLower(scheme) + "://" + NormalizeAccessDomain(rest)
+	}
+	host, path, hasPath := strings.Cut(domain, "/")
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if !hasPath || path == "" {
+		return host
+	}
+	return host + "/" + path
 }
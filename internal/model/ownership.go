@@ -16,6 +16,12 @@ func AccessManagedTag(value string) string {
 	return "managed-by=" + ManagedByValue(value)
 }
 
+// AccessPolicyManagedSuffix marks policy names owned by this controller, since
+// Access policies cannot carry tags.
+func AccessPolicyManagedSuffix(value string) string {
+	return " [" + AccessManagedTag(value) + "]"
+}
+
 func DNSManagedComment(value string) string {
 	return "managed-by=" + ManagedByValue(value)
 }
@@ -0,0 +1,43 @@
+package model
+
+import "strings"
+
+// ProtectedHostnames lists hostnames, from SYNC_PROTECTED_HOSTNAMES, whose
+// ingress rules, DNS records, and Access apps are never removed or rewritten.
+// Entries are lowercase; a "*.example.com" entry matches every subdomain of
+// example.com but not example.com itself.
+type ProtectedHostnames []string
+
+// Match reports whether hostname is protected.
+func (protected ProtectedHostnames) Match(hostname string) bool {
+	hostname = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(hostname), "."))
+	if hostname == "" {
+		return false
+	}
+	for _, entry := range protected {
+		if suffix, ok := strings.CutPrefix(entry, "*"); ok {
+			if strings.HasSuffix(hostname, suffix) && len(hostname) > len(suffix) {
+				return true
+			}
+			continue
+		}
+		if hostname == entry {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchAccessDomain reports whether the hostname of an Access app domain,
+// which may carry a path or, for bookmarks, a scheme, is protected.
+func (protected ProtectedHostnames) MatchAccessDomain(domain string) bool {
+	domain = NormalizeAccessDomain(domain)
+	if _, rest, ok := strings.Cut(domain, "://"); ok {
+		domain = rest
+	}
+	host, _, _ := strings.Cut(domain, "/")
+	if name, _, ok := strings.Cut(host, ":"); ok {
+		host = name
+	}
+	return protected.Match(host)
+}
@@ -0,0 +1,60 @@
+package model
+
+import (
+	"slices"
+	"strings"
+	"sync"
+)
+
+// RemovalGuard holds back a sync that would remove more resources at once
+// than SYNC_MAX_REMOVALS allows, as happens when the Docker daemon briefly
+// returns no containers. Held-back removals proceed when the next sync asks
+// for exactly the same removals again, or right away with
+// SYNC_FORCE_REMOVALS. A nil guard allows every removal.
+type RemovalGuard struct {
+	limit int
+	force bool
+
+	mu sync.Mutex
+	// pending maps each scope to the removals last held back in it.
+	pending map[string]string
+}
+
+// NewRemovalGuard returns nil when limit is zero, which disables the guard.
+func NewRemovalGuard(limit int, force bool) *RemovalGuard {
+	if limit <= 0 {
+		return nil
+	}
+	return &RemovalGuard{limit: limit, force: force, pending: map[string]string{}}
+}
+
+// Limit returns the number of removals allowed at once.
+func (guard *RemovalGuard) Limit() int {
+	if guard == nil {
+		return 0
+	}
+	return guard.limit
+}
+
+// Allow reports whether the removals named by keys may proceed. Each scope,
+// such as the tunnel ingress, a DNS zone, or Access apps, is counted and
+// confirmed separately.
+func (guard *RemovalGuard) Allow(scope string, keys []string) bool {
+	if guard == nil {
+		return true
+	}
+	guard.mu.Lock()
+	defer guard.mu.Unlock()
+
+	if len(keys) <= guard.limit || guard.force {
+		delete(guard.pending, scope)
+		return true
+	}
+	removals := strings.Join(slices.Sorted(slices.Values(keys)), "\n")
+	if guard.pending[scope] == removals {
+		delete(guard.pending, scope)
+		return true
+	}
+	guard.pending[scope] = removals
+	return false
+}
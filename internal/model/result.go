@@ -0,0 +1,92 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Resources reported in a SyncResult.
+const (
+	ResourceRoute        = "route"
+	ResourceDNSRecord    = "DNS record"
+	ResourceAccessApp    = "Access app"
+	ResourceAccessPolicy = "Access policy"
+)
+
+// Actions reported in a SyncResult.
+const (
+	ActionCreated = "created"
+	ActionUpdated = "updated"
+	ActionDeleted = "deleted"
+)
+
+// SyncChange is one resource an engine created, updated, or deleted, or
+// would have in dry-run.
+type SyncChange struct {
+	Resource string
+	Action   string
+	Name     string
+}
+
+// SyncResult lists the changes made by one engine's Reconcile.
+//
+// UnmatchedHostnames counts the desired hostnames whose DNS zone is not in
+// the Cloudflare account, so they get no DNS record.
+//
+// AccessDrift counts the differences found by SYNC_ACCESS_DRIFT_CHECK.
+type SyncResult struct {
+	Changes            []SyncChange
+	UnmatchedHostnames int
+	AccessDrift        int
+}
+
+// Add records a change.
+func (result *SyncResult) Add(resource string, action string, name string) {
+	result.Changes = append(result.Changes, SyncChange{Resource: resource, Action: action, Name: name})
+}
+
+// Merge appends the changes of other and adds up the unmatched hostnames and
+// Access drift.
+func (result *SyncResult) Merge(other SyncResult) {
+	result.Changes = append(result.Changes, other.Changes...)
+	result.UnmatchedHostnames += other.UnmatchedHostnames
+	result.AccessDrift += other.AccessDrift
+}
+
+// Count returns the number of changes of a resource with the given action.
+func (result SyncResult) Count(resource string, action string) int {
+	count := 0
+	for _, change := range result.Changes {
+		if change.Resource == resource && change.Action == action {
+			count++
+		}
+	}
+	return count
+}
+
+// Summary describes the counts in a sentence such as "created 2 route(s),
+// deleted 1 DNS record(s)", in the order changes were first recorded, or
+// "no changes".
+func (result SyncResult) Summary() string {
+	type countKey struct {
+		action   string
+		resource string
+	}
+	order := []countKey{}
+	counts := map[countKey]int{}
+	for _, change := range result.Changes {
+		key := countKey{action: change.Action, resource: change.Resource}
+		if _, ok := counts[key]; !ok {
+			order = append(order, key)
+		}
+		counts[key]++
+	}
+	if len(order) == 0 {
+		return "no changes"
+	}
+	parts := make([]string, 0, len(order))
+	for _, key := range order {
+		parts = append(parts, fmt.Sprintf("%s %d %s(s)", key.action, counts[key], key.resource))
+	}
+	return strings.Join(parts, ", ")
+}
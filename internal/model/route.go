@@ -26,7 +26,21 @@ type RouteSpec struct {
 	Key              RouteKey
 	Service          string
 	DNSZoneOverride  string
+	DNSProxied       *bool
 	OriginServerName *string
 	NoTLSVerify      *bool
-	Source           SourceRef
+	CAPool           *string
+	ProxyType        *string
+	ProxyAddress     *string
+	ProxyPort        *uint16
+	BastionMode      *bool
+	OriginRaw        map[string]any
+	Fallback         bool
+	// DNSComment is the note written after the managed marker in the DNS
+	// record comment; nil keeps the note of an existing record.
+	DNSComment *string
+	// Tunnel names the CF_TUNNEL_IDS tunnel the route belongs to; empty for
+	// the CF_TUNNEL_ID tunnel.
+	Tunnel string
+	Source SourceRef
 }
@@ -0,0 +1,134 @@
+package reconcile
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"log/slog"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/cloudflare"
+)
+
+const (
+	backupPrefix     = "tunnel-config-"
+	backupTimeLayout = "20060102T150405.000000000Z"
+)
+
+// Backups writes the tunnel configuration to SYNC_BACKUP_DIR before it is
+// replaced, keeping the newest SYNC_BACKUP_KEEP files, so a bad sync can be
+// undone with SYNC_RESTORE_FROM.
+type Backups struct {
+	dir  string
+	keep int
+	log  *slog.Logger
+	now  func() time.Time
+}
+
+// NewBackups returns nil when dir is empty, which disables backups.
+func NewBackups(dir string, keep int, logger *slog.Logger) *Backups {
+	if dir == "" {
+		return nil
+	}
+	return &Backups{dir: dir, keep: keep, log: logger, now: time.Now}
+}
+
+// save writes the full raw configuration, not only the ingress, to a new
+// timestamped file and removes the oldest files beyond the limit. It returns
+// the path of the new backup. Failing to remove an old file is only logged,
+// since the new backup was written.
+func (backups *Backups) save(config cloudflare.TunnelConfig) (string, error) {
+	content, err := json.MarshalIndent(config.Raw, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(backups.dir, 0o755); err != nil {
+		return "", fmt.Errorf("create backup directory %s: %w", backups.dir, err)
+	}
+
+	path := filepath.Join(backups.dir, backupPrefix+backups.now().UTC().Format(backupTimeLayout)+".json")
+	temp, err := os.CreateTemp(backups.dir, ".backup-*.json")
+	if err != nil {
+		return "", fmt.Errorf("write backup %s: %w", path, err)
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(append(content, '\n')); err != nil {
+		temp.Close()
+		return "", fmt.Errorf("write backup %s: %w", path, err)
+	}
+	if err := temp.Close(); err != nil {
+		return "", fmt.Errorf("write backup %s: %w", path, err)
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return "", fmt.Errorf("write backup %s: %w", path, err)
+	}
+	if err := backups.rotate(); err != nil {
+		backups.log.Warn("failed to remove old tunnel config backups", "dir", backups.dir, "error", err)
+	}
+	return path, nil
+}
+
+// rotate removes the oldest backups beyond the limit. File names sort in
+// creation order.
+func (backups *Backups) rotate() error {
+	entries, err := os.ReadDir(backups.dir)
+	if err != nil {
+		return fmt.Errorf("list backups in %s: %w", backups.dir, err)
+	}
+	names := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasPrefix(entry.Name(), backupPrefix) && strings.HasSuffix(entry.Name(), ".json") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	for len(names) > backups.keep {
+		if err := os.Remove(filepath.Join(backups.dir, names[0])); err != nil {
+			return fmt.Errorf("remove old backup: %w", err)
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// Restore replaces the tunnel configuration with a backup written by Backups.
+// The current configuration is backed up first when backups is set, so the
+// restore can be undone as well. In dry-run mode nothing is written.
+func Restore(ctx context.Context, api cloudflare.API, backups *Backups, path string, dryRun bool) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read backup %s: %w", path, err)
+	}
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return fmt.Errorf("decode backup %s: %w", path, err)
+	}
+	ingress := []cloudflare.IngressRule{}
+	if err := json.Unmarshal(raw["ingress"], &ingress); err != nil {
+		return fmt.Errorf("decode backup %s: invalid ingress rules: %w", path, err)
+	}
+	if err := validateIngress(ingress); err != nil {
+		return fmt.Errorf("refusing to restore backup %s that fails validation: %w", path, err)
+	}
+	if dryRun {
+		return nil
+	}
+
+	if backups != nil {
+		current, err := api.GetConfig(ctx)
+		if err != nil {
+			return fmt.Errorf("get tunnel config: %w", err)
+		}
+		if _, err := backups.save(current); err != nil {
+			return fmt.Errorf("back up tunnel config: %w", err)
+		}
+	}
+	// A nil Ingress sends the backed-up ingress exactly as saved.
+	return api.UpdateConfig(ctx, cloudflare.TunnelConfig{Raw: raw})
+}
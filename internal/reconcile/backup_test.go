@@ -0,0 +1,193 @@
+package reconcile
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"log/slog"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/cloudflare"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/model"
+)
+
+func backupTestConfig(hostname string) cloudflare.TunnelConfig {
+	ingress := []cloudflare.IngressRule{{Hostname: hostname, Service: "http://a"}, {Service: model.FallbackService}}
+	rawIngress, _ := json.Marshal(ingress)
+	return cloudflare.TunnelConfig{Ingress: ingress, Raw: map[string]json.RawMessage{
+		"ingress":      rawIngress,
+		"warp-routing": json.RawMessage(`{"enabled":true}`),
+	}}
+}
+
+func listBackups(t *testing.T, dir string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(dir, backupPrefix+"*.json"))
+	if err != nil {
+		t.Fatalf("list backups: %v", err)
+	}
+	return matches
+}
+
+func TestBackupsRotateOldestFiles(t *testing.T) {
+	dir := t.TempDir()
+	backups := NewBackups(dir, 2, slog.New(slog.NewTextHandler(testWriter{t}, nil)))
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	backups.now = func() time.Time { return now }
+
+	paths := []string{}
+	for i := 0; i < 3; i++ {
+		path, err := backups.save(backupTestConfig("a.example.com"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		paths = append(paths, path)
+		now = now.Add(time.Minute)
+	}
+
+	remaining := listBackups(t, dir)
+	if len(remaining) != 2 || remaining[0] != paths[1] || remaining[1] != paths[2] {
+		t.Fatalf("expected the 2 newest backups to be kept, got %v", remaining)
+	}
+}
+
+func TestEngineReconcileBacksUpConfigBeforeUpdate(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	api := &stubAPI{config: backupTestConfig("a.example.com")}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService, Backups: NewBackups(dir, 10, logger)})
+
+	if _, err := engine.Reconcile(ctx, []model.RouteSpec{{Key: model.RouteKey{Hostname: "b.example.com"}, Service: "http://b"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !api.updated {
+		t.Fatalf("expected the tunnel to be updated")
+	}
+	backupFiles := listBackups(t, dir)
+	if len(backupFiles) != 1 {
+		t.Fatalf("expected 1 backup, got %v", backupFiles)
+	}
+	content, err := os.ReadFile(backupFiles[0])
+	if err != nil {
+		t.Fatalf("read backup: %v", err)
+	}
+	saved := map[string]json.RawMessage{}
+	if err := json.Unmarshal(content, &saved); err != nil {
+		t.Fatalf("decode backup: %v", err)
+	}
+	if compactJSON(t, saved["warp-routing"]) != `{"enabled":true}` {
+		t.Fatalf("expected the full raw config in the backup, got %s", content)
+	}
+	if !json.Valid(saved["ingress"]) || !containsHostname(t, saved["ingress"], "a.example.com") {
+		t.Fatalf("expected the pre-change ingress in the backup, got %s", content)
+	}
+}
+
+func TestEngineReconcileBacksUpOncePerSync(t *testing.T) {
+	dir := t.TempDir()
+	unavailable := &cloudflare.StatusError{StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable"}
+	api := &flakyAPI{stubAPI: stubAPI{config: backupTestConfig("a.example.com")}, updateErrs: []error{unavailable, unavailable, unavailable}}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService, Retries: 3, Backups: NewBackups(dir, 10, logger)})
+	engine.retryDelay = time.Millisecond
+
+	if _, err := engine.Reconcile(context.Background(), []model.RouteSpec{{Key: model.RouteKey{Hostname: "b.example.com"}, Service: "http://b"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.updateCalls != 4 {
+		t.Fatalf("expected the update to succeed on the last retry, got %d attempts", api.updateCalls)
+	}
+	if backupFiles := listBackups(t, dir); len(backupFiles) != 1 {
+		t.Fatalf("expected a single backup for the sync and its retries, got %v", backupFiles)
+	}
+}
+
+func TestEngineReconcileDryRunWritesNoBackup(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	api := &stubAPI{config: backupTestConfig("a.example.com")}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{DryRun: true, ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService, Backups: NewBackups(dir, 10, logger)})
+
+	if _, err := engine.Reconcile(ctx, []model.RouteSpec{{Key: model.RouteKey{Hostname: "b.example.com"}, Service: "http://b"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.updated {
+		t.Fatalf("expected no update in dry-run mode")
+	}
+	if backupFiles := listBackups(t, dir); len(backupFiles) != 0 {
+		t.Fatalf("expected no backups in dry-run mode, got %v", backupFiles)
+	}
+}
+
+func TestRestoreSendsBackupAndBacksUpCurrentConfig(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	backups := NewBackups(dir, 10, slog.New(slog.NewTextHandler(testWriter{t}, nil)))
+	path, err := backups.save(backupTestConfig("a.example.com"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	backups.now = func() time.Time { return time.Now().Add(time.Hour) }
+
+	api := &stubAPI{config: backupTestConfig("b.example.com")}
+	if err := Restore(ctx, api, backups, path, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.updated {
+		t.Fatalf("expected no update in dry-run mode")
+	}
+
+	if err := Restore(ctx, api, backups, path, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !api.updated || api.config.Ingress != nil || !containsHostname(t, api.config.Raw["ingress"], "a.example.com") || compactJSON(t, api.config.Raw["warp-routing"]) != `{"enabled":true}` {
+		t.Fatalf("expected the backed-up raw config to be sent, got %+v", api.config)
+	}
+	if backupFiles := listBackups(t, dir); len(backupFiles) != 2 {
+		t.Fatalf("expected the current config to be backed up before restoring, got %v", backupFiles)
+	}
+}
+
+func TestRestoreRejectsInvalidBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backup.json")
+	if err := os.WriteFile(path, []byte(`{"ingress": [{"hostname": "a.example.com", "service": "http://a"}]}`), 0o600); err != nil {
+		t.Fatalf("write backup: %v", err)
+	}
+	api := &stubAPI{}
+	if err := Restore(context.Background(), api, nil, path, false); err == nil {
+		t.Fatalf("expected an error for a backup without a catch-all rule")
+	}
+	if api.updated {
+		t.Fatalf("expected no update for an invalid backup")
+	}
+}
+
+func containsHostname(t *testing.T, raw json.RawMessage, hostname string) bool {
+	t.Helper()
+	rules := []cloudflare.IngressRule{}
+	if err := json.Unmarshal(raw, &rules); err != nil {
+		t.Fatalf("decode ingress: %v", err)
+	}
+	for _, rule := range rules {
+		if rule.Hostname == hostname {
+			return true
+		}
+	}
+	return false
+}
+
+func compactJSON(t *testing.T, raw json.RawMessage) string {
+	t.Helper()
+	var buffer bytes.Buffer
+	if err := json.Compact(&buffer, raw); err != nil {
+		t.Fatalf("compact JSON: %v", err)
+	}
+	return buffer.String()
+}
@@ -0,0 +1,139 @@
+package reconcile
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"log/slog"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/cloudflare"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/model"
+)
+
+// catchAllRuleKey names the rule without hostname or path in diffs.
+const catchAllRuleKey = "catch-all"
+
+// Ingress change actions reported by diffIngress.
+const (
+	ingressRuleAdded   = "added"
+	ingressRuleRemoved = "removed"
+	ingressRuleChanged = "changed"
+)
+
+// ingressChange describes how one rule differs between the existing and the
+// desired ingress. Before is nil for added rules and After for removed ones.
+type ingressChange struct {
+	Action string
+	Rule   string
+	Before *cloudflare.IngressRule
+	After  *cloudflare.IngressRule
+}
+
+// diffIngress compares rules by hostname and path, in desired order followed
+// by removed rules in existing order. Only the first rule per key is compared,
+// as cloudflared ignores later duplicates.
+func diffIngress(existing []cloudflare.IngressRule, desired []cloudflare.IngressRule) []ingressChange {
+	existingByKey := map[string]cloudflare.IngressRule{}
+	for _, rule := range existing {
+		key := ingressDiffKey(rule)
+		if _, ok := existingByKey[key]; !ok {
+			existingByKey[key] = rule
+		}
+	}
+
+	changes := []ingressChange{}
+	desiredKeys := map[string]struct{}{}
+	for index := range desired {
+		after := desired[index]
+		key := ingressDiffKey(after)
+		if _, done := desiredKeys[key]; done {
+			continue
+		}
+		desiredKeys[key] = struct{}{}
+		before, found := existingByKey[key]
+		if !found {
+			changes = append(changes, ingressChange{Action: ingressRuleAdded, Rule: key, After: &after})
+			continue
+		}
+		if !ingressEqual([]cloudflare.IngressRule{before}, []cloudflare.IngressRule{after}) {
+			changes = append(changes, ingressChange{Action: ingressRuleChanged, Rule: key, Before: &before, After: &after})
+		}
+	}
+
+	removedKeys := map[string]struct{}{}
+	for index := range existing {
+		before := existing[index]
+		key := ingressDiffKey(before)
+		if _, wanted := desiredKeys[key]; wanted {
+			continue
+		}
+		if _, done := removedKeys[key]; done {
+			continue
+		}
+		removedKeys[key] = struct{}{}
+		changes = append(changes, ingressChange{Action: ingressRuleRemoved, Rule: key, Before: &before})
+	}
+
+	return changes
+}
+
+// ingressResult reports ingress changes as route changes.
+func ingressResult(changes []ingressChange) model.SyncResult {
+	actions := map[string]string{ingressRuleAdded: model.ActionCreated, ingressRuleChanged: model.ActionUpdated, ingressRuleRemoved: model.ActionDeleted}
+	result := model.SyncResult{}
+	for _, change := range changes {
+		result.Add(model.ResourceRoute, actions[change.Action], change.Rule)
+	}
+	return result
+}
+
+func ingressDiffKey(rule cloudflare.IngressRule) string {
+	key := ingressRuleKey(rule)
+	if key == "" {
+		return catchAllRuleKey
+	}
+	return key
+}
+
+// logIngressDiff logs each change as a "change" group: at info level in
+// dry-run, where it is the only record of what would happen, and at debug
+// level otherwise. Removed and changed rules name the container that last
+// defined them, when known.
+func (engine *Engine) logIngressDiff(ctx context.Context, changes []ingressChange) {
+	level := slog.LevelDebug
+	if engine.dryRun {
+		level = slog.LevelInfo
+	}
+	if !engine.log.Enabled(ctx, level) {
+		return
+	}
+	for _, change := range changes {
+		attrs := []any{slog.String("action", change.Action), slog.String("rule", change.Rule)}
+		if change.Before != nil {
+			attrs = append(attrs, engine.sources.attrs(ruleKey(*change.Before))...)
+			attrs = append(attrs, slog.String("before_service", change.Before.Service))
+			if origin := compactOriginRequest(change.Before.OriginRequest); origin != "" {
+				attrs = append(attrs, slog.String("before_origin_request", origin))
+			}
+		}
+		if change.After != nil {
+			attrs = append(attrs, slog.String("after_service", change.After.Service))
+			if origin := compactOriginRequest(change.After.OriginRequest); origin != "" {
+				attrs = append(attrs, slog.String("after_origin_request", origin))
+			}
+		}
+		engine.log.Log(ctx, level, "ingress rule diff", slog.Group("change", attrs...))
+	}
+}
+
+func compactOriginRequest(raw json.RawMessage) string {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return ""
+	}
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, raw); err != nil {
+		return string(raw)
+	}
+	return compacted.String()
+}
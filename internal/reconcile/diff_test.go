@@ -0,0 +1,93 @@
+package reconcile
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/cloudflare"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/model"
+)
+
+func TestDiffIngressReportsAddedRemovedAndChangedRules(t *testing.T) {
+	existing := []cloudflare.IngressRule{
+		{Hostname: "kept.example.com", Service: "http://kept"},
+		{Hostname: "changed.example.com", Service: "http://old", OriginRequest: []byte(`{"noTLSVerify": true}`)},
+		{Hostname: "gone.example.com", Path: "/api", Service: "http://gone"},
+		{Service: model.FallbackService},
+	}
+	desired := []cloudflare.IngressRule{
+		{Hostname: "kept.example.com", Service: "http://kept"},
+		{Hostname: "changed.example.com", Service: "http://new", OriginRequest: []byte(`{"noTLSVerify":false}`)},
+		{Hostname: "new.example.com", Service: "http://new"},
+		{Service: "http://error-pages:8080"},
+	}
+
+	changes := diffIngress(existing, desired)
+	if len(changes) != 4 {
+		t.Fatalf("expected 4 changes, got %+v", changes)
+	}
+
+	changed := changes[0]
+	if changed.Action != ingressRuleChanged || changed.Rule != "changed.example.com" {
+		t.Fatalf("unexpected first change: %+v", changed)
+	}
+	if changed.Before.Service != "http://old" || changed.After.Service != "http://new" {
+		t.Fatalf("expected before and after services, got %+v", changed)
+	}
+	if changes[1].Action != ingressRuleAdded || changes[1].Rule != "new.example.com" || changes[1].Before != nil {
+		t.Fatalf("unexpected added change: %+v", changes[1])
+	}
+	if changes[2].Action != ingressRuleChanged || changes[2].Rule != catchAllRuleKey {
+		t.Fatalf("expected catch-all change, got %+v", changes[2])
+	}
+	if changes[3].Action != ingressRuleRemoved || changes[3].Rule != "gone.example.com/api" || changes[3].After != nil {
+		t.Fatalf("unexpected removed change: %+v", changes[3])
+	}
+}
+
+func TestLogIngressDiffInDryRun(t *testing.T) {
+	var output bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&output, nil))
+	engine := NewEngine(nil, logger, Options{DryRun: true, ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService})
+
+	engine.logIngressDiff(context.Background(), []ingressChange{
+		{
+			Action: ingressRuleChanged,
+			Rule:   "app.example.com",
+			Before: &cloudflare.IngressRule{Hostname: "app.example.com", Service: "http://old", OriginRequest: []byte(`{ "noTLSVerify": true }`)},
+			After:  &cloudflare.IngressRule{Hostname: "app.example.com", Service: "http://new"},
+		},
+	})
+
+	logged := output.String()
+	for _, want := range []string{
+		"change.action=changed",
+		"change.rule=app.example.com",
+		"change.before_service=http://old",
+		`change.before_origin_request="{\"noTLSVerify\":true}"`,
+		"change.after_service=http://new",
+	} {
+		if !strings.Contains(logged, want) {
+			t.Fatalf("expected %q in log output, got %s", want, logged)
+		}
+	}
+	if strings.Contains(logged, "after_origin_request") {
+		t.Fatalf("expected empty originRequest to be omitted, got %s", logged)
+	}
+}
+
+func TestLogIngressDiffUsesDebugOutsideDryRun(t *testing.T) {
+	var output bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&output, nil))
+	engine := NewEngine(nil, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService})
+
+	engine.logIngressDiff(context.Background(), []ingressChange{
+		{Action: ingressRuleAdded, Rule: "app.example.com", After: &cloudflare.IngressRule{Hostname: "app.example.com", Service: "http://app"}},
+	})
+	if output.Len() != 0 {
+		t.Fatalf("expected no diff at info level outside dry-run, got %s", output.String())
+	}
+}
@@ -4,12 +4,17 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"reflect"
 	"sort"
+	"strings"
+	"time"
 
 	"log/slog"
 
 	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/cloudflare"
 	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/model"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/state"
 )
 
 // Engine reconciles desired routes against the tunnel configuration.
@@ -18,57 +23,427 @@ type Engine struct {
 	log          *slog.Logger
 	dryRun       bool
 	manageTunnel bool
+	// ignoreConfigSrc is true when SYNC_IGNORE_CONFIG_SRC skips the check that
+	// the tunnel is remotely managed.
+	ignoreConfigSrc bool
+	// remoteConfig records that the tunnel was seen remotely managed, so the
+	// check runs until it passes once; localConfigLogged avoids repeating the
+	// error on every sync.
+	remoteConfig      bool
+	localConfigLogged bool
+	// deleteRoutes is false when SYNC_DELETE_ROUTES makes the sync additive:
+	// rules no longer defined by labels are kept instead of removed.
+	deleteRoutes bool
+	// enforceOrder is false when SYNC_ENFORCE_RULE_ORDER lets rules keep the
+	// order set in the dashboard: only content differences trigger an update.
+	enforceOrder bool
+	// appendFallback is false when SYNC_TUNNEL_APPEND_FALLBACK disables the
+	// injected http_status:404 rule; the existing catch-all is kept instead.
+	appendFallback bool
+	// fallbackService is the service of the appended catch-all rule, from
+	// SYNC_FALLBACK_SERVICE.
+	fallbackService string
+	// store records which routes this controller owns and which default and
+	// origin.raw originRequest keys it applied, so a key dropped from
+	// SYNC_DEFAULT_ORIGIN_REQUEST or from a route's origin.raw label is
+	// removed from its rule. It may be nil.
+	store *state.Store
+	// preserveUnmanaged keeps ingress rules for routes store never recorded
+	// instead of removing them; false with SYNC_TAKE_OVER_RULES.
+	preserveUnmanaged bool
+	// protected hostnames keep their existing ingress rules verbatim, from
+	// SYNC_PROTECTED_HOSTNAMES.
+	protected model.ProtectedHostnames
+	// originDefaults are the SYNC_DEFAULT_ORIGIN_REQUEST keys applied to every
+	// label-defined route before its origin labels.
+	originDefaults map[string]any
+	// lastApplied is the ingress last written or found up-to-date; it is nil
+	// until the first such sync.
+	lastApplied []cloudflare.IngressRule
+	// retries is the number of times a sync failing with a retryable
+	// Cloudflare error is run again, from SYNC_TUNNEL_RETRIES; retryDelay is
+	// the first backoff delay, doubled on each attempt.
+	retries    int
+	retryDelay time.Duration
+	// backups saves the configuration before each update; it is nil unless
+	// SYNC_BACKUP_DIR is set.
+	backups *Backups
+	// removals holds back updates removing more rules at once than
+	// SYNC_MAX_REMOVALS allows; nil when unlimited.
+	removals *model.RemovalGuard
+	// warpRouting is the warp-routing.enabled value from SYNC_WARP_ROUTING;
+	// nil leaves the setting alone.
+	warpRouting *bool
+	// sources remembers the container that last defined each route, for
+	// removal and change logs.
+	sources routeSources
 }
 
-func NewEngine(api cloudflare.API, logger *slog.Logger, dryRun bool, manageTunnel bool) *Engine {
-	return &Engine{api: api, log: logger, dryRun: dryRun, manageTunnel: manageTunnel}
+// Options configures an Engine; each field sets the Engine field of the same
+// name.
+type Options struct {
+	DryRun            bool
+	ManageTunnel      bool
+	IgnoreConfigSrc   bool
+	DeleteRoutes      bool
+	EnforceOrder      bool
+	AppendFallback    bool
+	FallbackService   string
+	Store             *state.Store
+	PreserveUnmanaged bool
+	Protected         model.ProtectedHostnames
+	OriginDefaults    map[string]any
+	Retries           int
+	Backups           *Backups
+	Removals          *model.RemovalGuard
+	WarpRouting       *bool
 }
 
-func (engine *Engine) Reconcile(ctx context.Context, desired []model.RouteSpec) error {
+func NewEngine(api cloudflare.API, logger *slog.Logger, options Options) *Engine {
+	return &Engine{
+		api:               api,
+		log:               logger,
+		dryRun:            options.DryRun,
+		manageTunnel:      options.ManageTunnel,
+		ignoreConfigSrc:   options.IgnoreConfigSrc,
+		deleteRoutes:      options.DeleteRoutes,
+		enforceOrder:      options.EnforceOrder,
+		appendFallback:    options.AppendFallback,
+		fallbackService:   options.FallbackService,
+		store:             options.Store,
+		preserveUnmanaged: options.PreserveUnmanaged,
+		protected:         options.Protected,
+		originDefaults:    options.OriginDefaults,
+		retries:           options.Retries,
+		retryDelay:        defaultRetryDelay,
+		backups:           options.Backups,
+		removals:          options.Removals,
+		warpRouting:       options.WarpRouting,
+	}
+}
+
+// Reconcile updates the tunnel ingress to match the desired routes. The result
+// lists each rule added, changed, or removed, including in dry-run. A sync
+// failing with a retryable Cloudflare error is retried, see reconcileWithRetry.
+func (engine *Engine) Reconcile(ctx context.Context, desired []model.RouteSpec) (model.SyncResult, error) {
+	return engine.reconcileWithRetry(ctx, desired)
+}
+
+// reconcileOnce runs one attempt of a sync, reading the tunnel configuration
+// first.
+func (engine *Engine) reconcileOnce(ctx context.Context, desired []model.RouteSpec, cycle *syncCycle) (model.SyncResult, error) {
 	config, err := engine.api.GetConfig(ctx)
 	if err != nil {
-		return err
+		return model.SyncResult{}, err
 	}
+	desired = engine.withoutProtectedRoutes(desired)
 
 	existingIngress := config.Ingress
+	engine.detectExternalChanges(existingIngress)
 	desiredIngress, removedRules := engine.buildDesiredIngress(desired, existingIngress)
 	ingressMatches := ingressEqual(existingIngress, desiredIngress)
+	if !ingressMatches && !engine.enforceOrder {
+		ingressMatches = ingressEqualIgnoringOrder(existingIngress, desiredIngress)
+	}
+
+	// Without the appended fallback, cloudflared still needs a catch-all as the
+	// last rule, so the existing config has to provide one.
+	hasCatchAll := len(desiredIngress) > 0 && isCatchAll(desiredIngress[len(desiredIngress)-1])
+	if !hasCatchAll {
+		engine.log.Error("tunnel ingress does not end with a catch-all rule and SYNC_TUNNEL_APPEND_FALLBACK is false; cloudflared requires one", "existing_rules", len(existingIngress))
+	}
 
 	for _, rule := range removedRules {
-		engine.log.Warn("existing ingress rule not defined by labels; will be removed", "rule", ingressRuleKey(rule))
+		engine.log.Warn("existing ingress rule not defined by labels; will be removed", append([]any{"rule", ingressRuleKey(rule)}, engine.sources.attrs(ruleKey(rule))...)...)
 	}
 
-	if ingressMatches {
+	warpRouting, warpMatches := engine.warpRoutingConfig(config.Raw)
+	if ingressMatches && warpMatches {
 		engine.log.Debug("tunnel ingress up-to-date", "rules", len(desiredIngress))
-		return nil
+		engine.rememberApplied(existingIngress)
+		engine.sources.record(desired)
+		return model.SyncResult{}, engine.trackRoutes(desired, nil)
+	}
+	if ingressMatches {
+		// Only warp-routing changes; the ingress is sent back as found.
+		desiredIngress = existingIngress
 	}
 
 	if !engine.manageTunnel {
-		engine.log.Warn("tunnel ingress differs but SYNC_MANAGED_TUNNEL is false; skipping update", "desired_rules", len(desiredIngress), "existing_rules", len(existingIngress))
-		return nil
+		engine.log.Warn("tunnel configuration differs but SYNC_MANAGED_TUNNEL is false; skipping update", "desired_rules", len(desiredIngress), "existing_rules", len(existingIngress), "warp_routing_differs", !warpMatches)
+		return model.SyncResult{}, nil
+	}
+
+	remote, err := engine.tunnelRemotelyManaged(ctx)
+	if err != nil {
+		return model.SyncResult{}, err
+	}
+	if !remote {
+		return model.SyncResult{}, nil
+	}
+
+	if !hasCatchAll {
+		return model.SyncResult{}, fmt.Errorf("refusing to update tunnel ingress without a catch-all rule; add one in Cloudflare or set SYNC_TUNNEL_APPEND_FALLBACK=true")
+	}
+	if err := validateIngress(desiredIngress); err != nil {
+		return model.SyncResult{}, fmt.Errorf("refusing to update tunnel ingress that fails validation: %w", err)
+	}
+	removedKeys := make([]string, 0, len(removedRules))
+	for _, rule := range removedRules {
+		removedKeys = append(removedKeys, ingressRuleKey(rule))
+	}
+	if !engine.allowRemovals(cycle, removedKeys) {
+		engine.log.Error("tunnel update would remove more ingress rules than SYNC_MAX_REMOVALS allows; skipping it until the next sync asks for the same removals or SYNC_FORCE_REMOVALS=true", "removed_rules", len(removedRules), "limit", engine.removals.Limit())
+		return model.SyncResult{}, nil
 	}
 
-	engine.log.Info("updating tunnel ingress", "desired_rules", len(desiredIngress), "existing_rules", len(existingIngress))
+	result := model.SyncResult{}
+	if !ingressMatches {
+		engine.log.Info("updating tunnel ingress", "desired_rules", len(desiredIngress), "existing_rules", len(existingIngress))
+		engine.logRouteChanges(desired, existingIngress, desiredIngress)
+		changes := diffIngress(existingIngress, desiredIngress)
+		engine.logIngressDiff(ctx, changes)
+		result = ingressResult(changes)
+	}
+	if !warpMatches {
+		engine.log.Info("updating tunnel warp-routing", "enabled", *engine.warpRouting)
+	}
 	if engine.dryRun {
-		return nil
+		engine.sources.record(desired)
+		return result, nil
+	}
+
+	if engine.backups != nil && !cycle.backedUp {
+		path, err := engine.backups.save(config)
+		if err != nil {
+			return model.SyncResult{}, fmt.Errorf("back up tunnel config; skipping update: %w", err)
+		}
+		engine.log.Debug("backed up tunnel config", "path", path)
+		cycle.backedUp = true
 	}
 
 	config.Ingress = desiredIngress
-	return engine.api.UpdateConfig(ctx, config)
+	if !warpMatches {
+		if config.Raw == nil {
+			config.Raw = map[string]json.RawMessage{}
+		}
+		config.Raw["warp-routing"] = warpRouting
+	}
+	if err := engine.api.UpdateConfig(ctx, config); err != nil {
+		return model.SyncResult{}, err
+	}
+	engine.rememberApplied(desiredIngress)
+	engine.sources.record(desired)
+	return result, engine.trackRoutes(desired, removedRules)
+}
+
+// warpRoutingConfig returns the warp-routing object with enabled set from
+// SYNC_WARP_ROUTING, keeping its other keys, and whether the configuration
+// already matches. It always matches when SYNC_WARP_ROUTING is unset.
+func (engine *Engine) warpRoutingConfig(raw map[string]json.RawMessage) (json.RawMessage, bool) {
+	if engine.warpRouting == nil {
+		return nil, true
+	}
+	current := map[string]any{}
+	if existing := raw["warp-routing"]; len(existing) > 0 {
+		if err := json.Unmarshal(existing, &current); err != nil {
+			engine.log.Warn("existing warp-routing is invalid JSON; replacing it", "error", err)
+			current = map[string]any{}
+		}
+		if current == nil {
+			current = map[string]any{}
+		}
+	}
+	if enabled, ok := current["enabled"].(bool); ok && enabled == *engine.warpRouting {
+		return nil, true
+	}
+	current["enabled"] = *engine.warpRouting
+	encoded, err := json.Marshal(current)
+	if err != nil {
+		engine.log.Warn("failed to marshal warp-routing", "error", err)
+		return nil, true
+	}
+	return encoded, false
+}
+
+// tunnelRemotelyManaged reports whether the tunnel takes its ingress from
+// Cloudflare. For a tunnel created with a local config file, configuration
+// updates are accepted by the API but ignored by cloudflared, so they are
+// skipped with an error explaining how to migrate.
+func (engine *Engine) tunnelRemotelyManaged(ctx context.Context) (bool, error) {
+	if engine.ignoreConfigSrc || engine.remoteConfig {
+		return true, nil
+	}
+	tunnel, err := engine.api.GetTunnel(ctx)
+	if err != nil {
+		return false, fmt.Errorf("get tunnel details: %w", err)
+	}
+	if tunnel.ConfigSrc != "local" {
+		if engine.localConfigLogged {
+			engine.log.Info("tunnel is now remotely managed; resuming ingress updates", "tunnel", tunnel.Name)
+		}
+		engine.remoteConfig = true
+		return true, nil
+	}
+	if !engine.localConfigLogged {
+		engine.log.Error("tunnel is locally managed (config_src: local); cloudflared ignores ingress pushed through the API, so updates are skipped. Migrate the tunnel to remote management in the Zero Trust dashboard (Networks > Tunnels > Migrate), or set SYNC_IGNORE_CONFIG_SRC=true to push updates anyway", "tunnel", tunnel.Name)
+		engine.localConfigLogged = true
+	} else {
+		engine.log.Debug("tunnel is still locally managed; skipping ingress update", "tunnel", tunnel.Name)
+	}
+	return false, nil
+}
+
+// logRouteChanges reports each label-defined rule that an update adds or
+// changes, along with the container that defines it and, for changes, the
+// container that defined it in the last successful sync.
+func (engine *Engine) logRouteChanges(desired []model.RouteSpec, existing []cloudflare.IngressRule, desiredIngress []cloudflare.IngressRule) {
+	existingByKey := map[model.RouteKey]cloudflare.IngressRule{}
+	for _, rule := range existing {
+		key := ruleKey(rule)
+		if _, ok := existingByKey[key]; !ok && rule.Hostname != "" {
+			existingByKey[key] = rule
+		}
+	}
+	desiredByKey := map[model.RouteKey]cloudflare.IngressRule{}
+	for _, rule := range desiredIngress {
+		desiredByKey[ruleKey(rule)] = rule
+	}
+
+	for _, route := range desired {
+		if route.Fallback {
+			fallback := desiredIngress[len(desiredIngress)-1]
+			if len(existing) == 0 || !ingressEqual(existing[len(existing)-1:], []cloudflare.IngressRule{fallback}) {
+				engine.log.Info("updating fallback ingress rule", "service", route.Service, "source_container", route.Source.ContainerName)
+			}
+			continue
+		}
+		current, found := existingByKey[route.Key]
+		if !found {
+			engine.log.Info("adding ingress rule", "rule", route.Key.String(), "service", route.Service, "source_container", route.Source.ContainerName)
+			continue
+		}
+		if !ingressEqual([]cloudflare.IngressRule{current}, []cloudflare.IngressRule{desiredByKey[route.Key]}) {
+			engine.log.Info("updating ingress rule", append([]any{"rule", route.Key.String(), "service", route.Service, "source_container", route.Source.ContainerName}, engine.sources.attrs(route.Key)...)...)
+		}
+	}
+}
+
+// trackRoutes records the label-defined routes so they are removed once their
+// labels disappear, and forgets routes whose rules were removed.
+func (engine *Engine) trackRoutes(desired []model.RouteSpec, removed []cloudflare.IngressRule) error {
+	if !engine.manageTunnel || engine.dryRun {
+		return nil
+	}
+	if err := engine.trackOriginKeys(desired); err != nil {
+		return err
+	}
+	if engine.store == nil || !engine.preserveUnmanaged {
+		return nil
+	}
+
+	added := make([]model.RouteKey, 0, len(desired))
+	for _, route := range desired {
+		if !route.Fallback {
+			added = append(added, route.Key)
+		}
+	}
+	removedKeys := make([]model.RouteKey, 0, len(removed))
+	for _, rule := range removed {
+		removedKeys = append(removedKeys, ruleKey(rule))
+	}
+
+	changed := engine.store.AddTunnelRoutes(added)
+	if engine.store.RemoveTunnelRoutes(removedKeys) {
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return engine.store.Save()
+}
+
+// staleOriginDefaults returns the default originRequest keys applied by an
+// earlier sync that are no longer in SYNC_DEFAULT_ORIGIN_REQUEST.
+func (engine *Engine) staleOriginDefaults() []string {
+	if engine.store == nil {
+		return nil
+	}
+	stale := []string{}
+	for _, key := range engine.store.OriginDefaultKeys() {
+		if _, ok := engine.originDefaults[key]; !ok {
+			stale = append(stale, key)
+		}
+	}
+	return stale
+}
+
+// staleOriginRaw returns the originRequest keys applied to the route from its
+// origin.raw label by an earlier sync that the label no longer sets.
+func (engine *Engine) staleOriginRaw(route model.RouteSpec) []string {
+	if engine.store == nil {
+		return nil
+	}
+	stale := []string{}
+	for _, key := range engine.store.OriginRawKeys(route.Key) {
+		if _, ok := route.OriginRaw[key]; !ok {
+			stale = append(stale, key)
+		}
+	}
+	return stale
+}
+
+// trackOriginKeys records the default and origin.raw originRequest keys once
+// they are applied to the tunnel.
+func (engine *Engine) trackOriginKeys(desired []model.RouteSpec) error {
+	if engine.store == nil {
+		return nil
+	}
+	keys := make([]string, 0, len(engine.originDefaults))
+	for key := range engine.originDefaults {
+		keys = append(keys, key)
+	}
+	rawKeys := map[model.RouteKey][]string{}
+	for _, route := range desired {
+		for key := range route.OriginRaw {
+			rawKeys[route.Key] = append(rawKeys[route.Key], key)
+		}
+	}
+	changed := engine.store.SetOriginDefaultKeys(keys)
+	if engine.store.SetOriginRawKeys(rawKeys) {
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return engine.store.Save()
+}
+
+// DesiredIngress returns the ingress rules a sync would write to an empty
+// tunnel configuration, including the catch-all. It never calls the API, so
+// the engine may be created without one.
+func (engine *Engine) DesiredIngress(desired []model.RouteSpec) []cloudflare.IngressRule {
+	rules, _ := engine.buildDesiredIngress(engine.withoutProtectedRoutes(desired), nil)
+	return rules
 }
 
 func (engine *Engine) buildDesiredIngress(desired []model.RouteSpec, existing []cloudflare.IngressRule) ([]cloudflare.IngressRule, []cloudflare.IngressRule) {
 	existingByKey := map[model.RouteKey]cloudflare.IngressRule{}
 	duplicates := map[model.RouteKey]struct{}{}
-	for _, rule := range existing {
-		if rule.Hostname == "" && rule.Service == model.FallbackService {
+	var existingFallback *cloudflare.IngressRule
+	for index, rule := range existing {
+		if rule.Hostname == "" && index == len(existing)-1 {
+			existingFallback = &existing[index]
+			continue
+		}
+		if rule.Hostname == "" && (serviceEqual(rule.Service, engine.fallbackService) || rule.Service == model.FallbackService) {
 			continue
 		}
 		if rule.Hostname == "" {
 			engine.log.Warn("existing ingress rule missing hostname; will be replaced", "service", rule.Service)
 			continue
 		}
-		key := model.RouteKey{Hostname: rule.Hostname, Path: rule.Path}
+		key := ruleKey(rule)
 		if _, exists := existingByKey[key]; exists {
 			duplicates[key] = struct{}{}
 			continue
@@ -80,9 +455,36 @@ func (engine *Engine) buildDesiredIngress(desired []model.RouteSpec, existing []
 		engine.log.Warn("duplicate ingress rules detected; keeping first", "rule", key.String())
 	}
 
+	staleDefaults := engine.staleOriginDefaults()
 	desiredRules := make([]cloudflare.IngressRule, 0, len(desired)+1)
 	desiredKeys := make(map[model.RouteKey]struct{}, len(desired))
+	fallbackRule := cloudflare.IngressRule{Service: engine.fallbackService}
+	if existingFallback != nil && isCatchAll(*existingFallback) && serviceEqual(existingFallback.Service, engine.fallbackService) {
+		// Keep the existing catch-all as-is, including any originRequest, so a
+		// matching rule does not trigger an update.
+		fallbackRule = *existingFallback
+	}
+	if !engine.appendFallback {
+		// Keep whatever catch-all is already configured; Reconcile refuses to
+		// write a config that would lack one.
+		fallbackRule = cloudflare.IngressRule{}
+		if existingFallback != nil && isCatchAll(*existingFallback) {
+			fallbackRule = *existingFallback
+		}
+	}
 	for _, route := range desired {
+		if route.Fallback {
+			var existingOriginRequest json.RawMessage
+			if existingFallback != nil {
+				existingOriginRequest = existingFallback.OriginRequest
+			}
+			fallbackRule = cloudflare.IngressRule{
+				Service:       route.Service,
+				OriginRequest: mergeManagedOriginRequest(existingOriginRequest, route, engine.originDefaults, append(engine.staleOriginRaw(route), staleDefaults...), engine.log),
+			}
+			continue
+		}
+
 		var existingOriginRequest json.RawMessage
 		if existingRule, ok := existingByKey[route.Key]; ok {
 			existingOriginRequest = existingRule.OriginRequest
@@ -92,54 +494,237 @@ func (engine *Engine) buildDesiredIngress(desired []model.RouteSpec, existing []
 			Hostname:      route.Key.Hostname,
 			Path:          route.Key.Path,
 			Service:       route.Service,
-			OriginRequest: mergeManagedOriginRequest(existingOriginRequest, route, engine.log),
+			OriginRequest: mergeManagedOriginRequest(existingOriginRequest, route, engine.originDefaults, append(engine.staleOriginRaw(route), staleDefaults...), engine.log),
 		}
 		desiredRules = append(desiredRules, rule)
 		desiredKeys[route.Key] = struct{}{}
 	}
 
 	removed := make([]cloudflare.IngressRule, 0)
-	for key, rule := range existingByKey {
-		if _, wanted := desiredKeys[key]; !wanted {
-			removed = append(removed, rule)
+	preserved := make([]cloudflare.IngressRule, 0)
+	seen := make(map[model.RouteKey]struct{}, len(existingByKey))
+	for _, rule := range existing {
+		key := ruleKey(rule)
+		if _, ok := existingByKey[key]; !ok {
+			continue
+		}
+		if _, done := seen[key]; done {
+			continue
+		}
+		seen[key] = struct{}{}
+		rule = existingByKey[key]
+		if _, wanted := desiredKeys[key]; wanted {
+			continue
+		}
+		if engine.protected.Match(key.Hostname) {
+			engine.log.Debug("keeping ingress rule of protected hostname", "rule", key.String())
+			preserved = append(preserved, rule)
+			continue
+		}
+		if engine.preserveUnmanaged && (engine.store == nil || !engine.store.HasTunnelRoute(key)) {
+			engine.log.Info("preserving ingress rule not created by this controller", "rule", key.String())
+			preserved = append(preserved, rule)
+			continue
+		}
+		if !engine.deleteRoutes {
+			engine.log.Warn("existing ingress rule not defined by labels; keeping because SYNC_DELETE_ROUTES is false", "rule", key.String())
+			preserved = append(preserved, rule)
+			continue
 		}
+		removed = append(removed, rule)
 	}
 	sort.Slice(removed, func(i, j int) bool {
 		return ingressRuleKey(removed[i]) < ingressRuleKey(removed[j])
 	})
 
-	desiredRules = append(desiredRules, cloudflare.IngressRule{Service: model.FallbackService})
+	// Preserved rules are sorted with the label rules, so a kept path rule
+	// still comes before the catch-all of its hostname.
+	desiredRules = append(desiredRules, preserved...)
+	sortIngressRules(desiredRules)
+	if fallbackRule.Service != "" {
+		desiredRules = append(desiredRules, fallbackRule)
+	}
 
 	return desiredRules, removed
 }
 
+// withoutProtectedRoutes drops routes whose hostname is protected; their
+// existing ingress rules are kept as they are.
+func (engine *Engine) withoutProtectedRoutes(desired []model.RouteSpec) []model.RouteSpec {
+	if len(engine.protected) == 0 {
+		return desired
+	}
+	kept := make([]model.RouteSpec, 0, len(desired))
+	for _, route := range desired {
+		if !route.Fallback && engine.protected.Match(route.Key.Hostname) {
+			engine.log.Warn("route claims a protected hostname; ignoring", "rule", route.Key.String(), "source_container", route.Source.ContainerName)
+			continue
+		}
+		kept = append(kept, route)
+	}
+	return kept
+}
+
 func ingressEqual(left []cloudflare.IngressRule, right []cloudflare.IngressRule) bool {
 	if len(left) != len(right) {
 		return false
 	}
 	for i := range left {
-		if left[i].Hostname != right[i].Hostname {
+		if !strings.EqualFold(left[i].Hostname, right[i].Hostname) {
 			return false
 		}
 		if left[i].Path != right[i].Path {
 			return false
 		}
-		if left[i].Service != right[i].Service {
+		if !serviceEqual(left[i].Service, right[i].Service) {
 			return false
 		}
-		if !bytes.Equal(left[i].OriginRequest, right[i].OriginRequest) {
+		if !originRequestEqual(left[i].OriginRequest, right[i].OriginRequest) {
 			return false
 		}
 	}
 	return true
 }
 
+// ingressEqualIgnoringOrder compares rules keyed by hostname and path, so a
+// reordering made in the dashboard is not undone. The last rule, which must be
+// the catch-all, is still compared by position.
+func ingressEqualIgnoringOrder(left []cloudflare.IngressRule, right []cloudflare.IngressRule) bool {
+	if len(left) != len(right) {
+		return false
+	}
+	if len(left) == 0 {
+		return true
+	}
+	last := len(left) - 1
+	if !ingressEqual(left[last:], right[last:]) {
+		return false
+	}
+	rightByKey := make(map[string]cloudflare.IngressRule, last)
+	for _, rule := range right[:last] {
+		rightByKey[ingressRuleKey(rule)] = rule
+	}
+	if len(rightByKey) != last {
+		return false
+	}
+	for _, rule := range left[:last] {
+		match, ok := rightByKey[ingressRuleKey(rule)]
+		if !ok || !ingressEqual([]cloudflare.IngressRule{rule}, []cloudflare.IngressRule{match}) {
+			return false
+		}
+		delete(rightByKey, ingressRuleKey(rule))
+	}
+	return true
+}
+
+// serviceEqual compares services after normalizeService, so a dashboard
+// value that differs from the label only cosmetically does not trigger an
+// update. Updates still write the label's value as written.
+func serviceEqual(left string, right string) bool {
+	return left == right || normalizeService(left) == normalizeService(right)
+}
+
+// normalizeService lowercases the scheme and host of a URL service and strips
+// one trailing slash; anything after the host keeps its case. Services
+// without a host, such as http_status:404 or unix:/path, are returned as is.
+func normalizeService(service string) string {
+	scheme, rest, found := strings.Cut(service, "://")
+	if !found {
+		return service
+	}
+	host, path := rest, ""
+	if index := strings.IndexAny(rest, "/?#"); index >= 0 {
+		host, path = rest[:index], rest[index:]
+	}
+	return strings.ToLower(scheme) + "://" + strings.ToLower(host) + strings.TrimSuffix(path, "/")
+}
+
+// originRequestEqual compares originRequest objects by their decoded values,
+// so key order and whitespace differences do not trigger updates.
+func originRequestEqual(left json.RawMessage, right json.RawMessage) bool {
+	if bytes.Equal(left, right) {
+		return true
+	}
+	leftValue, leftOK := originRequestValue(left)
+	rightValue, rightOK := originRequestValue(right)
+	if !leftOK || !rightOK {
+		return false
+	}
+	return reflect.DeepEqual(leftValue, rightValue)
+}
+
+func originRequestValue(raw json.RawMessage) (any, bool) {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return nil, true
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// isCatchAll reports whether rule matches every request, as cloudflared
+// requires of the last ingress rule.
+func isCatchAll(rule cloudflare.IngressRule) bool {
+	return rule.Hostname == "" && rule.Path == "" && rule.Service != ""
+}
+
 func ingressRuleKey(rule cloudflare.IngressRule) string {
-	return model.RouteKey{Hostname: rule.Hostname, Path: rule.Path}.String()
+	return ruleKey(rule).String()
 }
 
-func mergeManagedOriginRequest(existing json.RawMessage, route model.RouteSpec, logger *slog.Logger) json.RawMessage {
-	if len(existing) == 0 && route.OriginServerName == nil && route.NoTLSVerify == nil {
+// ruleKey returns the route key of an ingress rule. Hostnames are lowercased
+// like label hostnames, so a rule differing only in case matches its route.
+func ruleKey(rule cloudflare.IngressRule) model.RouteKey {
+	return model.RouteKey{Hostname: strings.ToLower(rule.Hostname), Path: rule.Path}
+}
+
+// mergeManagedOriginRequest applies the managed keys to the existing
+// originRequest and removes staleKeys, the keys an earlier sync applied from
+// the defaults or the origin.raw label that they no longer set. An unchanged
+// object is returned as is; a changed one is re-encoded with sorted keys, so
+// the output is stable across cycles.
+func mergeManagedOriginRequest(existing json.RawMessage, route model.RouteSpec, defaults map[string]any, staleKeys []string, logger *slog.Logger) json.RawMessage {
+	// Managed keys come from SYNC_DEFAULT_ORIGIN_REQUEST first, then from the
+	// route's origin.raw label, then from the dedicated origin labels.
+	managed := map[string]any{}
+	for key, value := range defaults {
+		managed[key] = value
+	}
+	for key, value := range route.OriginRaw {
+		managed[key] = value
+	}
+	if route.OriginServerName != nil {
+		managed["originServerName"] = *route.OriginServerName
+	}
+	if route.NoTLSVerify != nil {
+		managed["noTLSVerify"] = *route.NoTLSVerify
+	}
+	if route.CAPool != nil {
+		managed["caPool"] = *route.CAPool
+	}
+	if route.ProxyType != nil {
+		managed["proxyType"] = *route.ProxyType
+	}
+	if route.ProxyAddress != nil {
+		managed["proxyAddress"] = *route.ProxyAddress
+	}
+	if route.ProxyPort != nil {
+		// Decoded JSON numbers are float64, so the port compares equal to the
+		// existing value.
+		managed["proxyPort"] = float64(*route.ProxyPort)
+	}
+	if route.BastionMode != nil {
+		managed["bastionMode"] = *route.BastionMode
+	}
+	// Dedicated keys without a label, and keys dropped from the defaults or
+	// the origin.raw label, are removed unless another source still sets them.
+	removedKeys := append([]string{"originServerName", "noTLSVerify", "caPool", "proxyType", "proxyAddress", "proxyPort", "bastionMode"}, staleKeys...)
+
+	if len(existing) == 0 && len(managed) == 0 {
 		return nil
 	}
 
@@ -152,26 +737,18 @@ func mergeManagedOriginRequest(existing json.RawMessage, route model.RouteSpec,
 	}
 
 	changed := false
-	if route.OriginServerName != nil {
-		if current, ok := originRequest["originServerName"]; !ok || !originRequestStringEqual(current, *route.OriginServerName) {
-			originRequest["originServerName"] = *route.OriginServerName
-			changed = true
+	for _, key := range removedKeys {
+		if _, set := managed[key]; set {
+			continue
 		}
-	} else {
-		if _, ok := originRequest["originServerName"]; ok {
-			delete(originRequest, "originServerName")
+		if _, ok := originRequest[key]; ok {
+			delete(originRequest, key)
 			changed = true
 		}
 	}
-
-	if route.NoTLSVerify != nil {
-		if current, ok := originRequest["noTLSVerify"]; !ok || !originRequestBoolEqual(current, *route.NoTLSVerify) {
-			originRequest["noTLSVerify"] = *route.NoTLSVerify
-			changed = true
-		}
-	} else {
-		if _, ok := originRequest["noTLSVerify"]; ok {
-			delete(originRequest, "noTLSVerify")
+	for key, value := range managed {
+		if current, ok := originRequest[key]; !ok || !reflect.DeepEqual(current, value) {
+			originRequest[key] = value
 			changed = true
 		}
 	}
@@ -198,13 +775,3 @@ func mergeManagedOriginRequest(existing json.RawMessage, route model.RouteSpec,
 
 	return merged
 }
-
-func originRequestStringEqual(value any, expected string) bool {
-	stringValue, ok := value.(string)
-	return ok && stringValue == expected
-}
-
-func originRequestBoolEqual(value any, expected bool) bool {
-	boolValue, ok := value.(bool)
-	return ok && boolValue == expected
-}
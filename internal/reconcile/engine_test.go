@@ -1,18 +1,22 @@
 package reconcile
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"log/slog"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/cloudflare"
 	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/model"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/state"
 )
 
 func TestBuildDesiredIngress(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
-	engine := NewEngine(nil, logger, false, true)
+	engine := NewEngine(nil, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService})
 
 	existing := []cloudflare.IngressRule{
 		{Hostname: "b.example.com", Service: "http://b1"},
@@ -60,7 +64,7 @@ func TestBuildDesiredIngress(t *testing.T) {
 
 func TestBuildDesiredIngressAppliesOriginLabels(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
-	engine := NewEngine(nil, logger, false, true)
+	engine := NewEngine(nil, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService})
 
 	existing := []cloudflare.IngressRule{
 		{Hostname: "a.example.com", Service: "https://a", OriginRequest: []byte(`{"httpHostHeader":"app.internal"}`)},
@@ -68,12 +72,14 @@ func TestBuildDesiredIngressAppliesOriginLabels(t *testing.T) {
 	}
 	originServerName := "origin.internal"
 	noTLSVerify := false
+	caPool := "/etc/cloudflared/origin-ca.pem"
 	desired := []model.RouteSpec{
 		{
 			Key:              model.RouteKey{Hostname: "a.example.com"},
 			Service:          "https://a",
 			OriginServerName: &originServerName,
 			NoTLSVerify:      &noTLSVerify,
+			CAPool:           &caPool,
 		},
 	}
 
@@ -88,14 +94,146 @@ func TestBuildDesiredIngressAppliesOriginLabels(t *testing.T) {
 	if originRequest["noTLSVerify"] != false {
 		t.Fatalf("expected noTLSVerify to be false, got %+v", originRequest)
 	}
+	if originRequest["caPool"] != caPool {
+		t.Fatalf("expected caPool to be set, got %+v", originRequest)
+	}
 	if originRequest["httpHostHeader"] != "app.internal" {
 		t.Fatalf("expected unmanaged originRequest keys to be preserved, got %+v", originRequest)
 	}
 }
 
+func TestBuildDesiredIngressMergesOriginRawKeys(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(nil, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService})
+
+	existing := []cloudflare.IngressRule{
+		{Hostname: "a.example.com", Service: "https://a", OriginRequest: []byte(`{"httpHostHeader":"app.internal","connectTimeout":"10s"}`)},
+		{Service: model.FallbackService},
+	}
+	desired := []model.RouteSpec{
+		{
+			Key:       model.RouteKey{Hostname: "a.example.com"},
+			Service:   "https://a",
+			OriginRaw: map[string]any{"connectTimeout": "30s", "keepAliveConnections": float64(10)},
+		},
+	}
+
+	desiredIngress, _ := engine.buildDesiredIngress(desired, existing)
+	originRequest := decodeOriginRequest(t, desiredIngress[0].OriginRequest)
+	if originRequest["connectTimeout"] != "30s" || originRequest["keepAliveConnections"] != float64(10) {
+		t.Fatalf("expected raw origin keys to be applied, got %+v", originRequest)
+	}
+	if originRequest["httpHostHeader"] != "app.internal" {
+		t.Fatalf("expected other originRequest keys to be preserved, got %+v", originRequest)
+	}
+
+	existing[0].OriginRequest = desiredIngress[0].OriginRequest
+	again, _ := engine.buildDesiredIngress(desired, existing)
+	if !ingressEqual(existing, again) {
+		t.Fatalf("expected no change once raw origin keys are applied, got %+v", again)
+	}
+}
+
+func TestBuildDesiredIngressRemovesKeysDroppedFromOriginRaw(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	store, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	engine := NewEngine(nil, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService, Store: store})
+
+	route := model.RouteSpec{
+		Key:       model.RouteKey{Hostname: "a.example.com"},
+		Service:   "https://a",
+		OriginRaw: map[string]any{"connectTimeout": "30s", "keepAliveConnections": float64(10)},
+	}
+	existing := []cloudflare.IngressRule{
+		{Hostname: "a.example.com", Service: "https://a", OriginRequest: []byte(`{"httpHostHeader":"app.internal"}`)},
+		{Service: model.FallbackService},
+	}
+	desiredIngress, _ := engine.buildDesiredIngress([]model.RouteSpec{route}, existing)
+	if err := engine.trackRoutes([]model.RouteSpec{route}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if keys := store.OriginRawKeys(route.Key); len(keys) != 2 || keys[0] != "connectTimeout" || keys[1] != "keepAliveConnections" {
+		t.Fatalf("expected the applied origin.raw keys to be recorded, got %v", keys)
+	}
+
+	// keepAliveConnections is dropped from the label.
+	existing[0].OriginRequest = desiredIngress[0].OriginRequest
+	route.OriginRaw = map[string]any{"connectTimeout": "30s"}
+	desiredIngress, _ = engine.buildDesiredIngress([]model.RouteSpec{route}, existing)
+	originRequest := decodeOriginRequest(t, desiredIngress[0].OriginRequest)
+	if _, ok := originRequest["keepAliveConnections"]; ok {
+		t.Fatalf("expected a key dropped from origin.raw to be removed, got %+v", originRequest)
+	}
+	if originRequest["connectTimeout"] != "30s" || originRequest["httpHostHeader"] != "app.internal" {
+		t.Fatalf("expected the remaining raw key and unmanaged keys to be kept, got %+v", originRequest)
+	}
+
+	if err := engine.trackRoutes([]model.RouteSpec{route}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if keys := store.OriginRawKeys(route.Key); len(keys) != 1 || keys[0] != "connectTimeout" {
+		t.Fatalf("expected the dropped key to be forgotten, got %v", keys)
+	}
+}
+
+func TestBuildDesiredIngressAppliesOriginDefaults(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	store, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	store.SetOriginDefaultKeys([]string{"keepAliveTimeout"})
+	defaults := map[string]any{"noTLSVerify": false, "connectTimeout": "10s", "http2Origin": true}
+	engine := NewEngine(nil, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService, Store: store, OriginDefaults: defaults})
+
+	existing := []cloudflare.IngressRule{
+		{Hostname: "a.example.com", Service: "https://a", OriginRequest: []byte(`{"httpHostHeader":"app.internal","connectTimeout":"5s","keepAliveTimeout":"1m"}`)},
+		{Service: model.FallbackService},
+	}
+	noTLSVerify := true
+	desired := []model.RouteSpec{
+		{
+			Key:         model.RouteKey{Hostname: "a.example.com"},
+			Service:     "https://a",
+			NoTLSVerify: &noTLSVerify,
+			OriginRaw:   map[string]any{"http2Origin": false},
+		},
+		{Key: model.RouteKey{Hostname: "b.example.com"}, Service: "https://b"},
+	}
+
+	desiredIngress, _ := engine.buildDesiredIngress(desired, existing)
+	labeled := decodeOriginRequest(t, desiredIngress[0].OriginRequest)
+	if labeled["noTLSVerify"] != true || labeled["http2Origin"] != false {
+		t.Fatalf("expected labels to override defaults, got %+v", labeled)
+	}
+	if labeled["connectTimeout"] != "10s" {
+		t.Fatalf("expected the default to override the existing managed key, got %+v", labeled)
+	}
+	if labeled["httpHostHeader"] != "app.internal" {
+		t.Fatalf("expected unmanaged originRequest keys to be preserved, got %+v", labeled)
+	}
+	if _, ok := labeled["keepAliveTimeout"]; ok {
+		t.Fatalf("expected a key dropped from the defaults to be removed, got %+v", labeled)
+	}
+	unlabeled := decodeOriginRequest(t, desiredIngress[1].OriginRequest)
+	if len(unlabeled) != 3 || unlabeled["noTLSVerify"] != false || unlabeled["connectTimeout"] != "10s" || unlabeled["http2Origin"] != true {
+		t.Fatalf("expected defaults on a route without origin labels, got %+v", unlabeled)
+	}
+
+	if err := engine.trackRoutes(desired, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if keys := store.OriginDefaultKeys(); len(keys) != 3 || keys[0] != "connectTimeout" {
+		t.Fatalf("expected the applied default keys to be recorded, got %v", keys)
+	}
+}
+
 func TestBuildDesiredIngressPreservesDesiredOrder(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
-	engine := NewEngine(nil, logger, false, true)
+	engine := NewEngine(nil, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService})
 
 	desired := []model.RouteSpec{
 		{Key: model.RouteKey{Hostname: "soulsync.example.com"}, Service: "http://soulsync:8008"},
@@ -124,6 +262,187 @@ func TestBuildDesiredIngressPreservesDesiredOrder(t *testing.T) {
 	}
 }
 
+func TestBuildDesiredIngressUsesFallbackRoute(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(nil, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService})
+
+	existing := []cloudflare.IngressRule{
+		{Hostname: "a.example.com", Service: "http://a"},
+		{Service: "http://maintenance:80"},
+	}
+	desired := []model.RouteSpec{
+		{Service: "http://maintenance:80", Fallback: true},
+		{Key: model.RouteKey{Hostname: "a.example.com"}, Service: "http://a"},
+	}
+
+	desiredIngress, removed := engine.buildDesiredIngress(desired, existing)
+	if len(removed) != 0 {
+		t.Fatalf("expected no removed rules, got %+v", removed)
+	}
+	if len(desiredIngress) != 2 {
+		t.Fatalf("expected 2 desired rules, got %d", len(desiredIngress))
+	}
+	if desiredIngress[1].Hostname != "" || desiredIngress[1].Service != "http://maintenance:80" {
+		t.Fatalf("expected custom fallback rule last, got %+v", desiredIngress[1])
+	}
+	if !ingressEqual(existing, desiredIngress) {
+		t.Fatalf("expected ingress to be unchanged")
+	}
+}
+
+func TestEngineReconcilePreservesUnmanagedRules(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.json")
+	tracked, err := state.Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tracked.AddTunnelRoutes([]model.RouteKey{{Hostname: "old.example.com"}})
+
+	api := &stubAPI{config: cloudflare.TunnelConfig{Ingress: []cloudflare.IngressRule{
+		{Hostname: "manual.example.com", Service: "http://manual"},
+		{Hostname: "old.example.com", Service: "http://old"},
+		{Hostname: "old.example.com", Path: "/manual", Service: "http://old-manual"},
+		{Service: model.FallbackService},
+	}}}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService, Store: tracked, PreserveUnmanaged: true})
+
+	result, err := engine.Reconcile(ctx, []model.RouteSpec{{Key: model.RouteKey{Hostname: "a.example.com"}, Service: "http://a"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Count(model.ResourceRoute, model.ActionCreated) != 1 || result.Count(model.ResourceRoute, model.ActionDeleted) != 1 {
+		t.Fatalf("expected one created and one deleted route, got %+v", result.Changes)
+	}
+	ingress := api.config.Ingress
+	if len(ingress) != 4 {
+		t.Fatalf("expected 4 rules, got %+v", ingress)
+	}
+	if ingress[0].Hostname != "a.example.com" || ingress[1].Hostname != "manual.example.com" || ingress[2].Path != "/manual" || ingress[3].Service != model.FallbackService {
+		t.Fatalf("expected labeled rule, preserved manual rules, then fallback, got %+v", ingress)
+	}
+
+	reloaded, err := state.Load(path)
+	if err != nil {
+		t.Fatalf("unexpected reload error: %v", err)
+	}
+	if !reloaded.HasTunnelRoute(model.RouteKey{Hostname: "a.example.com"}) {
+		t.Fatalf("expected created route to be tracked")
+	}
+	if reloaded.HasTunnelRoute(model.RouteKey{Hostname: "old.example.com"}) {
+		t.Fatalf("expected removed route to be forgotten")
+	}
+	if reloaded.HasTunnelRoute(model.RouteKey{Hostname: "manual.example.com"}) {
+		t.Fatalf("expected manual route to stay untracked")
+	}
+}
+
+func TestEngineReconcileLogsSourceContainer(t *testing.T) {
+	ctx := context.Background()
+	api := &stubAPI{config: cloudflare.TunnelConfig{Ingress: []cloudflare.IngressRule{
+		{Hostname: "a.example.com", Service: "http://old"},
+		{Service: model.FallbackService},
+	}}}
+	var output bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&output, nil))
+	engine := NewEngine(api, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService})
+
+	_, err := engine.Reconcile(ctx, []model.RouteSpec{
+		{Key: model.RouteKey{Hostname: "a.example.com"}, Service: "http://a", Source: model.SourceRef{ContainerName: "web"}},
+		{Key: model.RouteKey{Hostname: "b.example.com"}, Service: "http://b", Source: model.SourceRef{ContainerName: "worker"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	logs := output.String()
+	if !strings.Contains(logs, `msg="updating ingress rule" rule=a.example.com service=http://a source_container=web`) {
+		t.Fatalf("expected update log with source container, got:\n%s", logs)
+	}
+	if !strings.Contains(logs, `msg="adding ingress rule" rule=b.example.com service=http://b source_container=worker`) {
+		t.Fatalf("expected add log with source container, got:\n%s", logs)
+	}
+}
+
+func TestEngineReconcileLogsLastSourceOfRemovedRule(t *testing.T) {
+	ctx := context.Background()
+	api := &stubAPI{config: cloudflare.TunnelConfig{Ingress: []cloudflare.IngressRule{{Service: model.FallbackService}}}}
+	var output bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&output, nil))
+	engine := NewEngine(api, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService})
+
+	route := model.RouteSpec{Key: model.RouteKey{Hostname: "a.example.com"}, Service: "http://a", Source: model.SourceRef{ContainerID: "abc123", ContainerName: "web"}}
+	if _, err := engine.Reconcile(ctx, []model.RouteSpec{route}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := engine.Reconcile(ctx, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	logs := output.String()
+	if !strings.Contains(logs, `msg="existing ingress rule not defined by labels; will be removed" rule=a.example.com last_source_container=web last_source_container_id=abc123`) {
+		t.Fatalf("expected removal log with the last source container, got:\n%s", logs)
+	}
+}
+
+func TestServiceEqualIgnoresCosmeticDifferences(t *testing.T) {
+	cases := []struct {
+		left  string
+		right string
+		equal bool
+	}{
+		{"http://app:8080", "http://app:8080/", true},
+		{"http://app:8080", "HTTP://App:8080", true},
+		{"https://App.internal:8443/", "https://app.internal:8443", true},
+		{"http://app:8080/Base/", "http://app:8080/Base", true},
+		{"http://app:8080//", "http://app:8080", false},
+		{"http://app:8080/Base", "http://app:8080/base", false},
+		{"http://app:8080", "http://app:8081", false},
+		{"http_status:404", "HTTP_STATUS:404", false},
+		{"unix:/run/app.sock", "unix:/run/app.sock/", false},
+	}
+	for _, tc := range cases {
+		if got := serviceEqual(tc.left, tc.right); got != tc.equal {
+			t.Fatalf("serviceEqual(%q, %q) = %v, expected %v", tc.left, tc.right, got, tc.equal)
+		}
+	}
+}
+
+func TestEngineReconcileSkipsCosmeticServiceDifferences(t *testing.T) {
+	ctx := context.Background()
+	api := &stubAPI{config: cloudflare.TunnelConfig{Ingress: []cloudflare.IngressRule{
+		{Hostname: "a.example.com", Service: "http://app:8080/"},
+		{Hostname: "b.example.com", Service: "HTTPS://Backend.internal:8443"},
+		{Hostname: "c.example.com", Service: "http://C-App/"},
+		{Service: model.FallbackService},
+	}}}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService})
+
+	desired := []model.RouteSpec{
+		{Key: model.RouteKey{Hostname: "a.example.com"}, Service: "http://app:8080"},
+		{Key: model.RouteKey{Hostname: "b.example.com"}, Service: "https://backend.internal:8443/"},
+		{Key: model.RouteKey{Hostname: "c.example.com"}, Service: "http://c-app"},
+	}
+	result, err := engine.Reconcile(ctx, desired)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.updated || len(result.Changes) != 0 {
+		t.Fatalf("expected no update for cosmetic service differences, got %+v", result)
+	}
+
+	desired[0].Service = "http://app:9090"
+	if _, err := engine.Reconcile(ctx, desired); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !api.updated {
+		t.Fatalf("expected a real service change to update the tunnel")
+	}
+	if got := api.config.Ingress[1].Service; got != "https://backend.internal:8443/" {
+		t.Fatalf("expected the label's service to be written as is, got %q", got)
+	}
+}
+
 func TestIngressEqual(t *testing.T) {
 	ruleA := cloudflare.IngressRule{Hostname: "a.example.com", Service: "http://a"}
 	ruleB := cloudflare.IngressRule{Hostname: "a.example.com", Service: "http://a", OriginRequest: []byte(`{"noTLSVerify":true}`)}
@@ -136,6 +455,69 @@ func TestIngressEqual(t *testing.T) {
 	}
 }
 
+func TestIngressEqualIgnoresOriginRequestFormatting(t *testing.T) {
+	existing := cloudflare.IngressRule{Hostname: "a.example.com", Service: "https://a", OriginRequest: []byte(`{ "noTLSVerify": true, "connectTimeout": 30, "originServerName": "a.internal" }`)}
+	desired := cloudflare.IngressRule{Hostname: "a.example.com", Service: "https://a", OriginRequest: []byte(`{"connectTimeout":30,"noTLSVerify":true,"originServerName":"a.internal"}`)}
+	changed := cloudflare.IngressRule{Hostname: "a.example.com", Service: "https://a", OriginRequest: []byte(`{"connectTimeout":30,"noTLSVerify":false,"originServerName":"a.internal"}`)}
+
+	if !ingressEqual([]cloudflare.IngressRule{existing}, []cloudflare.IngressRule{desired}) {
+		t.Fatalf("expected reordered originRequest keys to compare equal")
+	}
+	if ingressEqual([]cloudflare.IngressRule{existing}, []cloudflare.IngressRule{changed}) {
+		t.Fatalf("expected originRequest value changes to be detected")
+	}
+}
+
+func TestEngineReconcileIgnoresReorderedOriginRequest(t *testing.T) {
+	ctx := context.Background()
+	existing := []cloudflare.IngressRule{
+		{Hostname: "a.example.com", Service: "https://a", OriginRequest: []byte(`{ "noTLSVerify": true,  "originServerName": "a.internal" }`)},
+		{Service: model.FallbackService},
+	}
+	api := &stubAPI{config: cloudflare.TunnelConfig{Ingress: existing}}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService})
+
+	serverName := "a.internal"
+	noTLSVerify := true
+	route := model.RouteSpec{Key: model.RouteKey{Hostname: "a.example.com"}, Service: "https://a", OriginServerName: &serverName, NoTLSVerify: &noTLSVerify}
+	if _, err := engine.Reconcile(ctx, []model.RouteSpec{route}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.updated {
+		t.Fatalf("expected no update when originRequest only differs in key order and whitespace")
+	}
+}
+
+func TestMergeManagedOriginRequestSortsKeys(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	serverName := "a.internal"
+	noTLSVerify := true
+	route := model.RouteSpec{Key: model.RouteKey{Hostname: "a.example.com"}, OriginServerName: &serverName, NoTLSVerify: &noTLSVerify}
+
+	merged := mergeManagedOriginRequest([]byte(`{"noTLSVerify": false, "connectTimeout": 30}`), route, nil, nil, logger)
+	if got, want := string(merged), `{"connectTimeout":30,"noTLSVerify":true,"originServerName":"a.internal"}`; got != want {
+		t.Fatalf("expected canonical originRequest %s, got %s", want, got)
+	}
+}
+
+func TestMergeManagedOriginRequestManagesProxyKeys(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	proxyType := "socks"
+	proxyPort := uint16(1080)
+	bastionMode := true
+	route := model.RouteSpec{Key: model.RouteKey{Hostname: "ssh.example.com"}, ProxyType: &proxyType, ProxyPort: &proxyPort, BastionMode: &bastionMode}
+
+	existing := json.RawMessage(`{"proxyAddress":"10.0.0.1","proxyPort":1080,"proxyType":"socks","bastionMode":true}`)
+	merged := mergeManagedOriginRequest(existing, route, nil, nil, logger)
+	if got, want := string(merged), `{"bastionMode":true,"proxyPort":1080,"proxyType":"socks"}`; got != want {
+		t.Fatalf("expected the unlabeled proxyAddress to be removed, got %s", got)
+	}
+	if unchanged := mergeManagedOriginRequest(merged, route, nil, nil, logger); string(unchanged) != string(merged) {
+		t.Fatalf("expected a matching proxyPort to leave originRequest unchanged, got %s", unchanged)
+	}
+}
+
 func decodeOriginRequest(t *testing.T, raw json.RawMessage) map[string]any {
 	t.Helper()
 	if len(raw) == 0 {
@@ -161,9 +543,9 @@ func TestEngineReconcileNoChanges(t *testing.T) {
 	ctx := context.Background()
 	api := &stubAPI{config: cloudflare.TunnelConfig{Ingress: []cloudflare.IngressRule{{Hostname: "a.example.com", Service: "http://a"}, {Service: model.FallbackService}}}}
 	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
-	engine := NewEngine(api, logger, false, true)
+	engine := NewEngine(api, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService})
 
-	err := engine.Reconcile(ctx, []model.RouteSpec{{Key: model.RouteKey{Hostname: "a.example.com"}, Service: "http://a"}})
+	_, err := engine.Reconcile(ctx, []model.RouteSpec{{Key: model.RouteKey{Hostname: "a.example.com"}, Service: "http://a"}})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -172,13 +554,93 @@ func TestEngineReconcileNoChanges(t *testing.T) {
 	}
 }
 
+func TestEngineReconcileIgnoresHostnameCase(t *testing.T) {
+	ctx := context.Background()
+	api := &stubAPI{config: cloudflare.TunnelConfig{Ingress: []cloudflare.IngressRule{{Hostname: "App.Example.com", Service: "http://a"}, {Service: model.FallbackService}}}}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService})
+
+	_, err := engine.Reconcile(ctx, []model.RouteSpec{{Key: model.RouteKey{Hostname: "app.example.com"}, Service: "http://a"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.updated {
+		t.Fatalf("expected no update when hostnames differ only in case")
+	}
+}
+
+func TestEngineReconcileHoldsBackMassRemovals(t *testing.T) {
+	ctx := context.Background()
+	existing := []cloudflare.IngressRule{{Hostname: "a.example.com", Service: "http://a"}, {Hostname: "b.example.com", Service: "http://b"}, {Service: model.FallbackService}}
+	api := &stubAPI{config: cloudflare.TunnelConfig{Ingress: existing}}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService, Removals: model.NewRemovalGuard(1, false)})
+
+	if _, err := engine.Reconcile(ctx, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.updated {
+		t.Fatalf("expected an update removing more rules than the limit to be held back")
+	}
+
+	if _, err := engine.Reconcile(ctx, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !api.updated || len(api.config.Ingress) != 1 {
+		t.Fatalf("expected the same removals to proceed on the next sync, got %+v", api.config.Ingress)
+	}
+}
+
+func TestEngineReconcileManagesWarpRouting(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	routes := []model.RouteSpec{{Key: model.RouteKey{Hostname: "a.example.com"}, Service: "http://a"}}
+	newAPI := func(warpRouting string) *stubAPI {
+		return &stubAPI{config: cloudflare.TunnelConfig{
+			Ingress: []cloudflare.IngressRule{{Hostname: "a.example.com", Service: "http://a"}, {Service: model.FallbackService}},
+			Raw:     map[string]json.RawMessage{"warp-routing": json.RawMessage(warpRouting)},
+		}}
+	}
+	enabled := true
+
+	unset := newAPI(`{"enabled":false}`)
+	if _, err := NewEngine(unset, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService}).Reconcile(ctx, routes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if unset.updated {
+		t.Fatalf("expected warp-routing to be left alone when SYNC_WARP_ROUTING is unset")
+	}
+
+	differs := newAPI(`{"enabled":false,"extra":1}`)
+	if _, err := NewEngine(differs, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService, WarpRouting: &enabled}).Reconcile(ctx, routes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !differs.updated {
+		t.Fatalf("expected an update when warp-routing differs")
+	}
+	if got := decodeOriginRequest(t, differs.config.Raw["warp-routing"]); got["enabled"] != true || got["extra"] != float64(1) {
+		t.Fatalf("expected warp-routing to be enabled with its other keys kept, got %v", got)
+	}
+	if len(differs.config.Ingress) != 2 || differs.config.Ingress[0].Hostname != "a.example.com" {
+		t.Fatalf("expected the ingress to be sent unchanged, got %+v", differs.config.Ingress)
+	}
+
+	matches := newAPI(`{"enabled":true}`)
+	if _, err := NewEngine(matches, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService, WarpRouting: &enabled}).Reconcile(ctx, routes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if matches.updated {
+		t.Fatalf("expected no update when warp-routing already matches")
+	}
+}
+
 func TestEngineReconcileManageDisabledSkipsUpdate(t *testing.T) {
 	ctx := context.Background()
 	api := &stubAPI{config: cloudflare.TunnelConfig{Ingress: []cloudflare.IngressRule{{Hostname: "a.example.com", Service: "http://a"}, {Service: model.FallbackService}}}}
 	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
-	engine := NewEngine(api, logger, false, false)
+	engine := NewEngine(api, logger, Options{DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService})
 
-	err := engine.Reconcile(ctx, []model.RouteSpec{{Key: model.RouteKey{Hostname: "b.example.com"}, Service: "http://b"}})
+	_, err := engine.Reconcile(ctx, []model.RouteSpec{{Key: model.RouteKey{Hostname: "b.example.com"}, Service: "http://b"}})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -187,11 +649,170 @@ func TestEngineReconcileManageDisabledSkipsUpdate(t *testing.T) {
 	}
 }
 
+func TestEngineReconcileWithoutAppendedFallback(t *testing.T) {
+	ctx := context.Background()
+	api := &stubAPI{config: cloudflare.TunnelConfig{Ingress: []cloudflare.IngressRule{{Hostname: "a.example.com", Service: "http://a"}, {Service: "http://catch-all:8080"}}}}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, FallbackService: model.FallbackService})
+
+	_, err := engine.Reconcile(ctx, []model.RouteSpec{{Key: model.RouteKey{Hostname: "b.example.com"}, Service: "http://b"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ingress := api.config.Ingress
+	if !api.updated || len(ingress) != 2 || ingress[0].Hostname != "b.example.com" || ingress[1].Service != "http://catch-all:8080" {
+		t.Fatalf("expected existing catch-all to be kept instead of the fallback, got %+v", ingress)
+	}
+}
+
+func TestEngineReconcileWithoutAppendedFallbackRequiresCatchAll(t *testing.T) {
+	ctx := context.Background()
+	api := &stubAPI{config: cloudflare.TunnelConfig{Ingress: []cloudflare.IngressRule{{Hostname: "a.example.com", Service: "http://a"}}}}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, FallbackService: model.FallbackService})
+
+	_, err := engine.Reconcile(ctx, []model.RouteSpec{{Key: model.RouteKey{Hostname: "b.example.com"}, Service: "http://b"}})
+	if err == nil || !strings.Contains(err.Error(), "without a catch-all rule") {
+		t.Fatalf("expected missing catch-all error, got %v", err)
+	}
+	if api.updated {
+		t.Fatalf("expected no update without a catch-all rule")
+	}
+}
+
+func TestEngineReconcileUsesConfiguredFallbackService(t *testing.T) {
+	ctx := context.Background()
+	api := &stubAPI{config: cloudflare.TunnelConfig{Ingress: []cloudflare.IngressRule{{Hostname: "a.example.com", Service: "http://a"}, {Service: model.FallbackService}}}}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: "http://error-pages:8080"})
+	desired := []model.RouteSpec{{Key: model.RouteKey{Hostname: "a.example.com"}, Service: "http://a"}}
+
+	if _, err := engine.Reconcile(ctx, desired); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ingress := api.config.Ingress
+	if !api.updated || len(ingress) != 2 || ingress[1].Service != "http://error-pages:8080" {
+		t.Fatalf("expected configured fallback service as the last rule, got %+v", ingress)
+	}
+
+	api.updated = false
+	api.config.Ingress[1].OriginRequest = []byte(`{"connectTimeout":"10s"}`)
+	if _, err := engine.Reconcile(ctx, desired); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.updated {
+		t.Fatalf("expected no update when the existing catch-all matches")
+	}
+}
+
+func TestEngineReconcileKeepsProtectedHostnames(t *testing.T) {
+	ctx := context.Background()
+	api := &stubAPI{config: cloudflare.TunnelConfig{Ingress: []cloudflare.IngressRule{
+		{Hostname: "mail.example.com", Service: "https://mail:443", OriginRequest: []byte(`{"noTLSVerify":true}`)},
+		{Hostname: "vpn.internal.example.com", Service: "tcp://vpn:1194"},
+		{Hostname: "old.example.com", Service: "http://old"},
+		{Service: model.FallbackService},
+	}}}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService, Protected: model.ProtectedHostnames{"mail.example.com", "*.internal.example.com"}})
+	desired := []model.RouteSpec{
+		{Key: model.RouteKey{Hostname: "app.example.com"}, Service: "http://app"},
+		{Key: model.RouteKey{Hostname: "MAIL.example.com"}, Service: "http://hijack"},
+	}
+
+	if _, err := engine.Reconcile(ctx, desired); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ingress := api.config.Ingress
+	if len(ingress) != 4 || ingress[0].Hostname != "app.example.com" {
+		t.Fatalf("expected labeled rule, protected rules, and fallback, got %+v", ingress)
+	}
+	if ingress[1].Hostname != "mail.example.com" || ingress[1].Service != "https://mail:443" || string(ingress[1].OriginRequest) != `{"noTLSVerify":true}` {
+		t.Fatalf("expected protected rule to be kept verbatim, got %+v", ingress[1])
+	}
+	if ingress[2].Hostname != "vpn.internal.example.com" {
+		t.Fatalf("expected wildcard-protected rule to be kept, got %+v", ingress[2])
+	}
+}
+
+func TestEngineReconcileSkipsLocallyManagedTunnel(t *testing.T) {
+	ctx := context.Background()
+	api := &stubAPI{
+		config: cloudflare.TunnelConfig{Ingress: []cloudflare.IngressRule{{Service: model.FallbackService}}},
+		tunnel: cloudflare.Tunnel{ID: "tunnel-id", Name: "home", ConfigSrc: "local"},
+	}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	desired := []model.RouteSpec{{Key: model.RouteKey{Hostname: "app.example.com"}, Service: "http://app"}}
+
+	engine := NewEngine(api, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService})
+	if _, err := engine.Reconcile(ctx, desired); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.updated {
+		t.Fatalf("expected no update for a locally managed tunnel")
+	}
+
+	api.tunnel.ConfigSrc = "cloudflare"
+	if _, err := engine.Reconcile(ctx, desired); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !api.updated {
+		t.Fatalf("expected updates to resume once the tunnel is remotely managed")
+	}
+
+	api.updated = false
+	api.config.Ingress = []cloudflare.IngressRule{{Service: model.FallbackService}}
+	api.tunnel.ConfigSrc = "local"
+	ignoring := NewEngine(api, logger, Options{ManageTunnel: true, IgnoreConfigSrc: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService})
+	if _, err := ignoring.Reconcile(ctx, desired); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !api.updated {
+		t.Fatalf("expected SYNC_IGNORE_CONFIG_SRC to push updates to a locally managed tunnel")
+	}
+}
+
+func TestBuildDesiredIngressKeepsRulesWhenDeleteRoutesDisabled(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(nil, logger, Options{DryRun: true, ManageTunnel: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService})
+
+	existing := []cloudflare.IngressRule{
+		{Hostname: "old.example.com", Service: "http://old"},
+		{Hostname: "a.example.com", Service: "http://a-old"},
+		{Service: model.FallbackService},
+	}
+	desired := []model.RouteSpec{
+		{Key: model.RouteKey{Hostname: "a.example.com"}, Service: "http://a"},
+		{Key: model.RouteKey{Hostname: "b.example.com"}, Service: "http://b"},
+	}
+
+	desiredIngress, removed := engine.buildDesiredIngress(desired, existing)
+	if len(removed) != 0 {
+		t.Fatalf("expected no removed rules, got %+v", removed)
+	}
+	if len(desiredIngress) != 4 || desiredIngress[2].Hostname != "old.example.com" || !isCatchAll(desiredIngress[3]) {
+		t.Fatalf("expected undefined rule kept before the catch-all, got %+v", desiredIngress)
+	}
+	if desiredIngress[0].Service != "http://a" {
+		t.Fatalf("expected labeled rule to be updated, got %+v", desiredIngress[0])
+	}
+	for _, change := range diffIngress(existing, desiredIngress) {
+		if change.Action == ingressRuleRemoved {
+			t.Fatalf("expected no removal in the ingress diff, got %+v", change)
+		}
+	}
+}
+
 type stubAPI struct {
 	config  cloudflare.TunnelConfig
+	tunnel  cloudflare.Tunnel
 	updated bool
 }
 
+func (api *stubAPI) GetTunnel(ctx context.Context) (cloudflare.Tunnel, error) {
+	return api.tunnel, nil
+}
+
 func (api *stubAPI) GetConfig(ctx context.Context) (cloudflare.TunnelConfig, error) {
 	return api.config, nil
 }
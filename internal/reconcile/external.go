@@ -0,0 +1,35 @@
+package reconcile
+
+import (
+	"strings"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/cloudflare"
+)
+
+// detectExternalChanges warns when the fetched ingress no longer matches the
+// ingress this engine last applied or found up-to-date, which means it was
+// edited elsewhere, such as in the dashboard. Each change is reported once.
+// The remembered ingress lives in memory only, so nothing is reported before
+// the first sync after a start.
+func (engine *Engine) detectExternalChanges(existing []cloudflare.IngressRule) {
+	if engine.lastApplied == nil || ingressEqual(engine.lastApplied, existing) {
+		return
+	}
+	changes := diffIngress(engine.lastApplied, existing)
+	rules := make([]string, 0, len(changes))
+	for _, change := range changes {
+		rules = append(rules, change.Action+" "+change.Rule)
+	}
+	if len(rules) == 0 {
+		// Same rules in another order.
+		rules = append(rules, "reordered")
+	}
+	engine.log.Warn("external modification detected: tunnel ingress changed since the last sync", "changes", strings.Join(rules, ", "))
+	engine.rememberApplied(existing)
+}
+
+// rememberApplied records the ingress now in Cloudflare for the next
+// detectExternalChanges.
+func (engine *Engine) rememberApplied(ingress []cloudflare.IngressRule) {
+	engine.lastApplied = append([]cloudflare.IngressRule{}, ingress...)
+}
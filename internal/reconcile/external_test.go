@@ -0,0 +1,54 @@
+package reconcile
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/cloudflare"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/model"
+)
+
+func TestEngineReconcileDetectsExternalModification(t *testing.T) {
+	ctx := context.Background()
+	api := &stubAPI{config: cloudflare.TunnelConfig{Ingress: []cloudflare.IngressRule{{Service: model.FallbackService}}}}
+	var output strings.Builder
+	logger := slog.New(slog.NewTextHandler(&output, nil))
+	engine := NewEngine(api, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService})
+	desired := []model.RouteSpec{{Key: model.RouteKey{Hostname: "app.example.com"}, Service: "http://app"}}
+
+	if _, err := engine.Reconcile(ctx, desired); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := engine.Reconcile(ctx, desired); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(output.String(), "external modification detected") {
+		t.Fatalf("expected no warning without outside changes, got %q", output.String())
+	}
+
+	api.config.Ingress = []cloudflare.IngressRule{
+		{Hostname: "app.example.com", Service: "http://changed"},
+		{Hostname: "manual.example.com", Service: "http://manual"},
+		{Service: model.FallbackService},
+	}
+	if _, err := engine.Reconcile(ctx, desired); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	logged := output.String()
+	if strings.Count(logged, "external modification detected") != 1 || !strings.Contains(logged, `changes="changed app.example.com, added manual.example.com"`) {
+		t.Fatalf("expected one warning listing the changed rules, got %q", logged)
+	}
+	if api.config.Ingress[0].Service != "http://app" {
+		t.Fatalf("expected the desired ingress to be applied again, got %+v", api.config.Ingress)
+	}
+
+	output.Reset()
+	if _, err := engine.Reconcile(ctx, desired); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(output.String(), "external modification detected") {
+		t.Fatalf("expected the engine's own update not to be reported, got %q", output.String())
+	}
+}
@@ -0,0 +1,66 @@
+package reconcile
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/cloudflare"
+)
+
+// sortIngressRules orders label-defined rules so cloudflared, which uses the
+// first matching rule, reaches the most specific one. Rules are grouped by
+// hostname: exact hostnames come before wildcards, deeper wildcards first, and
+// within a group the longest paths come first and the path-less rule last.
+// Groups otherwise keep the order in which they first appear.
+func sortIngressRules(rules []cloudflare.IngressRule) {
+	groups := [][]cloudflare.IngressRule{}
+	groupIndex := map[string]int{}
+	for _, rule := range rules {
+		hostname := strings.ToLower(rule.Hostname)
+		index, ok := groupIndex[hostname]
+		if !ok {
+			index = len(groups)
+			groupIndex[hostname] = index
+			groups = append(groups, nil)
+		}
+		groups[index] = append(groups[index], rule)
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		return hostnameBefore(groups[i][0].Hostname, groups[j][0].Hostname)
+	})
+
+	position := 0
+	for _, group := range groups {
+		sort.SliceStable(group, func(i, j int) bool {
+			return pathBefore(group[i].Path, group[j].Path)
+		})
+		position += copy(rules[position:], group)
+	}
+}
+
+// hostnameBefore orders exact hostnames before wildcards, and wildcards with
+// more labels before shorter ones. Other hostnames are equal.
+func hostnameBefore(left string, right string) bool {
+	leftWildcard := strings.HasPrefix(left, "*")
+	rightWildcard := strings.HasPrefix(right, "*")
+	if leftWildcard != rightWildcard {
+		return !leftWildcard
+	}
+	if !leftWildcard {
+		return false
+	}
+	return strings.Count(left, ".") > strings.Count(right, ".")
+}
+
+// pathBefore orders paths of one hostname: longer paths first, then
+// alphabetically, and the empty path last.
+func pathBefore(left string, right string) bool {
+	if (left == "") != (right == "") {
+		return left != ""
+	}
+	if len(left) != len(right) {
+		return len(left) > len(right)
+	}
+	return left < right
+}
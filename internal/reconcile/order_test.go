@@ -0,0 +1,145 @@
+package reconcile
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/cloudflare"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/model"
+)
+
+func TestSortIngressRulesOrdersBySpecificity(t *testing.T) {
+	rules := []cloudflare.IngressRule{
+		{Hostname: "*.example.com"},
+		{Hostname: "app.example.com"},
+		{Hostname: "other.example.com"},
+		{Hostname: "app.example.com", Path: "/api"},
+		{Hostname: "*.dev.example.com"},
+		{Hostname: "app.example.com", Path: "/api/v2"},
+		{Hostname: "app.example.com", Path: "/web"},
+	}
+
+	sortIngressRules(rules)
+
+	want := []string{
+		"app.example.com/api/v2",
+		"app.example.com/api",
+		"app.example.com/web",
+		"app.example.com",
+		"other.example.com",
+		"*.dev.example.com",
+		"*.example.com",
+	}
+	for index, rule := range rules {
+		if got := ingressRuleKey(rule); got != want[index] {
+			t.Fatalf("unexpected order at %d: got %s, want %s (all: %+v)", index, got, want[index], rules)
+		}
+	}
+}
+
+func TestEngineReconcileKeepsCanonicalOrder(t *testing.T) {
+	ctx := context.Background()
+	api := &stubAPI{config: cloudflare.TunnelConfig{Ingress: []cloudflare.IngressRule{
+		{Hostname: "app.example.com", Path: "/api", Service: "http://api"},
+		{Hostname: "app.example.com", Service: "http://app"},
+		{Hostname: "*.example.com", Service: "http://wildcard"},
+		{Service: model.FallbackService},
+	}}}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService})
+	desired := []model.RouteSpec{
+		{Key: model.RouteKey{Hostname: "*.example.com"}, Service: "http://wildcard"},
+		{Key: model.RouteKey{Hostname: "app.example.com"}, Service: "http://app"},
+		{Key: model.RouteKey{Hostname: "app.example.com", Path: "/api"}, Service: "http://api"},
+	}
+
+	if _, err := engine.Reconcile(ctx, desired); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.updated {
+		t.Fatalf("expected no update when the remote ingress is already in canonical order")
+	}
+
+	api.config.Ingress[0], api.config.Ingress[1] = api.config.Ingress[1], api.config.Ingress[0]
+	if _, err := engine.Reconcile(ctx, desired); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !api.updated || api.config.Ingress[0].Path != "/api" {
+		t.Fatalf("expected the path rule to be moved before the path-less rule, got %+v", api.config.Ingress)
+	}
+}
+
+func TestEngineReconcileSortsPreservedRulesWithLabelRules(t *testing.T) {
+	ctx := context.Background()
+	api := &stubAPI{config: cloudflare.TunnelConfig{Ingress: []cloudflare.IngressRule{
+		{Hostname: "app.example.com", Path: "/legacy", Service: "http://legacy"},
+		{Service: model.FallbackService},
+	}}}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{ManageTunnel: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService})
+	desired := []model.RouteSpec{
+		{Key: model.RouteKey{Hostname: "app.example.com"}, Service: "http://app"},
+	}
+
+	if _, err := engine.Reconcile(ctx, desired); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{"app.example.com/legacy", "app.example.com", ""}
+	if len(api.config.Ingress) != len(want) {
+		t.Fatalf("unexpected ingress: %+v", api.config.Ingress)
+	}
+	for index, rule := range api.config.Ingress {
+		if got := ingressRuleKey(rule); got != want[index] {
+			t.Fatalf("unexpected order at %d: got %s, want %s (all: %+v)", index, got, want[index], api.config.Ingress)
+		}
+	}
+}
+
+func TestEngineReconcileIgnoresRuleOrderWhenNotEnforced(t *testing.T) {
+	ctx := context.Background()
+	api := &stubAPI{config: cloudflare.TunnelConfig{Ingress: []cloudflare.IngressRule{
+		{Hostname: "*.example.com", Service: "http://wildcard"},
+		{Hostname: "app.example.com", Service: "http://app"},
+		{Service: model.FallbackService},
+	}}}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{ManageTunnel: true, DeleteRoutes: true, AppendFallback: true, FallbackService: model.FallbackService})
+	desired := []model.RouteSpec{
+		{Key: model.RouteKey{Hostname: "app.example.com"}, Service: "http://app"},
+		{Key: model.RouteKey{Hostname: "*.example.com"}, Service: "http://wildcard"},
+	}
+
+	if _, err := engine.Reconcile(ctx, desired); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.updated {
+		t.Fatalf("expected no update when only the rule order differs")
+	}
+
+	api.config.Ingress = []cloudflare.IngressRule{
+		{Service: model.FallbackService},
+		{Hostname: "*.example.com", Service: "http://wildcard"},
+		{Hostname: "app.example.com", Service: "http://app"},
+	}
+	if _, err := engine.Reconcile(ctx, desired); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !api.updated || !isCatchAll(api.config.Ingress[len(api.config.Ingress)-1]) {
+		t.Fatalf("expected the catch-all to be moved back to the end, got %+v", api.config.Ingress)
+	}
+
+	api.updated = false
+	api.config.Ingress = []cloudflare.IngressRule{
+		{Hostname: "*.example.com", Service: "http://wildcard"},
+		{Hostname: "app.example.com", Service: "http://old"},
+		{Service: model.FallbackService},
+	}
+	if _, err := engine.Reconcile(ctx, desired); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !api.updated {
+		t.Fatalf("expected an update when a rule's content differs")
+	}
+}
@@ -0,0 +1,79 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/cloudflare"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/model"
+)
+
+const (
+	// defaultRetryDelay is the first backoff delay between two attempts.
+	defaultRetryDelay = time.Second
+	// maxRetryDelay caps the backoff delay and the honored Retry-After.
+	maxRetryDelay = time.Minute
+)
+
+// reconcileWithRetry runs the sync and, when it fails with a retryable
+// Cloudflare error (429, 5xx, or a network failure), runs it again up to
+// engine.retries times with exponential backoff. Each attempt reads the
+// tunnel configuration again, so edits made in the dashboard in the meantime
+// are not overwritten with a stale copy. Other errors are returned at once.
+func (engine *Engine) reconcileWithRetry(ctx context.Context, desired []model.RouteSpec) (model.SyncResult, error) {
+	delay := engine.retryDelay
+	cycle := &syncCycle{}
+	for attempt := 1; ; attempt++ {
+		result, err := engine.reconcileOnce(ctx, desired, cycle)
+		if err == nil || attempt > engine.retries || !cloudflare.Retryable(err) {
+			return result, err
+		}
+
+		wait := delay
+		var statusErr *cloudflare.StatusError
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+			wait = statusErr.RetryAfter
+		}
+		wait = min(wait, maxRetryDelay)
+		engine.log.Warn("tunnel sync failed with a retryable error; retrying", "attempt", attempt, "retries", engine.retries, "delay", wait, "error", err)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return model.SyncResult{}, err
+		case <-timer.C:
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
+
+// syncCycle carries decisions made by one attempt of a sync to its retries.
+type syncCycle struct {
+	// allowedRemovals are the rule removals the removal guard allowed; the
+	// guard forgets removals once it confirms them, so a retry removing the
+	// same rules must not ask it again.
+	allowedRemovals []string
+	removalsAllowed bool
+	// backedUp is set once the configuration was backed up, so retries do
+	// not write the same backup again and rotate out older ones.
+	backedUp bool
+}
+
+// allowRemovals asks the removal guard whether the sync may remove the rules
+// named by keys, once per sync: a retry removing the same rules reuses the
+// first answer.
+func (engine *Engine) allowRemovals(cycle *syncCycle, keys []string) bool {
+	sorted := slices.Sorted(slices.Values(keys))
+	if cycle.removalsAllowed && slices.Equal(cycle.allowedRemovals, sorted) {
+		return true
+	}
+	if !engine.removals.Allow("tunnel", keys) {
+		return false
+	}
+	cycle.allowedRemovals = sorted
+	cycle.removalsAllowed = true
+	return true
+}
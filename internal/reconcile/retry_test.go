@@ -0,0 +1,117 @@
+package reconcile
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"log/slog"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/cloudflare"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/model"
+)
+
+func TestEngineReconcileRetriesTransientUpdateFailures(t *testing.T) {
+	api := &flakyAPI{
+		stubAPI:    stubAPI{config: cloudflare.TunnelConfig{Ingress: []cloudflare.IngressRule{{Service: model.FallbackService}}}},
+		updateErrs: []error{&cloudflare.StatusError{StatusCode: http.StatusBadGateway, Status: "502 Bad Gateway"}},
+	}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService, Retries: 3})
+	engine.retryDelay = time.Millisecond
+	desired := []model.RouteSpec{{Key: model.RouteKey{Hostname: "app.example.com"}, Service: "http://app"}}
+
+	if _, err := engine.Reconcile(context.Background(), desired); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.updateCalls != 2 || !api.updated {
+		t.Fatalf("expected the update to succeed on the second attempt, got %d attempts", api.updateCalls)
+	}
+	if api.getCalls != 2 {
+		t.Fatalf("expected the configuration to be read again before retrying, got %d reads", api.getCalls)
+	}
+}
+
+func TestEngineReconcileFailsImmediatelyOnClientErrors(t *testing.T) {
+	api := &flakyAPI{
+		stubAPI:    stubAPI{config: cloudflare.TunnelConfig{Ingress: []cloudflare.IngressRule{{Service: model.FallbackService}}}},
+		updateErrs: []error{&cloudflare.StatusError{StatusCode: http.StatusBadRequest, Status: "400 Bad Request", Summary: "10001: invalid ingress"}},
+	}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService, Retries: 3})
+	engine.retryDelay = time.Millisecond
+
+	_, err := engine.Reconcile(context.Background(), []model.RouteSpec{{Key: model.RouteKey{Hostname: "app.example.com"}, Service: "http://app"}})
+	if err == nil || !strings.Contains(err.Error(), "10001: invalid ingress") {
+		t.Fatalf("expected the API error detail, got %v", err)
+	}
+	if api.updateCalls != 1 {
+		t.Fatalf("expected no retry for a 400, got %d attempts", api.updateCalls)
+	}
+}
+
+func TestEngineReconcileStopsAfterConfiguredRetries(t *testing.T) {
+	unavailable := &cloudflare.StatusError{StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable"}
+	api := &flakyAPI{
+		stubAPI:    stubAPI{config: cloudflare.TunnelConfig{Ingress: []cloudflare.IngressRule{{Service: model.FallbackService}}}},
+		updateErrs: []error{unavailable, unavailable, unavailable},
+	}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService, Retries: 1})
+	engine.retryDelay = time.Millisecond
+
+	_, err := engine.Reconcile(context.Background(), []model.RouteSpec{{Key: model.RouteKey{Hostname: "app.example.com"}, Service: "http://app"}})
+	if err == nil || api.updateCalls != 2 {
+		t.Fatalf("expected the sync to fail after one retry, got %d attempts and %v", api.updateCalls, err)
+	}
+}
+
+func TestEngineReconcileRetriesConfirmedRemovals(t *testing.T) {
+	existing := []cloudflare.IngressRule{{Hostname: "a.example.com", Service: "http://a"}, {Hostname: "b.example.com", Service: "http://b"}, {Service: model.FallbackService}}
+	api := &flakyAPI{stubAPI: stubAPI{config: cloudflare.TunnelConfig{Ingress: existing}}}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService, Retries: 3, Removals: model.NewRemovalGuard(1, false)})
+	engine.retryDelay = time.Millisecond
+
+	if _, err := engine.Reconcile(context.Background(), nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.updateCalls != 0 {
+		t.Fatalf("expected the mass removal to be held back, got %d updates", api.updateCalls)
+	}
+
+	// The next sync confirms the removals and its first update fails.
+	api.updateErrs = []error{&cloudflare.StatusError{StatusCode: http.StatusBadGateway, Status: "502 Bad Gateway"}}
+	if _, err := engine.Reconcile(context.Background(), nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.updateCalls != 2 || !api.updated || len(api.config.Ingress) != 1 {
+		t.Fatalf("expected the confirmed removals to be applied on the retry, got %d attempts and %+v", api.updateCalls, api.config.Ingress)
+	}
+}
+
+// flakyAPI fails UpdateConfig with updateErrs, one per call, before
+// delegating to stubAPI.
+type flakyAPI struct {
+	stubAPI
+	updateErrs  []error
+	updateCalls int
+	getCalls    int
+}
+
+func (api *flakyAPI) GetConfig(ctx context.Context) (cloudflare.TunnelConfig, error) {
+	api.getCalls++
+	return api.stubAPI.GetConfig(ctx)
+}
+
+func (api *flakyAPI) UpdateConfig(ctx context.Context, config cloudflare.TunnelConfig) error {
+	api.updateCalls++
+	if len(api.updateErrs) > 0 {
+		err := api.updateErrs[0]
+		api.updateErrs = api.updateErrs[1:]
+		return err
+	}
+	return api.stubAPI.UpdateConfig(ctx, config)
+}
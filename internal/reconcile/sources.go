@@ -0,0 +1,62 @@
+package reconcile
+
+import (
+	"sort"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/model"
+)
+
+// maxRouteSources bounds the routes whose last source is remembered. The
+// routes seen longest ago are forgotten first.
+const maxRouteSources = 4096
+
+// routeSources remembers which container last defined each route in a
+// successful sync, so logs about a rule that is removed or changed can name
+// the container that used to own it. It lives in memory only.
+type routeSources struct {
+	cycle   uint64
+	entries map[model.RouteKey]routeSource
+}
+
+type routeSource struct {
+	source model.SourceRef
+	seen   uint64
+}
+
+// record remembers the source of each label-defined route.
+func (sources *routeSources) record(desired []model.RouteSpec) {
+	if sources.entries == nil {
+		sources.entries = map[model.RouteKey]routeSource{}
+	}
+	sources.cycle++
+	for _, route := range desired {
+		if route.Fallback || route.Source.ContainerName == "" && route.Source.ContainerID == "" {
+			continue
+		}
+		sources.entries[route.Key] = routeSource{source: route.Source, seen: sources.cycle}
+	}
+	if len(sources.entries) <= maxRouteSources {
+		return
+	}
+
+	keys := make([]model.RouteKey, 0, len(sources.entries))
+	for key := range sources.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return sources.entries[keys[i]].seen < sources.entries[keys[j]].seen
+	})
+	for _, key := range keys[:len(keys)-maxRouteSources] {
+		delete(sources.entries, key)
+	}
+}
+
+// attrs returns the last known source of the route as log attributes, or
+// nothing when it was never seen.
+func (sources *routeSources) attrs(key model.RouteKey) []any {
+	entry, found := sources.entries[key]
+	if !found {
+		return nil
+	}
+	return []any{"last_source_container", entry.source.ContainerName, "last_source_container_id", entry.source.ContainerID}
+}
@@ -0,0 +1,30 @@
+package reconcile
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/model"
+)
+
+func TestRouteSourcesForgetsRoutesSeenLongestAgo(t *testing.T) {
+	sources := routeSources{}
+	old := model.RouteSpec{Key: model.RouteKey{Hostname: "old.example.com"}, Source: model.SourceRef{ContainerName: "old"}}
+	sources.record([]model.RouteSpec{old})
+
+	routes := make([]model.RouteSpec, 0, maxRouteSources)
+	for index := range maxRouteSources {
+		routes = append(routes, model.RouteSpec{Key: model.RouteKey{Hostname: fmt.Sprintf("app-%d.example.com", index)}, Source: model.SourceRef{ContainerName: "app"}})
+	}
+	sources.record(routes)
+
+	if len(sources.entries) != maxRouteSources {
+		t.Fatalf("expected at most %d remembered routes, got %d", maxRouteSources, len(sources.entries))
+	}
+	if attrs := sources.attrs(old.Key); attrs != nil {
+		t.Fatalf("expected the oldest route to be forgotten, got %v", attrs)
+	}
+	if attrs := sources.attrs(routes[0].Key); len(attrs) == 0 {
+		t.Fatalf("expected the latest routes to be remembered")
+	}
+}
@@ -0,0 +1,58 @@
+package reconcile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/cloudflare"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/model"
+)
+
+// validateIngress checks an ingress list before it replaces the tunnel
+// configuration, so a list Cloudflare would reject is never sent. It returns
+// one error per offending rule: the only catch-all must be the last rule,
+// every other rule needs a hostname and a service, hostname and path pairs
+// must be unique, and originRequest must be valid JSON.
+func validateIngress(rules []cloudflare.IngressRule) error {
+	failures := []error{}
+	if len(rules) == 0 {
+		return errors.New("ingress has no rules")
+	}
+	last := len(rules) - 1
+	if !isCatchAll(rules[last]) {
+		failures = append(failures, fmt.Errorf("rule %d (%s): last rule must be a catch-all with a service and no hostname or path", last, ruleName(rules[last])))
+	}
+	seen := map[string]int{}
+	for index, rule := range rules[:last] {
+		name := ruleName(rule)
+		switch {
+		case isCatchAll(rule):
+			failures = append(failures, fmt.Errorf("rule %d: catch-all rule must be last", index))
+		case rule.Hostname == "":
+			failures = append(failures, fmt.Errorf("rule %d (%s): hostname is empty", index, name))
+		case rule.Service == "":
+			failures = append(failures, fmt.Errorf("rule %d (%s): service is empty", index, name))
+		}
+		if rule.Hostname != "" {
+			key := strings.ToLower(name)
+			if first, ok := seen[key]; ok {
+				failures = append(failures, fmt.Errorf("rule %d (%s): duplicates rule %d", index, name, first))
+			} else {
+				seen[key] = index
+			}
+		}
+	}
+	for index, rule := range rules {
+		if len(rule.OriginRequest) > 0 && !json.Valid(rule.OriginRequest) {
+			failures = append(failures, fmt.Errorf("rule %d (%s): originRequest is not valid JSON", index, ruleName(rule)))
+		}
+	}
+	return errors.Join(failures...)
+}
+
+// ruleName describes a rule in validation errors with its hostname as written.
+func ruleName(rule cloudflare.IngressRule) string {
+	return model.RouteKey{Hostname: rule.Hostname, Path: rule.Path}.String()
+}
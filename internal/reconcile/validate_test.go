@@ -0,0 +1,62 @@
+package reconcile
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/cloudflare"
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/model"
+)
+
+func TestValidateIngressListsOffendingRules(t *testing.T) {
+	err := validateIngress([]cloudflare.IngressRule{
+		{Hostname: "app.example.com", Service: "http://app"},
+		{Service: "http_status:404"},
+		{Hostname: "App.example.com", Service: "http://other"},
+		{Hostname: "api.example.com"},
+		{Hostname: "web.example.com", Service: "http://web", OriginRequest: json.RawMessage(`{"noTLSVerify":`)},
+		{Hostname: "last.example.com", Service: "http://last"},
+	})
+	if err == nil {
+		t.Fatalf("expected validation errors")
+	}
+	for _, want := range []string{
+		"rule 5 (last.example.com): last rule must be a catch-all",
+		"rule 1: catch-all rule must be last",
+		"rule 2 (App.example.com): duplicates rule 0",
+		"rule 3 (api.example.com): service is empty",
+		"rule 4 (web.example.com): originRequest is not valid JSON",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q in %v", want, err)
+		}
+	}
+
+	if err := validateIngress([]cloudflare.IngressRule{
+		{Hostname: "app.example.com", Path: "/api", Service: "http://api"},
+		{Hostname: "app.example.com", Service: "http://app"},
+		{Service: "http_status:404"},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestEngineReconcileRefusesInvalidIngress(t *testing.T) {
+	api := &stubAPI{config: cloudflare.TunnelConfig{Ingress: []cloudflare.IngressRule{{Service: model.FallbackService}}}}
+	logger := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	engine := NewEngine(api, logger, Options{ManageTunnel: true, DeleteRoutes: true, EnforceOrder: true, AppendFallback: true, FallbackService: model.FallbackService})
+
+	_, err := engine.Reconcile(context.Background(), []model.RouteSpec{
+		{Key: model.RouteKey{Hostname: "app.example.com"}, Service: "http://app"},
+		{Key: model.RouteKey{Hostname: "api.example.com"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "rule 1 (api.example.com): service is empty") {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	if api.updated {
+		t.Fatalf("expected the invalid ingress not to be sent")
+	}
+}
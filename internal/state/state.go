@@ -0,0 +1,279 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/model"
+)
+
+// Store persists the tunnel routes (hostname and path) this controller has written to the ingress configuration,
+// the hostnames whose DNS records it manages, and the SYNC_DEFAULT_ORIGIN_REQUEST and origin.raw keys it last applied.
+type Store struct {
+	path              string
+	routes            map[model.RouteKey]struct{}
+	dnsHostnames      map[string]struct{}
+	originDefaultKeys []string
+	originRawKeys     map[model.RouteKey][]string
+}
+
+type stateFile struct {
+	TunnelRoutes      []routePayload     `json:"tunnel_routes"`
+	DNSHostnames      []string           `json:"dns_hostnames,omitempty"`
+	OriginDefaultKeys []string           `json:"origin_default_keys,omitempty"`
+	OriginRawKeys     []originRawPayload `json:"origin_raw_keys,omitempty"`
+}
+
+type routePayload struct {
+	Hostname string `json:"hostname"`
+	Path     string `json:"path,omitempty"`
+}
+
+type originRawPayload struct {
+	Hostname string   `json:"hostname"`
+	Path     string   `json:"path,omitempty"`
+	Keys     []string `json:"keys"`
+}
+
+// Load reads the state file at path. A missing file yields an empty store.
+func Load(path string) (*Store, error) {
+	store := &Store{path: path, routes: map[model.RouteKey]struct{}{}, dnsHostnames: map[string]struct{}{}, originRawKeys: map[model.RouteKey][]string{}}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return store, nil
+		}
+		return nil, fmt.Errorf("read state file %s: %w", path, err)
+	}
+
+	var decoded stateFile
+	if err := json.Unmarshal(content, &decoded); err != nil {
+		return nil, fmt.Errorf("decode state file %s: %w", path, err)
+	}
+	for _, route := range decoded.TunnelRoutes {
+		key := normalizeRouteKey(model.RouteKey{Hostname: route.Hostname, Path: route.Path})
+		if key.Hostname == "" {
+			continue
+		}
+		store.routes[key] = struct{}{}
+	}
+	for _, hostname := range decoded.DNSHostnames {
+		hostname = normalizeHostname(hostname)
+		if hostname == "" {
+			continue
+		}
+		store.dnsHostnames[hostname] = struct{}{}
+	}
+	store.SetOriginDefaultKeys(decoded.OriginDefaultKeys)
+	rawKeys := map[model.RouteKey][]string{}
+	for _, route := range decoded.OriginRawKeys {
+		key := model.RouteKey{Hostname: route.Hostname, Path: route.Path}
+		rawKeys[key] = append(rawKeys[key], route.Keys...)
+	}
+	store.SetOriginRawKeys(rawKeys)
+
+	return store, nil
+}
+
+// HasTunnelRoute reports whether the route was previously written by this controller.
+func (store *Store) HasTunnelRoute(key model.RouteKey) bool {
+	_, ok := store.routes[normalizeRouteKey(key)]
+	return ok
+}
+
+// AddTunnelRoutes records routes and reports whether any were new.
+func (store *Store) AddTunnelRoutes(keys []model.RouteKey) bool {
+	changed := false
+	for _, key := range keys {
+		normalized := normalizeRouteKey(key)
+		if normalized.Hostname == "" {
+			continue
+		}
+		if _, ok := store.routes[normalized]; ok {
+			continue
+		}
+		store.routes[normalized] = struct{}{}
+		changed = true
+	}
+	return changed
+}
+
+// RemoveTunnelRoutes forgets routes and reports whether any were tracked.
+func (store *Store) RemoveTunnelRoutes(keys []model.RouteKey) bool {
+	changed := false
+	for _, key := range keys {
+		normalized := normalizeRouteKey(key)
+		if _, ok := store.routes[normalized]; !ok {
+			continue
+		}
+		delete(store.routes, normalized)
+		changed = true
+	}
+	return changed
+}
+
+// DNSHostnames returns the hostnames whose DNS records this controller manages, sorted.
+func (store *Store) DNSHostnames() []string {
+	hostnames := make([]string, 0, len(store.dnsHostnames))
+	for hostname := range store.dnsHostnames {
+		hostnames = append(hostnames, hostname)
+	}
+	sort.Strings(hostnames)
+	return hostnames
+}
+
+// HasDNSHostname reports whether the hostname's DNS record was previously managed by this controller.
+func (store *Store) HasDNSHostname(hostname string) bool {
+	_, ok := store.dnsHostnames[normalizeHostname(hostname)]
+	return ok
+}
+
+// AddDNSHostnames records hostnames and reports whether any were new.
+func (store *Store) AddDNSHostnames(hostnames []string) bool {
+	changed := false
+	for _, hostname := range hostnames {
+		normalized := normalizeHostname(hostname)
+		if normalized == "" {
+			continue
+		}
+		if _, ok := store.dnsHostnames[normalized]; ok {
+			continue
+		}
+		store.dnsHostnames[normalized] = struct{}{}
+		changed = true
+	}
+	return changed
+}
+
+// RemoveDNSHostnames forgets hostnames and reports whether any were tracked.
+func (store *Store) RemoveDNSHostnames(hostnames []string) bool {
+	changed := false
+	for _, hostname := range hostnames {
+		normalized := normalizeHostname(hostname)
+		if _, ok := store.dnsHostnames[normalized]; !ok {
+			continue
+		}
+		delete(store.dnsHostnames, normalized)
+		changed = true
+	}
+	return changed
+}
+
+// OriginDefaultKeys returns the originRequest keys of the defaults last applied to managed routes.
+func (store *Store) OriginDefaultKeys() []string {
+	return append([]string(nil), store.originDefaultKeys...)
+}
+
+// SetOriginDefaultKeys records the originRequest keys of the applied defaults and reports whether they changed.
+func (store *Store) SetOriginDefaultKeys(keys []string) bool {
+	sorted := sortedKeys(keys)
+	if slices.Equal(sorted, store.originDefaultKeys) {
+		return false
+	}
+	store.originDefaultKeys = sorted
+	return true
+}
+
+// OriginRawKeys returns the originRequest keys last applied to the route from its origin.raw label.
+func (store *Store) OriginRawKeys(key model.RouteKey) []string {
+	return append([]string(nil), store.originRawKeys[normalizeRouteKey(key)]...)
+}
+
+// SetOriginRawKeys records the origin.raw keys applied to each route, replacing the previous record, and reports
+// whether it changed. Routes without keys are not recorded.
+func (store *Store) SetOriginRawKeys(keys map[model.RouteKey][]string) bool {
+	recorded := map[model.RouteKey][]string{}
+	for route, routeKeys := range keys {
+		if sorted := sortedKeys(routeKeys); len(sorted) > 0 {
+			normalized := normalizeRouteKey(route)
+			recorded[normalized] = sortedKeys(append(recorded[normalized], sorted...))
+		}
+	}
+	if maps.EqualFunc(recorded, store.originRawKeys, slices.Equal) {
+		return false
+	}
+	store.originRawKeys = recorded
+	return true
+}
+
+// Save writes the store to disk, replacing the previous file atomically.
+func (store *Store) Save() error {
+	routes := make([]routePayload, 0, len(store.routes))
+	for key := range store.routes {
+		routes = append(routes, routePayload{Hostname: key.Hostname, Path: key.Path})
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Hostname != routes[j].Hostname {
+			return routes[i].Hostname < routes[j].Hostname
+		}
+		return routes[i].Path < routes[j].Path
+	})
+
+	rawKeys := make([]originRawPayload, 0, len(store.originRawKeys))
+	for key, keys := range store.originRawKeys {
+		rawKeys = append(rawKeys, originRawPayload{Hostname: key.Hostname, Path: key.Path, Keys: keys})
+	}
+	sort.Slice(rawKeys, func(i, j int) bool {
+		if rawKeys[i].Hostname != rawKeys[j].Hostname {
+			return rawKeys[i].Hostname < rawKeys[j].Hostname
+		}
+		return rawKeys[i].Path < rawKeys[j].Path
+	})
+
+	content, err := json.MarshalIndent(stateFile{TunnelRoutes: routes, DNSHostnames: store.DNSHostnames(), OriginDefaultKeys: store.originDefaultKeys, OriginRawKeys: rawKeys}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(store.path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create state directory %s: %w", dir, err)
+	}
+	temp, err := os.CreateTemp(dir, ".state-*.json")
+	if err != nil {
+		return fmt.Errorf("write state file %s: %w", store.path, err)
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(append(content, '\n')); err != nil {
+		temp.Close()
+		return fmt.Errorf("write state file %s: %w", store.path, err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("write state file %s: %w", store.path, err)
+	}
+	if err := os.Rename(temp.Name(), store.path); err != nil {
+		return fmt.Errorf("write state file %s: %w", store.path, err)
+	}
+	return nil
+}
+
+// sortedKeys returns the non-empty keys sorted, without duplicates.
+func sortedKeys(keys []string) []string {
+	sorted := []string{}
+	for _, key := range keys {
+		if key != "" && !slices.Contains(sorted, key) {
+			sorted = append(sorted, key)
+		}
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+func normalizeRouteKey(key model.RouteKey) model.RouteKey {
+	return model.RouteKey{
+		Hostname: normalizeHostname(key.Hostname),
+		Path:     strings.TrimSpace(key.Path),
+	}
+}
+
+func normalizeHostname(hostname string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(hostname), "."))
+}
@@ -0,0 +1,164 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/darkdragon/docker-cloudflare-tunnel-sync/internal/model"
+)
+
+func TestLoadMissingFileReturnsEmptyStore(t *testing.T) {
+	store, err := Load(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if store.HasTunnelRoute(model.RouteKey{Hostname: "app.example.com"}) {
+		t.Fatalf("expected empty store")
+	}
+}
+
+func TestSaveAndReloadTunnelRoutes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "state.json")
+	store, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	routes := []model.RouteKey{
+		{Hostname: "App.Example.com"},
+		{Hostname: "app.example.com", Path: "/admin"},
+		{Hostname: "b.example.com"},
+	}
+	if !store.AddTunnelRoutes(routes) {
+		t.Fatalf("expected new routes to report a change")
+	}
+	if store.AddTunnelRoutes([]model.RouteKey{{Hostname: "app.example.com"}}) {
+		t.Fatalf("expected known route to report no change")
+	}
+	if !store.RemoveTunnelRoutes([]model.RouteKey{{Hostname: "b.example.com"}}) {
+		t.Fatalf("expected tracked route removal to report a change")
+	}
+	if err := store.Save(); err != nil {
+		t.Fatalf("unexpected save error: %v", err)
+	}
+
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected reload error: %v", err)
+	}
+	if !reloaded.HasTunnelRoute(model.RouteKey{Hostname: "app.example.com"}) || !reloaded.HasTunnelRoute(model.RouteKey{Hostname: "APP.example.com", Path: "/admin"}) {
+		t.Fatalf("expected routes to survive reload")
+	}
+	if reloaded.HasTunnelRoute(model.RouteKey{Hostname: "app.example.com", Path: "/other"}) {
+		t.Fatalf("expected routes to be tracked per path")
+	}
+	if reloaded.HasTunnelRoute(model.RouteKey{Hostname: "b.example.com"}) {
+		t.Fatalf("expected removed route to be forgotten")
+	}
+}
+
+func TestSaveAndReloadDNSHostnames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	store.AddTunnelRoutes([]model.RouteKey{{Hostname: "app.example.com"}})
+	if !store.AddDNSHostnames([]string{"App.Example.com.", "old.example.com"}) {
+		t.Fatalf("expected new hostnames to report a change")
+	}
+	if store.AddDNSHostnames([]string{"app.example.com"}) {
+		t.Fatalf("expected known hostname to report no change")
+	}
+	if !store.RemoveDNSHostnames([]string{"OLD.example.com"}) {
+		t.Fatalf("expected tracked hostname removal to report a change")
+	}
+	if err := store.Save(); err != nil {
+		t.Fatalf("unexpected save error: %v", err)
+	}
+
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected reload error: %v", err)
+	}
+	if hostnames := reloaded.DNSHostnames(); len(hostnames) != 1 || hostnames[0] != "app.example.com" {
+		t.Fatalf("unexpected DNS hostnames after reload: %+v", hostnames)
+	}
+	if !reloaded.HasTunnelRoute(model.RouteKey{Hostname: "app.example.com"}) {
+		t.Fatalf("expected tunnel routes to be kept alongside DNS hostnames")
+	}
+}
+
+func TestSaveAndReloadOriginDefaultKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if store.SetOriginDefaultKeys(nil) {
+		t.Fatalf("expected empty keys on an empty store to report no change")
+	}
+	if !store.SetOriginDefaultKeys([]string{"noTLSVerify", "connectTimeout", "noTLSVerify"}) {
+		t.Fatalf("expected new keys to report a change")
+	}
+	if store.SetOriginDefaultKeys([]string{"connectTimeout", "noTLSVerify"}) {
+		t.Fatalf("expected the same keys in another order to report no change")
+	}
+	if err := store.Save(); err != nil {
+		t.Fatalf("unexpected save error: %v", err)
+	}
+
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected reload error: %v", err)
+	}
+	if keys := reloaded.OriginDefaultKeys(); len(keys) != 2 || keys[0] != "connectTimeout" || keys[1] != "noTLSVerify" {
+		t.Fatalf("unexpected origin default keys after reload: %+v", keys)
+	}
+}
+
+func TestSaveAndReloadOriginRawKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	route := model.RouteKey{Hostname: "App.Example.com", Path: "/api"}
+	if store.SetOriginRawKeys(map[model.RouteKey][]string{route: nil}) {
+		t.Fatalf("expected a route without keys to report no change")
+	}
+	if !store.SetOriginRawKeys(map[model.RouteKey][]string{route: {"noHappyEyeballs", "connectTimeout"}}) {
+		t.Fatalf("expected new keys to report a change")
+	}
+	if store.SetOriginRawKeys(map[model.RouteKey][]string{route: {"connectTimeout", "noHappyEyeballs"}}) {
+		t.Fatalf("expected the same keys in another order to report no change")
+	}
+	if err := store.Save(); err != nil {
+		t.Fatalf("unexpected save error: %v", err)
+	}
+
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected reload error: %v", err)
+	}
+	if keys := reloaded.OriginRawKeys(model.RouteKey{Hostname: "app.example.com", Path: "/api"}); len(keys) != 2 || keys[0] != "connectTimeout" || keys[1] != "noHappyEyeballs" {
+		t.Fatalf("unexpected origin.raw keys after reload: %+v", keys)
+	}
+	if !reloaded.SetOriginRawKeys(nil) || len(reloaded.OriginRawKeys(route)) != 0 {
+		t.Fatalf("expected routes missing from the new record to be forgotten")
+	}
+}
+
+func TestLoadInvalidFileReturnsError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte("not json"), 0o644); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Fatalf("expected error for invalid state file")
+	}
+}